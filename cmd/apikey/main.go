@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
+	"github.com/guoxiaopeng875/wallet/internal/config"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
+	"github.com/guoxiaopeng875/wallet/internal/repository/pg"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+)
+
+const usage = `usage: apikey -conf config.json <command>
+
+commands:
+  create NAME [ROLE [TENANT]]
+                      create a key and print the API key, the secret can't be shown again,
+                      ROLE is client (default) or admin, TENANT is default unless given
+  rotate ID           replace the secret of a key and print the new API key
+  revoke ID           revoke a key for good
+  list                list the keys
+`
+
+func main() {
+	// Parse command line flags
+	configPath := flag.String("conf", "", "config path, eg: -conf config.json")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// Initialize logger
+	setupLogger()
+
+	// Load configuration
+	conf, err := loadConfig(*configPath)
+	if err != nil {
+		logrus.Fatalf("Failed to load config: %v", err)
+	}
+	if err := log.Setup(conf.Log.Level, conf.Log.Format); err != nil {
+		logrus.Fatalf("Invalid log config: %v", err)
+	}
+
+	// Run the command
+	if err := runAPIKey(conf, flag.Args(), os.Stdout); err != nil {
+		logrus.Fatalf("API key command failed: %v", err)
+	}
+}
+
+func setupLogger() {
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	logrus.SetLevel(logrus.InfoLevel)
+}
+
+func loadConfig(path string) (*config.Config, error) {
+	if path == "" {
+		return nil, fmt.Errorf("config path is required")
+	}
+	return config.NewConfig(path)
+}
+
+// runAPIKey runs the command of args, API keys and the key list are written to out
+func runAPIKey(conf *config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("command is required")
+	}
+	command, args := args[0], args[1:]
+	role, tenantID := auth.RoleClient, tenant.Default
+	switch command {
+	case "create":
+		if len(args) < 1 || len(args) > 3 {
+			return fmt.Errorf("create needs a name, an optional role and an optional tenant: %v", args)
+		}
+		if len(args) == 3 {
+			tenantID = args[2]
+		}
+		if len(args) >= 2 {
+			var err error
+			if role, err = auth.ParseRole(args[1]); err != nil {
+				return err
+			}
+		}
+	case "rotate", "revoke":
+		if len(args) != 1 {
+			return fmt.Errorf("%s needs exactly one argument: %v", command, args)
+		}
+	case "list":
+		if len(args) != 0 {
+			return fmt.Errorf("unexpected arguments for list: %v", args)
+		}
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	// keys can sign requests only if their signing keys can be sealed
+	var opts []auth.Option
+	if conf.Auth.EncryptionKey != "" {
+		aead, err := auth.NewCipher(conf.Auth.EncryptionKey)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, auth.WithCipher(aead))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	// Connect to database
+	pool, closer, err := pg.NewPool(ctx, conf.Repository)
+	defer closer()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	uc := auth.NewUseCase(pg.NewAPIKeyRepository(pg.NewRepository(pool)), opts...)
+
+	switch command {
+	case "create":
+		key, apiKey, err := uc.CreateKey(ctx, args[0], role, tenantID)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Created API key %s", key.ID)
+		_, err = fmt.Fprintln(out, apiKey)
+		return err
+	case "rotate":
+		apiKey, err := uc.RotateKey(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Rotated API key %s", args[0])
+		_, err = fmt.Fprintln(out, apiKey)
+		return err
+	case "revoke":
+		if err := uc.RevokeKey(ctx, args[0]); err != nil {
+			return err
+		}
+		logrus.Infof("Revoked API key %s", args[0])
+		return nil
+	default:
+		keys, err := uc.ListKeys(ctx)
+		if err != nil {
+			return err
+		}
+		return printKeys(out, keys)
+	}
+}
+
+func printKeys(out io.Writer, keys []*auth.Key) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tROLE\tTENANT\tSTATUS\tCREATED AT\tROTATED AT")
+	for _, k := range keys {
+		status, rotatedAt := "active", ""
+		if k.Revoked() {
+			status = "revoked"
+		}
+		if k.RotatedAt != nil {
+			rotatedAt = k.RotatedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Role, k.TenantID, status, k.CreatedAt.Format(time.RFC3339), rotatedAt)
+	}
+	return w.Flush()
+}
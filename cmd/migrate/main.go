@@ -5,9 +5,15 @@ import (
 	"flag"
 	"fmt"
 	"github.com/guoxiaopeng875/wallet/internal/config"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
 	"github.com/guoxiaopeng875/wallet/internal/repository/pg"
-	"github.com/jackc/pgx/v5"
+	"github.com/guoxiaopeng875/wallet/migration"
 	"github.com/sirupsen/logrus"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"text/tabwriter"
 	"time"
 )
 
@@ -15,15 +21,23 @@ const (
 	defaultTimeout = 30 * time.Second
 )
 
-type migrator struct {
-	ctx    context.Context
-	conn   *pgx.Conn
-	closer func()
-}
+const usage = `usage: migrate -conf config.json [-dir migration] <command>
+
+commands:
+  up        apply all pending migrations (default)
+  down [N]  roll back the last N applied migrations, 1 by default
+  status    list the migrations and whether they are applied
+  redo      roll back the last applied migration and apply it again
+`
 
 func main() {
 	// Parse command line flags
 	configPath := flag.String("conf", "", "config path, eg: -conf config.json")
+	dir := flag.String("dir", "", "directory of the migration files, the built-in migrations by default")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	// Initialize logger
@@ -34,13 +48,14 @@ func main() {
 	if err != nil {
 		logrus.Fatalf("Failed to load config: %v", err)
 	}
+	if err := log.Setup(conf.Log.Level, conf.Log.Format); err != nil {
+		logrus.Fatalf("Invalid log config: %v", err)
+	}
 
 	// Run migration
-	if err := runMigration(conf); err != nil {
+	if err := runMigration(conf, migrationFS(*dir), flag.Args(), os.Stdout); err != nil {
 		logrus.Fatalf("Migration failed: %v", err)
 	}
-
-	logrus.Info("Migration completed successfully")
 }
 
 func setupLogger() {
@@ -55,7 +70,31 @@ func loadConfig(path string) (*config.Config, error) {
 	return config.NewConfig(path)
 }
 
-func runMigration(conf *config.Config) error {
+// migrationFS returns the migration files of dir, or the built-in ones if dir is empty
+func migrationFS(dir string) fs.FS {
+	if dir == "" {
+		return migration.FS
+	}
+	return os.DirFS(dir)
+}
+
+// runMigration runs the command of args against the migrate DSN, status is written to out
+func runMigration(conf *config.Config, fsys fs.FS, args []string, out io.Writer) error {
+	command := "up"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	n := 1
+	switch {
+	case command == "down" && len(args) == 1:
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return fmt.Errorf("down needs a positive number of migrations: %q", args[0])
+		}
+	case len(args) > 0:
+		return fmt.Errorf("unexpected arguments for %s: %v", command, args)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
 
@@ -66,100 +105,56 @@ func runMigration(conf *config.Config) error {
 	}
 	defer closer()
 
-	m := &migrator{
-		ctx:    ctx,
-		conn:   conn,
-		closer: closer,
-	}
-
-	// Run migrations in order
-	migrations := []struct {
-		name string
-		fn   func() error
-	}{
-		{"Create wallet table", m.createWalletTable},
-		{"Create transaction table", m.createTransactionTable},
-		{"Insert initial data", m.insertInitialData},
+	m, err := pg.NewMigrator(conn, fsys)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
 	}
 
-	for _, migration := range migrations {
-		logrus.Infof("Running migration: %s", migration.name)
-		if err := migration.fn(); err != nil {
-			return fmt.Errorf("migration '%s' failed: %w", migration.name, err)
+	switch command {
+	case "up":
+		applied, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Applied %d migrations", applied)
+	case "down":
+		rolledBack, err := m.Down(ctx, n)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Rolled back %d migrations", rolledBack)
+	case "redo":
+		if err := m.Redo(ctx); err != nil {
+			return err
+		}
+		logrus.Info("Redid the last migration")
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
 		}
-		logrus.Infof("Completed migration: %s", migration.name)
+		return printStatus(out, statuses)
+	default:
+		return fmt.Errorf("unknown command %q", command)
 	}
-
 	return nil
 }
 
-func (m *migrator) createWalletTable() error {
-	tx, err := m.conn.Begin(m.ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback(m.ctx)
-
-	query := `
-		CREATE TABLE IF NOT EXISTS wallets (
-			id SERIAL PRIMARY KEY,
-			balance DECIMAL(20,4) NOT NULL DEFAULT 0.0000
-		);
-		ALTER TABLE IF EXISTS public.wallets OWNER to postgres;
-	`
-
-	if _, err := tx.Exec(m.ctx, query); err != nil {
-		return fmt.Errorf("failed to create wallet table: %w", err)
-	}
-
-	return tx.Commit(m.ctx)
-}
-
-func (m *migrator) createTransactionTable() error {
-	tx, err := m.conn.Begin(m.ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback(m.ctx)
-
-	query := `
-		CREATE TABLE IF NOT EXISTS transactions (
-			id SERIAL PRIMARY KEY,
-			method VARCHAR(10) NOT NULL,
-			tx_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			amount DECIMAL(20,4) NOT NULL,
-			from_wallet_id INTEGER,
-			to_wallet_id INTEGER
-		);
-		ALTER TABLE IF EXISTS public.transactions OWNER to postgres;
-	`
-
-	if _, err := tx.Exec(m.ctx, query); err != nil {
-		return fmt.Errorf("failed to create transaction table: %w", err)
-	}
-
-	return tx.Commit(m.ctx)
-}
-
-func (m *migrator) insertInitialData() error {
-	tx, err := m.conn.Begin(m.ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback(m.ctx)
-
-	query := `
-		INSERT INTO wallets (balance) VALUES
-		(0.00),
-		(0.00),
-		(0.00),
-		(0.00),
-		(0.00);
-	`
-
-	if _, err := tx.Exec(m.ctx, query); err != nil {
-		return fmt.Errorf("failed to insert initial data: %w", err)
+func printStatus(out io.Writer, statuses []pg.MigrationStatus) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		status, appliedAt := "pending", ""
+		if s.AppliedAt != nil {
+			status, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+		}
+		switch {
+		case s.Missing:
+			status = "missing"
+		case s.Modified:
+			status = "modified"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
 	}
-
-	return tx.Commit(m.ctx)
+	return w.Flush()
 }
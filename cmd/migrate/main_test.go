@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"github.com/guoxiaopeng875/wallet/internal/config"
 	"github.com/guoxiaopeng875/wallet/internal/repository/pg"
+	"github.com/guoxiaopeng875/wallet/migration"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io"
 	"os"
 	"testing"
 	"time"
@@ -67,7 +70,7 @@ func TestRunMigration(t *testing.T) {
 		},
 	}
 
-	err := runMigration(conf)
+	err := runMigration(conf, migration.FS, nil, io.Discard)
 	require.NoError(t, err)
 
 	// 验证数据库和表是否创建成功
@@ -77,21 +80,62 @@ func TestRunMigration(t *testing.T) {
 
 	var exists bool
 	// 检查表是否存在
-	tables := []string{"wallets", "transactions"}
+	tables := []string{"wallets", "transactions", "idempotency_keys", "fx_rates", "fx_quotes", "holds", "journal_entries", "postings", "api_keys", "api_key_nonces", "outbox_events", "webhook_subscriptions", "webhook_deliveries", "schema_migrations"}
 	for _, table := range tables {
 		err = conn.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM information_schema.tables WHERE table_name = $1)", table).Scan(&exists)
 		require.NoError(t, err)
 		assert.True(t, exists, "%s table should exist", table)
 	}
+
+	// running again applies nothing
+	require.NoError(t, runMigration(conf, migration.FS, []string{"up"}, io.Discard))
+
+	var status bytes.Buffer
+	require.NoError(t, runMigration(conf, migration.FS, []string{"status"}, &status))
+	assert.Contains(t, status.String(), "create_ledger")
+	assert.NotContains(t, status.String(), "pending")
+
+	require.NoError(t, runMigration(conf, migration.FS, []string{"redo"}, io.Discard))
+	require.NoError(t, runMigration(conf, migration.FS, []string{"down", "1"}, io.Discard))
+	status.Reset()
+	require.NoError(t, runMigration(conf, migration.FS, []string{"status"}, &status))
+	assert.Contains(t, status.String(), "pending")
+	require.NoError(t, runMigration(conf, migration.FS, []string{"up"}, io.Discard))
 }
 
-func TestRunMigrationWithInvalidDSN(t *testing.T) {
+func TestRunMigrationWithInvalidArgs(t *testing.T) {
 	conf := &config.Config{
 		Repository: config.Repository{
 			MigrateDSN: "invalid://dsn",
 		},
 	}
 
-	err := runMigration(conf)
-	assert.Error(t, err)
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "invalid dsn", args: nil},
+		{name: "unknown command", args: []string{"sideways"}},
+		{name: "down zero", args: []string{"down", "0"}},
+		{name: "down not a number", args: []string{"down", "all"}},
+		{name: "extra arguments", args: []string{"status", "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runMigration(conf, migration.FS, tt.args, io.Discard)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMigrationFS(t *testing.T) {
+	migrations, err := pg.LoadMigrations(migrationFS(""))
+	require.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+
+	// the files on disk are the built-in ones
+	fromDir, err := pg.LoadMigrations(migrationFS("../../migration"))
+	require.NoError(t, err)
+	assert.Equal(t, migrations, fromDir)
 }
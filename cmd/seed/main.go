@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/config"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
+	"github.com/guoxiaopeng875/wallet/internal/repository/pg"
+	"github.com/guoxiaopeng875/wallet/internal/seed"
+	"github.com/guoxiaopeng875/wallet/internal/wallet"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	defaultTimeout = 5 * time.Minute
+)
+
+func main() {
+	// Parse command line flags
+	configPath := flag.String("conf", "", "config path, eg: -conf config.json")
+	fixturePath := flag.String("file", "", "fixture path, JSON or YAML, eg: -file fixture.yaml")
+	flag.Parse()
+
+	// Initialize logger
+	setupLogger()
+
+	// Load configuration
+	conf, err := loadConfig(*configPath)
+	if err != nil {
+		logrus.Fatalf("Failed to load config: %v", err)
+	}
+	if err := log.Setup(conf.Log.Level, conf.Log.Format); err != nil {
+		logrus.Fatalf("Invalid log config: %v", err)
+	}
+
+	// Load the fixture
+	if err := runSeed(conf, *fixturePath, os.Stdout); err != nil {
+		logrus.Fatalf("Seed failed: %v", err)
+	}
+
+	logrus.Info("Seed completed successfully")
+}
+
+func setupLogger() {
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	logrus.SetLevel(logrus.InfoLevel)
+}
+
+func loadConfig(path string) (*config.Config, error) {
+	if path == "" {
+		return nil, fmt.Errorf("config path is required")
+	}
+	return config.NewConfig(path)
+}
+
+// runSeed loads the fixture through the wallet use cases and writes the IDs of the created wallets to out
+func runSeed(conf *config.Config, path string, out io.Writer) error {
+	if path == "" {
+		return fmt.Errorf("fixture path is required")
+	}
+	fixture, err := seed.LoadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := fixture.Validate(); err != nil {
+		return fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	// Connect to database
+	pool, closer, err := pg.NewPool(ctx, conf.Repository)
+	defer closer()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	repo := pg.NewRepository(pool)
+	fxUC := fx.NewUseCase(
+		pg.NewRateRepository(repo),
+		pg.NewQuoteRepository(repo),
+		time.Duration(conf.FX.QuoteTTL),
+	)
+	// cross-currency transfers are converted at the configured rates
+	if conf.FX.RatesFile != "" {
+		rates, err := fx.LoadRatesFile(conf.FX.RatesFile)
+		if err != nil {
+			return fmt.Errorf("failed to read rates file: %w", err)
+		}
+		if err := fxUC.LoadRates(ctx, rates); err != nil {
+			return fmt.Errorf("failed to load rates: %w", err)
+		}
+	}
+	uc := wallet.NewUseCase(
+		pg.NewWalletRepository(repo),
+		pg.NewTransactionRepository(repo),
+		pg.NewHoldRepository(repo),
+		pg.NewLedgerRepository(repo),
+		pg.NewOutboxRepository(repo),
+		pg.NewDBTx(repo),
+		fxUC,
+	)
+
+	ids, err := seed.Load(ctx, uc, fixture)
+	if len(ids) > 0 {
+		if err := printWallets(out, fixture, ids); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Loaded %d wallets and %d transactions from %s", len(ids), len(fixture.Transactions), path)
+	return nil
+}
+
+// printWallets lists the created wallets in fixture order
+func printWallets(out io.Writer, fixture *seed.Fixture, ids map[string]uint) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REF\tWALLET ID")
+	for _, wallet := range fixture.Wallets {
+		if id, ok := ids[wallet.Ref]; ok {
+			fmt.Fprintf(w, "%s\t%d\n", wallet.Ref, id)
+		}
+	}
+	return w.Flush()
+}
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"flag"
 	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
 	"github.com/guoxiaopeng875/wallet/internal/config"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+	"github.com/guoxiaopeng875/wallet/internal/idempotency"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/metrics"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace"
 	"github.com/guoxiaopeng875/wallet/internal/repository/pg"
 	"github.com/guoxiaopeng875/wallet/internal/server"
 	"github.com/guoxiaopeng875/wallet/internal/wallet"
+	"github.com/guoxiaopeng875/wallet/internal/webhook"
 	"github.com/sirupsen/logrus"
 	"os"
 	"os/signal"
@@ -15,6 +24,19 @@ import (
 	"time"
 )
 
+const (
+	// defaultHoldSweepInterval is how often expired holds are released when no interval is configured
+	defaultHoldSweepInterval = time.Minute
+	// defaultRelayInterval is how often pending events are relayed when no interval is configured
+	defaultRelayInterval = time.Second
+	// defaultDeliverInterval is how often due webhook deliveries are attempted when no interval is configured
+	defaultDeliverInterval = time.Second
+	// defaultServiceName names the service of the spans when no name is configured
+	defaultServiceName = "wallet"
+	// tracerShutdownTimeout bounds the export of the last spans on shutdown
+	tracerShutdownTimeout = 5 * time.Second
+)
+
 func main() {
 	// Parse command line flags
 	configPath := flag.String("conf", "", "config path, eg: -conf config.json")
@@ -28,6 +50,9 @@ func main() {
 	if err != nil {
 		logrus.Fatalf("Failed to load config: %v", err)
 	}
+	if err := log.Setup(conf.Log.Level, conf.Log.Format); err != nil {
+		logrus.Fatalf("Invalid log config: %v", err)
+	}
 
 	// Setup application
 	app, cleanup, err := setupApp(conf)
@@ -57,33 +82,301 @@ func loadConfig(path string) (*config.Config, error) {
 func setupApp(conf *config.Config) (server.Server, func(), error) {
 	ctx := context.Background()
 
+	lockMode, err := wallet.ParseLockMode(conf.Wallet.LockMode)
+	if err != nil {
+		return nil, nil, err
+	}
+	isolationLevel, err := pg.ParseIsolationLevel(conf.Repository.IsolationLevel)
+	if err != nil {
+		return nil, nil, err
+	}
+	authOpts := []auth.Option{auth.WithMaxClockSkew(time.Duration(conf.Auth.MaxClockSkew))}
+	if conf.Auth.EncryptionKey != "" {
+		aead, err := auth.NewCipher(conf.Auth.EncryptionKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		authOpts = append(authOpts, auth.WithCipher(aead))
+	}
+
 	// Initialize database
-	conn, dbCloser, err := pg.NewConnect(ctx, conf.Repository.DSN)
+	pool, dbCloser, err := pg.NewPool(ctx, conf.Repository)
 	if err != nil {
+		dbCloser()
 		return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	// Initialize repositories and use cases
-	repo := pg.NewRepository(conn)
+	// Initialize repositories and use cases, all exporting their metrics and traced if configured
+	reg := metrics.NewRegistry()
+	tracer, tracerCloser, err := newTracer(conf.Tracing)
+	if err != nil {
+		dbCloser()
+		return nil, nil, err
+	}
+	repo := pg.NewRepository(
+		pool,
+		pg.WithMetrics(reg),
+		pg.WithTracer(tracer),
+		pg.WithIsolationLevel(isolationLevel),
+		pg.WithRetry(conf.Repository.TxRetries, time.Duration(conf.Repository.TxRetryBackoff)),
+	)
+	fxUC := fx.NewUseCase(
+		pg.NewRateRepository(repo),
+		pg.NewQuoteRepository(repo),
+		time.Duration(conf.FX.QuoteTTL),
+	)
+	if conf.FX.RatesFile != "" {
+		if err := loadRates(ctx, fxUC, conf.FX.RatesFile); err != nil {
+			tracerCloser()
+			dbCloser()
+			return nil, nil, err
+		}
+	}
 	uc := wallet.NewUseCase(
 		pg.NewWalletRepository(repo),
 		pg.NewTransactionRepository(repo),
+		pg.NewHoldRepository(repo),
+		pg.NewLedgerRepository(repo),
+		pg.NewOutboxRepository(repo),
 		pg.NewDBTx(repo),
+		fxUC,
+		wallet.WithLockMode(lockMode),
+		wallet.WithWithdrawalFee(conf.Wallet.WithdrawalFeeRate),
+		wallet.WithMetrics(reg),
+		wallet.WithTracer(tracer),
 	)
+	idempotencyUC := idempotency.NewUseCase(
+		pg.NewIdempotencyRepository(repo),
+		pg.NewDBTx(repo),
+	)
+
+	webhookUC := webhook.NewUseCase(
+		pg.NewWebhookRepository(repo),
+		uc,
+		webhook.WithRetryPolicy(webhook.RetryPolicy{
+			MaxAttempts:    conf.Webhooks.MaxAttempts,
+			InitialBackoff: time.Duration(conf.Webhooks.InitialBackoff),
+			MaxBackoff:     time.Duration(conf.Webhooks.MaxBackoff),
+		}),
+		webhook.WithHTTPClient(webhook.NewHTTPClient(cmp.Or(time.Duration(conf.Webhooks.Timeout), webhook.DefaultTimeout))),
+		webhook.WithClaimTimeout(time.Duration(conf.Webhooks.ClaimTimeout)),
+	)
+
+	// the events are queued for the webhook subscriptions, and published to the configured publisher if any
+	publishers := []outbox.Publisher{webhookUC}
+	publisher, publisherCloser, err := newPublisher(conf.Outbox)
+	if err != nil {
+		tracerCloser()
+		dbCloser()
+		return nil, nil, err
+	}
+	if publisher != nil {
+		publishers = append(publishers, publisher)
+	}
+
+	authUC := auth.NewUseCase(pg.NewAPIKeyRepository(repo), authOpts...)
 
 	// Initialize server
 	srv := server.NewServer(
-		server.NewHandler(uc),
+		server.NewHandler(
+			uc,
+			server.WithRates(fxUC),
+			server.WithWebhooks(webhookUC),
+			server.WithMetrics(reg),
+			server.WithTracer(tracer),
+		),
 		conf,
+		server.AuthMiddleware(authUC),
+		server.IdempotencyMiddleware(idempotencyUC),
 	)
 
+	// Release expired holds in the background
+	sweepCtx, stopSweep := context.WithCancel(ctx)
+	sweepDone := make(chan struct{})
+	go func() {
+		defer close(sweepDone)
+		sweepHolds(sweepCtx, uc, time.Duration(conf.Holds.SweepInterval))
+	}()
+
+	// Relay the domain events of the outbox in the background
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	relayDone := make(chan struct{})
+	outboxUC := outbox.NewUseCase(
+		pg.NewOutboxRepository(repo),
+		outbox.NewMultiPublisher(publishers...),
+		outbox.WithBatchSize(conf.Outbox.BatchSize),
+		outbox.WithRetryPolicy(outbox.RetryPolicy{
+			MaxAttempts:    conf.Outbox.MaxAttempts,
+			InitialBackoff: time.Duration(conf.Outbox.InitialBackoff),
+			MaxBackoff:     time.Duration(conf.Outbox.MaxBackoff),
+		}),
+		outbox.WithClaimTimeout(time.Duration(conf.Outbox.ClaimTimeout)),
+	)
+	go func() {
+		defer close(relayDone)
+		relayEvents(relayCtx, outboxUC, time.Duration(conf.Outbox.RelayInterval))
+	}()
+
+	// Post the webhook deliveries in the background
+	deliverCtx, stopDeliver := context.WithCancel(ctx)
+	deliverDone := make(chan struct{})
+	go func() {
+		defer close(deliverDone)
+		deliverWebhooks(deliverCtx, webhookUC, time.Duration(conf.Webhooks.DeliverInterval))
+	}()
+
 	cleanup := func() {
+		stopSweep()
+		stopRelay()
+		stopDeliver()
+		<-sweepDone
+		<-relayDone
+		<-deliverDone
+		publisherCloser()
+		tracerCloser()
 		dbCloser()
 	}
 
 	return srv, cleanup, nil
 }
 
+func loadRates(ctx context.Context, uc fx.UseCase, path string) error {
+	rates, err := fx.LoadRatesFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read rates file: %w", err)
+	}
+	if err := uc.LoadRates(ctx, rates); err != nil {
+		return fmt.Errorf("failed to load rates: %w", err)
+	}
+	logrus.Infof("Loaded %d exchange rates from %s", len(rates), path)
+	return nil
+}
+
+// sweepHolds releases expired holds every interval until ctx is done
+func sweepHolds(ctx context.Context, uc wallet.UseCase, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultHoldSweepInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := uc.ExpireHolds(ctx, time.Now())
+			if err != nil {
+				logrus.Errorf("Failed to release expired holds: %v", err)
+			}
+			if n > 0 {
+				logrus.Infof("Released %d expired holds", n)
+			}
+		}
+	}
+}
+
+// newPublisher creates the publisher of the domain events configured by conf, nil if none is
+func newPublisher(conf config.Outbox) (outbox.Publisher, func(), error) {
+	closer := func() {}
+	switch conf.Publisher {
+	case "":
+		return nil, closer, nil
+	case "stdout":
+		return outbox.NewWriterPublisher(os.Stdout), closer, nil
+	case "file":
+		if conf.File == "" {
+			return nil, closer, fmt.Errorf("outbox file publisher needs a file")
+		}
+		publisher, closer, err := outbox.NewFilePublisher(conf.File)
+		if err != nil {
+			return nil, closer, fmt.Errorf("failed to open outbox file: %w", err)
+		}
+		return publisher, closer, nil
+	case "webhook":
+		if conf.WebhookURL == "" {
+			return nil, closer, fmt.Errorf("outbox webhook publisher needs a webhook_url")
+		}
+		return outbox.NewWebhookPublisher(conf.WebhookURL), closer, nil
+	}
+	return nil, closer, fmt.Errorf("unknown outbox publisher %q", conf.Publisher)
+}
+
+// newTracer creates the tracer exporting the spans as conf configures, nil if tracing is off.
+// The returned closer exports the last spans.
+func newTracer(conf config.Tracing) (*trace.Tracer, func(), error) {
+	closer := func() {}
+	var (
+		exporter  trace.Exporter
+		closeFile = func() {}
+	)
+	switch conf.Exporter {
+	case "":
+		return nil, closer, nil
+	case "stdout":
+		exporter = trace.NewWriterExporter(os.Stdout)
+	case "file":
+		if conf.File == "" {
+			return nil, closer, fmt.Errorf("tracing file exporter needs a file")
+		}
+		var err error
+		if exporter, closeFile, err = trace.NewFileExporter(conf.File); err != nil {
+			return nil, closer, fmt.Errorf("failed to open tracing file: %w", err)
+		}
+	case "otlp":
+		exporter = trace.NewOTLPExporter(conf.Endpoint, cmp.Or(conf.ServiceName, defaultServiceName))
+	default:
+		return nil, closer, fmt.Errorf("unknown tracing exporter %q", conf.Exporter)
+	}
+	tracer := trace.NewTracer(exporter)
+	closer = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracerShutdownTimeout)
+		defer cancel()
+		if err := tracer.Shutdown(ctx); err != nil {
+			logrus.Warnf("Failed to export the last spans: %v", err)
+		}
+		closeFile()
+	}
+	return tracer, closer, nil
+}
+
+// relayEvents publishes the pending domain events every interval until ctx is done
+func relayEvents(ctx context.Context, uc outbox.UseCase, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultRelayInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := uc.Relay(ctx); err != nil {
+				logrus.Errorf("Failed to relay events: %v", err)
+			}
+		}
+	}
+}
+
+// deliverWebhooks attempts the due webhook deliveries every interval until ctx is done
+func deliverWebhooks(ctx context.Context, uc webhook.UseCase, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultDeliverInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := uc.Deliver(ctx, time.Now()); err != nil {
+				logrus.Errorf("Failed to deliver webhooks: %v", err)
+			}
+		}
+	}
+}
+
 func run(srv server.Server) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
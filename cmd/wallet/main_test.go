@@ -6,6 +6,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 	"time"
@@ -154,3 +155,65 @@ func TestSetupApp(t *testing.T) {
 		})
 	}
 }
+
+func TestNewPublisher(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.Outbox
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "none", conf: config.Outbox{}, wantNil: true},
+		{name: "stdout", conf: config.Outbox{Publisher: "stdout"}},
+		{name: "file", conf: config.Outbox{Publisher: "file", File: filepath.Join(t.TempDir(), "events.jsonl")}},
+		{name: "file without path", conf: config.Outbox{Publisher: "file"}, wantErr: true},
+		{name: "file in missing directory", conf: config.Outbox{Publisher: "file", File: filepath.Join(t.TempDir(), "missing", "events.jsonl")}, wantErr: true},
+		{name: "webhook", conf: config.Outbox{Publisher: "webhook", WebhookURL: "http://localhost:9000/events"}},
+		{name: "webhook without url", conf: config.Outbox{Publisher: "webhook"}, wantErr: true},
+		{name: "unknown", conf: config.Outbox{Publisher: "kafka"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher, closer, err := newPublisher(tt.conf)
+			defer closer()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantNil, publisher == nil)
+		})
+	}
+}
+
+func TestNewTracer(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.Tracing
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "none", conf: config.Tracing{}, wantNil: true},
+		{name: "stdout", conf: config.Tracing{Exporter: "stdout"}},
+		{name: "file", conf: config.Tracing{Exporter: "file", File: filepath.Join(t.TempDir(), "spans.jsonl")}},
+		{name: "file without path", conf: config.Tracing{Exporter: "file"}, wantErr: true},
+		{name: "file in missing directory", conf: config.Tracing{Exporter: "file", File: filepath.Join(t.TempDir(), "missing", "spans.jsonl")}, wantErr: true},
+		{name: "otlp", conf: config.Tracing{Exporter: "otlp"}},
+		{name: "otlp to a collector", conf: config.Tracing{Exporter: "otlp", Endpoint: "http://collector:4318/v1/traces", ServiceName: "wallet-staging"}},
+		{name: "unknown", conf: config.Tracing{Exporter: "zipkin"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer, closer, err := newTracer(tt.conf)
+			defer closer()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantNil, tracer == nil)
+		})
+	}
+}
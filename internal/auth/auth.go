@@ -0,0 +1,177 @@
+// Package auth authenticates API clients.
+//
+// A client holds an API key made of a public ID and a secret, written "<id>.<secret>".
+// Only the SHA-256 of the secret is stored to verify it. A request is authenticated either
+// by sending the whole key, or by signing the request with HMAC-SHA256: the signing key
+// is the HMAC-SHA256 of SigningKeyContext keyed by the secret, and the signed string covers
+// the method, the path with its query, a timestamp, a nonce and the SHA-256 of the body.
+// A signature is accepted once, within the allowed clock skew, so a captured request can't
+// be replayed. The server keeps the signing key encrypted with a key of its configuration,
+// so reading the api keys table isn't enough to sign requests.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	keyIDPrefix = "ak_"
+	// MaxNonceLength is the maximum length of a signature nonce.
+	MaxNonceLength = 64
+	// SigningKeyContext is the message the secret is keyed with to derive the signing key.
+	SigningKeyContext = "wallet request signing key"
+)
+
+// Role is what a key is allowed to do beyond its own wallets.
+type Role string
+
+const (
+	// RoleClient acts on the wallets it owns and credits any wallet.
+	RoleClient Role = "client"
+	// RoleAdmin may do everything.
+	RoleAdmin Role = "admin"
+)
+
+// ParseRole parses a role name, empty is RoleClient.
+func ParseRole(role string) (Role, error) {
+	switch Role(role) {
+	case "", RoleClient:
+		return RoleClient, nil
+	case RoleAdmin:
+		return RoleAdmin, nil
+	}
+	return "", fmt.Errorf("unknown role %q", role)
+}
+
+// Key is an API key, its secret is only known to the client.
+type Key struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+	// TenantID is the tenant whose wallets the key acts on
+	TenantID string `json:"tenant_id"`
+	// SecretHash is the hex SHA-256 of the secret
+	SecretHash string `json:"-"`
+	// SigningKey is the signing key sealed by the cipher of the use case, nil if the key can't sign requests
+	SigningKey []byte     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Revoked tells if the key can't be used anymore.
+func (k *Key) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+func (k *Key) principal() *Principal {
+	return &Principal{KeyID: k.ID, Name: k.Name, Role: k.Role, TenantID: k.TenantID}
+}
+
+// Principal is the authenticated client of a request.
+// The key ID identifies it, it owns the wallets it creates.
+type Principal struct {
+	KeyID    string `json:"key_id"`
+	Name     string `json:"name"`
+	Role     Role   `json:"role"`
+	TenantID string `json:"tenant_id"`
+}
+
+// IsAdmin tells if the principal has the admin role.
+func (p *Principal) IsAdmin() bool {
+	return p.Role == RoleAdmin
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of ctx, if the request was authenticated.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// SignedRequest is what a signature covers.
+type SignedRequest struct {
+	KeyID  string
+	Method string
+	// Path is the path of the request with its query
+	Path      string
+	Timestamp time.Time
+	Nonce     string
+	Body      []byte
+	// Signature is the hex HMAC-SHA256 of the string to sign
+	Signature string
+}
+
+// StringToSign is the string a client signs, one field per line:
+// the method, the path with its query, the unix timestamp in seconds, the nonce
+// and the hex SHA-256 of the body.
+func (r *SignedRequest) StringToSign() string {
+	body := sha256.Sum256(r.Body)
+	return strings.Join([]string{
+		strings.ToUpper(r.Method),
+		r.Path,
+		strconv.FormatInt(r.Timestamp.Unix(), 10),
+		r.Nonce,
+		hex.EncodeToString(body[:]),
+	}, "\n")
+}
+
+// Sign returns the signature of the request with the key secret, as a client computes it.
+func Sign(secret string, r *SignedRequest) string {
+	return sign(signingKey(secret), r)
+}
+
+func sign(key []byte, r *SignedRequest) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(r.StringToSign()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signingKey derives the HMAC key of the signatures from the secret, it can't be computed from the secret hash.
+func signingKey(secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(SigningKeyContext))
+	return mac.Sum(nil)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseAPIKey splits an API key into its ID and secret.
+func ParseAPIKey(apiKey string) (id, secret string, err error) {
+	id, secret, ok := strings.Cut(apiKey, ".")
+	if !ok || !strings.HasPrefix(id, keyIDPrefix) || secret == "" {
+		return "", "", fmt.Errorf("malformed api key")
+	}
+	return id, secret, nil
+}
+
+func newKeyID() string {
+	return keyIDPrefix + randomHex(8)
+}
+
+func newSecret() string {
+	return randomHex(32)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// EncryptionKeySize is the size in bytes of the key encrypting the signing keys, AES-256.
+const EncryptionKeySize = 32
+
+// NewCipher creates the AES-256-GCM cipher sealing the signing keys from a hex encryption key.
+func NewCipher(encryptionKey string) (cipher.AEAD, error) {
+	key, err := hex.DecodeString(encryptionKey)
+	if err != nil || len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d hex encoded bytes", EncryptionKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the signing key of the key ID, the nonce is prepended. The key ID is authenticated
+// so a sealed signing key can't be moved to another key.
+func seal(aead cipher.AEAD, keyID string, signingKey []byte) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	_, _ = rand.Read(nonce)
+	return aead.Seal(nonce, nonce, signingKey, []byte(keyID))
+}
+
+// open decrypts a signing key sealed for the key ID.
+func open(aead cipher.AEAD, keyID string, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed signing key too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(keyID))
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+type MockRepository struct {
+	keys   map[string]Key
+	nonces map[string]time.Time
+}
+
+func NewMockRepository() *MockRepository {
+	return &MockRepository{
+		keys:   make(map[string]Key),
+		nonces: make(map[string]time.Time),
+	}
+}
+
+func (m *MockRepository) Create(ctx context.Context, key *Key) error {
+	if _, exists := m.keys[key.ID]; exists {
+		return errors.DuplicateRecord
+	}
+	m.keys[key.ID] = *key
+	return nil
+}
+
+func (m *MockRepository) Get(ctx context.Context, id string) (*Key, error) {
+	if k, exists := m.keys[id]; exists {
+		return &k, nil
+	}
+	return nil, errors.RecordNotFound
+}
+
+func (m *MockRepository) List(ctx context.Context) ([]*Key, error) {
+	keys := make([]*Key, 0, len(m.keys))
+	for _, k := range m.keys {
+		k := k
+		keys = append(keys, &k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (m *MockRepository) Update(ctx context.Context, key *Key) error {
+	if _, exists := m.keys[key.ID]; !exists {
+		return errors.RecordNotFound
+	}
+	m.keys[key.ID] = *key
+	return nil
+}
+
+func (m *MockRepository) CreateNonce(ctx context.Context, keyID, nonce string, at time.Time) error {
+	if _, exists := m.nonces[keyID+"/"+nonce]; exists {
+		return errors.DuplicateRecord
+	}
+	m.nonces[keyID+"/"+nonce] = at
+	return nil
+}
+
+func (m *MockRepository) DeleteNonces(ctx context.Context, keyID string, before time.Time) error {
+	for k, at := range m.nonces {
+		if at.Before(before) && strings.HasPrefix(k, keyID+"/") {
+			delete(m.nonces, k)
+		}
+	}
+	return nil
+}
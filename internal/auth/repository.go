@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Repository defines the repository for API keys and the nonces of their signatures.
+type Repository interface {
+	// Create stores a new key.
+	Create(ctx context.Context, key *Key) error
+	// Get gets the key by ID.
+	Get(ctx context.Context, id string) (*Key, error)
+	// List lists all keys, revoked ones included, oldest first.
+	List(ctx context.Context) ([]*Key, error)
+	// Update updates the secret hash, signing key, rotation and revocation times of the key.
+	Update(ctx context.Context, key *Key) error
+	// CreateNonce records a nonce used by a signature of the key, fails with DuplicateRecord if it was used already.
+	CreateNonce(ctx context.Context, keyID, nonce string, at time.Time) error
+	// DeleteNonces forgets the nonces of the key used before the time.
+	DeleteNonces(ctx context.Context, keyID string, before time.Time) error
+}
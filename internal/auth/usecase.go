@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/subtle"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
+	"time"
+)
+
+// DefaultMaxClockSkew is how far the timestamp of a signature may be from the server clock by default.
+const DefaultMaxClockSkew = 5 * time.Minute
+
+// UseCase defines use cases for API keys.
+type UseCase interface {
+	// CreateKey creates a key with the role in the tenant and returns it with the API key the client uses,
+	// the secret is not stored. The key can sign requests if the use case has a cipher.
+	CreateKey(ctx context.Context, name string, role Role, tenantID string) (key *Key, apiKey string, err error)
+	// RotateKey replaces the secret of a key and returns the new API key, the old secret stops working.
+	RotateKey(ctx context.Context, id string) (apiKey string, err error)
+	// RevokeKey revokes a key for good.
+	RevokeKey(ctx context.Context, id string) error
+	// ListKeys lists all keys.
+	ListKeys(ctx context.Context) ([]*Key, error)
+	// Authenticate authenticates a request sending the whole API key.
+	Authenticate(ctx context.Context, apiKey string) (*Principal, error)
+	// AuthenticateSigned authenticates a signed request, the nonce is used up.
+	AuthenticateSigned(ctx context.Context, r *SignedRequest) (*Principal, error)
+}
+
+// useCase implements UseCase.
+type useCase struct {
+	repo         Repository
+	maxClockSkew time.Duration
+	cipher       cipher.AEAD
+	now          func() time.Time
+}
+
+// Option configures the use case.
+type Option func(*useCase)
+
+// WithMaxClockSkew sets how far the timestamp of a signature may be from the server clock, zero keeps the default.
+func WithMaxClockSkew(d time.Duration) Option {
+	return func(u *useCase) {
+		if d > 0 {
+			u.maxClockSkew = d
+		}
+	}
+}
+
+// WithCipher sets the cipher sealing the signing keys, see NewCipher. Without it keys can't sign requests.
+func WithCipher(aead cipher.AEAD) Option {
+	return func(u *useCase) {
+		u.cipher = aead
+	}
+}
+
+func NewUseCase(repo Repository, opts ...Option) UseCase {
+	u := &useCase{repo: repo, maxClockSkew: DefaultMaxClockSkew, now: time.Now}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+func (u *useCase) CreateKey(ctx context.Context, name string, role Role, tenantID string) (*Key, string, error) {
+	if name == "" {
+		return nil, "", errors.InvalidArgs.WithCause(fmt.Errorf("key name is required"))
+	}
+	if _, err := ParseRole(string(role)); err != nil || role == "" {
+		return nil, "", errors.InvalidArgs.WithCause(fmt.Errorf("unknown role %q", role))
+	}
+	if tenantID == "" || len(tenantID) > tenant.MaxLength {
+		return nil, "", errors.InvalidArgs.WithCause(fmt.Errorf("tenant length must be between 1 and %d", tenant.MaxLength))
+	}
+	secret := newSecret()
+	key := &Key{
+		ID:         newKeyID(),
+		Name:       name,
+		Role:       role,
+		TenantID:   tenantID,
+		SecretHash: hashSecret(secret),
+		CreatedAt:  u.now(),
+	}
+	key.SigningKey = u.sealSigningKey(key.ID, secret)
+	if err := u.repo.Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, key.ID + "." + secret, nil
+}
+
+func (u *useCase) RotateKey(ctx context.Context, id string) (string, error) {
+	key, err := u.getKey(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if key.Revoked() {
+		return "", errors.APIKeyRevoked
+	}
+	secret, now := newSecret(), u.now()
+	key.SecretHash, key.RotatedAt = hashSecret(secret), &now
+	key.SigningKey = u.sealSigningKey(key.ID, secret)
+	if err := u.repo.Update(ctx, key); err != nil {
+		return "", err
+	}
+	return key.ID + "." + secret, nil
+}
+
+func (u *useCase) RevokeKey(ctx context.Context, id string) error {
+	key, err := u.getKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key.Revoked() {
+		return nil
+	}
+	now := u.now()
+	key.RevokedAt = &now
+	return u.repo.Update(ctx, key)
+}
+
+func (u *useCase) ListKeys(ctx context.Context) ([]*Key, error) {
+	return u.repo.List(ctx)
+}
+
+func (u *useCase) Authenticate(ctx context.Context, apiKey string) (*Principal, error) {
+	id, secret, err := ParseAPIKey(apiKey)
+	if err != nil {
+		return nil, errors.Unauthenticated.WithCause(err)
+	}
+	key, err := u.activeKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.SecretHash)) != 1 {
+		return nil, errors.Unauthenticated.WithCause(fmt.Errorf("wrong secret for key %s", id))
+	}
+	return key.principal(), nil
+}
+
+func (u *useCase) AuthenticateSigned(ctx context.Context, r *SignedRequest) (*Principal, error) {
+	if r.Nonce == "" || len(r.Nonce) > MaxNonceLength {
+		return nil, errors.Unauthenticated.WithCause(fmt.Errorf("nonce length must be between 1 and %d", MaxNonceLength))
+	}
+	now := u.now()
+	if skew := now.Sub(r.Timestamp).Abs(); skew > u.maxClockSkew {
+		return nil, errors.Unauthenticated.WithCause(fmt.Errorf("timestamp is %s away from the server clock", skew))
+	}
+	key, err := u.activeKey(ctx, r.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if u.cipher == nil || key.SigningKey == nil {
+		return nil, errors.Unauthenticated.WithCause(fmt.Errorf("key %s can't sign requests", key.ID))
+	}
+	signingKey, err := open(u.cipher, key.ID, key.SigningKey)
+	if err != nil {
+		return nil, errors.InternalServer.WithCause(fmt.Errorf("failed to open the signing key of %s: %w", key.ID, err))
+	}
+	if !hmac.Equal([]byte(sign(signingKey, r)), []byte(r.Signature)) {
+		return nil, errors.Unauthenticated.WithCause(fmt.Errorf("invalid signature for key %s", key.ID))
+	}
+
+	// a nonce only needs to be kept as long as its timestamp is accepted
+	if err := u.repo.DeleteNonces(ctx, key.ID, now.Add(-2*u.maxClockSkew)); err != nil {
+		return nil, err
+	}
+	if err := u.repo.CreateNonce(ctx, key.ID, r.Nonce, now); err != nil {
+		if errors.Is(err, errors.DuplicateRecord) {
+			return nil, errors.Unauthenticated.WithCause(fmt.Errorf("nonce %q already used", r.Nonce))
+		}
+		return nil, err
+	}
+	return key.principal(), nil
+}
+
+// sealSigningKey seals the signing key of the secret, nil without a cipher.
+func (u *useCase) sealSigningKey(keyID, secret string) []byte {
+	if u.cipher == nil {
+		return nil
+	}
+	return seal(u.cipher, keyID, signingKey(secret))
+}
+
+// getKey gets a key by ID for the admin use cases.
+func (u *useCase) getKey(ctx context.Context, id string) (*Key, error) {
+	key, err := u.repo.Get(ctx, id)
+	if errors.Is(err, errors.RecordNotFound) {
+		return nil, errors.APIKeyNotFound.WithCause(err)
+	}
+	return key, err
+}
+
+// activeKey gets a key usable to authenticate, an unknown or revoked key doesn't authenticate.
+func (u *useCase) activeKey(ctx context.Context, id string) (*Key, error) {
+	key, err := u.repo.Get(ctx, id)
+	if errors.Is(err, errors.RecordNotFound) {
+		return nil, errors.Unauthenticated.WithCause(fmt.Errorf("unknown key %s", id))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.Revoked() {
+		return nil, errors.Unauthenticated.WithCause(fmt.Errorf("key %s is revoked", id))
+	}
+	return key, nil
+}
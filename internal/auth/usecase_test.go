@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/hex"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUseCase_Keys(t *testing.T) {
+	ctx := context.Background()
+	uc := NewUseCase(NewMockRepository())
+
+	if _, _, err := uc.CreateKey(ctx, "", RoleClient, tenant.Default); !errors.Is(err, errors.InvalidArgs) {
+		t.Errorf("CreateKey() without name error = %v, want %v", err, errors.InvalidArgs)
+	}
+
+	if _, _, err := uc.CreateKey(ctx, "root", "root", tenant.Default); !errors.Is(err, errors.InvalidArgs) {
+		t.Errorf("CreateKey() with unknown role error = %v, want %v", err, errors.InvalidArgs)
+	}
+	if _, _, err := uc.CreateKey(ctx, "checkout", RoleClient, ""); !errors.Is(err, errors.InvalidArgs) {
+		t.Errorf("CreateKey() without tenant error = %v, want %v", err, errors.InvalidArgs)
+	}
+
+	key, apiKey, err := uc.CreateKey(ctx, "checkout", RoleClient, tenant.Default)
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	if !strings.HasPrefix(apiKey, key.ID+".") || strings.Contains(key.SecretHash, strings.TrimPrefix(apiKey, key.ID+".")) {
+		t.Errorf("CreateKey() api key = %q, key = %+v", apiKey, key)
+	}
+	p, err := uc.Authenticate(ctx, apiKey)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if *p != (Principal{KeyID: key.ID, Name: "checkout", Role: RoleClient, TenantID: tenant.Default}) {
+		t.Errorf("Authenticate() = %+v", p)
+	}
+
+	// the old secret stops working once rotated
+	rotated, err := uc.RotateKey(ctx, key.ID)
+	if err != nil {
+		t.Fatalf("RotateKey() error = %v", err)
+	}
+	if _, err := uc.Authenticate(ctx, apiKey); !errors.Is(err, errors.Unauthenticated) {
+		t.Errorf("Authenticate() with rotated secret error = %v, want %v", err, errors.Unauthenticated)
+	}
+	if _, err := uc.Authenticate(ctx, rotated); err != nil {
+		t.Errorf("Authenticate() with new secret error = %v", err)
+	}
+
+	if err := uc.RevokeKey(ctx, key.ID); err != nil {
+		t.Fatalf("RevokeKey() error = %v", err)
+	}
+	if _, err := uc.Authenticate(ctx, rotated); !errors.Is(err, errors.Unauthenticated) {
+		t.Errorf("Authenticate() with revoked key error = %v, want %v", err, errors.Unauthenticated)
+	}
+	if _, err := uc.RotateKey(ctx, key.ID); !errors.Is(err, errors.APIKeyRevoked) {
+		t.Errorf("RotateKey() of revoked key error = %v, want %v", err, errors.APIKeyRevoked)
+	}
+	if err := uc.RevokeKey(ctx, "ak_unknown"); !errors.Is(err, errors.APIKeyNotFound) {
+		t.Errorf("RevokeKey() of unknown key error = %v, want %v", err, errors.APIKeyNotFound)
+	}
+
+	keys, err := uc.ListKeys(ctx)
+	if err != nil || len(keys) != 1 || !keys[0].Revoked() {
+		t.Errorf("ListKeys() = %v, %v", keys, err)
+	}
+}
+
+func TestUseCase_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	uc := NewUseCase(NewMockRepository())
+	key, apiKey, err := uc.CreateKey(ctx, "checkout", RoleClient, tenant.Default)
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		wantErr error
+	}{
+		{name: "valid key", apiKey: apiKey},
+		{name: "malformed key", apiKey: "secret", wantErr: errors.Unauthenticated},
+		{name: "unknown key", apiKey: "ak_unknown.secret", wantErr: errors.Unauthenticated},
+		{name: "wrong secret", apiKey: key.ID + ".secret", wantErr: errors.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := uc.Authenticate(ctx, tt.apiKey)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUseCase_AuthenticateSigned(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo := NewMockRepository()
+	uc := NewUseCase(repo, WithMaxClockSkew(time.Minute), WithCipher(testCipher(t))).(*useCase)
+	uc.now = func() time.Time { return now }
+	key, apiKey, err := uc.CreateKey(ctx, "checkout", RoleClient, tenant.Default)
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	_, secret, _ := ParseAPIKey(apiKey)
+
+	// the stored secret hash and signing key can't sign requests
+	stored, _ := repo.Get(ctx, key.ID)
+	if len(stored.SigningKey) == 0 || strings.Contains(string(stored.SigningKey), string(signingKey(secret))) {
+		t.Fatalf("CreateKey() signing key = %x, want it sealed", stored.SigningKey)
+	}
+	hashKey, _ := hex.DecodeString(stored.SecretHash)
+	forged := &SignedRequest{KeyID: key.ID, Method: "POST", Path: "/wallets/1/deposit", Timestamp: now, Nonce: "forged"}
+	forged.Signature = sign(hashKey, forged)
+	if _, err := uc.AuthenticateSigned(ctx, forged); !errors.Is(err, errors.Unauthenticated) {
+		t.Errorf("AuthenticateSigned() signed with the secret hash error = %v, want %v", err, errors.Unauthenticated)
+	}
+
+	signed := func(nonce string, at time.Time, modify func(r *SignedRequest)) *SignedRequest {
+		r := &SignedRequest{
+			KeyID:     key.ID,
+			Method:    "POST",
+			Path:      "/wallets/1/deposit",
+			Timestamp: at,
+			Nonce:     nonce,
+			Body:      []byte(`{"amount":"10"}`),
+		}
+		r.Signature = Sign(secret, r)
+		if modify != nil {
+			modify(r)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		req     *SignedRequest
+		wantErr error
+	}{
+		{name: "valid signature", req: signed("n1", now, nil)},
+		{name: "replayed nonce", req: signed("n1", now, nil), wantErr: errors.Unauthenticated},
+		{name: "clock skew within bounds", req: signed("n2", now.Add(-50*time.Second), nil)},
+		{name: "stale timestamp", req: signed("n3", now.Add(-2*time.Minute), nil), wantErr: errors.Unauthenticated},
+		{name: "future timestamp", req: signed("n4", now.Add(2*time.Minute), nil), wantErr: errors.Unauthenticated},
+		{name: "missing nonce", req: signed("", now, nil), wantErr: errors.Unauthenticated},
+		{
+			name: "tampered body",
+			req: signed("n5", now, func(r *SignedRequest) {
+				r.Body = []byte(`{"amount":"1000"}`)
+			}),
+			wantErr: errors.Unauthenticated,
+		},
+		{
+			name: "signed with another secret",
+			req: signed("n6", now, func(r *SignedRequest) {
+				r.Signature = Sign("other", r)
+			}),
+			wantErr: errors.Unauthenticated,
+		},
+		{
+			name: "unknown key",
+			req: signed("n7", now, func(r *SignedRequest) {
+				r.KeyID = "ak_unknown"
+			}),
+			wantErr: errors.Unauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := uc.AuthenticateSigned(ctx, tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("AuthenticateSigned() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AuthenticateSigned() error = %v", err)
+			}
+			if p.KeyID != key.ID {
+				t.Errorf("AuthenticateSigned() = %+v", p)
+			}
+		})
+	}
+}
+
+func TestUseCase_AuthenticateSignedWithoutCipher(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockRepository()
+	key, apiKey, err := NewUseCase(repo).CreateKey(ctx, "checkout", RoleClient, tenant.Default)
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	if key.SigningKey != nil {
+		t.Errorf("CreateKey() without cipher signing key = %x, want nil", key.SigningKey)
+	}
+	_, secret, _ := ParseAPIKey(apiKey)
+	r := &SignedRequest{KeyID: key.ID, Method: "POST", Path: "/wallets/1/deposit", Timestamp: time.Now(), Nonce: "n1"}
+	r.Signature = Sign(secret, r)
+
+	// a key created without cipher can't sign requests, even once the use case has one
+	for _, uc := range []UseCase{NewUseCase(repo), NewUseCase(repo, WithCipher(testCipher(t)))} {
+		if _, err := uc.AuthenticateSigned(ctx, r); !errors.Is(err, errors.Unauthenticated) {
+			t.Errorf("AuthenticateSigned() error = %v, want %v", err, errors.Unauthenticated)
+		}
+	}
+
+	// nor with a signing key sealed by another cipher
+	signing := NewUseCase(repo, WithCipher(testCipher(t)))
+	rotated, err := signing.RotateKey(ctx, key.ID)
+	if err != nil {
+		t.Fatalf("RotateKey() error = %v", err)
+	}
+	_, secret, _ = ParseAPIKey(rotated)
+	r.Signature = Sign(secret, r)
+	if _, err := signing.AuthenticateSigned(ctx, r); err != nil {
+		t.Fatalf("AuthenticateSigned() after rotation error = %v", err)
+	}
+	r.Nonce = "n2"
+	r.Signature = Sign(secret, r)
+	other := NewUseCase(repo, WithCipher(testCipher(t)))
+	if _, err := other.AuthenticateSigned(ctx, r); !errors.Is(err, errors.InternalServer) {
+		t.Errorf("AuthenticateSigned() with another cipher error = %v, want %v", err, errors.InternalServer)
+	}
+}
+
+func TestNewCipher(t *testing.T) {
+	for _, key := range []string{"", "not hex", strings.Repeat("00", 16)} {
+		if _, err := NewCipher(key); err == nil {
+			t.Errorf("NewCipher(%q) want error", key)
+		}
+	}
+	aead := testCipher(t)
+	sealed := seal(aead, "ak_1", []byte("signing key"))
+	if got, err := open(aead, "ak_1", sealed); err != nil || string(got) != "signing key" {
+		t.Errorf("open() = %q, %v", got, err)
+	}
+	if _, err := open(aead, "ak_2", sealed); err == nil {
+		t.Error("open() of another key's signing key want error")
+	}
+	if _, err := open(aead, "ak_1", sealed[:4]); err == nil {
+		t.Error("open() of a truncated signing key want error")
+	}
+}
+
+// testCipher creates a cipher with a random encryption key
+func testCipher(t *testing.T) cipher.AEAD {
+	aead, err := NewCipher(randomHex(EncryptionKeySize))
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	return aead
+}
+
+func TestSignedRequest_StringToSign(t *testing.T) {
+	r := &SignedRequest{
+		Method:    "post",
+		Path:      "/wallets/1/deposit?x=1",
+		Timestamp: time.Unix(1700000000, 0),
+		Nonce:     "abc",
+	}
+	want := "POST\n/wallets/1/deposit?x=1\n1700000000\nabc\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if got := r.StringToSign(); got != want {
+		t.Errorf("StringToSign() = %q, want %q", got, want)
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		role    string
+		want    Role
+		wantErr bool
+	}{
+		{role: "", want: RoleClient},
+		{role: "client", want: RoleClient},
+		{role: "admin", want: RoleAdmin},
+		{role: "root", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRole(tt.role)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRole(%q) = %v, %v, want %v", tt.role, got, err, tt.want)
+		}
+	}
+}
@@ -2,23 +2,129 @@ package config
 
 import (
 	"encoding/json"
+	"github.com/shopspring/decimal"
 	"os"
 )
 
 type Config struct {
 	Repository Repository `json:"repository"`
 	Server     Server     `json:"server"`
+	FX         FX         `json:"fx"`
+	Holds      Holds      `json:"holds"`
+	Wallet     Wallet     `json:"wallet"`
+	Auth       Auth       `json:"auth"`
+	Outbox     Outbox     `json:"outbox"`
+	Webhooks   Webhooks   `json:"webhooks"`
+	Log        Log        `json:"log"`
+	Tracing    Tracing    `json:"tracing"`
 }
 
 type Repository struct {
 	DSN        string `json:"dsn"`
 	MigrateDSN string `json:"migrate_dsn"`
+	// MaxConns and MinConns bound the size of the connection pool
+	MaxConns int32 `json:"max_conns"`
+	MinConns int32 `json:"min_conns"`
+	// MaxConnLifetime is how long a connection is used before it is replaced
+	MaxConnLifetime Duration `json:"max_conn_lifetime"`
+	// MaxConnIdleTime is how long an idle connection is kept open
+	MaxConnIdleTime Duration `json:"max_conn_idle_time"`
+	// HealthCheckPeriod is how often idle connections are checked
+	HealthCheckPeriod Duration `json:"health_check_period"`
+	// IsolationLevel of transactions, eg: read_committed, repeatable_read or serializable
+	IsolationLevel string `json:"isolation_level"`
+	// TxRetries is how many times a transaction failed by a concurrent one runs again
+	TxRetries int `json:"tx_retries"`
+	// TxRetryBackoff is the initial upper bound of the random delay before a retry
+	TxRetryBackoff Duration `json:"tx_retry_backoff"`
+	// RowLevelSecurity sets the tenant of the request on the connections so the row level security
+	// policies of the database scope the queries too, the application must not connect as the table owner
+	RowLevelSecurity bool `json:"row_level_security"`
 }
 
 type Server struct {
 	Address string `json:"address"`
 }
 
+type FX struct {
+	// QuoteTTL is how long a quoted exchange rate is locked
+	QuoteTTL Duration `json:"quote_ttl"`
+	// RatesFile is a JSON array of exchange rates loaded on startup
+	RatesFile string `json:"rates_file"`
+}
+
+type Holds struct {
+	// SweepInterval is how often expired holds are released
+	SweepInterval Duration `json:"sweep_interval"`
+}
+
+type Wallet struct {
+	// LockMode is optimistic (default) or pessimistic
+	LockMode string `json:"lock_mode"`
+	// WithdrawalFeeRate is the rate of every withdrawal charged as a fee on top of it, no fee if zero
+	WithdrawalFeeRate decimal.Decimal `json:"withdrawal_fee_rate"`
+}
+
+type Auth struct {
+	// MaxClockSkew is how far the timestamp of a signed request may be from the server clock
+	MaxClockSkew Duration `json:"max_clock_skew"`
+	// EncryptionKey is the hex AES-256 key sealing the signing keys of the API keys,
+	// keys can't sign requests without it
+	EncryptionKey string `json:"encryption_key"`
+}
+
+type Outbox struct {
+	// Publisher also relays the domain events to stdout, file or webhook, besides the webhook subscriptions
+	Publisher string `json:"publisher"`
+	// File is the path the file publisher appends the events to
+	File string `json:"file"`
+	// WebhookURL is the endpoint the webhook publisher posts the events to
+	WebhookURL string `json:"webhook_url"`
+	// RelayInterval is how often pending events are relayed
+	RelayInterval Duration `json:"relay_interval"`
+	// BatchSize is how many events are claimed at a time
+	BatchSize int `json:"batch_size"`
+	// MaxAttempts is how many attempts to publish an event fail before it is dead
+	MaxAttempts int `json:"max_attempts"`
+	// InitialBackoff is the wait after the first failed attempt, it doubles after every failure up to MaxBackoff
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
+	// ClaimTimeout is how long claimed events are reserved to a relay before another may publish them
+	ClaimTimeout Duration `json:"claim_timeout"`
+}
+
+type Webhooks struct {
+	// DeliverInterval is how often due deliveries are attempted
+	DeliverInterval Duration `json:"deliver_interval"`
+	// MaxAttempts is how many attempts of a delivery fail before it is dead
+	MaxAttempts int `json:"max_attempts"`
+	// InitialBackoff is the wait after the first failed attempt, it doubles after every failure up to MaxBackoff
+	InitialBackoff Duration `json:"initial_backoff"`
+	MaxBackoff     Duration `json:"max_backoff"`
+	// Timeout bounds an attempt
+	Timeout Duration `json:"timeout"`
+	// ClaimTimeout is how long claimed deliveries are reserved to an instance before another may attempt them
+	ClaimTimeout Duration `json:"claim_timeout"`
+}
+
+type Log struct {
+	// Level is the lowest level logged: trace, debug, info (default), warn or error
+	Level string `json:"level"`
+	// Format is json (default) or text
+	Format string `json:"format"`
+}
+
+type Tracing struct {
+	// Exporter sends the spans to stdout, file or otlp, tracing is off if empty
+	Exporter string `json:"exporter"`
+	// File is the path the file exporter appends the spans to
+	File string `json:"file"`
+	// Endpoint is the OTLP/HTTP traces endpoint, a local collector by default
+	Endpoint string `json:"endpoint"`
+	// ServiceName names the service of the spans, wallet by default
+	ServiceName string `json:"service_name"`
+}
+
 func NewConfig(confFile string) (*Config, error) {
 	f, err := os.Open(confFile)
 	if err != nil {
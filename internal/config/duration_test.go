@@ -0,0 +1,43 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDuration_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"seconds", `"30s"`, 30 * time.Second, false},
+		{"mixed units", `"1m30s"`, 90 * time.Second, false},
+		{"invalid duration", `"30 seconds"`, 0, true},
+		{"number", `30`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Duration
+			err := json.Unmarshal([]byte(tt.content), &d)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if time.Duration(d) != tt.want {
+				t.Errorf("UnmarshalJSON() got = %v, want %v", time.Duration(d), tt.want)
+			}
+		})
+	}
+}
+
+func TestDuration_MarshalJSON(t *testing.T) {
+	b, err := json.Marshal(Duration(90 * time.Second))
+	if err != nil {
+		t.Fatalf("MarshalJSON() error = %v", err)
+	}
+	if string(b) != `"1m30s"` {
+		t.Errorf("MarshalJSON() got = %s, want %s", b, `"1m30s"`)
+	}
+}
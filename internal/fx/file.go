@@ -0,0 +1,22 @@
+package fx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// LoadRatesFile reads a JSON array of rates from the file
+func LoadRatesFile(path string) ([]*Rate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rates []*Rate
+	if err := json.NewDecoder(f).Decode(&rates); err != nil {
+		return nil, fmt.Errorf("failed to decode rates file %s: %w", path, err)
+	}
+	return rates, nil
+}
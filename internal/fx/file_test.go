@@ -0,0 +1,29 @@
+package fx
+
+import (
+	"testing"
+)
+
+func TestLoadRatesFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    int
+		wantErr bool
+	}{
+		{"valid file", "testdata/rates.json", 2, false},
+		{"missing file", "testdata/missing.json", 0, true},
+		{"invalid json", "file.go", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates, err := LoadRatesFile(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadRatesFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(rates) != tt.want {
+				t.Errorf("LoadRatesFile() got %d rates, want %d", len(rates), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package fx
+
+import (
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/currency"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// RatePrecision is the number of decimal places a rate is stored with
+const RatePrecision = 10
+
+// Rate is the price of one unit of Base in Quote currency, valid from ValidFrom until ValidTo.
+// A rate without ValidTo stays valid until a newer rate replaces it.
+type Rate struct {
+	ID        uint            `json:"id"`
+	Base      string          `json:"base"`
+	Quote     string          `json:"quote"`
+	Rate      decimal.Decimal `json:"rate"`
+	ValidFrom time.Time       `json:"valid_from"`
+	ValidTo   *time.Time      `json:"valid_to,omitempty"`
+}
+
+// Validate checks the currencies, the rate and the validity window
+func (r *Rate) Validate() error {
+	base, err := currency.Lookup(r.Base)
+	if err != nil {
+		return err
+	}
+	quote, err := currency.Lookup(r.Quote)
+	if err != nil {
+		return err
+	}
+	if base == quote {
+		return errors.InvalidRate.WithCause(fmt.Errorf("base and quote are both %s", base.Code))
+	}
+	if !r.Rate.IsPositive() || !r.Rate.Equal(r.Rate.Round(RatePrecision)) {
+		return errors.InvalidRate.WithCause(fmt.Errorf("rate must be positive with at most %d decimal places: %v", RatePrecision, r.Rate))
+	}
+	if r.ValidFrom.IsZero() {
+		return errors.InvalidRate.WithCause(fmt.Errorf("valid_from is required"))
+	}
+	if r.ValidTo != nil && !r.ValidTo.After(r.ValidFrom) {
+		return errors.InvalidRate.WithCause(fmt.Errorf("valid_to %v must be after valid_from %v", r.ValidTo, r.ValidFrom))
+	}
+	r.Base, r.Quote = base.Code, quote.Code
+	return nil
+}
+
+// Inverse returns the rate of Quote in Base currency
+func (r *Rate) Inverse() *Rate {
+	return &Rate{
+		ID:        r.ID,
+		Base:      r.Quote,
+		Quote:     r.Base,
+		Rate:      decimal.NewFromInt(1).DivRound(r.Rate, RatePrecision),
+		ValidFrom: r.ValidFrom,
+		ValidTo:   r.ValidTo,
+	}
+}
+
+// Quote is a conversion of Amount from one wallet to another at a locked rate until ExpiresAt
+type Quote struct {
+	ID           string          `json:"id"`
+	FromWalletID uint            `json:"from_wallet_id"`
+	ToWalletID   uint            `json:"to_wallet_id"`
+	FromCurrency string          `json:"from_currency"`
+	ToCurrency   string          `json:"to_currency"`
+	Amount       decimal.Decimal `json:"amount"`
+	ToAmount     decimal.Decimal `json:"to_amount"`
+	Rate         decimal.Decimal `json:"rate"`
+	CreatedAt    time.Time       `json:"created_at"`
+	ExpiresAt    time.Time       `json:"expires_at"`
+	UsedAt       *time.Time      `json:"used_at,omitempty"`
+}
+
+// CheckRedeemable checks if the quote can still be used at the given time
+func (q *Quote) CheckRedeemable(at time.Time) error {
+	if q.UsedAt != nil {
+		return errors.QuoteUsed
+	}
+	if !at.Before(q.ExpiresAt) {
+		return errors.QuoteExpired
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package fx
+
+import (
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"testing"
+	"time"
+)
+
+func TestRate_Validate(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := from.Add(-time.Hour)
+	tests := []struct {
+		name    string
+		rate    Rate
+		wantErr error
+	}{
+		{
+			name: "valid rate",
+			rate: Rate{Base: "usd", Quote: "eur", Rate: decimal.NewFromFloat(0.92), ValidFrom: from},
+		},
+		{
+			name:    "unknown currency",
+			rate:    Rate{Base: "USD", Quote: "XXX", Rate: decimal.NewFromFloat(0.92), ValidFrom: from},
+			wantErr: errors.UnsupportedCurrency,
+		},
+		{
+			name:    "same currency",
+			rate:    Rate{Base: "USD", Quote: "USD", Rate: decimal.NewFromInt(1), ValidFrom: from},
+			wantErr: errors.InvalidRate,
+		},
+		{
+			name:    "zero rate",
+			rate:    Rate{Base: "USD", Quote: "EUR", Rate: decimal.Zero, ValidFrom: from},
+			wantErr: errors.InvalidRate,
+		},
+		{
+			name:    "too precise rate",
+			rate:    Rate{Base: "USD", Quote: "EUR", Rate: decimal.RequireFromString("0.12345678901"), ValidFrom: from},
+			wantErr: errors.InvalidRate,
+		},
+		{
+			name:    "missing valid_from",
+			rate:    Rate{Base: "USD", Quote: "EUR", Rate: decimal.NewFromFloat(0.92)},
+			wantErr: errors.InvalidRate,
+		},
+		{
+			name:    "valid_to before valid_from",
+			rate:    Rate{Base: "USD", Quote: "EUR", Rate: decimal.NewFromFloat(0.92), ValidFrom: from, ValidTo: &before},
+			wantErr: errors.InvalidRate,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rate.Validate()
+			if (err != nil) != (tt.wantErr != nil) || (err != nil && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRate_Validate_NormalizesCodes(t *testing.T) {
+	r := Rate{Base: "usd", Quote: "eur", Rate: decimal.NewFromFloat(0.92), ValidFrom: time.Now()}
+	if err := r.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if r.Base != "USD" || r.Quote != "EUR" {
+		t.Errorf("Validate() base = %s, quote = %s", r.Base, r.Quote)
+	}
+}
+
+func TestRate_Inverse(t *testing.T) {
+	r := &Rate{Base: "USD", Quote: "EUR", Rate: decimal.NewFromInt(4)}
+	inv := r.Inverse()
+	if inv.Base != "EUR" || inv.Quote != "USD" || inv.Rate.String() != "0.25" {
+		t.Errorf("Inverse() = %+v", inv)
+	}
+}
+
+func TestQuote_CheckRedeemable(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		quote   Quote
+		wantErr error
+	}{
+		{name: "valid", quote: Quote{ExpiresAt: now.Add(time.Second)}},
+		{name: "expired", quote: Quote{ExpiresAt: now}, wantErr: errors.QuoteExpired},
+		{name: "used", quote: Quote{ExpiresAt: now.Add(time.Second), UsedAt: &now}, wantErr: errors.QuoteUsed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.quote.CheckRedeemable(now); err != tt.wantErr {
+				t.Errorf("CheckRedeemable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
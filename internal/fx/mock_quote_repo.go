@@ -0,0 +1,42 @@
+package fx
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"time"
+)
+
+type MockQuoteRepository struct {
+	quotes map[string]Quote
+}
+
+func NewMockQuoteRepository() *MockQuoteRepository {
+	return &MockQuoteRepository{
+		quotes: make(map[string]Quote),
+	}
+}
+
+func (m *MockQuoteRepository) Create(ctx context.Context, quote *Quote) error {
+	m.quotes[quote.ID] = *quote
+	return nil
+}
+
+func (m *MockQuoteRepository) Get(ctx context.Context, id string) (*Quote, error) {
+	if q, exists := m.quotes[id]; exists {
+		return &q, nil
+	}
+	return nil, errors.RecordNotFound
+}
+
+func (m *MockQuoteRepository) MarkUsed(ctx context.Context, quote *Quote, usedAt time.Time) error {
+	q, exists := m.quotes[quote.ID]
+	if !exists {
+		return errors.RecordNotFound
+	}
+	if q.UsedAt != nil {
+		return errors.QuoteUsed
+	}
+	q.UsedAt = &usedAt
+	m.quotes[quote.ID] = q
+	return nil
+}
@@ -0,0 +1,51 @@
+package fx
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"slices"
+	"time"
+)
+
+type MockRateRepository struct {
+	rates []Rate
+}
+
+func NewMockRateRepository() *MockRateRepository {
+	return &MockRateRepository{
+		rates: make([]Rate, 0),
+	}
+}
+
+func (m *MockRateRepository) Create(ctx context.Context, rates ...*Rate) error {
+	for _, r := range rates {
+		i := slices.IndexFunc(m.rates, func(stored Rate) bool {
+			return stored.Base == r.Base && stored.Quote == r.Quote && stored.ValidFrom.Equal(r.ValidFrom)
+		})
+		if i < 0 {
+			r.ID = uint(len(m.rates) + 1)
+			m.rates = append(m.rates, *r)
+			continue
+		}
+		r.ID = m.rates[i].ID
+		m.rates[i] = *r
+	}
+	return nil
+}
+
+func (m *MockRateRepository) Find(ctx context.Context, base, quote string, at time.Time) (*Rate, error) {
+	var found *Rate
+	for i := range m.rates {
+		r := m.rates[i]
+		if r.Base != base || r.Quote != quote || r.ValidFrom.After(at) || (r.ValidTo != nil && !r.ValidTo.After(at)) {
+			continue
+		}
+		if found == nil || r.ValidFrom.After(found.ValidFrom) {
+			found = &r
+		}
+	}
+	if found == nil {
+		return nil, errors.RecordNotFound
+	}
+	return found, nil
+}
@@ -0,0 +1,25 @@
+package fx
+
+import (
+	"context"
+	"time"
+)
+
+// RateRepository defines the repository for exchange rates.
+type RateRepository interface {
+	// Create stores all the rates or none of them.
+	// A rate of a pair stored from the same time is replaced, and keeps its id.
+	Create(ctx context.Context, rates ...*Rate) error
+	// Find gets the latest rate of base in quote currency that is valid at the given time.
+	Find(ctx context.Context, base, quote string, at time.Time) (*Rate, error)
+}
+
+// QuoteRepository defines the repository for quotes.
+type QuoteRepository interface {
+	// Create stores a new quote.
+	Create(ctx context.Context, quote *Quote) error
+	// Get gets the quote by id.
+	Get(ctx context.Context, id string) (*Quote, error)
+	// MarkUsed marks an unused quote as used.
+	MarkUsed(ctx context.Context, quote *Quote, usedAt time.Time) error
+}
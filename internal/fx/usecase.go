@@ -0,0 +1,136 @@
+package fx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/currency"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"time"
+)
+
+// DefaultQuoteTTL is how long a quote is locked when no TTL is configured
+const DefaultQuoteTTL = 30 * time.Second
+
+// UseCase defines use cases for currency exchange.
+type UseCase interface {
+	// LoadRates validates and stores the rates, only admins may.
+	// Returns an error if any rate is invalid, in which case no rate is stored.
+	LoadRates(ctx context.Context, rates []*Rate) error
+
+	// Rate gets the rate of base in quote currency that is valid now,
+	// falling back to the inverse of the quote to base rate.
+	// Returns an error if no rate is valid.
+	Rate(ctx context.Context, base, quote string) (*Rate, error)
+
+	// Quote converts the quote amount at the current rate and stores the quote, locked for the quote TTL.
+	// FromWalletID, ToWalletID, FromCurrency, ToCurrency and Amount must be set by the caller.
+	Quote(ctx context.Context, quote *Quote) error
+
+	// Redeem marks the quote used and returns it.
+	// Returns an error if the quote doesn't exist, is expired or is already used.
+	Redeem(ctx context.Context, quoteID string) (*Quote, error)
+}
+
+// useCase implements UseCase.
+type useCase struct {
+	rateRepo  RateRepository
+	quoteRepo QuoteRepository
+	quoteTTL  time.Duration
+}
+
+func NewUseCase(rateRepo RateRepository, quoteRepo QuoteRepository, quoteTTL time.Duration) UseCase {
+	if quoteTTL <= 0 {
+		quoteTTL = DefaultQuoteTTL
+	}
+	return &useCase{rateRepo: rateRepo, quoteRepo: quoteRepo, quoteTTL: quoteTTL}
+}
+
+func (u *useCase) LoadRates(ctx context.Context, rates []*Rate) error {
+	// rates loaded on startup have no principal
+	if p, ok := auth.FromContext(ctx); ok && !p.IsAdmin() {
+		return errors.Forbidden.WithCause(fmt.Errorf("%s may not load rates", p.KeyID))
+	}
+	if len(rates) == 0 {
+		return errors.InvalidArgs.WithCause(fmt.Errorf("no rates to load"))
+	}
+	for i, r := range rates {
+		if err := r.Validate(); err != nil {
+			return errors.InvalidRate.WithCause(fmt.Errorf("rate %d: %w", i, err))
+		}
+	}
+	return u.rateRepo.Create(ctx, rates...)
+}
+
+func (u *useCase) Rate(ctx context.Context, base, quote string) (*Rate, error) {
+	now := time.Now()
+	rate, err := u.rateRepo.Find(ctx, base, quote, now)
+	if err == nil {
+		return rate, nil
+	}
+	if !errors.Is(err, errors.RecordNotFound) {
+		return nil, err
+	}
+	inverse, err := u.rateRepo.Find(ctx, quote, base, now)
+	if errors.Is(err, errors.RecordNotFound) {
+		return nil, errors.RateNotFound.WithCause(fmt.Errorf("no %s/%s rate valid at %v", base, quote, now))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return inverse.Inverse(), nil
+}
+
+func (u *useCase) Quote(ctx context.Context, quote *Quote) error {
+	to, err := currency.Lookup(quote.ToCurrency)
+	if err != nil {
+		return err
+	}
+	rate, err := u.Rate(ctx, quote.FromCurrency, quote.ToCurrency)
+	if err != nil {
+		return err
+	}
+	toAmount := to.Round(quote.Amount.Mul(rate.Rate))
+	if !toAmount.IsPositive() {
+		return errors.InvalidArgs.WithCause(fmt.Errorf("%v %s converts to %v %s", quote.Amount, quote.FromCurrency, toAmount, to.Code))
+	}
+
+	id, err := newQuoteID()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	quote.ID = id
+	quote.Rate = rate.Rate
+	quote.ToAmount = toAmount
+	quote.CreatedAt = now
+	quote.ExpiresAt = now.Add(u.quoteTTL)
+	quote.UsedAt = nil
+	return u.quoteRepo.Create(ctx, quote)
+}
+
+func (u *useCase) Redeem(ctx context.Context, quoteID string) (*Quote, error) {
+	quote, err := u.quoteRepo.Get(ctx, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := quote.CheckRedeemable(now); err != nil {
+		return nil, err
+	}
+	if err := u.quoteRepo.MarkUsed(ctx, quote, now); err != nil {
+		return nil, err
+	}
+	quote.UsedAt = &now
+	return quote, nil
+}
+
+func newQuoteID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.InternalServer.WithCause(err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,126 @@
+package fx
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"testing"
+	"time"
+)
+
+func setupTest(t *testing.T) (UseCase, *MockQuoteRepository) {
+	quoteRepo := NewMockQuoteRepository()
+	uc := NewUseCase(NewMockRateRepository(), quoteRepo, time.Minute)
+	err := uc.LoadRates(context.Background(), []*Rate{
+		{Base: "USD", Quote: "EUR", Rate: decimal.NewFromFloat(0.9), ValidFrom: time.Now().Add(-time.Hour)},
+		{Base: "USD", Quote: "JPY", Rate: decimal.NewFromFloat(150.5), ValidFrom: time.Now().Add(-time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("LoadRates() error = %v", err)
+	}
+	return uc, quoteRepo
+}
+
+func TestUseCase_LoadRates(t *testing.T) {
+	uc := NewUseCase(NewMockRateRepository(), NewMockQuoteRepository(), 0)
+	err := uc.LoadRates(context.Background(), []*Rate{
+		{Base: "USD", Quote: "EUR", Rate: decimal.NewFromFloat(0.9), ValidFrom: time.Now()},
+		{Base: "USD", Quote: "EUR", Rate: decimal.Zero, ValidFrom: time.Now()},
+	})
+	if !errors.Is(err, errors.InvalidRate) {
+		t.Errorf("LoadRates() error = %v, want %v", err, errors.InvalidRate)
+	}
+	if _, err := uc.Rate(context.Background(), "USD", "EUR"); !errors.Is(err, errors.RateNotFound) {
+		t.Errorf("Rate() after failed load error = %v, want %v", err, errors.RateNotFound)
+	}
+	if err := uc.LoadRates(context.Background(), nil); !errors.Is(err, errors.InvalidArgs) {
+		t.Errorf("LoadRates() empty error = %v, want %v", err, errors.InvalidArgs)
+	}
+
+	rates := []*Rate{{Base: "USD", Quote: "EUR", Rate: decimal.NewFromFloat(0.9), ValidFrom: time.Now()}}
+	client := auth.NewContext(context.Background(), &auth.Principal{KeyID: "ak_1", Role: auth.RoleClient})
+	if err := uc.LoadRates(client, rates); !errors.Is(err, errors.Forbidden) {
+		t.Errorf("LoadRates() by client error = %v, want %v", err, errors.Forbidden)
+	}
+	admin := auth.NewContext(context.Background(), &auth.Principal{KeyID: "ak_2", Role: auth.RoleAdmin})
+	if err := uc.LoadRates(admin, rates); err != nil {
+		t.Errorf("LoadRates() by admin error = %v", err)
+	}
+}
+
+func TestUseCase_Rate(t *testing.T) {
+	uc, _ := setupTest(t)
+	tests := []struct {
+		name    string
+		base    string
+		quote   string
+		want    string
+		wantErr error
+	}{
+		{name: "direct rate", base: "USD", quote: "EUR", want: "0.9"},
+		{name: "inverse rate", base: "JPY", quote: "USD", want: "0.0066445183"},
+		{name: "missing rate", base: "EUR", quote: "JPY", wantErr: errors.RateNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := uc.Rate(context.Background(), tt.base, tt.quote)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Rate() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rate() error = %v", err)
+			}
+			if got.Rate.String() != tt.want {
+				t.Errorf("Rate() = %v, want %v", got.Rate, tt.want)
+			}
+		})
+	}
+}
+
+func TestUseCase_QuoteAndRedeem(t *testing.T) {
+	ctx := context.Background()
+	uc, quoteRepo := setupTest(t)
+
+	q := &Quote{FromWalletID: 1, ToWalletID: 2, FromCurrency: "USD", ToCurrency: "JPY", Amount: decimal.NewFromFloat(10.01)}
+	if err := uc.Quote(ctx, q); err != nil {
+		t.Fatalf("Quote() error = %v", err)
+	}
+	if q.ID == "" || q.Rate.String() != "150.5" || q.ToAmount.String() != "1507" {
+		t.Errorf("Quote() = %+v", q)
+	}
+	if d := q.ExpiresAt.Sub(q.CreatedAt); d != time.Minute {
+		t.Errorf("Quote() ttl = %v, want %v", d, time.Minute)
+	}
+
+	redeemed, err := uc.Redeem(ctx, q.ID)
+	if err != nil {
+		t.Fatalf("Redeem() error = %v", err)
+	}
+	if redeemed.UsedAt == nil || !redeemed.ToAmount.Equal(q.ToAmount) {
+		t.Errorf("Redeem() = %+v", redeemed)
+	}
+	if _, err := uc.Redeem(ctx, q.ID); err != errors.QuoteUsed {
+		t.Errorf("Redeem() twice error = %v, want %v", err, errors.QuoteUsed)
+	}
+
+	expired := &Quote{ID: "expired", ExpiresAt: time.Now().Add(-time.Second)}
+	_ = quoteRepo.Create(ctx, expired)
+	if _, err := uc.Redeem(ctx, expired.ID); err != errors.QuoteExpired {
+		t.Errorf("Redeem() expired error = %v, want %v", err, errors.QuoteExpired)
+	}
+	if _, err := uc.Redeem(ctx, "missing"); !errors.Is(err, errors.RecordNotFound) {
+		t.Errorf("Redeem() missing error = %v, want %v", err, errors.RecordNotFound)
+	}
+}
+
+func TestUseCase_QuoteTooSmall(t *testing.T) {
+	uc, _ := setupTest(t)
+	q := &Quote{FromCurrency: "USD", ToCurrency: "EUR", Amount: decimal.NewFromFloat(0.001)}
+	if err := uc.Quote(context.Background(), q); !errors.Is(err, errors.InvalidArgs) {
+		t.Errorf("Quote() error = %v, want %v", err, errors.InvalidArgs)
+	}
+}
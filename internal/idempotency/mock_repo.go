@@ -0,0 +1,31 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+)
+
+type MockRepository struct {
+	records map[string]Record
+}
+
+func NewMockRepository() *MockRepository {
+	return &MockRepository{
+		records: make(map[string]Record),
+	}
+}
+
+func (m *MockRepository) Get(ctx context.Context, key string) (*Record, error) {
+	if r, exists := m.records[key]; exists {
+		return &r, nil
+	}
+	return nil, errors.RecordNotFound
+}
+
+func (m *MockRepository) Create(ctx context.Context, record *Record) error {
+	if _, exists := m.records[record.Key]; exists {
+		return errors.DuplicateRecord
+	}
+	m.records[record.Key] = *record
+	return nil
+}
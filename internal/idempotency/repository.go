@@ -0,0 +1,11 @@
+package idempotency
+
+import "context"
+
+// Repository defines the repository for idempotency records.
+type Repository interface {
+	// Get gets the record by key.
+	Get(ctx context.Context, key string) (*Record, error)
+	// Create stores a new record, fails if the key already exists.
+	Create(ctx context.Context, record *Record) error
+}
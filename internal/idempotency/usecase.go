@@ -0,0 +1,86 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/wallet"
+	"time"
+)
+
+// UseCase defines use cases for idempotent requests.
+type UseCase interface {
+	// Execute runs fn at most once per key in a database transaction and stores its response in the same transaction.
+	// A retry with the same key and fingerprint returns the stored record with replayed set to true.
+	// A concurrent request with the same key that stores its response first is replayed the same way.
+	// Returns an error if the key was used with a different fingerprint or if fn fails,
+	// in which case nothing is stored and the request can be retried. fn failing with errors.ConcurrentUpdate
+	// fails the transaction with it, so a retrying DBTx runs fn again in a new one.
+	Execute(ctx context.Context, key, fingerprint string, fn func(ctx context.Context) (*Record, error)) (record *Record, replayed bool, err error)
+}
+
+// useCase implements UseCase.
+type useCase struct {
+	repo Repository
+	dbTx wallet.DBTx
+}
+
+func NewUseCase(repo Repository, dbTx wallet.DBTx) UseCase {
+	return &useCase{repo: repo, dbTx: dbTx}
+}
+
+func (u *useCase) Execute(ctx context.Context, key, fingerprint string, fn func(ctx context.Context) (*Record, error)) (*Record, bool, error) {
+	if key == "" || len(key) > MaxKeyLength {
+		return nil, false, errors.InvalidArgs.WithCause(fmt.Errorf("idempotency key length must be between 1 and %d", MaxKeyLength))
+	}
+	var (
+		record   *Record
+		replayed bool
+		raced    bool
+	)
+	err := u.dbTx.ExecTx(ctx, func(ctx context.Context) error {
+		raced = false
+		stored, err := u.repo.Get(ctx, key)
+		if err == nil {
+			record, err = replay(stored, fingerprint)
+			replayed = err == nil
+			return err
+		}
+		if !errors.Is(err, errors.RecordNotFound) {
+			return err
+		}
+
+		record, err = fn(ctx)
+		if err != nil {
+			return err
+		}
+		record.Key = key
+		record.Fingerprint = fingerprint
+		record.CreatedAt = time.Now()
+		err = u.repo.Create(ctx, record)
+		// a concurrent request with the key stored its response first
+		raced = errors.Is(err, errors.DuplicateRecord)
+		return err
+	})
+	if raced {
+		// the transaction rolled the work of fn back, reply what the request stored
+		stored, getErr := u.repo.Get(ctx, key)
+		if getErr != nil {
+			return nil, false, err
+		}
+		record, err = replay(stored, fingerprint)
+		return record, err == nil, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return record, replayed, nil
+}
+
+// replay returns the stored record to a retry, which must be the request that stored it
+func replay(stored *Record, fingerprint string) (*Record, error) {
+	if stored.Fingerprint != fingerprint {
+		return nil, errors.IdempotencyKeyReuse
+	}
+	return stored, nil
+}
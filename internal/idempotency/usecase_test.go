@@ -0,0 +1,150 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"strings"
+	"testing"
+)
+
+type mockDBTx struct{}
+
+func (m *mockDBTx) ExecTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func TestFingerprint(t *testing.T) {
+	a := Fingerprint("POST", "/wallets/1/deposit", []byte(`{"amount":"1"}`))
+	if len(a) != 64 {
+		t.Errorf("Fingerprint() length = %d, want 64", len(a))
+	}
+	if a != Fingerprint("POST", "/wallets/1/deposit", []byte(`{"amount":"1"}`)) {
+		t.Error("Fingerprint() is not stable")
+	}
+	if a == Fingerprint("POST", "/wallets/2/deposit", []byte(`{"amount":"1"}`)) {
+		t.Error("Fingerprint() ignores path")
+	}
+	if a == Fingerprint("POST", "/wallets/1/deposit", []byte(`{"amount":"2"}`)) {
+		t.Error("Fingerprint() ignores body")
+	}
+}
+
+func TestUseCase_Execute(t *testing.T) {
+	ctx := context.Background()
+	uc := NewUseCase(NewMockRepository(), &mockDBTx{})
+
+	calls := 0
+	fn := func(ctx context.Context) (*Record, error) {
+		calls++
+		return &Record{StatusCode: 200, Body: []byte(`{"ok":true}`)}, nil
+	}
+
+	// first request executes fn
+	rec, replayed, err := uc.Execute(ctx, "key-1", "fp-1", fn)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if replayed || calls != 1 || rec.StatusCode != 200 {
+		t.Errorf("Execute() replayed = %v, calls = %d, record = %+v", replayed, calls, rec)
+	}
+
+	// retry replays the stored response
+	rec, replayed, err = uc.Execute(ctx, "key-1", "fp-1", fn)
+	if err != nil {
+		t.Fatalf("Execute() retry error = %v", err)
+	}
+	if !replayed || calls != 1 || string(rec.Body) != `{"ok":true}` {
+		t.Errorf("Execute() retry replayed = %v, calls = %d, record = %+v", replayed, calls, rec)
+	}
+
+	// same key, different request
+	_, _, err = uc.Execute(ctx, "key-1", "fp-2", fn)
+	if !errors.Is(err, errors.IdempotencyKeyReuse) {
+		t.Errorf("Execute() reuse error = %v, want %v", err, errors.IdempotencyKeyReuse)
+	}
+	if calls != 1 {
+		t.Errorf("Execute() reuse calls = %d, want 1", calls)
+	}
+}
+
+func TestUseCase_ExecuteFailed(t *testing.T) {
+	ctx := context.Background()
+	uc := NewUseCase(NewMockRepository(), &mockDBTx{})
+
+	_, _, err := uc.Execute(ctx, "key-1", "fp-1", func(ctx context.Context) (*Record, error) {
+		return nil, errors.InsufficientBalance
+	})
+	if !errors.Is(err, errors.InsufficientBalance) {
+		t.Fatalf("Execute() error = %v, want %v", err, errors.InsufficientBalance)
+	}
+
+	// failed requests are not stored and can be retried
+	_, replayed, err := uc.Execute(ctx, "key-1", "fp-1", func(ctx context.Context) (*Record, error) {
+		return &Record{StatusCode: 200}, nil
+	})
+	if err != nil || replayed {
+		t.Errorf("Execute() retry error = %v, replayed = %v", err, replayed)
+	}
+}
+
+func TestUseCase_ExecuteConcurrent(t *testing.T) {
+	tests := []struct {
+		name        string
+		fingerprint string
+		wantErr     error
+	}{
+		{name: "same request", fingerprint: "fp-1"},
+		{name: "different request", fingerprint: "fp-2", wantErr: errors.IdempotencyKeyReuse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewMockRepository()
+			uc := NewUseCase(repo, &mockDBTx{})
+
+			rec, replayed, err := uc.Execute(ctx, "key-1", "fp-1", func(ctx context.Context) (*Record, error) {
+				// a concurrent request with the key commits while this one runs
+				winner := &Record{Key: "key-1", Fingerprint: tt.fingerprint, StatusCode: 201, Body: []byte(`{"winner":true}`)}
+				if err := repo.Create(ctx, winner); err != nil {
+					t.Fatalf("Create() error = %v", err)
+				}
+				return &Record{StatusCode: 201, Body: []byte(`{"winner":false}`)}, nil
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Execute() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if !replayed || string(rec.Body) != `{"winner":true}` {
+				t.Errorf("Execute() replayed = %v, record = %+v, want the response of the winner", replayed, rec)
+			}
+		})
+	}
+
+	// a duplicate failing fn isn't taken for a concurrent request
+	uc := NewUseCase(NewMockRepository(), &mockDBTx{})
+	_, _, err := uc.Execute(context.Background(), "key-1", "fp-1", func(ctx context.Context) (*Record, error) {
+		return nil, errors.DuplicateRecord
+	})
+	if !errors.Is(err, errors.DuplicateRecord) {
+		t.Errorf("Execute() error = %v, want %v", err, errors.DuplicateRecord)
+	}
+}
+
+func TestUseCase_ExecuteInvalidKey(t *testing.T) {
+	uc := NewUseCase(NewMockRepository(), &mockDBTx{})
+	fn := func(ctx context.Context) (*Record, error) {
+		t.Error("fn should not be called")
+		return nil, nil
+	}
+	for _, key := range []string{"", strings.Repeat("k", MaxKeyLength+1)} {
+		if _, _, err := uc.Execute(context.Background(), key, "fp", fn); !errors.Is(err, errors.InvalidArgs) {
+			t.Errorf("Execute(%q) error = %v, want %v", key, err, errors.InvalidArgs)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package ledger
+
+import (
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// Account identifies a ledger account. Wallet accounts mirror the wallet balances,
+// system accounts are the counter-accounts of money entering or leaving the wallets.
+type Account string
+
+// SystemKind is the purpose of a system account
+type SystemKind string
+
+const (
+	// SystemDeposits is the counter-account of deposits, its balance goes negative as money comes in
+	SystemDeposits SystemKind = "deposits"
+	// SystemWithdrawals is the counter-account of withdrawals and captured holds
+	SystemWithdrawals SystemKind = "withdrawals"
+	// SystemFees collects the fees charged on withdrawals
+	SystemFees SystemKind = "fees"
+	// SystemFX exchanges one currency for another in cross-currency transfers
+	SystemFX SystemKind = "fx"
+)
+
+// WalletAccount returns the account of the wallet
+func WalletAccount(walletID uint) Account {
+	return Account(fmt.Sprintf("wallet:%d", walletID))
+}
+
+// SystemAccount returns the system account of the kind in the currency
+func SystemAccount(kind SystemKind, currency string) Account {
+	return Account(fmt.Sprintf("system:%s:%s", kind, currency))
+}
+
+// Posting changes the balance of an account by Amount, a negative amount decreases it
+type Posting struct {
+	ID       uint            `json:"id"`
+	EntryID  uint            `json:"entry_id"`
+	Account  Account         `json:"account"`
+	Currency string          `json:"currency"`
+	Amount   decimal.Decimal `json:"amount"`
+}
+
+// Entry is a journal entry recording one money movement.
+// The amounts of its postings sum to zero in every currency.
+type Entry struct {
+	ID            uint      `json:"id"`
+	TransactionID uint      `json:"transaction_id"`
+	Description   string    `json:"description"`
+	CreatedAt     time.Time `json:"created_at"`
+	Postings      []Posting `json:"postings"`
+}
+
+// NewEntry creates a journal entry and checks that it is balanced
+func NewEntry(description string, postings ...Posting) (*Entry, error) {
+	e := &Entry{
+		Description: description,
+		CreatedAt:   time.Now(),
+		Postings:    postings,
+	}
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Validate checks that the entry has at least two non-zero postings that sum to zero in every currency
+func (e *Entry) Validate() error {
+	if len(e.Postings) < 2 {
+		return errors.UnbalancedEntry.WithCause(fmt.Errorf("entry has %d postings, at least 2 are required", len(e.Postings)))
+	}
+	sums := make(map[string]decimal.Decimal)
+	for _, p := range e.Postings {
+		if p.Amount.IsZero() {
+			return errors.UnbalancedEntry.WithCause(fmt.Errorf("posting to %s has zero amount", p.Account))
+		}
+		sums[p.Currency] = sums[p.Currency].Add(p.Amount)
+	}
+	for c, sum := range sums {
+		if !sum.IsZero() {
+			return errors.UnbalancedEntry.WithCause(fmt.Errorf("%s postings sum to %v", c, sum))
+		}
+	}
+	return nil
+}
+
+// Move returns the postings of amount moving from one account to another
+func Move(from, to Account, currency string, amount decimal.Decimal) []Posting {
+	return []Posting{
+		{Account: from, Currency: currency, Amount: amount.Neg()},
+		{Account: to, Currency: currency, Amount: amount},
+	}
+}
+
+// Convert returns the postings of amount in one currency leaving an account
+// and toAmount in another currency reaching another account, exchanged by the FX system accounts
+func Convert(from, to Account, currency string, amount decimal.Decimal, toCurrency string, toAmount decimal.Decimal) []Posting {
+	return append(
+		Move(from, SystemAccount(SystemFX, currency), currency, amount),
+		Move(SystemAccount(SystemFX, toCurrency), to, toCurrency, toAmount)...,
+	)
+}
+
+// Balance is the sum of the postings to an account in a currency
+type Balance struct {
+	Account  Account         `json:"account"`
+	Currency string          `json:"currency"`
+	Amount   decimal.Decimal `json:"amount"`
+}
+
+// CheckBalances checks that the balances of all accounts sum to zero in every currency,
+// which holds as long as every entry is balanced
+func CheckBalances(balances []Balance) error {
+	sums := make(map[string]decimal.Decimal)
+	for _, b := range balances {
+		sums[b.Currency] = sums[b.Currency].Add(b.Amount)
+	}
+	for c, sum := range sums {
+		if !sum.IsZero() {
+			return errors.UnbalancedEntry.WithCause(fmt.Errorf("%s accounts sum to %v", c, sum))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package ledger
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+func TestAccounts(t *testing.T) {
+	if got := WalletAccount(42); got != "wallet:42" {
+		t.Errorf("WalletAccount() = %v, want %v", got, "wallet:42")
+	}
+	if got := SystemAccount(SystemDeposits, "USD"); got != "system:deposits:USD" {
+		t.Errorf("SystemAccount() = %v, want %v", got, "system:deposits:USD")
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	hundred := decimal.NewFromFloat(100)
+	tests := []struct {
+		name     string
+		postings []Posting
+		wantErr  bool
+	}{
+		{
+			name:     "balanced move",
+			postings: Move(SystemAccount(SystemDeposits, "USD"), WalletAccount(1), "USD", hundred),
+		},
+		{
+			name:     "balanced conversion",
+			postings: Convert(WalletAccount(1), WalletAccount(2), "USD", hundred, "EUR", decimal.NewFromFloat(90)),
+		},
+		{
+			name: "unbalanced amounts",
+			postings: []Posting{
+				{Account: WalletAccount(1), Currency: "USD", Amount: hundred.Neg()},
+				{Account: WalletAccount(2), Currency: "USD", Amount: decimal.NewFromFloat(99.99)},
+			},
+			wantErr: true,
+		},
+		{
+			name: "balanced total across currencies",
+			postings: []Posting{
+				{Account: WalletAccount(1), Currency: "USD", Amount: hundred.Neg()},
+				{Account: WalletAccount(2), Currency: "EUR", Amount: hundred},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "single posting",
+			postings: []Posting{{Account: WalletAccount(1), Currency: "USD", Amount: hundred}},
+			wantErr:  true,
+		},
+		{
+			name: "zero postings",
+			postings: []Posting{
+				{Account: WalletAccount(1), Currency: "USD", Amount: decimal.Zero},
+				{Account: WalletAccount(2), Currency: "USD", Amount: decimal.Zero},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewEntry("test", tt.postings...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewEntry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, errors.UnbalancedEntry) {
+				t.Errorf("NewEntry() error = %v, want %v", err, errors.UnbalancedEntry)
+			}
+			if !tt.wantErr && len(e.Postings) != len(tt.postings) {
+				t.Errorf("NewEntry() postings = %v, want %v", e.Postings, tt.postings)
+			}
+		})
+	}
+}
+
+func TestCheckBalances(t *testing.T) {
+	repo := NewMockRepository()
+	for _, postings := range [][]Posting{
+		Move(SystemAccount(SystemDeposits, "USD"), WalletAccount(1), "USD", decimal.NewFromFloat(100)),
+		Convert(WalletAccount(1), WalletAccount(2), "USD", decimal.NewFromFloat(50), "EUR", decimal.NewFromFloat(45)),
+		Move(WalletAccount(2), SystemAccount(SystemWithdrawals, "EUR"), "EUR", decimal.NewFromFloat(5)),
+	} {
+		e, err := NewEntry("test", postings...)
+		if err != nil {
+			t.Fatalf("NewEntry() error = %v", err)
+		}
+		if err := repo.Create(context.Background(), e); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	balances, _ := repo.Balances(context.Background())
+	if err := CheckBalances(balances); err != nil {
+		t.Errorf("CheckBalances() error = %v", err)
+	}
+	for _, b := range balances {
+		if b.Account == WalletAccount(2) && !b.Amount.Equal(decimal.NewFromFloat(40)) {
+			t.Errorf("wallet 2 balance = %v, want 40", b.Amount)
+		}
+	}
+
+	balances = append(balances, Balance{Account: WalletAccount(3), Currency: "USD", Amount: decimal.NewFromFloat(1)})
+	if err := CheckBalances(balances); !errors.Is(err, errors.UnbalancedEntry) {
+		t.Errorf("CheckBalances() error = %v, want %v", err, errors.UnbalancedEntry)
+	}
+}
+
+func TestMockRepository_RefusesUnbalanced(t *testing.T) {
+	repo := NewMockRepository()
+	e := &Entry{Postings: []Posting{
+		{Account: WalletAccount(1), Currency: "USD", Amount: decimal.NewFromFloat(-1)},
+		{Account: WalletAccount(2), Currency: "USD", Amount: decimal.NewFromFloat(2)},
+	}}
+	if err := repo.Create(context.Background(), e); !errors.Is(err, errors.UnbalancedEntry) {
+		t.Errorf("Create() error = %v, want %v", err, errors.UnbalancedEntry)
+	}
+	if balances, _ := repo.Balances(context.Background()); len(balances) != 0 {
+		t.Errorf("Balances() = %v, want none", balances)
+	}
+}
@@ -0,0 +1,66 @@
+package ledger
+
+import (
+	"context"
+	"github.com/shopspring/decimal"
+	"sort"
+)
+
+type MockRepository struct {
+	entries  []Entry
+	postings uint
+}
+
+func NewMockRepository() *MockRepository {
+	return &MockRepository{
+		entries: make([]Entry, 0),
+	}
+}
+
+func (m *MockRepository) Create(ctx context.Context, entry *Entry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+	entry.ID = uint(len(m.entries) + 1)
+	for i := range entry.Postings {
+		m.postings++
+		entry.Postings[i].ID, entry.Postings[i].EntryID = m.postings, entry.ID
+	}
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+func (m *MockRepository) ListByTransactionID(ctx context.Context, transactionID uint) ([]Entry, error) {
+	result := make([]Entry, 0)
+	for _, e := range m.entries {
+		if e.TransactionID == transactionID {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockRepository) Balances(ctx context.Context) ([]Balance, error) {
+	type key struct {
+		account  Account
+		currency string
+	}
+	sums := make(map[key]decimal.Decimal)
+	for _, e := range m.entries {
+		for _, p := range e.Postings {
+			k := key{p.Account, p.Currency}
+			sums[k] = sums[k].Add(p.Amount)
+		}
+	}
+	result := make([]Balance, 0, len(sums))
+	for k, sum := range sums {
+		result = append(result, Balance{Account: k.account, Currency: k.currency, Amount: sum})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Account != result[j].Account {
+			return result[i].Account < result[j].Account
+		}
+		return result[i].Currency < result[j].Currency
+	})
+	return result, nil
+}
@@ -0,0 +1,14 @@
+package ledger
+
+import "context"
+
+// Repository defines the repository for journal entries.
+type Repository interface {
+	// Create stores the entry with its postings and sets their ids.
+	// Returns an error if the entry is not balanced.
+	Create(ctx context.Context, entry *Entry) error
+	// ListByTransactionID lists the entries recording the transaction.
+	ListByTransactionID(ctx context.Context, transactionID uint) ([]Entry, error)
+	// Balances sums the postings of every account by currency.
+	Balances(ctx context.Context) ([]Balance, error)
+}
@@ -0,0 +1,62 @@
+package outbox
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"time"
+)
+
+type MockRepository struct {
+	events []Event
+}
+
+func NewMockRepository() *MockRepository {
+	return &MockRepository{
+		events: make([]Event, 0),
+	}
+}
+
+func (m *MockRepository) Create(ctx context.Context, events ...*Event) error {
+	for _, e := range events {
+		e.ID = uint(len(m.events) + 1)
+		if e.Status == "" {
+			e.Status, e.NextAttemptAt = StatusPending, e.CreatedAt
+		}
+		m.events = append(m.events, *e)
+	}
+	return nil
+}
+
+func (m *MockRepository) Claim(ctx context.Context, at, until time.Time, limit int) ([]Event, error) {
+	result := make([]Event, 0)
+	// wallets with an earlier pending event
+	held := make(map[uint]bool)
+	for i := range m.events {
+		e := &m.events[i]
+		if len(result) == limit {
+			break
+		}
+		if e.Status != StatusPending {
+			continue
+		}
+		if !held[e.WalletID] && !e.NextAttemptAt.After(at) {
+			e.NextAttemptAt = until
+			result = append(result, *e)
+		}
+		held[e.WalletID] = true
+	}
+	return result, nil
+}
+
+func (m *MockRepository) Update(ctx context.Context, event *Event) error {
+	if event.ID == 0 || event.ID > uint(len(m.events)) || m.events[event.ID-1].Status != StatusPending {
+		return errors.RecordNotFound
+	}
+	m.events[event.ID-1] = *event
+	return nil
+}
+
+// Events returns all the events, published or not, in order.
+func (m *MockRepository) Events() []Event {
+	return m.events
+}
@@ -0,0 +1,69 @@
+// Package outbox delivers the domain events of the wallets to downstream systems.
+//
+// The use cases write the events to the outbox in the database transaction of the change they describe,
+// so an event exists if and only if the change is committed. The relay then claims the due events for a
+// while, publishes them through a Publisher outside of any transaction and marks them published.
+// An event may be published more than once if the relay stops between publishing and marking it, or
+// outlives its claim, consumers deduplicate them by ID.
+// The events of a wallet are published in the order they were written: an event failing to publish is
+// retried after a backoff and holds back the next events of its wallet until it succeeds, or until it
+// is dead after the maximum attempts.
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Type of event, named after what happened in the past tense.
+type Type string
+
+// Status is the state of an event in the outbox.
+type Status string
+
+const (
+	// StatusPending events wait to be published
+	StatusPending Status = "pending"
+	// StatusPublished events were accepted by the publisher
+	StatusPublished Status = "published"
+	// StatusDead events failed the maximum attempts, they aren't retried nor hold back their wallet anymore
+	StatusDead Status = "dead"
+)
+
+// Event is a domain event waiting in the outbox or published.
+type Event struct {
+	ID   uint `json:"id"`
+	Type Type `json:"type"`
+	// WalletID is the wallet the event is about, events are ordered per wallet
+	WalletID uint   `json:"wallet_id"`
+	TenantID string `json:"tenant_id"`
+	// Payload is the JSON document describing the event, its schema depends on the type
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	// PublishedAt is nil while the event is pending
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	// Attempts counts the failed publications, LastError is the error of the last one
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+	// Status and NextAttemptAt are the state of the relay, not part of the published event
+	Status        Status    `json:"-"`
+	NextAttemptAt time.Time `json:"-"`
+}
+
+// NewEvent creates a pending event of the wallet with payload encoded as JSON.
+func NewEvent(eventType Type, walletID uint, tenantID string, payload any) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &Event{
+		Type:          eventType,
+		WalletID:      walletID,
+		TenantID:      tenantID,
+		Payload:       data,
+		CreatedAt:     now,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+	}, nil
+}
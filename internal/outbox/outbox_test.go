@@ -0,0 +1,26 @@
+package outbox
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewEvent(t *testing.T) {
+	e, err := NewEvent("wallet.credited", 1, "acme", map[string]int{"amount": 10})
+	if err != nil {
+		t.Fatalf("NewEvent() error = %v", err)
+	}
+	if e.Type != "wallet.credited" || e.WalletID != 1 || e.TenantID != "acme" {
+		t.Errorf("NewEvent() = %+v", e)
+	}
+	if string(e.Payload) != `{"amount":10}` {
+		t.Errorf("NewEvent() payload = %s", e.Payload)
+	}
+	if e.CreatedAt.IsZero() || e.PublishedAt != nil {
+		t.Errorf("NewEvent() created at %v, published at %v, want a pending event", e.CreatedAt, e.PublishedAt)
+	}
+
+	if _, err := NewEvent("wallet.credited", 1, "acme", json.RawMessage("{")); err == nil {
+		t.Error("NewEvent() with an invalid payload error = nil")
+	}
+}
@@ -0,0 +1,129 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultWebhookTimeout bounds a webhook request when the client has no timeout.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// Publisher delivers events to downstream systems.
+// Publish returns once the event is accepted, an error leaves the event pending.
+type Publisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+// writerPublisher writes events as JSON lines.
+type writerPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterPublisher creates a publisher writing one JSON line per event to w, such as os.Stdout.
+func NewWriterPublisher(w io.Writer) Publisher {
+	return &writerPublisher{w: w}
+}
+
+// NewFilePublisher creates a publisher appending one JSON line per event to the file at path.
+// The returned closer closes the file.
+func NewFilePublisher(path string) (Publisher, func(), error) {
+	closer := func() {}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, closer, err
+	}
+	closer = func() {
+		_ = f.Close()
+	}
+	return NewWriterPublisher(f), closer, nil
+}
+
+func (p *writerPublisher) Publish(ctx context.Context, event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.w.Write(append(line, '\n'))
+	return err
+}
+
+// WebhookOption configures the webhook publisher.
+type WebhookOption func(*webhookPublisher)
+
+// WithHTTPClient sets the client sending the webhook requests.
+func WithHTTPClient(client *http.Client) WebhookOption {
+	return func(p *webhookPublisher) {
+		p.client = client
+	}
+}
+
+// webhookPublisher posts events to an HTTP endpoint.
+type webhookPublisher struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookPublisher creates a publisher posting every event as JSON to url.
+// The event ID and type are sent in the X-Event-ID and X-Event-Type headers too,
+// any response but a 2xx fails the publication.
+func NewWebhookPublisher(url string, opts ...WebhookOption) Publisher {
+	p := &webhookPublisher{url: url, client: &http.Client{Timeout: DefaultWebhookTimeout}}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *webhookPublisher) Publish(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", strconv.FormatUint(uint64(event.ID), 10))
+	req.Header.Set("X-Event-Type", string(event.Type))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// multiPublisher publishes events to several publishers.
+type multiPublisher []Publisher
+
+// NewMultiPublisher creates a publisher publishing every event to each publisher in order.
+// It stops at the first failure, the event is then published again to all of them, so they
+// must tolerate duplicates as the outbox delivers at least once anyway.
+func NewMultiPublisher(publishers ...Publisher) Publisher {
+	return multiPublisher(publishers)
+}
+
+func (m multiPublisher) Publish(ctx context.Context, event *Event) error {
+	for _, p := range m {
+		if err := p.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testEvent(t *testing.T) *Event {
+	e, err := NewEvent("wallet.credited", 7, "default", map[string]string{"amount": "10"})
+	if err != nil {
+		t.Fatalf("NewEvent() error = %v", err)
+	}
+	e.ID = 3
+	return e
+}
+
+func TestWriterPublisher(t *testing.T) {
+	var out bytes.Buffer
+	p := NewWriterPublisher(&out)
+	e := testEvent(t)
+	for i := 0; i < 2; i++ {
+		if err := p.Publish(context.Background(), e); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Publish() wrote %d lines, want 2", len(lines))
+	}
+	var got Event
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("Publish() wrote invalid JSON: %v", err)
+	}
+	if got.ID != e.ID || got.Type != e.Type || got.WalletID != e.WalletID || string(got.Payload) != string(e.Payload) {
+		t.Errorf("Publish() wrote %+v, want %+v", got, e)
+	}
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	for i := 0; i < 2; i++ {
+		// the file is appended to, not truncated
+		p, closer, err := NewFilePublisher(path)
+		if err != nil {
+			t.Fatalf("NewFilePublisher() error = %v", err)
+		}
+		if err := p.Publish(context.Background(), testEvent(t)); err != nil {
+			t.Errorf("Publish() error = %v", err)
+		}
+		closer()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 2 {
+		t.Errorf("file has %d lines, want 2", n)
+	}
+
+	if _, closer, err := NewFilePublisher(filepath.Join(t.TempDir(), "missing", "events.jsonl")); err == nil {
+		closer()
+		t.Error("NewFilePublisher() in a missing directory error = nil")
+	}
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "accepted", status: http.StatusAccepted},
+		{name: "rejected", status: http.StatusBadRequest, wantErr: true},
+		{name: "unavailable", status: http.StatusServiceUnavailable, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			var body Event
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			e := testEvent(t)
+			err := NewWebhookPublisher(srv.URL, WithHTTPClient(srv.Client())).Publish(context.Background(), e)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Publish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got == nil {
+				t.Fatal("Publish() sent no request")
+			}
+			if got.Method != http.MethodPost || got.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("Publish() sent %s with %s", got.Method, got.Header.Get("Content-Type"))
+			}
+			if got.Header.Get("X-Event-ID") != "3" || got.Header.Get("X-Event-Type") != "wallet.credited" {
+				t.Errorf("Publish() headers = %v", got.Header)
+			}
+			if body.ID != e.ID || string(body.Payload) != string(e.Payload) {
+				t.Errorf("Publish() body = %+v, want %+v", body, e)
+			}
+		})
+	}
+
+	// unreachable endpoint
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	if err := NewWebhookPublisher(srv.URL).Publish(context.Background(), testEvent(t)); err == nil {
+		t.Error("Publish() to a closed server error = nil")
+	}
+}
+
+func TestMultiPublisher(t *testing.T) {
+	first, failing, last := &mockPublisher{}, &mockPublisher{failing: map[uint]bool{7: true}}, &mockPublisher{}
+	e := testEvent(t)
+	if err := NewMultiPublisher(first, last).Publish(context.Background(), e); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if len(first.published) != 1 || len(last.published) != 1 {
+		t.Errorf("Publish() published %v and %v, want the event to both", first.published, last.published)
+	}
+
+	// a failure stops the publication
+	if err := NewMultiPublisher(first, failing, last).Publish(context.Background(), e); err == nil {
+		t.Error("Publish() error = nil, want the failure")
+	}
+	if len(first.published) != 2 || len(last.published) != 1 {
+		t.Errorf("Publish() published %v and %v after a failure, want the event to the first only", first.published, last.published)
+	}
+}
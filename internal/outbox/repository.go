@@ -0,0 +1,20 @@
+package outbox
+
+import (
+	"context"
+	"time"
+)
+
+// Repository defines the repository for outbox events.
+type Repository interface {
+	// Create stores the events in order and sets their ids, it must run in the transaction of the change.
+	Create(ctx context.Context, events ...*Event) error
+	// Claim reserves up to limit events due at the given time to the relay until the given time,
+	// and returns them in the order they were created. Only the first pending event of a wallet is due,
+	// so the events of a wallet are claimed one at a time in order. Claim commits on its own,
+	// events being claimed by a concurrent relay are skipped rather than waited for.
+	Claim(ctx context.Context, at, until time.Time, limit int) ([]Event, error)
+	// Update records the outcome of a publication: the status, publication time, attempts, last error
+	// and next attempt of the event. Fails with RecordNotFound if the event isn't pending anymore.
+	Update(ctx context.Context, event *Event) error
+}
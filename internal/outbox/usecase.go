@@ -0,0 +1,160 @@
+package outbox
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
+	"time"
+)
+
+// Defaults of the relay and its retry policy.
+const (
+	// DefaultBatchSize is how many events Relay claims at a time when no batch size is configured
+	DefaultBatchSize      = 100
+	DefaultMaxAttempts    = 10
+	DefaultInitialBackoff = 10 * time.Second
+	DefaultMaxBackoff     = time.Hour
+	// DefaultClaimTimeout is how long claimed events are reserved to a relay when no timeout is configured
+	DefaultClaimTimeout = 5 * time.Minute
+)
+
+// UseCase defines use cases for the outbox.
+type UseCase interface {
+	// Relay publishes the due events, claiming a batch at a time, and marks them published.
+	// An event failing to publish is retried after a backoff, and the next events of its wallet wait for it,
+	// so the events of a wallet are never published out of order. It is dead after the maximum attempts.
+	// Returns the number of published events, or an error if the outbox can't be read or updated.
+	Relay(ctx context.Context) (int, error)
+}
+
+// RetryPolicy schedules the attempts of a publication.
+// The backoff doubles after every failure, from InitialBackoff up to MaxBackoff.
+type RetryPolicy struct {
+	// MaxAttempts is how many attempts fail before the publication is dead
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Backoff returns how long to wait after the given number of failed attempts.
+func (p RetryPolicy) Backoff(failures int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < failures && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, p.MaxBackoff)
+}
+
+// Option configures the use case.
+type Option func(*useCase)
+
+// WithBatchSize sets how many events Relay claims at a time, DefaultBatchSize by default.
+func WithBatchSize(size int) Option {
+	return func(u *useCase) {
+		if size > 0 {
+			u.batchSize = size
+		}
+	}
+}
+
+// WithRetryPolicy sets the retry policy, zero fields keep their default.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(u *useCase) {
+		if p.MaxAttempts > 0 {
+			u.retry.MaxAttempts = p.MaxAttempts
+		}
+		if p.InitialBackoff > 0 {
+			u.retry.InitialBackoff = p.InitialBackoff
+		}
+		if p.MaxBackoff > 0 {
+			u.retry.MaxBackoff = p.MaxBackoff
+		}
+	}
+}
+
+// WithClaimTimeout sets how long claimed events are reserved to the relay, DefaultClaimTimeout by default.
+// Events still pending after it, because the relay stopped, are claimed again.
+func WithClaimTimeout(d time.Duration) Option {
+	return func(u *useCase) {
+		if d > 0 {
+			u.claimTimeout = d
+		}
+	}
+}
+
+// useCase implements UseCase.
+type useCase struct {
+	repo         Repository
+	publisher    Publisher
+	batchSize    int
+	retry        RetryPolicy
+	claimTimeout time.Duration
+	now          func() time.Time
+}
+
+func NewUseCase(repo Repository, publisher Publisher, opts ...Option) UseCase {
+	u := &useCase{
+		repo:      repo,
+		publisher: publisher,
+		batchSize: DefaultBatchSize,
+		retry: RetryPolicy{
+			MaxAttempts:    DefaultMaxAttempts,
+			InitialBackoff: DefaultInitialBackoff,
+			MaxBackoff:     DefaultMaxBackoff,
+		},
+		claimTimeout: DefaultClaimTimeout,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+func (u *useCase) Relay(ctx context.Context) (int, error) {
+	var published int
+	// every batch claims the next event of the wallets whose previous one was published
+	for ctx.Err() == nil {
+		now := u.now()
+		events, err := u.repo.Claim(ctx, now, now.Add(u.claimTimeout), u.batchSize)
+		if err != nil || len(events) == 0 {
+			return published, err
+		}
+		for i := range events {
+			e := &events[i]
+			u.publish(ctx, e)
+			err := u.repo.Update(ctx, e)
+			if errors.Is(err, errors.RecordNotFound) {
+				// the claim timed out and another relay published it
+				continue
+			}
+			if err != nil {
+				return published, err
+			}
+			if e.Status == StatusPublished {
+				published++
+			}
+		}
+	}
+	return published, ctx.Err()
+}
+
+// publish publishes the event and records the outcome in it.
+func (u *useCase) publish(ctx context.Context, e *Event) {
+	err := u.publisher.Publish(ctx, e)
+	now := u.now()
+	if err == nil {
+		e.Status, e.PublishedAt, e.LastError = StatusPublished, &now, ""
+		return
+	}
+	e.Attempts++
+	e.LastError = err.Error()
+	if e.Attempts >= u.retry.MaxAttempts {
+		log.FromContext(ctx).Warnf("event %d (%s) of wallet %d is dead after %d attempts: %v",
+			e.ID, e.Type, e.WalletID, e.Attempts, err)
+		e.Status = StatusDead
+		return
+	}
+	log.FromContext(ctx).Warnf("failed to publish event %d (%s) of wallet %d: %v", e.ID, e.Type, e.WalletID, err)
+	e.NextAttemptAt = now.Add(u.retry.Backoff(e.Attempts))
+}
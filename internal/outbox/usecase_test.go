@@ -0,0 +1,193 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mockPublisher records the published events and fails those of the failing wallets
+type mockPublisher struct {
+	published []uint
+	failing   map[uint]bool
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, event *Event) error {
+	if m.failing[event.WalletID] {
+		return fmt.Errorf("wallet %d is unreachable", event.WalletID)
+	}
+	m.published = append(m.published, event.ID)
+	return nil
+}
+
+func setupTest(t *testing.T, walletIDs ...uint) *MockRepository {
+	repo := NewMockRepository()
+	for _, id := range walletIDs {
+		e, err := NewEvent("wallet.credited", id, "default", nil)
+		if err != nil {
+			t.Fatalf("NewEvent() error = %v", err)
+		}
+		if err := repo.Create(context.Background(), e); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+	return repo
+}
+
+func TestUseCase_Relay(t *testing.T) {
+	tests := []struct {
+		name          string
+		walletIDs     []uint
+		failing       map[uint]bool
+		batchSize     int
+		wantPublished []uint
+		wantPending   []uint
+	}{
+		{
+			name:          "publishes in order",
+			walletIDs:     []uint{1, 2, 1},
+			wantPublished: []uint{1, 2, 3},
+		},
+		{
+			name:      "nothing pending",
+			walletIDs: nil,
+		},
+		{
+			name:          "claims a batch at a time",
+			walletIDs:     []uint{1, 2, 1},
+			batchSize:     1,
+			wantPublished: []uint{1, 2, 3},
+		},
+		{
+			name:          "failure holds back the next events of the wallet",
+			walletIDs:     []uint{1, 2, 1, 3},
+			failing:       map[uint]bool{1: true},
+			wantPublished: []uint{2, 4},
+			wantPending:   []uint{1, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := setupTest(t, tt.walletIDs...)
+			publisher := &mockPublisher{failing: tt.failing}
+			uc := NewUseCase(repo, publisher, WithBatchSize(tt.batchSize))
+
+			n, err := uc.Relay(ctx)
+			if err != nil {
+				t.Fatalf("Relay() error = %v", err)
+			}
+			if n != len(tt.wantPublished) || !reflect.DeepEqual(publisher.published, tt.wantPublished) {
+				t.Errorf("Relay() published %d: %v, want %v", n, publisher.published, tt.wantPublished)
+			}
+			var pending []uint
+			for _, e := range repo.Events() {
+				if e.PublishedAt == nil {
+					pending = append(pending, e.ID)
+				}
+			}
+			if !reflect.DeepEqual(pending, tt.wantPending) {
+				t.Errorf("Relay() pending = %v, want %v", pending, tt.wantPending)
+			}
+		})
+	}
+}
+
+func TestUseCase_RelayRetries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo := setupTest(t, 1, 1, 2)
+	publisher := &mockPublisher{failing: map[uint]bool{1: true}}
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+	uc := NewUseCase(repo, publisher, WithRetryPolicy(policy)).(*useCase)
+	uc.now = func() time.Time { return now }
+	for i := range repo.events {
+		repo.events[i].NextAttemptAt = now
+	}
+
+	relay := func(wantPublished int) {
+		t.Helper()
+		n, err := uc.Relay(ctx)
+		if err != nil || n != wantPublished {
+			t.Fatalf("Relay() = %d, %v, want %d", n, err, wantPublished)
+		}
+	}
+	relay(1)
+	// the failed event waits for its backoff, and the next event of its wallet for it
+	events := repo.Events()
+	if events[0].Attempts != 1 || events[0].LastError != "wallet 1 is unreachable" || !events[0].NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Relay() failed event = %+v, want a retry in a minute", events[0])
+	}
+	if events[1].Attempts != 0 || events[1].Status != StatusPending {
+		t.Errorf("Relay() attempted the next event of the wallet: %+v", events[1])
+	}
+	relay(0)
+	if events[0].Attempts != 1 {
+		t.Errorf("Relay() attempted the event before its backoff")
+	}
+
+	// once due again the event is retried, then the next event of its wallet is published
+	now = now.Add(time.Minute)
+	publisher.failing = nil
+	relay(2)
+	if events[0].Status != StatusPublished || events[1].Status != StatusPublished {
+		t.Errorf("Relay() after recovery = %s and %s, want published", events[0].Status, events[1].Status)
+	}
+	if !reflect.DeepEqual(publisher.published, []uint{3, 1, 2}) {
+		t.Errorf("Relay() published %v, want [3 1 2]", publisher.published)
+	}
+}
+
+func TestUseCase_RelayDead(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo := setupTest(t, 1, 1)
+	publisher := &mockPublisher{failing: map[uint]bool{1: true}}
+	policy := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+	uc := NewUseCase(repo, publisher, WithRetryPolicy(policy)).(*useCase)
+	uc.now = func() time.Time { return now }
+	for i := range repo.events {
+		repo.events[i].NextAttemptAt = now
+	}
+
+	for i := 0; i < policy.MaxAttempts; i++ {
+		if _, err := uc.Relay(ctx); err != nil {
+			t.Fatalf("Relay() error = %v", err)
+		}
+		now = now.Add(policy.Backoff(i + 1))
+	}
+	// both events of the wallet failed their attempts in order
+	events := repo.Events()
+	if events[0].Status != StatusDead || events[0].Attempts != 2 {
+		t.Errorf("Relay() first event = %s after %d attempts, want dead after 2", events[0].Status, events[0].Attempts)
+	}
+	if events[1].Status != StatusPending || events[1].Attempts != 1 {
+		t.Errorf("Relay() next event = %s after %d attempts, want pending after 1", events[1].Status, events[1].Attempts)
+	}
+}
+
+func TestUseCase_RelayClaimed(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTest(t, 1)
+	now := time.Now()
+	// another relay claimed the event
+	if _, err := repo.Claim(ctx, now, now.Add(time.Minute), 10); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	publisher := &mockPublisher{}
+	if n, err := NewUseCase(repo, publisher).Relay(ctx); err != nil || n != 0 || len(publisher.published) != 0 {
+		t.Errorf("Relay() = %d, %v, published %v, want the claimed event skipped", n, err, publisher.published)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Minute, MaxBackoff: 5 * time.Minute}
+	for failures, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 4 * time.Minute, 4: 5 * time.Minute, 10: 5 * time.Minute} {
+		if got := p.Backoff(failures); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
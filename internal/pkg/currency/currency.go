@@ -0,0 +1,60 @@
+package currency
+
+import (
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"strings"
+)
+
+// MaxMinorUnits is the highest precision the database can store.
+const MaxMinorUnits = 4
+
+// Currency is an ISO-4217 currency.
+type Currency struct {
+	Code       string
+	MinorUnits int32
+}
+
+var currencies = map[string]Currency{
+	"AUD": {Code: "AUD", MinorUnits: 2},
+	"BHD": {Code: "BHD", MinorUnits: 3},
+	"CAD": {Code: "CAD", MinorUnits: 2},
+	"CHF": {Code: "CHF", MinorUnits: 2},
+	"CLF": {Code: "CLF", MinorUnits: 4},
+	"CNY": {Code: "CNY", MinorUnits: 2},
+	"EUR": {Code: "EUR", MinorUnits: 2},
+	"GBP": {Code: "GBP", MinorUnits: 2},
+	"HKD": {Code: "HKD", MinorUnits: 2},
+	"INR": {Code: "INR", MinorUnits: 2},
+	"JOD": {Code: "JOD", MinorUnits: 3},
+	"JPY": {Code: "JPY", MinorUnits: 0},
+	"KRW": {Code: "KRW", MinorUnits: 0},
+	"KWD": {Code: "KWD", MinorUnits: 3},
+	"OMR": {Code: "OMR", MinorUnits: 3},
+	"SGD": {Code: "SGD", MinorUnits: 2},
+	"TND": {Code: "TND", MinorUnits: 3},
+	"USD": {Code: "USD", MinorUnits: 2},
+}
+
+// Lookup finds the currency by its ISO-4217 code, case-insensitively.
+func Lookup(code string) (Currency, error) {
+	c, ok := currencies[strings.ToUpper(code)]
+	if !ok {
+		return Currency{}, errors.UnsupportedCurrency.WithCause(fmt.Errorf("unknown currency code: %q", code))
+	}
+	return c, nil
+}
+
+// Round rounds the amount to the minor units of the currency.
+func (c Currency) Round(amount decimal.Decimal) decimal.Decimal {
+	return amount.Round(c.MinorUnits)
+}
+
+// Validate checks that the amount has no more decimal places than the minor units of the currency.
+func (c Currency) Validate(amount decimal.Decimal) error {
+	if !amount.Equal(c.Round(amount)) {
+		return errors.InvalidAmountPrecision.WithCause(fmt.Errorf("%s allows %d decimal places: %v", c.Code, c.MinorUnits, amount))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package currency
+
+import (
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		want    Currency
+		wantErr bool
+	}{
+		{"upper case", "USD", Currency{Code: "USD", MinorUnits: 2}, false},
+		{"lower case", "jpy", Currency{Code: "JPY", MinorUnits: 0}, false},
+		{"three minor units", "KWD", Currency{Code: "KWD", MinorUnits: 3}, false},
+		{"unknown", "XXX", Currency{}, true},
+		{"empty", "", Currency{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Lookup(tt.code)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Lookup() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Lookup() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrenciesFitDatabase(t *testing.T) {
+	for code, c := range currencies {
+		if c.Code != code || c.MinorUnits > MaxMinorUnits {
+			t.Errorf("invalid currency %s: %+v", code, c)
+		}
+	}
+}
+
+func TestCurrency_Round(t *testing.T) {
+	tests := []struct {
+		code   string
+		amount string
+		want   string
+	}{
+		{"USD", "10.005", "10.01"},
+		{"USD", "10.004", "10"},
+		{"JPY", "100.5", "101"},
+		{"KWD", "1.23456", "1.235"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code+" "+tt.amount, func(t *testing.T) {
+			c, _ := Lookup(tt.code)
+			if got := c.Round(decimal.RequireFromString(tt.amount)); got.String() != tt.want {
+				t.Errorf("Round() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrency_Validate(t *testing.T) {
+	tests := []struct {
+		code    string
+		amount  string
+		wantErr bool
+	}{
+		{"USD", "10.01", false},
+		{"USD", "10.10", false},
+		{"USD", "10.001", true},
+		{"JPY", "100", false},
+		{"JPY", "100.5", true},
+		{"KWD", "1.234", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code+" "+tt.amount, func(t *testing.T) {
+			c, _ := Lookup(tt.code)
+			err := c.Validate(decimal.RequireFromString(tt.amount))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errors.InvalidAmountPrecision) {
+				t.Errorf("Validate() error = %v, want %v", err, errors.InvalidAmountPrecision)
+			}
+		})
+	}
+}
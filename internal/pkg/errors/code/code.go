@@ -1,7 +1,15 @@
 package code
 
 const (
-	InvalidArgs    = 400
-	NotFound       = 404
-	InternalServer = 500
+	InvalidArgs         = 400
+	Unauthorized        = 401
+	Forbidden           = 403
+	NotFound            = 404
+	MethodNotAllowed    = 405
+	Conflict            = 409
+	Gone                = 410
+	PayloadTooLarge     = 413
+	UnprocessableEntity = 422
+	Locked              = 423
+	InternalServer      = 500
 )
@@ -6,17 +6,50 @@ import (
 )
 
 var (
-	InvalidArgs         = New(code.InvalidArgs, "invalid arguments")
-	InsufficientBalance = New(code.InvalidArgs, "insufficient balance")
-	RecordNotFound      = New(code.NotFound, "record not found")
-	InternalDB          = New(code.InternalServer, "database unknown error")
-	InternalServer      = New(code.InternalServer, "internal server error")
+	InvalidArgs            = New(code.InvalidArgs, "INVALID_ARGUMENT", "invalid arguments")
+	RequestTooLarge        = New(code.PayloadTooLarge, "REQUEST_TOO_LARGE", "request body is too large")
+	Unauthenticated        = New(code.Unauthorized, "UNAUTHENTICATED", "missing or invalid credentials")
+	Forbidden              = New(code.Forbidden, "FORBIDDEN", "not allowed to perform this action")
+	CrossTenantTransfer    = New(code.Forbidden, "CROSS_TENANT_TRANSFER", "wallets belong to different tenants")
+	APIKeyNotFound         = New(code.NotFound, "API_KEY_NOT_FOUND", "api key not found")
+	APIKeyRevoked          = New(code.Gone, "API_KEY_REVOKED", "api key is revoked")
+	InsufficientBalance    = New(code.UnprocessableEntity, "INSUFFICIENT_BALANCE", "insufficient balance")
+	RecordNotFound         = New(code.NotFound, "NOT_FOUND", "record not found")
+	RouteNotFound          = New(code.NotFound, "ROUTE_NOT_FOUND", "no route matches the path")
+	MethodNotAllowed       = New(code.MethodNotAllowed, "METHOD_NOT_ALLOWED", "method not allowed on the route")
+	WalletNotFound         = New(code.NotFound, "WALLET_NOT_FOUND", "wallet not found")
+	WalletFrozen           = New(code.Locked, "WALLET_FROZEN", "wallet is frozen")
+	WalletClosed           = New(code.Gone, "WALLET_CLOSED", "wallet is closed")
+	WalletNotEmpty         = New(code.Conflict, "WALLET_NOT_EMPTY", "wallet balance is not zero")
+	InvalidWalletStatus    = New(code.Conflict, "INVALID_WALLET_STATUS", "invalid wallet status transition")
+	DuplicateRecord        = New(code.Conflict, "DUPLICATE_RECORD", "record already exists")
+	IdempotencyKeyReuse    = New(code.Conflict, "IDEMPOTENCY_KEY_REUSED", "idempotency key reused with a different request")
+	UnsupportedCurrency    = New(code.InvalidArgs, "UNSUPPORTED_CURRENCY", "unsupported currency")
+	InvalidAmountPrecision = New(code.InvalidArgs, "INVALID_AMOUNT_PRECISION", "amount exceeds currency precision")
+	CurrencyMismatch       = New(code.InvalidArgs, "CURRENCY_MISMATCH", "currency mismatch")
+	InvalidRate            = New(code.InvalidArgs, "INVALID_RATE", "invalid exchange rate")
+	RateNotFound           = New(code.NotFound, "RATE_NOT_FOUND", "exchange rate not found")
+	QuoteMismatch          = New(code.InvalidArgs, "QUOTE_MISMATCH", "quote does not match the transfer")
+	QuoteExpired           = New(code.Gone, "QUOTE_EXPIRED", "quote expired")
+	QuoteUsed              = New(code.Conflict, "QUOTE_USED", "quote already used")
+	InvalidHoldStatus      = New(code.Conflict, "INVALID_HOLD_STATUS", "hold is not authorized")
+	HoldExpired            = New(code.Gone, "HOLD_EXPIRED", "hold expired")
+	CaptureExceedsHold     = New(code.InvalidArgs, "CAPTURE_EXCEEDS_HOLD", "capture amount exceeds hold")
+	NotReversible          = New(code.InvalidArgs, "NOT_REVERSIBLE", "transaction can't be reversed")
+	TransactionReversed    = New(code.Conflict, "TRANSACTION_REVERSED", "transaction already reversed")
+	ReversalExceedsAmount  = New(code.InvalidArgs, "REVERSAL_EXCEEDS_AMOUNT", "reversal amount exceeds the unreversed amount")
+	WebhookNotFound        = New(code.NotFound, "WEBHOOK_NOT_FOUND", "webhook not found")
+	UnbalancedEntry        = New(code.InternalServer, "UNBALANCED_ENTRY", "unbalanced journal entry")
+	ConcurrentUpdate       = New(code.Conflict, "CONFLICT", "wallet was updated concurrently, please retry")
+	InternalDB             = New(code.InternalServer, "DATABASE_ERROR", "database unknown error")
+	InternalServer         = New(code.InternalServer, "INTERNAL", "internal server error")
 )
 
-func New(code int, message string) *Error {
+func New(code int, reason, message string) *Error {
 	return &Error{
 		Status: Status{
 			Code:    code,
+			Reason:  reason,
 			Message: message,
 		},
 	}
@@ -32,6 +65,21 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("error: message = %s  cause = %v", e.Message, e.cause)
 }
 
+// Is reports whether target is an *Error with the same code and reason,
+// so errors created by WithCause or WithMetadata still match the predefined error.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return t.Code == e.Code && t.Reason == e.Reason
+}
+
+// Unwrap returns the underlying cause of the error.
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
 // WithCause with the underlying cause of the error.
 func (e *Error) WithCause(cause error) *Error {
 	err := Clone(e)
@@ -39,13 +87,29 @@ func (e *Error) WithCause(cause error) *Error {
 	return err
 }
 
+// WithMetadata with the details of the error.
+func (e *Error) WithMetadata(md map[string]string) *Error {
+	err := Clone(e)
+	err.Metadata = md
+	return err
+}
+
 // Clone deep clone error to a new error.
 func Clone(err *Error) *Error {
+	var metadata map[string]string
+	if err.Metadata != nil {
+		metadata = make(map[string]string, len(err.Metadata))
+		for k, v := range err.Metadata {
+			metadata[k] = v
+		}
+	}
 	return &Error{
 		cause: err.cause,
 		Status: Status{
-			Code:    err.Code,
-			Message: err.Message,
+			Code:     err.Code,
+			Reason:   err.Reason,
+			Message:  err.Message,
+			Metadata: metadata,
 		},
 	}
 }
@@ -10,16 +10,19 @@ func TestNew(t *testing.T) {
 	tests := []struct {
 		name    string
 		code    int
+		reason  string
 		message string
 		want    *Error
 	}{
 		{
 			name:    "create new error",
 			code:    code.InvalidArgs,
+			reason:  "TEST",
 			message: "test error",
 			want: &Error{
 				Status: Status{
 					Code:    code.InvalidArgs,
+					Reason:  "TEST",
 					Message: "test error",
 				},
 			},
@@ -27,10 +30,12 @@ func TestNew(t *testing.T) {
 		{
 			name:    "create error with empty message",
 			code:    code.InternalServer,
+			reason:  "TEST",
 			message: "",
 			want: &Error{
 				Status: Status{
 					Code:    code.InternalServer,
+					Reason:  "TEST",
 					Message: "",
 				},
 			},
@@ -39,8 +44,8 @@ func TestNew(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := New(tt.code, tt.message)
-			if got.Code != tt.want.Code || got.Message != tt.want.Message {
+			got := New(tt.code, tt.reason, tt.message)
+			if got.Code != tt.want.Code || got.Reason != tt.want.Reason || got.Message != tt.want.Message {
 				t.Errorf("New() = %v, want %v", got, tt.want)
 			}
 		})
@@ -56,12 +61,12 @@ func TestError_Error(t *testing.T) {
 	}{
 		{
 			name:    "error without cause",
-			err:     New(code.InvalidArgs, "test error"),
+			err:     New(code.InvalidArgs, "TEST", "test error"),
 			wantStr: "error: message = test error  cause = <nil>",
 		},
 		{
 			name:    "error with cause",
-			err:     New(code.InvalidArgs, "test error").WithCause(fmt.Errorf("underlying error")),
+			err:     New(code.InvalidArgs, "TEST", "test error").WithCause(fmt.Errorf("underlying error")),
 			wantStr: "error: message = test error  cause = underlying error",
 		},
 	}
@@ -83,11 +88,11 @@ func TestError_WithCause(t *testing.T) {
 	}{
 		{
 			name: "add cause to error",
-			err:  New(code.InvalidArgs, "test error"),
+			err:  New(code.InvalidArgs, "TEST", "test error"),
 		},
 		{
 			name: "override existing cause",
-			err:  New(code.InternalServer, "test error").WithCause(fmt.Errorf("old cause")),
+			err:  New(code.InternalServer, "TEST", "test error").WithCause(fmt.Errorf("old cause")),
 		},
 	}
 
@@ -104,6 +109,73 @@ func TestError_WithCause(t *testing.T) {
 	}
 }
 
+func TestError_Is(t *testing.T) {
+	cause := fmt.Errorf("test cause")
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{
+			name:   "same error",
+			err:    RecordNotFound,
+			target: RecordNotFound,
+			want:   true,
+		},
+		{
+			name:   "error with cause",
+			err:    RecordNotFound.WithCause(cause),
+			target: RecordNotFound,
+			want:   true,
+		},
+		{
+			name:   "wrapped error with cause",
+			err:    fmt.Errorf("wrap: %w", RecordNotFound.WithCause(cause)),
+			target: RecordNotFound,
+			want:   true,
+		},
+		{
+			name:   "different message",
+			err:    InsufficientBalance,
+			target: InvalidArgs,
+			want:   false,
+		},
+		{
+			name:   "error with metadata",
+			err:    InvalidArgs.WithMetadata(map[string]string{"amount": "required"}),
+			target: InvalidArgs,
+			want:   true,
+		},
+		{
+			name:   "same code different reason",
+			err:    InsufficientBalance,
+			target: InvalidArgs,
+			want:   false,
+		},
+		{
+			name:   "wallet not found is a record not found",
+			err:    WalletNotFound.WithCause(RecordNotFound),
+			target: RecordNotFound,
+			want:   true,
+		},
+		{
+			name:   "underlying cause",
+			err:    InternalDB.WithCause(cause),
+			target: cause,
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("Is() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestClone(t *testing.T) {
 	tests := []struct {
 		name string
@@ -111,11 +183,11 @@ func TestClone(t *testing.T) {
 	}{
 		{
 			name: "clone error without cause",
-			err:  New(code.InvalidArgs, "test error"),
+			err:  New(code.InvalidArgs, "TEST", "test error"),
 		},
 		{
 			name: "clone error with cause",
-			err:  New(code.InternalServer, "test error").WithCause(fmt.Errorf("test cause")),
+			err:  New(code.InternalServer, "TEST", "test error").WithCause(fmt.Errorf("test cause")),
 		},
 	}
 
@@ -134,10 +206,50 @@ func TestClone(t *testing.T) {
 			if got.cause != tt.err.cause {
 				t.Errorf("Clone() cause = %v, want %v", got.cause, tt.err.cause)
 			}
+			if got.Reason != tt.err.Reason {
+				t.Errorf("Clone() reason = %v, want %v", got.Reason, tt.err.Reason)
+			}
 		})
 	}
 }
 
+func TestError_WithMetadata(t *testing.T) {
+	md := map[string]string{"amount": "required"}
+	err := InvalidArgs.WithMetadata(md)
+	if InvalidArgs.Metadata != nil {
+		t.Errorf("WithMetadata() changed the predefined error: %v", InvalidArgs.Metadata)
+	}
+	if err.Metadata["amount"] != "required" {
+		t.Errorf("WithMetadata() metadata = %v, want %v", err.Metadata, md)
+	}
+
+	// clones don't share the metadata
+	clone := Clone(err)
+	clone.Metadata["amount"] = "changed"
+	if err.Metadata["amount"] != "required" {
+		t.Errorf("Clone() shares metadata with the original: %v", err.Metadata)
+	}
+}
+
+func TestPredefinedReasons(t *testing.T) {
+	predefined := []*Error{
+		InvalidArgs, RequestTooLarge, Unauthenticated, Forbidden, CrossTenantTransfer, APIKeyNotFound, APIKeyRevoked, InsufficientBalance, RecordNotFound,
+		RouteNotFound, MethodNotAllowed, WalletNotFound, WalletFrozen, WalletClosed,
+		WalletNotEmpty, InvalidWalletStatus, DuplicateRecord, IdempotencyKeyReuse, UnsupportedCurrency,
+		InvalidAmountPrecision, CurrencyMismatch, InvalidRate, RateNotFound, QuoteMismatch, QuoteExpired,
+		QuoteUsed, InvalidHoldStatus, HoldExpired, CaptureExceedsHold, NotReversible, TransactionReversed,
+		ReversalExceedsAmount, WebhookNotFound, UnbalancedEntry, ConcurrentUpdate, InternalDB, InternalServer,
+	}
+	// the reason tells the predefined errors apart, clients rely on it
+	seen := make(map[string]bool, len(predefined))
+	for _, err := range predefined {
+		if err.Reason == "" || seen[err.Reason] {
+			t.Errorf("%s has an empty or duplicate reason %q", err.Message, err.Reason)
+		}
+		seen[err.Reason] = true
+	}
+}
+
 func TestPredefinedErrors(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -149,16 +261,176 @@ func TestPredefinedErrors(t *testing.T) {
 			err:      InvalidArgs,
 			wantCode: code.InvalidArgs,
 		},
+		{
+			name:     "RequestTooLarge error",
+			err:      RequestTooLarge,
+			wantCode: code.PayloadTooLarge,
+		},
+		{
+			name:     "Unauthenticated error",
+			err:      Unauthenticated,
+			wantCode: code.Unauthorized,
+		},
+		{
+			name:     "Forbidden error",
+			err:      Forbidden,
+			wantCode: code.Forbidden,
+		},
+		{
+			name:     "CrossTenantTransfer error",
+			err:      CrossTenantTransfer,
+			wantCode: code.Forbidden,
+		},
+		{
+			name:     "APIKeyNotFound error",
+			err:      APIKeyNotFound,
+			wantCode: code.NotFound,
+		},
+		{
+			name:     "APIKeyRevoked error",
+			err:      APIKeyRevoked,
+			wantCode: code.Gone,
+		},
 		{
 			name:     "InsufficientBalance error",
 			err:      InsufficientBalance,
-			wantCode: code.InvalidArgs,
+			wantCode: code.UnprocessableEntity,
 		},
 		{
 			name:     "RecordNotFound error",
 			err:      RecordNotFound,
 			wantCode: code.NotFound,
 		},
+		{
+			name:     "RouteNotFound error",
+			err:      RouteNotFound,
+			wantCode: code.NotFound,
+		},
+		{
+			name:     "MethodNotAllowed error",
+			err:      MethodNotAllowed,
+			wantCode: code.MethodNotAllowed,
+		},
+		{
+			name:     "WalletNotFound error",
+			err:      WalletNotFound,
+			wantCode: code.NotFound,
+		},
+		{
+			name:     "WalletFrozen error",
+			err:      WalletFrozen,
+			wantCode: code.Locked,
+		},
+		{
+			name:     "WalletClosed error",
+			err:      WalletClosed,
+			wantCode: code.Gone,
+		},
+		{
+			name:     "WalletNotEmpty error",
+			err:      WalletNotEmpty,
+			wantCode: code.Conflict,
+		},
+		{
+			name:     "InvalidWalletStatus error",
+			err:      InvalidWalletStatus,
+			wantCode: code.Conflict,
+		},
+		{
+			name:     "DuplicateRecord error",
+			err:      DuplicateRecord,
+			wantCode: code.Conflict,
+		},
+		{
+			name:     "IdempotencyKeyReuse error",
+			err:      IdempotencyKeyReuse,
+			wantCode: code.Conflict,
+		},
+		{
+			name:     "UnsupportedCurrency error",
+			err:      UnsupportedCurrency,
+			wantCode: code.InvalidArgs,
+		},
+		{
+			name:     "InvalidAmountPrecision error",
+			err:      InvalidAmountPrecision,
+			wantCode: code.InvalidArgs,
+		},
+		{
+			name:     "CurrencyMismatch error",
+			err:      CurrencyMismatch,
+			wantCode: code.InvalidArgs,
+		},
+		{
+			name:     "InvalidRate error",
+			err:      InvalidRate,
+			wantCode: code.InvalidArgs,
+		},
+		{
+			name:     "RateNotFound error",
+			err:      RateNotFound,
+			wantCode: code.NotFound,
+		},
+		{
+			name:     "QuoteMismatch error",
+			err:      QuoteMismatch,
+			wantCode: code.InvalidArgs,
+		},
+		{
+			name:     "QuoteExpired error",
+			err:      QuoteExpired,
+			wantCode: code.Gone,
+		},
+		{
+			name:     "QuoteUsed error",
+			err:      QuoteUsed,
+			wantCode: code.Conflict,
+		},
+		{
+			name:     "InvalidHoldStatus error",
+			err:      InvalidHoldStatus,
+			wantCode: code.Conflict,
+		},
+		{
+			name:     "HoldExpired error",
+			err:      HoldExpired,
+			wantCode: code.Gone,
+		},
+		{
+			name:     "CaptureExceedsHold error",
+			err:      CaptureExceedsHold,
+			wantCode: code.InvalidArgs,
+		},
+		{
+			name:     "NotReversible error",
+			err:      NotReversible,
+			wantCode: code.InvalidArgs,
+		},
+		{
+			name:     "TransactionReversed error",
+			err:      TransactionReversed,
+			wantCode: code.Conflict,
+		},
+		{
+			name:     "ReversalExceedsAmount error",
+			err:      ReversalExceedsAmount,
+			wantCode: code.InvalidArgs,
+		},
+		{
+			name:     "WebhookNotFound error",
+			err:      WebhookNotFound,
+			wantCode: code.NotFound,
+		},
+		{
+			name:     "UnbalancedEntry error",
+			err:      UnbalancedEntry,
+			wantCode: code.InternalServer,
+		},
+		{
+			name:     "ConcurrentUpdate error",
+			err:      ConcurrentUpdate,
+			wantCode: code.Conflict,
+		},
 		{
 			name:     "InternalDB error",
 			err:      InternalDB,
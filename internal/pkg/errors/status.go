@@ -1,6 +1,11 @@
 package errors
 
 type Status struct {
-	Code    int
+	// Code is the HTTP status of the error
+	Code int
+	// Reason is the stable application error code clients can rely on, e.g. INSUFFICIENT_BALANCE
+	Reason  string
 	Message string
+	// Metadata holds optional details of the error, e.g. the invalid fields of a request
+	Metadata map[string]string
 }
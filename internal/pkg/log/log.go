@@ -0,0 +1,53 @@
+// Package log carries the logger of a request in its context.
+// The entry holds the fields correlating the lines of a request, such as its ID,
+// the use cases and repositories log through it so their lines can be tied back to the request.
+// A context without logger comes from the service itself and logs through the standard logger.
+package log
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+)
+
+type entryKey struct{}
+
+// NewContext returns a copy of ctx carrying the entry.
+func NewContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, entry)
+}
+
+// FromContext returns the entry of ctx, or an entry of the standard logger if it has none.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(entryKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// WithFields returns a copy of ctx whose entry has the fields too.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	return NewContext(ctx, FromContext(ctx).WithFields(fields))
+}
+
+// Setup configures the standard logger, level is a logrus level and format json or text.
+// Empty values keep info and json.
+func Setup(level, format string) error {
+	lvl := logrus.InfoLevel
+	if level != "" {
+		var err error
+		if lvl, err = logrus.ParseLevel(level); err != nil {
+			return err
+		}
+	}
+	switch format {
+	case "", "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	case "text":
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	default:
+		return fmt.Errorf("unknown log format %q, want json or text", format)
+	}
+	logrus.SetLevel(lvl)
+	return nil
+}
@@ -0,0 +1,54 @@
+package log
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if entry := FromContext(ctx); entry.Logger != logrus.StandardLogger() || len(entry.Data) != 0 {
+		t.Errorf("FromContext() = %v, want an entry of the standard logger", entry.Data)
+	}
+
+	ctx = NewContext(ctx, logrus.WithField("request_id", "abc"))
+	ctx = WithFields(ctx, logrus.Fields{"key_id": "k1"})
+	entry := FromContext(ctx)
+	if entry.Data["request_id"] != "abc" || entry.Data["key_id"] != "k1" {
+		t.Errorf("FromContext() = %v, want request_id and key_id", entry.Data)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	defer func() {
+		logrus.SetLevel(logrus.InfoLevel)
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	}()
+
+	if err := Setup("debug", "text"); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if logrus.GetLevel() != logrus.DebugLevel {
+		t.Errorf("level = %s, want debug", logrus.GetLevel())
+	}
+	if _, ok := logrus.StandardLogger().Formatter.(*logrus.TextFormatter); !ok {
+		t.Errorf("formatter = %T, want text", logrus.StandardLogger().Formatter)
+	}
+
+	if err := Setup("", ""); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if logrus.GetLevel() != logrus.InfoLevel {
+		t.Errorf("level = %s, want info", logrus.GetLevel())
+	}
+	if _, ok := logrus.StandardLogger().Formatter.(*logrus.JSONFormatter); !ok {
+		t.Errorf("formatter = %T, want json", logrus.StandardLogger().Formatter)
+	}
+
+	for _, tt := range []struct{ level, format string }{{"loud", "json"}, {"info", "xml"}} {
+		if err := Setup(tt.level, tt.format); err == nil {
+			t.Errorf("Setup(%q, %q) want error", tt.level, tt.format)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests served.", "route", "status")
+	requests.With("/wallets", "200").Inc()
+	requests.With("/wallets", "200").Add(2)
+	requests.With(`/a"b`, "500").Inc()
+	latency := r.Histogram("latency_seconds", "Request latency.\nIn seconds.", []float64{0.5, 0.1}, "route")
+	latency.With("/wallets").Observe(0.05)
+	latency.With("/wallets").Observe(0.1)
+	latency.With("/wallets").Observe(3)
+	r.GaugeFunc("conns", "Open connections.", func() float64 { return 4 })
+	r.CounterFunc("retries_total", "Retries.", func() float64 { return 1.5 })
+
+	var out bytes.Buffer
+	n, err := r.WriteTo(&out)
+	if err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if n != int64(out.Len()) {
+		t.Errorf("WriteTo() = %d, wrote %d bytes", n, out.Len())
+	}
+	want := `# HELP conns Open connections.
+# TYPE conns gauge
+conns 4
+# HELP latency_seconds Request latency.\nIn seconds.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/wallets",le="0.1"} 2
+latency_seconds_bucket{route="/wallets",le="0.5"} 2
+latency_seconds_bucket{route="/wallets",le="+Inf"} 3
+latency_seconds_sum{route="/wallets"} 3.15
+latency_seconds_count{route="/wallets"} 3
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/a\"b",status="500"} 1
+requests_total{route="/wallets",status="200"} 3
+# HELP retries_total Retries.
+# TYPE retries_total counter
+retries_total 1.5
+`
+	if out.String() != want {
+		t.Errorf("WriteTo() wrote\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestRegistry_Reuse(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("ops_total", "Operations.", "op").With("deposit").Inc()
+	// asking again returns the same counter
+	if got := r.Counter("ops_total", "Operations.", "op").With("deposit").Value(); got != 1 {
+		t.Errorf("Counter() value = %v, want 1", got)
+	}
+
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{name: "other labels", fn: func() { r.Counter("ops_total", "Operations.", "code") }},
+		{name: "other kind", fn: func() { r.Histogram("ops_total", "Operations.", DefaultBuckets, "op") }},
+		{name: "missing label value", fn: func() { r.Counter("ops_total", "Operations.", "op").With() }},
+		{name: "negative add", fn: func() { r.Counter("ops_total", "Operations.", "op").With("deposit").Add(-1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("want a panic")
+				}
+			}()
+			tt.fn()
+		})
+	}
+}
+
+func TestCounter_Concurrent(t *testing.T) {
+	c := NewRegistry().Counter("ops_total", "Operations.").With()
+	h := NewRegistry().Histogram("latency_seconds", "Latency.", DefaultBuckets).With()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Inc()
+				h.Observe(0.01)
+			}
+		}()
+	}
+	wg.Wait()
+	if c.Value() != 1000 || h.Count() != 1000 {
+		t.Errorf("counter = %v, histogram count = %d, want 1000", c.Value(), h.Count())
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("ops_total", "Operations.").With().Inc()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "ops_total 1\n") {
+		t.Errorf("body = %s", w.Body.String())
+	}
+}
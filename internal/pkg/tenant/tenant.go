@@ -0,0 +1,33 @@
+// Package tenant carries the tenant of a request in its context.
+// Wallets and transactions belong to a tenant, and repositories only see the tenant of the context.
+// A context without tenant comes from the service itself, such as the hold sweeper, and isn't scoped.
+package tenant
+
+import "context"
+
+// Default is the tenant of data created without tenant, and of the data that existed before tenants.
+const Default = "default"
+
+// MaxLength is the maximum length of a tenant ID.
+const MaxLength = 64
+
+type tenantKey struct{}
+
+// NewContext returns a copy of ctx scoped to the tenant.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// FromContext returns the tenant ctx is scoped to, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(tenantKey{}).(string)
+	return id, ok
+}
+
+// OrDefault returns the tenant of ctx, or Default if it has none.
+func OrDefault(ctx context.Context) string {
+	if id, ok := FromContext(ctx); ok {
+		return id
+	}
+	return Default
+}
@@ -0,0 +1,24 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if id, ok := FromContext(ctx); ok {
+		t.Errorf("FromContext() = %q, want none", id)
+	}
+	if id := OrDefault(ctx); id != Default {
+		t.Errorf("OrDefault() = %q, want %q", id, Default)
+	}
+
+	ctx = NewContext(ctx, "acme")
+	if id, ok := FromContext(ctx); !ok || id != "acme" {
+		t.Errorf("FromContext() = %q, %v, want acme", id, ok)
+	}
+	if id := OrDefault(ctx); id != "acme" {
+		t.Errorf("OrDefault() = %q, want acme", id)
+	}
+}
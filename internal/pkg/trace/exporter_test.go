@@ -0,0 +1,174 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSpans() []SpanData {
+	start := time.Unix(1700000000, 0)
+	root := SpanData{
+		Name:    "POST /wallets/{id}/deposit",
+		Kind:    KindServer,
+		TraceID: TraceID{0x4b, 0xf9, 15: 0x36},
+		SpanID:  SpanID{0x00, 0xf0, 7: 0xb7},
+		Start:   start,
+		End:     start.Add(time.Millisecond),
+		Attributes: []Attribute{
+			Attr("http.route", "/wallets/{id}/deposit"),
+			Attr("http.response.status_code", 500),
+			Attr("db.rows_affected", int64(1)),
+			Attr("retried", false),
+			Attr("ratio", 0.5),
+		},
+		Status:        StatusError,
+		StatusMessage: "internal server error",
+	}
+	child := SpanData{
+		Name:         "wallet.deposit",
+		Kind:         KindInternal,
+		TraceID:      root.TraceID,
+		SpanID:       SpanID{0x01, 7: 0x02},
+		ParentSpanID: root.SpanID,
+		Start:        start,
+		End:          start.Add(time.Millisecond),
+	}
+	return []SpanData{root, child}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriterExporter(&buf).Export(context.Background(), testSpans()); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("wrote %d lines, want 2", len(lines))
+	}
+	var root map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &root); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	want := map[string]any{
+		"name":           "POST /wallets/{id}/deposit",
+		"kind":           "server",
+		"trace_id":       "4bf90000000000000000000000000036",
+		"span_id":        "00f00000000000b7",
+		"parent_span_id": "",
+		"status":         "error",
+		"status_message": "internal server error",
+	}
+	for k, v := range want {
+		if root[k] != v {
+			t.Errorf("%s = %v, want %v", k, root[k], v)
+		}
+	}
+	if !strings.Contains(lines[1], `"parent_span_id":"00f00000000000b7"`) {
+		t.Errorf("child line = %s, want its parent", lines[1])
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exporter, closer, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatalf("NewFileExporter() error = %v", err)
+	}
+	defer closer()
+	if err := exporter.Export(context.Background(), testSpans()); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if _, _, err := NewFileExporter(filepath.Join(t.TempDir(), "missing", "spans.jsonl")); err == nil {
+		t.Error("NewFileExporter() in a missing directory want error")
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body []byte
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request %s %s %s", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	exporter := NewOTLPExporter(srv.URL+"/v1/traces", "wallet", WithHTTPClient(srv.Client()))
+	if err := exporter.Export(context.Background(), testSpans()); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []map[string]any `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Scope struct {
+					Name string `json:"name"`
+				} `json:"scope"`
+				Spans []map[string]any `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatalf("invalid request body: %v", err)
+	}
+	rs := req.ResourceSpans[0]
+	if got, _ := json.Marshal(rs.Resource.Attributes); string(got) != `[{"key":"service.name","value":{"stringValue":"wallet"}}]` {
+		t.Errorf("resource attributes = %s", got)
+	}
+	if rs.ScopeSpans[0].Scope.Name != scopeName {
+		t.Errorf("scope = %s", rs.ScopeSpans[0].Scope.Name)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	root := spans[0]
+	want := map[string]any{
+		"traceId":           "4bf90000000000000000000000000036",
+		"spanId":            "00f00000000000b7",
+		"name":              "POST /wallets/{id}/deposit",
+		"kind":              float64(KindServer),
+		"startTimeUnixNano": "1700000000000000000",
+		"endTimeUnixNano":   "1700000000001000000",
+	}
+	for k, v := range want {
+		if root[k] != v {
+			t.Errorf("%s = %v, want %v", k, root[k], v)
+		}
+	}
+	if _, ok := root["parentSpanId"]; ok {
+		t.Errorf("root span has a parent: %v", root["parentSpanId"])
+	}
+	if got, _ := json.Marshal(root["status"]); string(got) != `{"code":2,"message":"internal server error"}` {
+		t.Errorf("status = %s", got)
+	}
+	wantAttributes := `[{"key":"http.route","value":{"stringValue":"/wallets/{id}/deposit"}},` +
+		`{"key":"http.response.status_code","value":{"intValue":"500"}},` +
+		`{"key":"db.rows_affected","value":{"intValue":"1"}},` +
+		`{"key":"retried","value":{"boolValue":false}},` +
+		`{"key":"ratio","value":{"doubleValue":0.5}}]`
+	if got, _ := json.Marshal(root["attributes"]); string(got) != wantAttributes {
+		t.Errorf("attributes = %s", got)
+	}
+	if spans[1]["parentSpanId"] != "00f00000000000b7" {
+		t.Errorf("child span parent = %v", spans[1]["parentSpanId"])
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := exporter.Export(context.Background(), testSpans()); err == nil {
+		t.Error("Export() want error on a 503")
+	}
+}
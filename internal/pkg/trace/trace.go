@@ -0,0 +1,483 @@
+// Package trace records spans of the work done for a request, in the model of OpenTelemetry.
+//
+// A Tracer starts spans and hands the ended ones to its Exporter in batches. The span in progress
+// is carried by the context, so the spans started from it are its children, see Start. The trace of
+// a request continues the one of its W3C traceparent header, see ParseTraceparent.
+//
+// Every method of a nil *Tracer or *Span does nothing, so code can be instrumented unconditionally.
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of the batches exported by a Tracer.
+const (
+	// DefaultBatchTimeout is how long an ended span waits at most before it is exported
+	DefaultBatchTimeout = 5 * time.Second
+	// maxBatchSize is how many spans are exported at most at a time
+	maxBatchSize = 512
+	// maxQueueSize is how many ended spans wait for export at most, the next ones are dropped
+	maxQueueSize = 4096
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span in its trace.
+type SpanID [8]byte
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// MarshalText encodes the ID in lowercase hex.
+func (t TraceID) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
+
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// MarshalText encodes the ID in lowercase hex, empty if it isn't valid so a root span has no parent.
+func (s SpanID) MarshalText() ([]byte, error) {
+	if !s.IsValid() {
+		return []byte{}, nil
+	}
+	return []byte(s.String()), nil
+}
+
+// SpanContext is what identifies a span across services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled tells the spans of the trace are exported
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent encodes the span context as a W3C traceparent header.
+func (sc SpanContext) Traceparent() string {
+	flags := 0
+	if sc.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent decodes a W3C traceparent header: version-traceid-parentid-flags in lowercase hex.
+// Versions after 00 are read as 00, as the specification requires.
+func ParseTraceparent(h string) (SpanContext, error) {
+	var sc SpanContext
+	if len(h) < 55 || h[2] != '-' || h[35] != '-' || h[52] != '-' || (len(h) > 55 && h[55] != '-') {
+		return sc, fmt.Errorf("invalid traceparent %q", h)
+	}
+	version, ok := decodeHex(h[0:2], 1)
+	if !ok || version[0] == 0xff || (version[0] == 0 && len(h) != 55) {
+		return sc, fmt.Errorf("invalid traceparent version %q", h[0:2])
+	}
+	traceID, ok := decodeHex(h[3:35], 16)
+	if !ok {
+		return sc, fmt.Errorf("invalid trace ID %q", h[3:35])
+	}
+	spanID, ok := decodeHex(h[36:52], 8)
+	if !ok {
+		return sc, fmt.Errorf("invalid parent ID %q", h[36:52])
+	}
+	flags, ok := decodeHex(h[53:55], 1)
+	if !ok {
+		return sc, fmt.Errorf("invalid trace flags %q", h[53:55])
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q: zero ID", h)
+	}
+	return sc, nil
+}
+
+// decodeHex decodes n bytes of lowercase hex, uppercase is invalid in a traceparent.
+func decodeHex(s string, n int) ([]byte, bool) {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && (s[i] < 'a' || s[i] > 'f') {
+			return nil, false
+		}
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil && len(b) == n
+}
+
+// Kind is the role of a span, valued as in OTLP.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	// KindServer is a span handling a request of a remote client
+	KindServer Kind = 2
+	// KindClient is a span of a request to a remote service, such as the database
+	KindClient Kind = 3
+)
+
+func (k Kind) MarshalText() ([]byte, error) {
+	switch k {
+	case KindServer:
+		return []byte("server"), nil
+	case KindClient:
+		return []byte("client"), nil
+	}
+	return []byte("internal"), nil
+}
+
+// StatusCode is the outcome of a span, valued as in OTLP.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+func (c StatusCode) MarshalText() ([]byte, error) {
+	switch c {
+	case StatusOK:
+		return []byte("ok"), nil
+	case StatusError:
+		return []byte("error"), nil
+	}
+	return []byte("unset"), nil
+}
+
+// Attribute describes a span, its value is a string, a bool, an integer or a float,
+// other values are exported as their string.
+type Attribute struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+// Attr returns the attribute key of value.
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanData is an ended span, as exported.
+type SpanData struct {
+	Name         string      `json:"name"`
+	Kind         Kind        `json:"kind"`
+	TraceID      TraceID     `json:"trace_id"`
+	SpanID       SpanID      `json:"span_id"`
+	ParentSpanID SpanID      `json:"parent_span_id"`
+	Start        time.Time   `json:"start"`
+	End          time.Time   `json:"end"`
+	Attributes   []Attribute `json:"attributes,omitempty"`
+	Status       StatusCode  `json:"status"`
+	// StatusMessage describes the error of the span
+	StatusMessage string `json:"status_message,omitempty"`
+}
+
+// Span is an operation of a trace, it is exported once it ends if its trace is sampled.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns the span context of s, invalid if s is nil.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttributes adds the attributes to the span, replacing those of the same key.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range attrs {
+		replaced := false
+		for i := range s.data.Attributes {
+			if s.data.Attributes[i].Key == a.Key {
+				s.data.Attributes[i].Value, replaced = a.Value, true
+				break
+			}
+		}
+		if !replaced {
+			s.data.Attributes = append(s.data.Attributes, a)
+		}
+	}
+}
+
+// SetStatus sets the outcome of the span, the message only describes an error.
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status, s.data.StatusMessage = code, ""
+	if code == StatusError {
+		s.data.StatusMessage = msg
+	}
+}
+
+// SetError marks the span failed by err, a nil error changes nothing.
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.SetStatus(StatusError, err.Error())
+	}
+}
+
+// End ends the span and queues it for export, ending it again does nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	data.Attributes = slices.Clone(data.Attributes)
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		s.tracer.enqueue(data)
+	}
+}
+
+// StartOption configures a span when it starts.
+type StartOption func(*SpanData)
+
+// WithKind sets the kind of the span, internal by default.
+func WithKind(kind Kind) StartOption {
+	return func(d *SpanData) {
+		d.Kind = kind
+	}
+}
+
+// WithAttributes sets attributes of the span.
+func WithAttributes(attrs ...Attribute) StartOption {
+	return func(d *SpanData) {
+		d.Attributes = append(d.Attributes, attrs...)
+	}
+}
+
+// Exporter sends ended spans to a tracing backend.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// Option configures the tracer.
+type Option func(*Tracer)
+
+// WithBatchTimeout sets how long an ended span waits at most before it is exported.
+func WithBatchTimeout(d time.Duration) Option {
+	return func(t *Tracer) {
+		if d > 0 {
+			t.batchTimeout = d
+		}
+	}
+}
+
+// Tracer starts spans and exports them in batches from a goroutine, Shutdown exports the last ones.
+type Tracer struct {
+	exporter     Exporter
+	batchTimeout time.Duration
+	queue        chan SpanData
+	stop         chan struct{}
+	done         chan struct{}
+	stopOnce     sync.Once
+	dropped      atomic.Uint64
+}
+
+// NewTracer creates a tracer exporting the spans to exporter.
+func NewTracer(exporter Exporter, opts ...Option) *Tracer {
+	t := &Tracer{
+		exporter:     exporter,
+		batchTimeout: DefaultBatchTimeout,
+		queue:        make(chan SpanData, maxQueueSize),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	go t.run()
+	return t
+}
+
+// Start starts a span, child of the span of ctx, or of the remote span of ctx, or the root of a new trace.
+// The returned context carries the span. A new trace is sampled, a continued one keeps its sampling.
+func (t *Tracer) Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{TraceID: parent.TraceID, SpanID: newSpanID(), Sampled: parent.Sampled}
+	if !parent.IsValid() {
+		sc.TraceID, sc.Sampled = newTraceID(), true
+	}
+	s := &Span{
+		tracer: t,
+		sc:     sc,
+		data: SpanData{
+			Name:         name,
+			Kind:         KindInternal,
+			TraceID:      sc.TraceID,
+			SpanID:       sc.SpanID,
+			ParentSpanID: parent.SpanID,
+			Start:        time.Now(),
+		},
+	}
+	for _, opt := range opts {
+		opt(&s.data)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Dropped returns how many ended spans were dropped because the export queue was full.
+func (t *Tracer) Dropped() uint64 {
+	if t == nil {
+		return 0
+	}
+	return t.dropped.Load()
+}
+
+// Shutdown exports the ended spans and stops the tracer, the spans ending later are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.stopOnce.Do(func() { close(t.stop) })
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	select {
+	case <-t.stop:
+		t.dropped.Add(1)
+		return
+	default:
+	}
+	select {
+	case t.queue <- data:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// run exports a batch when it is full or has waited the batch timeout, until the tracer stops.
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.batchTimeout)
+	defer ticker.Stop()
+	batch := make([]SpanData, 0, maxBatchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(context.Background(), batch); err != nil {
+			logrus.Warnf("failed to export %d spans: %v", len(batch), err)
+		}
+		batch = make([]SpanData, 0, maxBatchSize)
+	}
+	for {
+		select {
+		case data := <-t.queue:
+			if batch = append(batch, data); len(batch) >= maxBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case <-t.stop:
+			for {
+				select {
+				case data := <-t.queue:
+					if batch = append(batch, data); len(batch) >= maxBatchSize {
+						export()
+					}
+				default:
+					export()
+					return
+				}
+			}
+		}
+	}
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// Start starts a child of the span of ctx with its tracer, it does nothing if ctx has no span.
+// Code reached by traced work only, such as the statements of the database, uses it instead of a tracer.
+func Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, opts...)
+}
+
+// SpanFromContext returns the span of ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// ContextWithRemote returns a copy of ctx whose next span continues the trace of a remote span.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context of the span of ctx, or of its remote span,
+// invalid if it has neither.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(id[8:], rand.Uint64())
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return id
+}
@@ -0,0 +1,179 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingExporter keeps the exported spans
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *recordingExporter) Export(ctx context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		wantErr     bool
+		wantSampled bool
+	}{
+		{name: "sampled", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantSampled: true},
+		{name: "not sampled", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		{name: "future version with more fields", header: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-later", wantSampled: true},
+		{name: "version 00 with more fields", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-later", wantErr: true},
+		{name: "invalid version", header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "uppercase", header: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "zero trace ID", header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{name: "zero parent ID", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", wantErr: true},
+		{name: "short", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", wantErr: true},
+		{name: "empty", header: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTraceparent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+				t.Errorf("ParseTraceparent() = %s %s", sc.TraceID, sc.SpanID)
+			}
+			if sc.Sampled != tt.wantSampled {
+				t.Errorf("ParseTraceparent() sampled = %v, want %v", sc.Sampled, tt.wantSampled)
+			}
+		})
+	}
+
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if got := sc.Traceparent(); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("Traceparent() = %s", got)
+	}
+}
+
+func TestTracer_Start(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := NewTracer(exporter)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := ContextWithRemote(context.Background(), remote)
+	ctx, server := tracer.Start(ctx, "POST /wallets/{id}/transfer", WithKind(KindServer))
+	childCtx, child := Start(ctx, "wallet.transfer", WithAttributes(Attr("wallet.id", uint(1))))
+	_, query := Start(childCtx, "UPDATE")
+	child.SetAttributes(Attr("wallet.id", uint(2)), Attr("amount", "10"))
+	child.SetError(errors.New("insufficient balance"))
+	query.End()
+	child.End()
+	child.End()
+	server.End()
+
+	// the root of a new trace
+	_, root := tracer.Start(context.Background(), "wallet.expire_holds")
+	root.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if len(exporter.spans) != 4 {
+		t.Fatalf("exported %d spans, want 4", len(exporter.spans))
+	}
+	byName := make(map[string]SpanData)
+	for _, s := range exporter.spans {
+		byName[s.Name] = s
+	}
+	s := byName["POST /wallets/{id}/transfer"]
+	if s.TraceID != remote.TraceID || s.ParentSpanID != remote.SpanID || s.Kind != KindServer {
+		t.Errorf("server span = %+v, want a child of the remote span", s)
+	}
+	c := byName["wallet.transfer"]
+	if c.TraceID != remote.TraceID || c.ParentSpanID != s.SpanID || c.Kind != KindInternal {
+		t.Errorf("use case span = %+v, want a child of the server span", c)
+	}
+	if c.Status != StatusError || c.StatusMessage != "insufficient balance" {
+		t.Errorf("use case span status = %v %q", c.Status, c.StatusMessage)
+	}
+	if len(c.Attributes) != 2 || c.Attributes[0] != Attr("wallet.id", uint(2)) {
+		t.Errorf("use case span attributes = %v", c.Attributes)
+	}
+	if q := byName["UPDATE"]; q.ParentSpanID != c.SpanID {
+		t.Errorf("query span parent = %s, want %s", q.ParentSpanID, c.SpanID)
+	}
+	if r := byName["wallet.expire_holds"]; r.TraceID == remote.TraceID || r.ParentSpanID.IsValid() {
+		t.Errorf("root span = %+v, want a new trace", r)
+	}
+	if !c.End.After(c.Start) && !c.End.Equal(c.Start) {
+		t.Errorf("use case span ends %v before it starts %v", c.End, c.Start)
+	}
+}
+
+func TestTracer_NotSampled(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := NewTracer(exporter)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, span := tracer.Start(ContextWithRemote(context.Background(), remote), "GET /wallets/{id}/balance")
+	if got := SpanContextFromContext(ctx); got.TraceID != remote.TraceID || got.Sampled {
+		t.Errorf("SpanContextFromContext() = %+v, want the unsampled remote trace", got)
+	}
+	span.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if len(exporter.spans) != 0 {
+		t.Errorf("exported %d spans of an unsampled trace", len(exporter.spans))
+	}
+}
+
+func TestTracer_BatchTimeout(t *testing.T) {
+	exporter := &recordingExporter{}
+	tracer := NewTracer(exporter, WithBatchTimeout(10*time.Millisecond))
+	defer tracer.Shutdown(context.Background())
+
+	_, span := tracer.Start(context.Background(), "wallet.deposit")
+	span.End()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		exporter.mu.Lock()
+		n := len(exporter.spans)
+		exporter.mu.Unlock()
+		if n == 1 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("span not exported after the batch timeout")
+}
+
+func TestNil(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "wallet.deposit")
+	if span != nil || SpanFromContext(ctx) != nil {
+		t.Fatalf("nil tracer started a span")
+	}
+	span.SetAttributes(Attr("wallet.id", 1))
+	span.SetError(errors.New("failed"))
+	span.End()
+	if span.SpanContext().IsValid() {
+		t.Error("nil span has a valid span context")
+	}
+	if _, span := Start(ctx, "SELECT"); span != nil {
+		t.Error("Start() without a span in the context started one")
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+}
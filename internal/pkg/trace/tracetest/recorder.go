@@ -0,0 +1,28 @@
+// Package tracetest provides an exporter recording the spans, for the tests of traced packages.
+package tracetest
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace"
+	"sync"
+)
+
+// Recorder is an exporter keeping the exported spans in memory.
+type Recorder struct {
+	mu    sync.Mutex
+	spans []trace.SpanData
+}
+
+func (r *Recorder) Export(ctx context.Context, spans []trace.SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+// Spans returns the spans exported so far, in order.
+func (r *Recorder) Spans() []trace.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]trace.SpanData(nil), r.spans...)
+}
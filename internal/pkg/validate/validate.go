@@ -0,0 +1,209 @@
+// Package validate checks values against their `validate` struct tags.
+//
+// The tags follow the go-playground/validator syntax for the rules the API uses,
+// separated by commas:
+//
+//	required   the value is not zero
+//	gt=N gte=N lt=N lte=N
+//	           numbers and decimals compare their value, strings and slices their length
+//	min=N max=N
+//	           aliases of gte and lte
+//	len=N      strings and slices have exactly N elements
+//	oneof=a b  strings are one of the listed values
+//
+// Nested structs and slices of structs are validated too.
+package validate
+
+import (
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+var decimalType = reflect.TypeOf(decimal.Decimal{})
+
+// Struct validates v, a struct, a slice of structs or a pointer to one.
+// It returns nil, or errors.InvalidArgs with one metadata entry per invalid field,
+// keyed by the JSON name of the field.
+func Struct(v any) error {
+	fields := make(map[string]string)
+	check(reflect.ValueOf(v), "", fields)
+	if len(fields) == 0 {
+		return nil
+	}
+	return errors.InvalidArgs.WithMetadata(fields)
+}
+
+func check(v reflect.Value, path string, fields map[string]string) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			check(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fields)
+		}
+	case v.Kind() == reflect.Struct && v.Type() != decimalType:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := join(path, fieldName(f))
+			if tag := f.Tag.Get("validate"); tag != "" {
+				if msg := rules(v.Field(i), tag); msg != "" {
+					fields[name] = msg
+					continue
+				}
+			}
+			check(v.Field(i), name, fields)
+		}
+	}
+}
+
+// rules returns the message of the first rule of tag v breaks, or empty.
+func rules(v reflect.Value, tag string) string {
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		if msg := apply(v, name, param); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+func apply(v reflect.Value, rule, param string) string {
+	switch rule {
+	case "required":
+		if isZero(v) {
+			return "is required"
+		}
+	case "gt", "gte", "min", "lt", "lte", "max":
+		return compare(v, rule, param)
+	case "len":
+		n, ok := size(v)
+		if !ok {
+			panic(fmt.Sprintf("validate: len on %s", v.Type()))
+		}
+		if !decimal.NewFromInt(int64(n)).Equal(mustDecimal(param)) {
+			return fmt.Sprintf("must have a length of %s", param)
+		}
+	case "oneof":
+		if v.Kind() != reflect.String {
+			panic(fmt.Sprintf("validate: oneof on %s", v.Type()))
+		}
+		for _, option := range strings.Fields(param) {
+			if v.String() == option {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s", strings.Join(strings.Fields(param), ", "))
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q", rule))
+	}
+	return ""
+}
+
+// compare checks a bound, on the value of numbers and the length of strings and slices.
+func compare(v reflect.Value, rule, param string) string {
+	bound := mustDecimal(param)
+	value, isLength := number(v)
+	var ok bool
+	switch rule {
+	case "gt":
+		ok = value.GreaterThan(bound)
+	case "gte", "min":
+		ok = value.GreaterThanOrEqual(bound)
+	case "lt":
+		ok = value.LessThan(bound)
+	case "lte", "max":
+		ok = value.LessThanOrEqual(bound)
+	}
+	if ok {
+		return ""
+	}
+	what := "must be"
+	if isLength {
+		what = "must have a length of"
+	}
+	switch rule {
+	case "gt":
+		return fmt.Sprintf("%s more than %s", what, param)
+	case "gte", "min":
+		return fmt.Sprintf("%s at least %s", what, param)
+	case "lt":
+		return fmt.Sprintf("%s less than %s", what, param)
+	default:
+		return fmt.Sprintf("%s at most %s", what, param)
+	}
+}
+
+// number returns the value compared by the bounds, and whether it is a length.
+func number(v reflect.Value) (decimal.Decimal, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return decimal.NewFromInt(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return decimal.NewFromUint64(v.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return decimal.NewFromFloat(v.Float()), false
+	}
+	if v.Type() == decimalType {
+		return v.Interface().(decimal.Decimal), false
+	}
+	if n, ok := size(v); ok {
+		return decimal.NewFromInt(int64(n)), true
+	}
+	panic(fmt.Sprintf("validate: bound on %s", v.Type()))
+}
+
+func size(v reflect.Value) (int, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len(), true
+	}
+	return 0, false
+}
+
+func isZero(v reflect.Value) bool {
+	if v.Type() == decimalType {
+		return v.Interface().(decimal.Decimal).IsZero()
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Map {
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func mustDecimal(param string) decimal.Decimal {
+	d, err := decimal.NewFromString(param)
+	if err != nil {
+		panic(fmt.Sprintf("validate: invalid parameter %q", param))
+	}
+	return d
+}
+
+// fieldName is the JSON name of the field, its Go name if it has none.
+func fieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
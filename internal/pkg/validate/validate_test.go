@@ -0,0 +1,128 @@
+package validate
+
+import (
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"reflect"
+	"testing"
+)
+
+type item struct {
+	Name string `json:"name" validate:"required,max=5"`
+}
+
+type request struct {
+	Amount   decimal.Decimal `json:"amount" validate:"required,gt=0"`
+	Fee      decimal.Decimal `json:"fee,omitempty" validate:"gte=0"`
+	WalletID uint            `json:"wallet_id" validate:"required,gt=0"`
+	Currency string          `json:"currency" validate:"required,len=3"`
+	Order    string          `json:"order" validate:"oneof=asc desc"`
+	TTL      int64           `validate:"gte=0,lte=60"`
+	Items    []item          `json:"items" validate:"required"`
+	Note     string          `json:"note"`
+}
+
+func valid() request {
+	return request{
+		Amount:   decimal.NewFromInt(10),
+		WalletID: 1,
+		Currency: "USD",
+		Order:    "asc",
+		Items:    []item{{Name: "a"}},
+	}
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(r *request)
+		want   map[string]string
+	}{
+		{name: "valid", modify: func(r *request) {}},
+		{
+			name:   "missing fields",
+			modify: func(r *request) { *r = request{Order: "asc"} },
+			want: map[string]string{
+				"amount":    "is required",
+				"wallet_id": "is required",
+				"currency":  "is required",
+				"items":     "is required",
+			},
+		},
+		{
+			name: "out of bounds",
+			modify: func(r *request) {
+				r.Amount, r.Fee, r.TTL = decimal.NewFromInt(-1), decimal.NewFromFloat(-0.01), 61
+			},
+			want: map[string]string{
+				"amount": "must be more than 0",
+				"fee":    "must be at least 0",
+				"TTL":    "must be at most 60",
+			},
+		},
+		{
+			name:   "zero decimal with precision is required",
+			modify: func(r *request) { r.Amount = decimal.RequireFromString("0.00") },
+			want:   map[string]string{"amount": "is required"},
+		},
+		{
+			name:   "length and options",
+			modify: func(r *request) { r.Currency, r.Order = "EURO", "random" },
+			want: map[string]string{
+				"currency": "must have a length of 3",
+				"order":    "must be one of asc, desc",
+			},
+		},
+		{
+			name:   "nested",
+			modify: func(r *request) { r.Items = []item{{Name: "ok"}, {}, {Name: "toolong"}} },
+			want: map[string]string{
+				"items[1].name": "is required",
+				"items[2].name": "must have a length of at most 5",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.modify(&r)
+			err := Struct(&r)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Struct() error = %v, want nil", err)
+				}
+				return
+			}
+			var wErr *errors.Error
+			if !errors.As(err, &wErr) || !errors.Is(err, errors.InvalidArgs) {
+				t.Fatalf("Struct() error = %v, want %v", err, errors.InvalidArgs)
+			}
+			if !reflect.DeepEqual(wErr.Metadata, tt.want) {
+				t.Errorf("Struct() fields = %v, want %v", wErr.Metadata, tt.want)
+			}
+		})
+	}
+}
+
+func TestStruct_Slice(t *testing.T) {
+	err := Struct([]item{{Name: "a"}, {}})
+	var wErr *errors.Error
+	if !errors.As(err, &wErr) || wErr.Metadata["[1].name"] != "is required" {
+		t.Errorf("Struct() error = %v, want [1].name required", err)
+	}
+	if err := Struct(nil); err != nil {
+		t.Errorf("Struct(nil) error = %v, want nil", err)
+	}
+}
+
+func TestStruct_UnknownRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Struct() didn't panic on an unknown rule")
+		}
+	}()
+	_ = Struct(&struct {
+		Name string `validate:"email"`
+	}{})
+}
@@ -0,0 +1,75 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const apiKeyColumns = "id, name, role, tenant_id, secret_hash, signing_key, created_at, rotated_at, revoked_at"
+
+type apiKeyRepository struct {
+	*Repository
+}
+
+func NewAPIKeyRepository(repo *Repository) auth.Repository {
+	return &apiKeyRepository{repo}
+}
+
+func (ar *apiKeyRepository) Create(ctx context.Context, k *auth.Key) error {
+	_, err := ar.DB(ctx).Exec(
+		ctx,
+		"insert into api_keys ("+apiKeyColumns+") values ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		k.ID, k.Name, k.Role, k.TenantID, k.SecretHash, k.SigningKey, k.CreatedAt, k.RotatedAt, k.RevokedAt,
+	)
+	return wrapError(err)
+}
+
+func (ar *apiKeyRepository) Get(ctx context.Context, id string) (*auth.Key, error) {
+	rows, err := ar.DB(ctx).Query(ctx, "select "+apiKeyColumns+" from api_keys where id = $1", id)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	k, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[auth.Key])
+	return k, wrapError(err)
+}
+
+func (ar *apiKeyRepository) List(ctx context.Context) ([]*auth.Key, error) {
+	rows, err := ar.DB(ctx).Query(ctx, "select "+apiKeyColumns+" from api_keys order by created_at, id")
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	list, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[auth.Key])
+	return list, wrapError(err)
+}
+
+func (ar *apiKeyRepository) Update(ctx context.Context, k *auth.Key) error {
+	ct, err := ar.DB(ctx).Exec(
+		ctx,
+		"update api_keys set secret_hash = $1, signing_key = $2, rotated_at = $3, revoked_at = $4 where id = $5",
+		k.SecretHash, k.SigningKey, k.RotatedAt, k.RevokedAt, k.ID,
+	)
+	if err != nil {
+		return wrapError(err)
+	}
+	if ct.RowsAffected() != 1 {
+		return errors.RecordNotFound
+	}
+	return nil
+}
+
+func (ar *apiKeyRepository) CreateNonce(ctx context.Context, keyID, nonce string, at time.Time) error {
+	_, err := ar.DB(ctx).Exec(
+		ctx,
+		"insert into api_key_nonces (key_id, nonce, used_at) values ($1, $2, $3)",
+		keyID, nonce, at,
+	)
+	return wrapError(err)
+}
+
+func (ar *apiKeyRepository) DeleteNonces(ctx context.Context, keyID string, before time.Time) error {
+	_, err := ar.DB(ctx).Exec(ctx, "delete from api_key_nonces where key_id = $1 and used_at < $2", keyID, before)
+	return wrapError(err)
+}
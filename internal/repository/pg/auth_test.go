@@ -0,0 +1,48 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyRepository(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		ar := NewAPIKeyRepository(NewRepository(pool))
+		_, err := ar.Get(ctx, "ak_1")
+		assert.True(t, errors.Is(err, errors.RecordNotFound))
+
+		created := time.Date(2024, 11, 5, 0, 0, 0, 0, time.Local)
+		k := &auth.Key{ID: "ak_1", Name: "checkout", Role: auth.RoleAdmin, TenantID: "acme", SecretHash: strings.Repeat("0", 64), SigningKey: []byte("sealed"), CreatedAt: created}
+		require.NoError(t, ar.Create(ctx, k))
+		assert.True(t, errors.Is(ar.Create(ctx, k), errors.DuplicateRecord))
+
+		got, err := ar.Get(ctx, "ak_1")
+		require.NoError(t, err)
+		assert.Equal(t, k, got)
+
+		revoked := created.Add(time.Hour)
+		k.RevokedAt = &revoked
+		require.NoError(t, ar.Update(ctx, k))
+		list, err := ar.List(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []*auth.Key{k}, list)
+		assert.True(t, errors.Is(ar.Update(ctx, &auth.Key{ID: "ak_2"}), errors.RecordNotFound))
+
+		// a nonce is used once per key, until it is deleted
+		require.NoError(t, ar.CreateNonce(ctx, "ak_1", "n1", created))
+		assert.True(t, errors.Is(ar.CreateNonce(ctx, "ak_1", "n1", created), errors.DuplicateRecord))
+		require.NoError(t, ar.DeleteNonces(ctx, "ak_1", created))
+		assert.True(t, errors.Is(ar.CreateNonce(ctx, "ak_1", "n1", created), errors.DuplicateRecord))
+		require.NoError(t, ar.DeleteNonces(ctx, "ak_1", created.Add(time.Second)))
+		assert.NoError(t, ar.CreateNonce(ctx, "ak_1", "n1", created))
+	})
+}
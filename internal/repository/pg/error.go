@@ -3,15 +3,54 @@ package pg
 import (
 	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	integrityConstraintViolation = "23000"
+	uniqueViolation              = "23505"
+	checkViolation               = "23514"
+	serializationFailure         = "40001"
+	deadlockDetected             = "40P01"
+)
+
+// the checks keeping the balance of wallets from going negative or below the held amount
+const (
+	walletsBalanceCheck = "wallets_balance_check"
+	walletsHeldCheck    = "wallets_held_check"
 )
 
 func wrapError(err error) error {
 	if err == nil {
 		return err
 	}
+	// already classified, e.g. returned by a repository inside ExecTx
+	var wErr *errors.Error
+	if errors.As(err, &wErr) {
+		return err
+	}
 	if errors.Is(err, pgx.ErrNoRows) {
 		return errors.RecordNotFound.WithCause(err)
 	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case uniqueViolation:
+			return errors.DuplicateRecord.WithCause(err)
+		case integrityConstraintViolation:
+			// raised by the trigger refusing unbalanced journal entries
+			return errors.UnbalancedEntry.WithCause(err)
+		case checkViolation:
+			switch pgErr.ConstraintName {
+			case walletsBalanceCheck, walletsHeldCheck:
+				return errors.InsufficientBalance.WithCause(err)
+			}
+			// such as a zero posting
+			return errors.InvalidArgs.WithCause(err)
+		case serializationFailure, deadlockDetected:
+			return errors.ConcurrentUpdate.WithCause(err)
+		}
+	}
 	// TODO handle more specific errors
 	return errors.InternalDB.WithCause(err)
 }
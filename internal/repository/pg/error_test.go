@@ -0,0 +1,45 @@
+package pg
+
+import (
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"testing"
+)
+
+func TestWrapError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "nil", err: nil, want: nil},
+		{name: "no rows", err: pgx.ErrNoRows, want: errors.RecordNotFound},
+		{name: "unique violation", err: &pgconn.PgError{Code: uniqueViolation}, want: errors.DuplicateRecord},
+		{name: "balance check", err: &pgconn.PgError{Code: checkViolation, ConstraintName: walletsBalanceCheck}, want: errors.InsufficientBalance},
+		{name: "held check", err: &pgconn.PgError{Code: checkViolation, ConstraintName: walletsHeldCheck}, want: errors.InsufficientBalance},
+		{name: "other check", err: &pgconn.PgError{Code: checkViolation, ConstraintName: "postings_amount_check"}, want: errors.InvalidArgs},
+		{name: "unbalanced entry", err: &pgconn.PgError{Code: integrityConstraintViolation}, want: errors.UnbalancedEntry},
+		{name: "serialization failure", err: &pgconn.PgError{Code: serializationFailure}, want: errors.ConcurrentUpdate},
+		{name: "deadlock", err: fmt.Errorf("commit: %w", &pgconn.PgError{Code: deadlockDetected}), want: errors.ConcurrentUpdate},
+		{name: "already classified", err: errors.QuoteMismatch, want: errors.QuoteMismatch},
+		{name: "unknown", err: fmt.Errorf("connection reset"), want: errors.InternalDB},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wrapError(tt.err)
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("wrapError() = %v, want nil", got)
+				}
+				return
+			}
+			var wErr *errors.Error
+			if !errors.As(got, &wErr) || !wErr.Is(tt.want) {
+				t.Errorf("wrapError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
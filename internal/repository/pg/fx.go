@@ -0,0 +1,93 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"time"
+)
+
+type rateRepository struct {
+	*Repository
+}
+
+func NewRateRepository(repo *Repository) fx.RateRepository {
+	return &rateRepository{repo}
+}
+
+// Create upserts the rates on their pair and start, so the rates file can be loaded on every start
+func (rr *rateRepository) Create(ctx context.Context, rates ...*fx.Rate) error {
+	return rr.ExecTx(ctx, func(ctx context.Context) error {
+		for _, r := range rates {
+			err := rr.DB(ctx).QueryRow(
+				ctx,
+				`insert into fx_rates (base, quote, rate, valid_from, valid_to) values ($1, $2, $3, $4, $5)
+				on conflict (base, quote, valid_from) do update set rate = excluded.rate, valid_to = excluded.valid_to
+				returning id`,
+				r.Base, r.Quote, r.Rate, r.ValidFrom, r.ValidTo,
+			).Scan(&r.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (rr *rateRepository) Find(ctx context.Context, base, quote string, at time.Time) (*fx.Rate, error) {
+	var r fx.Rate
+	err := rr.DB(ctx).QueryRow(
+		ctx,
+		`select id, base, quote, rate, valid_from, valid_to from fx_rates
+		where base = $1 and quote = $2 and valid_from <= $3 and (valid_to is null or valid_to > $3)
+		order by valid_from desc, id desc limit 1`,
+		base, quote, at,
+	).Scan(&r.ID, &r.Base, &r.Quote, &r.Rate, &r.ValidFrom, &r.ValidTo)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &r, nil
+}
+
+type quoteRepository struct {
+	*Repository
+}
+
+func NewQuoteRepository(repo *Repository) fx.QuoteRepository {
+	return &quoteRepository{repo}
+}
+
+func (qr *quoteRepository) Create(ctx context.Context, q *fx.Quote) error {
+	_, err := qr.DB(ctx).Exec(
+		ctx,
+		`insert into fx_quotes (id, from_wallet_id, to_wallet_id, from_currency, to_currency, amount, to_amount, rate, created_at, expires_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		q.ID, q.FromWalletID, q.ToWalletID, q.FromCurrency, q.ToCurrency, q.Amount, q.ToAmount, q.Rate, q.CreatedAt, q.ExpiresAt,
+	)
+	return wrapError(err)
+}
+
+func (qr *quoteRepository) Get(ctx context.Context, id string) (*fx.Quote, error) {
+	var q fx.Quote
+	err := qr.DB(ctx).QueryRow(
+		ctx,
+		`select id, from_wallet_id, to_wallet_id, from_currency, to_currency, amount, to_amount, rate, created_at, expires_at, used_at
+		from fx_quotes where id = $1`,
+		id,
+	).Scan(&q.ID, &q.FromWalletID, &q.ToWalletID, &q.FromCurrency, &q.ToCurrency, &q.Amount, &q.ToAmount, &q.Rate, &q.CreatedAt, &q.ExpiresAt, &q.UsedAt)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &q, nil
+}
+
+func (qr *quoteRepository) MarkUsed(ctx context.Context, q *fx.Quote, usedAt time.Time) error {
+	ct, err := qr.DB(ctx).Exec(ctx, "update fx_quotes set used_at = $1 where id = $2 and used_at is null", usedAt, q.ID)
+	if err != nil {
+		return wrapError(err)
+	}
+	if ct.RowsAffected() != 1 {
+		return errors.QuoteUsed
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRateRepository(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		rr := NewRateRepository(NewRepository(pool))
+		day := time.Date(2024, 11, 5, 0, 0, 0, 0, time.UTC)
+		end := day.Add(24 * time.Hour)
+		err := rr.Create(ctx,
+			&fx.Rate{Base: "USD", Quote: "EUR", Rate: decimal.NewFromFloat(0.9), ValidFrom: day.Add(-24 * time.Hour)},
+			&fx.Rate{Base: "USD", Quote: "EUR", Rate: decimal.NewFromFloat(0.92), ValidFrom: day, ValidTo: &end},
+		)
+		assert.NoError(t, err)
+
+		r, err := rr.Find(ctx, "USD", "EUR", day.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, "0.92", r.Rate.String())
+
+		// the newer rate expired, the older one is still valid
+		r, err = rr.Find(ctx, "USD", "EUR", end)
+		assert.NoError(t, err)
+		assert.Equal(t, "0.9", r.Rate.String())
+
+		_, err = rr.Find(ctx, "USD", "EUR", day.Add(-48*time.Hour))
+		assert.True(t, errors.Is(err, errors.RecordNotFound))
+		_, err = rr.Find(ctx, "EUR", "USD", day)
+		assert.True(t, errors.Is(err, errors.RecordNotFound))
+
+		// loading a rate again replaces it rather than adding a row
+		again := &fx.Rate{Base: "USD", Quote: "EUR", Rate: decimal.NewFromFloat(0.93), ValidFrom: day, ValidTo: &end}
+		assert.NoError(t, rr.Create(ctx, again))
+		assert.Equal(t, uint(2), again.ID)
+		r, err = rr.Find(ctx, "USD", "EUR", day.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, "0.93", r.Rate.String())
+		var count int
+		assert.NoError(t, pool.QueryRow(ctx, "select count(1) from fx_rates").Scan(&count))
+		assert.Equal(t, 2, count)
+	})
+}
+
+func TestQuoteRepository(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		qr := NewQuoteRepository(NewRepository(pool))
+		now := time.Date(2024, 11, 5, 0, 0, 0, 0, time.Local)
+		q := &fx.Quote{
+			ID:           "quote-1",
+			FromWalletID: 1,
+			ToWalletID:   2,
+			FromCurrency: "USD",
+			ToCurrency:   "EUR",
+			Amount:       decimal.NewFromFloat(100),
+			ToAmount:     decimal.NewFromFloat(92),
+			Rate:         decimal.NewFromFloat(0.92),
+			CreatedAt:    now,
+			ExpiresAt:    now.Add(time.Minute),
+		}
+		assert.NoError(t, qr.Create(ctx, q))
+
+		got, err := qr.Get(ctx, q.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, q, got)
+
+		assert.NoError(t, qr.MarkUsed(ctx, q, now))
+		assert.Equal(t, errors.QuoteUsed, qr.MarkUsed(ctx, q, now))
+
+		got, err = qr.Get(ctx, q.ID)
+		assert.NoError(t, err)
+		assert.NotNil(t, got.UsedAt)
+
+		_, err = qr.Get(ctx, "missing")
+		assert.True(t, errors.Is(err, errors.RecordNotFound))
+	})
+}
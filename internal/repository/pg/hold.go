@@ -0,0 +1,80 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/hold"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+const holdColumns = "id, wallet_id, amount, captured_amount, currency, status, created_at, expires_at, updated_at"
+
+type holdRepository struct {
+	*Repository
+}
+
+func NewHoldRepository(repo *Repository) hold.Repository {
+	return &holdRepository{repo}
+}
+
+func (hr *holdRepository) Create(ctx context.Context, h *hold.Hold) error {
+	err := hr.DB(ctx).QueryRow(
+		ctx,
+		`insert into holds (wallet_id, amount, captured_amount, currency, status, created_at, expires_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`,
+		h.WalletID, h.Amount, h.CapturedAmount, h.Currency, h.Status, h.CreatedAt, h.ExpiresAt, h.UpdatedAt,
+	).Scan(&h.ID)
+	return wrapError(err)
+}
+
+func (hr *holdRepository) Get(ctx context.Context, id uint) (*hold.Hold, error) {
+	rows, err := hr.DB(ctx).Query(ctx, "select "+holdColumns+" from holds where id = $1", id)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	h, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[hold.Hold])
+	return h, wrapError(err)
+}
+
+func (hr *holdRepository) ListByWalletID(ctx context.Context, walletID uint) ([]hold.Hold, error) {
+	rows, err := hr.DB(ctx).Query(ctx, "select "+holdColumns+" from holds where wallet_id = $1 order by id desc", walletID)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	list, err := pgx.CollectRows(rows, pgx.RowToStructByName[hold.Hold])
+	return list, wrapError(err)
+}
+
+func (hr *holdRepository) ListExpired(ctx context.Context, at time.Time, limit int) ([]hold.Hold, error) {
+	rows, err := hr.DB(ctx).Query(
+		ctx,
+		"select "+holdColumns+" from holds where status = $1 and expires_at <= $2 order by expires_at, id limit $3",
+		hold.StatusAuthorized, at, limit,
+	)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	list, err := pgx.CollectRows(rows, pgx.RowToStructByName[hold.Hold])
+	return list, wrapError(err)
+}
+
+func (hr *holdRepository) UpdateStatus(ctx context.Context, h *hold.Hold, status hold.Status, capturedAmount decimal.Decimal) error {
+	now := time.Now()
+	ct, err := hr.DB(ctx).Exec(
+		ctx,
+		"update holds set status = $1, captured_amount = $2, updated_at = $3 where id = $4 and status = $5",
+		status, capturedAmount, now, h.ID, h.Status,
+	)
+	if err != nil {
+		return wrapError(err)
+	}
+	if ct.RowsAffected() != 1 {
+		log.FromContext(ctx).Warnf("hold %d status update failed, oldStatus=%s, status=%s", h.ID, h.Status, status)
+		return errors.ConcurrentUpdate
+	}
+	h.Status, h.CapturedAmount, h.UpdatedAt = status, capturedAmount, now
+	return nil
+}
@@ -0,0 +1,57 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/hold"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHoldRepository(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		hr := NewHoldRepository(NewRepository(pool))
+		_, err := hr.Get(ctx, 1)
+		assert.True(t, errors.Is(err, errors.RecordNotFound))
+
+		h := hold.New(1, decimal.NewFromFloat(100), "USD", time.Hour)
+		assert.NoError(t, hr.Create(ctx, h))
+		assert.Equal(t, uint(1), h.ID)
+		expiring := hold.New(1, decimal.NewFromFloat(20), "USD", time.Minute)
+		assert.NoError(t, hr.Create(ctx, expiring))
+		assert.NoError(t, hr.Create(ctx, hold.New(2, decimal.NewFromFloat(30), "USD", time.Minute)))
+
+		got, err := hr.Get(ctx, h.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "100", got.Amount.String())
+		assert.Equal(t, hold.StatusAuthorized, got.Status)
+		assert.True(t, got.ExpiresAt.Equal(h.ExpiresAt.Truncate(time.Microsecond)))
+
+		list, err := hr.ListByWalletID(ctx, 1)
+		assert.NoError(t, err)
+		assert.Len(t, list, 2)
+		assert.Equal(t, expiring.ID, list[0].ID)
+
+		expired, err := hr.ListExpired(ctx, time.Now().Add(2*time.Minute), 1)
+		assert.NoError(t, err)
+		assert.Len(t, expired, 1)
+		assert.Equal(t, expiring.ID, expired[0].ID)
+
+		err = hr.UpdateStatus(ctx, got, hold.StatusCaptured, decimal.NewFromFloat(60))
+		assert.NoError(t, err)
+		assert.Equal(t, hold.StatusCaptured, got.Status)
+		got, err = hr.Get(ctx, h.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, hold.StatusCaptured, got.Status)
+		assert.Equal(t, "60", got.CapturedAmount.String())
+
+		// stale status
+		err = hr.UpdateStatus(ctx, h, hold.StatusVoided, decimal.Zero)
+		assert.True(t, errors.Is(err, errors.ConcurrentUpdate))
+	})
+}
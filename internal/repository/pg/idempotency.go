@@ -0,0 +1,36 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/idempotency"
+)
+
+type idempotencyRepository struct {
+	*Repository
+}
+
+func NewIdempotencyRepository(repo *Repository) idempotency.Repository {
+	return &idempotencyRepository{repo}
+}
+
+func (ir *idempotencyRepository) Get(ctx context.Context, key string) (*idempotency.Record, error) {
+	var r idempotency.Record
+	err := ir.DB(ctx).QueryRow(
+		ctx,
+		"select key, fingerprint, status_code, body, created_at from idempotency_keys where key = $1",
+		key,
+	).Scan(&r.Key, &r.Fingerprint, &r.StatusCode, &r.Body, &r.CreatedAt)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &r, nil
+}
+
+func (ir *idempotencyRepository) Create(ctx context.Context, r *idempotency.Record) error {
+	_, err := ir.DB(ctx).Exec(
+		ctx,
+		"insert into idempotency_keys (key, fingerprint, status_code, body, created_at) values ($1, $2, $3, $4, $5)",
+		r.Key, r.Fingerprint, r.StatusCode, r.Body, r.CreatedAt,
+	)
+	return wrapError(err)
+}
@@ -0,0 +1,37 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/idempotency"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyRepository(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		ir := NewIdempotencyRepository(NewRepository(pool))
+		_, err := ir.Get(ctx, "key-1")
+		assert.True(t, errors.Is(err, errors.RecordNotFound))
+
+		r := &idempotency.Record{
+			Key:         "key-1",
+			Fingerprint: idempotency.Fingerprint("POST", "/wallets/1/deposit", nil),
+			StatusCode:  200,
+			Body:        []byte(`{"ok":true}`),
+			CreatedAt:   time.Date(2024, 11, 5, 0, 0, 0, 0, time.Local),
+		}
+		assert.NoError(t, ir.Create(ctx, r))
+
+		got, err := ir.Get(ctx, "key-1")
+		assert.NoError(t, err)
+		assert.Equal(t, r, got)
+
+		err = ir.Create(ctx, r)
+		assert.True(t, errors.Is(err, errors.DuplicateRecord))
+	})
+}
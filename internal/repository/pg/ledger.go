@@ -0,0 +1,84 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/ledger"
+	"github.com/jackc/pgx/v5"
+)
+
+type ledgerRepository struct {
+	*Repository
+}
+
+func NewLedgerRepository(repo *Repository) ledger.Repository {
+	return &ledgerRepository{repo}
+}
+
+// Create stores the entry and its postings, the balance of the entry is checked by a deferred trigger on commit
+func (lr *ledgerRepository) Create(ctx context.Context, e *ledger.Entry) error {
+	return lr.ExecTx(ctx, func(ctx context.Context) error {
+		err := lr.DB(ctx).QueryRow(
+			ctx,
+			"insert into journal_entries (transaction_id, description, created_at) values ($1, $2, $3) returning id",
+			e.TransactionID, e.Description, e.CreatedAt,
+		).Scan(&e.ID)
+		if err != nil {
+			return err
+		}
+		for i := range e.Postings {
+			p := &e.Postings[i]
+			p.EntryID = e.ID
+			err := lr.DB(ctx).QueryRow(
+				ctx,
+				"insert into postings (entry_id, account, currency, amount) values ($1, $2, $3, $4) returning id",
+				p.EntryID, p.Account, p.Currency, p.Amount,
+			).Scan(&p.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (lr *ledgerRepository) ListByTransactionID(ctx context.Context, transactionID uint) ([]ledger.Entry, error) {
+	list, err := lr.listByTransactionID(ctx, transactionID)
+	return list, wrapError(err)
+}
+func (lr *ledgerRepository) listByTransactionID(ctx context.Context, transactionID uint) ([]ledger.Entry, error) {
+	rows, err := lr.DB(ctx).Query(
+		ctx,
+		"select id, transaction_id, description, created_at from journal_entries where transaction_id = $1 order by id",
+		transactionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ledger.Entry, error) {
+		var e ledger.Entry
+		err := row.Scan(&e.ID, &e.TransactionID, &e.Description, &e.CreatedAt)
+		return e, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		rows, err := lr.DB(ctx).Query(ctx, "select id, entry_id, account, currency, amount from postings where entry_id = $1 order by id", entries[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		if entries[i].Postings, err = pgx.CollectRows(rows, pgx.RowToStructByName[ledger.Posting]); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func (lr *ledgerRepository) Balances(ctx context.Context) ([]ledger.Balance, error) {
+	rows, err := lr.DB(ctx).Query(ctx, "select account, currency, sum(amount) as amount from postings group by account, currency order by account, currency")
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	list, err := pgx.CollectRows(rows, pgx.RowToStructByName[ledger.Balance])
+	return list, wrapError(err)
+}
@@ -0,0 +1,54 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/ledger"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLedgerRepository(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		lr := NewLedgerRepository(NewRepository(pool))
+		deposit, err := ledger.NewEntry("deposit", ledger.Move(ledger.SystemAccount(ledger.SystemDeposits, "USD"), ledger.WalletAccount(1), "USD", decimal.NewFromFloat(100))...)
+		assert.NoError(t, err)
+		deposit.TransactionID = 1
+		assert.NoError(t, lr.Create(ctx, deposit))
+		assert.Equal(t, uint(1), deposit.ID)
+		assert.Equal(t, deposit.ID, deposit.Postings[1].EntryID)
+
+		conversion, err := ledger.NewEntry("transfer", ledger.Convert(ledger.WalletAccount(1), ledger.WalletAccount(2), "USD", decimal.NewFromFloat(50), "EUR", decimal.NewFromFloat(45.5))...)
+		assert.NoError(t, err)
+		conversion.TransactionID = 2
+		assert.NoError(t, lr.Create(ctx, conversion))
+
+		entries, err := lr.ListByTransactionID(ctx, 2)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		assert.Len(t, entries[0].Postings, 4)
+		assert.Equal(t, ledger.SystemAccount(ledger.SystemFX, "EUR"), entries[0].Postings[2].Account)
+		assert.Equal(t, "-45.5", entries[0].Postings[2].Amount.String())
+
+		balances, err := lr.Balances(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, ledger.CheckBalances(balances))
+		assert.Len(t, balances, 5)
+
+		// the database refuses unbalanced entries even if the entry is not validated
+		unbalanced := &ledger.Entry{TransactionID: 3, Description: "transfer", CreatedAt: time.Now(), Postings: []ledger.Posting{
+			{Account: ledger.WalletAccount(1), Currency: "USD", Amount: decimal.NewFromFloat(-10)},
+			{Account: ledger.WalletAccount(3), Currency: "USD", Amount: decimal.NewFromFloat(11)},
+		}}
+		err = lr.Create(ctx, unbalanced)
+		assert.True(t, errors.Is(err, errors.UnbalancedEntry))
+		entries, err = lr.ListByTransactionID(ctx, 3)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 0)
+	})
+}
@@ -0,0 +1,288 @@
+package pg
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// migrationLockKey is the advisory lock held while migrating, so concurrent runs wait for each other.
+const migrationLockKey int64 = 0x77616c6c6574 // "wallet"
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a reversible schema change read from a pair of NNNN_name.up.sql and NNNN_name.down.sql files.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// Checksum is the SHA-256 of the up file, an applied migration must keep it
+	Checksum string
+}
+
+// MigrationStatus is the state of a migration in the database.
+type MigrationStatus struct {
+	Migration
+	// AppliedAt is nil while the migration is pending
+	AppliedAt *time.Time
+	// Modified tells the up file changed after the migration was applied
+	Modified bool
+	// Missing tells the migration was applied but its files are gone
+	Missing bool
+}
+
+// LoadMigrations reads the migrations of fsys in version order.
+// Every version needs both an up and a down file.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, f := range files {
+		match := migrationFileName.FindStringSubmatch(f.Name())
+		if f.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", f.Name(), err)
+		}
+		body, err := fs.ReadFile(fsys, f.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			sum := sha256.Sum256(body)
+			m.Up, m.Checksum = string(body), hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Checksum == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		if m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+// Migrator applies and rolls back migrations, recording them in the schema_migrations table.
+// It needs a single connection because the advisory lock belongs to the session.
+type Migrator struct {
+	conn       *pgx.Conn
+	migrations []Migration
+}
+
+// NewMigrator creates a migrator of the migrations in fsys.
+func NewMigrator(conn *pgx.Conn, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{conn: conn, migrations: migrations}, nil
+}
+
+// Up applies the pending migrations in version order and returns how many ran.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(statuses []MigrationStatus) error {
+		if err := verify(statuses); err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.AppliedAt != nil {
+				continue
+			}
+			if err := m.apply(ctx, s.Migration); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last n applied migrations in reverse version order and returns how many ran.
+func (m *Migrator) Down(ctx context.Context, n int) (int, error) {
+	if n < 1 {
+		return 0, fmt.Errorf("down needs a positive number of migrations: %d", n)
+	}
+	rolledBack := 0
+	err := m.locked(ctx, func(statuses []MigrationStatus) error {
+		if err := verify(statuses); err != nil {
+			return err
+		}
+		for _, s := range slices.Backward(statuses) {
+			if rolledBack == n {
+				break
+			}
+			if s.AppliedAt == nil {
+				continue
+			}
+			if err := m.rollback(ctx, s.Migration); err != nil {
+				return err
+			}
+			rolledBack++
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Redo rolls back the last applied migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) error {
+	return m.locked(ctx, func(statuses []MigrationStatus) error {
+		if err := verify(statuses); err != nil {
+			return err
+		}
+		for _, s := range slices.Backward(statuses) {
+			if s.AppliedAt == nil {
+				continue
+			}
+			if err := m.rollback(ctx, s.Migration); err != nil {
+				return err
+			}
+			return m.apply(ctx, s.Migration)
+		}
+		return fmt.Errorf("no migration applied")
+	})
+}
+
+// Status returns the state of every known or applied migration in version order.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.locked(ctx, func(s []MigrationStatus) error {
+		statuses = s
+		return nil
+	})
+	return statuses, err
+}
+
+// locked runs fn holding the migration lock, with the current state of the migrations.
+func (m *Migrator) locked(ctx context.Context, fn func(statuses []MigrationStatus) error) error {
+	if _, err := m.conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	defer func() {
+		// the lock must be released even if ctx is done, or the session keeps it
+		if _, err := m.conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey); err != nil {
+			logrus.Warnf("failed to release the migration lock: %v", err)
+		}
+	}()
+
+	_, err := m.conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum CHAR(64) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	statuses, err := m.statuses(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(statuses)
+}
+
+// statuses merges the migration files with the rows of schema_migrations.
+func (m *Migrator) statuses(ctx context.Context) ([]MigrationStatus, error) {
+	rows, err := m.conn.Query(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	applied, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (MigrationStatus, error) {
+		var s MigrationStatus
+		err := row.Scan(&s.Version, &s.Name, &s.Checksum, &s.AppliedAt)
+		return s, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		statuses = append(statuses, MigrationStatus{Migration: mig})
+	}
+	for _, a := range applied {
+		i, found := slices.BinarySearchFunc(statuses, a.Version, func(s MigrationStatus, version int64) int {
+			return cmp.Compare(s.Version, version)
+		})
+		if !found {
+			a.Missing = true
+			statuses = slices.Insert(statuses, i, a)
+			continue
+		}
+		statuses[i].AppliedAt = a.AppliedAt
+		statuses[i].Modified = statuses[i].Checksum != a.Checksum
+	}
+	return statuses, nil
+}
+
+// verify refuses to migrate a database whose applied migrations don't match the files.
+func verify(statuses []MigrationStatus) error {
+	for _, s := range statuses {
+		switch {
+		case s.Missing:
+			return fmt.Errorf("migration %d_%s is applied but has no files", s.Version, s.Name)
+		case s.Modified:
+			return fmt.Errorf("migration %d_%s was modified after it was applied", s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// apply runs the up file of the migration and records it, in one transaction.
+func (m *Migrator) apply(ctx context.Context, mig Migration) error {
+	logrus.Infof("Applying migration %d_%s", mig.Version, mig.Name)
+	return pgx.BeginFunc(ctx, m.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, mig.Up); err != nil {
+			return fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+		}
+		_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+			mig.Version, mig.Name, mig.Checksum)
+		return err
+	})
+}
+
+// rollback runs the down file of the migration and forgets it, in one transaction.
+func (m *Migrator) rollback(ctx context.Context, mig Migration) error {
+	logrus.Infof("Rolling back migration %d_%s", mig.Version, mig.Name)
+	return pgx.BeginFunc(ctx, m.conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, mig.Down); err != nil {
+			return fmt.Errorf("rollback of migration %d_%s failed: %w", mig.Version, mig.Name, err)
+		}
+		_, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", mig.Version)
+		return err
+	})
+}
@@ -0,0 +1,189 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/migration"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(body string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(body)}
+	}
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    []int64
+		wantErr bool
+	}{
+		{
+			name: "version order",
+			fsys: fstest.MapFS{
+				"0010_b.up.sql":   file("CREATE TABLE b ()"),
+				"0010_b.down.sql": file("DROP TABLE b"),
+				"0002_a.up.sql":   file("CREATE TABLE a ()"),
+				"0002_a.down.sql": file("DROP TABLE a"),
+				"README.md":       file("not a migration"),
+			},
+			want: []int64{2, 10},
+		},
+		{
+			name:    "missing down file",
+			fsys:    fstest.MapFS{"0001_a.up.sql": file("CREATE TABLE a ()")},
+			wantErr: true,
+		},
+		{
+			name:    "missing up file",
+			fsys:    fstest.MapFS{"0001_a.down.sql": file("DROP TABLE a")},
+			wantErr: true,
+		},
+		{
+			name: "two names for a version",
+			fsys: fstest.MapFS{
+				"0001_a.up.sql":   file("CREATE TABLE a ()"),
+				"0001_b.down.sql": file("DROP TABLE a"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := LoadMigrations(tt.fsys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadMigrations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var versions []int64
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+				assert.Len(t, m.Checksum, 64)
+			}
+			assert.Equal(t, tt.want, versions)
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	runMigrationTest(ctx, t, func(conn *pgx.Conn) {
+		m, err := NewMigrator(conn, migration.FS)
+		require.NoError(t, err)
+		total := len(m.migrations)
+
+		applied, err := m.Up(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, total, applied)
+		mustExec(ctx, t, conn, "insert into wallets (balance) values (1.0000);")
+
+		// nothing left to apply
+		applied, err = m.Up(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, applied)
+
+		rolledBack, err := m.Down(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, 2, rolledBack)
+		statuses, err := m.Status(ctx)
+		require.NoError(t, err)
+		require.Len(t, statuses, total)
+		assert.NotNil(t, statuses[total-3].AppliedAt)
+		assert.Nil(t, statuses[total-2].AppliedAt)
+		assert.Nil(t, statuses[total-1].AppliedAt)
+
+		require.NoError(t, m.Redo(ctx))
+		applied, err = m.Up(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, applied)
+
+		// the data survives migrations that don't touch it
+		var balance string
+		require.NoError(t, conn.QueryRow(ctx, "select balance::text from wallets").Scan(&balance))
+		assert.Equal(t, "1.0000", balance)
+
+		// an applied migration must not change
+		modified := fstest.MapFS{}
+		for _, mig := range m.migrations {
+			modified[fmt.Sprintf("%04d_%s.up.sql", mig.Version, mig.Name)] = &fstest.MapFile{Data: []byte(mig.Up)}
+			modified[fmt.Sprintf("%04d_%s.down.sql", mig.Version, mig.Name)] = &fstest.MapFile{Data: []byte(mig.Down)}
+		}
+		modified["0001_create_wallets.up.sql"].Data = append(modified["0001_create_wallets.up.sql"].Data, "\n-- edited"...)
+		m2, err := NewMigrator(conn, modified)
+		require.NoError(t, err)
+		_, err = m2.Up(ctx)
+		assert.ErrorContains(t, err, "modified")
+		statuses, err = m2.Status(ctx)
+		require.NoError(t, err)
+		assert.True(t, statuses[0].Modified)
+
+		// nor disappear
+		delete(modified, fmt.Sprintf("%04d_%s.up.sql", m.migrations[total-1].Version, m.migrations[total-1].Name))
+		delete(modified, fmt.Sprintf("%04d_%s.down.sql", m.migrations[total-1].Version, m.migrations[total-1].Name))
+		modified["0001_create_wallets.up.sql"].Data = []byte(m.migrations[0].Up)
+		m3, err := NewMigrator(conn, modified)
+		require.NoError(t, err)
+		_, err = m3.Down(ctx, 1)
+		assert.ErrorContains(t, err, "no files")
+
+		rolledBack, err = m.Down(ctx, total+1)
+		require.NoError(t, err)
+		assert.Equal(t, total, rolledBack)
+		var exists bool
+		require.NoError(t, conn.QueryRow(ctx, "select to_regclass('wallets') is not null").Scan(&exists))
+		assert.False(t, exists)
+	})
+}
+
+func TestMigratorConcurrentUp(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	runMigrationTest(ctx, t, func(conn *pgx.Conn) {
+		other, err := pgx.ConnectConfig(ctx, conn.Config().Copy())
+		require.NoError(t, err)
+		defer other.Close(context.Background())
+
+		// both runs wait for the lock, only one applies the migrations
+		results := make(chan int, 2)
+		for _, c := range []*pgx.Conn{conn, other} {
+			go func() {
+				m, err := NewMigrator(c, migration.FS)
+				if err != nil {
+					results <- -1
+					return
+				}
+				applied, err := m.Up(ctx)
+				if err != nil {
+					t.Errorf("Up() error = %v", err)
+				}
+				results <- applied
+			}()
+		}
+		first, second := <-results, <-results
+		migrations, err := LoadMigrations(migration.FS)
+		require.NoError(t, err)
+		assert.Equal(t, len(migrations), first+second)
+		assert.Zero(t, min(first, second))
+	})
+}
+
+// runMigrationTest runs fn with a connection to an empty schema, dropped when the test ends.
+func runMigrationTest(ctx context.Context, t testing.TB, fn func(conn *pgx.Conn)) {
+	conf, err := pgx.ParseConfig(os.Getenv("PGX_TEST_DATABASE"))
+	require.NoError(t, err)
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	conf.RuntimeParams["search_path"] = schema
+	conn, err := pgx.ConnectConfig(ctx, conf)
+	require.NoError(t, err)
+	defer conn.Close(context.Background())
+
+	mustExec(ctx, t, conn, "CREATE SCHEMA "+schema)
+	defer mustExec(context.Background(), t, conn, "DROP SCHEMA "+schema+" CASCADE")
+	fn(conn)
+}
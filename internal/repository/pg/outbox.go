@@ -0,0 +1,84 @@
+package pg
+
+import (
+	"cmp"
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/jackc/pgx/v5"
+	"slices"
+	"time"
+)
+
+const outboxColumns = "id, type, wallet_id, tenant_id, payload, created_at, published_at, attempts, last_error, status, next_attempt_at"
+
+type outboxRepository struct {
+	*Repository
+}
+
+func NewOutboxRepository(repo *Repository) outbox.Repository {
+	return &outboxRepository{repo}
+}
+
+func (ob *outboxRepository) Create(ctx context.Context, events ...*outbox.Event) error {
+	for _, e := range events {
+		err := ob.DB(ctx).QueryRow(
+			ctx,
+			`insert into outbox_events (type, wallet_id, tenant_id, payload, created_at, status, next_attempt_at)
+			values ($1, $2, $3, $4, $5, $6, $7) returning id`,
+			e.Type, e.WalletID, e.TenantID, e.Payload, e.CreatedAt, cmp.Or(e.Status, outbox.StatusPending), e.CreatedAt,
+		).Scan(&e.ID)
+		if err != nil {
+			return wrapError(err)
+		}
+	}
+	return nil
+}
+
+// Claim takes the due events with FOR UPDATE SKIP LOCKED in a single statement, so the locks are only held
+// while they are claimed, a concurrent relay skips them and the claim hides them until it times out
+func (ob *outboxRepository) Claim(ctx context.Context, at, until time.Time, limit int) ([]outbox.Event, error) {
+	rows, err := ob.DB(ctx).Query(
+		ctx,
+		`with due as (
+			select id from outbox_events e
+			where status = 'pending' and next_attempt_at <= $1
+			and not exists (
+				select 1 from outbox_events earlier
+				where earlier.wallet_id = e.wallet_id and earlier.status = 'pending' and earlier.id < e.id
+			)
+			order by id limit $2
+			for update skip locked
+		)
+		update outbox_events set next_attempt_at = $3 where id in (select id from due) returning `+outboxColumns,
+		at, limit, until,
+	)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	list, err := pgx.CollectRows(rows, pgx.RowToStructByName[outbox.Event])
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	// the updated rows are returned in no particular order
+	slices.SortFunc(list, func(a, b outbox.Event) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return list, nil
+}
+
+func (ob *outboxRepository) Update(ctx context.Context, e *outbox.Event) error {
+	ct, err := ob.DB(ctx).Exec(
+		ctx,
+		`update outbox_events set status = $1, published_at = $2, attempts = $3, last_error = $4, next_attempt_at = $5
+		where id = $6 and status = 'pending'`,
+		e.Status, e.PublishedAt, e.Attempts, e.LastError, e.NextAttemptAt, e.ID,
+	)
+	if err != nil {
+		return wrapError(err)
+	}
+	if ct.RowsAffected() != 1 {
+		return errors.RecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestOutboxRepository(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		repo := NewRepository(pool)
+		ob := NewOutboxRepository(repo)
+		var events []*outbox.Event
+		for _, walletID := range []uint{1, 2, 1} {
+			e, err := outbox.NewEvent("wallet.credited", walletID, "acme", map[string]uint{"wallet_id": walletID})
+			require.NoError(t, err)
+			e.CreatedAt = time.Date(2024, 11, 5, 0, 0, 0, 0, time.Local)
+			events = append(events, e)
+		}
+		require.NoError(t, ob.Create(ctx, events...))
+		assert.Equal(t, []uint{1, 2, 3}, []uint{events[0].ID, events[1].ID, events[2].ID})
+
+		at := events[0].CreatedAt
+		claimed, err := ob.Claim(ctx, at, at.Add(time.Minute), 10)
+		require.NoError(t, err)
+		// the second event of wallet 1 waits for the first one
+		require.Len(t, claimed, 2)
+		events[0].Status, events[0].NextAttemptAt = outbox.StatusPending, at.Add(time.Minute)
+		assert.Equal(t, *events[0], claimed[0])
+		assert.JSONEq(t, `{"wallet_id": 2}`, string(claimed[1].Payload))
+		// claimed events aren't due until the claim times out
+		none, err := ob.Claim(ctx, at, at.Add(time.Minute), 10)
+		require.NoError(t, err)
+		assert.Empty(t, none)
+
+		failed := &claimed[0]
+		failed.Attempts, failed.LastError, failed.NextAttemptAt = 1, "unreachable", at.Add(time.Hour)
+		require.NoError(t, ob.Update(ctx, failed))
+		published := &claimed[1]
+		publishedAt := at.Add(time.Second)
+		published.Status, published.PublishedAt = outbox.StatusPublished, &publishedAt
+		require.NoError(t, ob.Update(ctx, published))
+		// published once
+		assert.True(t, errors.Is(ob.Update(ctx, published), errors.RecordNotFound))
+
+		// the failed event is due after its backoff, then the next event of its wallet once it is dead
+		claimed, err = ob.Claim(ctx, at.Add(time.Hour), at.Add(2*time.Hour), 10)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+		assert.Equal(t, uint(1), claimed[0].ID)
+		assert.Equal(t, 1, claimed[0].Attempts)
+		assert.Equal(t, "unreachable", claimed[0].LastError)
+		claimed[0].Status = outbox.StatusDead
+		require.NoError(t, ob.Update(ctx, &claimed[0]))
+		claimed, err = ob.Claim(ctx, at.Add(time.Hour), at.Add(2*time.Hour), 10)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+		assert.Equal(t, uint(3), claimed[0].ID)
+
+		// events locked by a concurrent claim are skipped, not waited for
+		require.NoError(t, ob.Create(ctx, &outbox.Event{Type: "wallet.credited", WalletID: 4, TenantID: "acme", Payload: []byte("{}"), CreatedAt: at}))
+		err = repo.ExecTx(ctx, func(ctx context.Context) error {
+			mustExec(ctx, t, repo.DB(ctx), "select id from outbox_events where wallet_id = 4 for update")
+			lockCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			claimed, err := ob.Claim(lockCtx, at.Add(time.Hour), at.Add(2*time.Hour), 10)
+			require.NoError(t, err)
+			assert.Empty(t, claimed)
+			return nil
+		})
+		assert.NoError(t, err)
+	})
+}
@@ -2,18 +2,135 @@ package pg
 
 import (
 	"context"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/config"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/metrics"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace"
 	"github.com/guoxiaopeng875/wallet/internal/wallet"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Querier runs statements, both the pool and pgx.Tx satisfy it so repositories
+// work the same inside and outside of ExecTx.
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type Repository struct {
-	db *pgx.Conn
+	db        *pgxpool.Pool
+	txOptions pgx.TxOptions
+	retry     retry
+	stats     txStats
+	// txDuration observes the transactions of ExecTx, nil without metrics
+	txDuration *metrics.HistogramVec
+	// tracer traces the transactions of ExecTx, nil without tracing
+	tracer *trace.Tracer
+}
+
+// Option configures the repository.
+type Option func(*Repository)
+
+// WithIsolationLevel sets the isolation level of the transactions started by ExecTx,
+// empty keeps the default of the server.
+func WithIsolationLevel(level pgx.TxIsoLevel) Option {
+	return func(repo *Repository) {
+		repo.txOptions.IsoLevel = level
+	}
+}
+
+// WithRetry runs a transaction failed by a concurrent one up to attempts more times,
+// waiting a random delay below backoff, doubled on every attempt.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(repo *Repository) {
+		repo.retry = retry{attempts: attempts, backoff: backoff}
+	}
+}
+
+// WithMetrics exports the duration of the transactions of ExecTx by outcome, the retry counters of TxStats
+// and the statistics of the connection pool.
+func WithMetrics(reg *metrics.Registry) Option {
+	return func(repo *Repository) {
+		repo.txDuration = reg.Histogram("db_tx_duration_seconds",
+			"Duration of the database transactions in seconds, retries included, by outcome.", metrics.DefaultBuckets, "outcome")
+		reg.CounterFunc("db_tx_retries_total", "Database transactions run again after a conflict.", func() float64 {
+			return float64(repo.TxStats().Retries)
+		})
+		reg.CounterFunc("db_tx_recovered_total", "Database transactions committed after a retry.", func() float64 {
+			return float64(repo.TxStats().Recovered)
+		})
+		reg.CounterFunc("db_tx_exhausted_total", "Database transactions still conflicting after the last retry.", func() float64 {
+			return float64(repo.TxStats().Exhausted)
+		})
+		if repo.db != nil {
+			registerPoolMetrics(reg, repo.db)
+		}
+	}
+}
+
+// WithTracer traces the transactions of ExecTx in spans named db.transaction, recording their retries.
+// The statements are traced by the pool of NewPoolConfig, as children of the span of their context.
+func WithTracer(tracer *trace.Tracer) Option {
+	return func(repo *Repository) {
+		repo.tracer = tracer
+	}
+}
+
+// registerPoolMetrics exports the statistics of the pool, read when scraped.
+func registerPoolMetrics(reg *metrics.Registry, pool *pgxpool.Pool) {
+	gauges := []struct {
+		name, help string
+		value      func(s *pgxpool.Stat) float64
+	}{
+		{"db_pool_acquired_conns", "Connections in use.", func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) }},
+		{"db_pool_idle_conns", "Idle connections.", func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) }},
+		{"db_pool_constructing_conns", "Connections being opened.", func(s *pgxpool.Stat) float64 { return float64(s.ConstructingConns()) }},
+		{"db_pool_total_conns", "Open connections.", func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) }},
+		{"db_pool_max_conns", "Maximum size of the pool.", func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) }},
+	}
+	for _, g := range gauges {
+		reg.GaugeFunc(g.name, g.help, func() float64 { return g.value(pool.Stat()) })
+	}
+	counters := []struct {
+		name, help string
+		value      func(s *pgxpool.Stat) float64
+	}{
+		{"db_pool_acquires_total", "Connections acquired from the pool.", func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) }},
+		{"db_pool_empty_acquires_total", "Acquires that waited for a connection.", func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) }},
+		{"db_pool_canceled_acquires_total", "Acquires canceled by their context.", func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) }},
+		{"db_pool_acquire_duration_seconds_total", "Time spent acquiring connections in seconds.", func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() }},
+	}
+	for _, c := range counters {
+		reg.CounterFunc(c.name, c.help, func() float64 { return c.value(pool.Stat()) })
+	}
+}
+
+func NewRepository(db *pgxpool.Pool, opts ...Option) *Repository {
+	repo := &Repository{db: db}
+	for _, opt := range opts {
+		opt(repo)
+	}
+	return repo
 }
 
-func NewRepository(db *pgx.Conn) *Repository {
-	return &Repository{db: db}
+// ParseIsolationLevel parses a configured isolation level such as "repeatable read" or "serializable",
+// underscores may replace the spaces and empty keeps the default of the server.
+func ParseIsolationLevel(level string) (pgx.TxIsoLevel, error) {
+	switch l := pgx.TxIsoLevel(strings.ReplaceAll(strings.ToLower(level), "_", " ")); l {
+	case "", pgx.ReadUncommitted, pgx.ReadCommitted, pgx.RepeatableRead, pgx.Serializable:
+		return l, nil
+	}
+	return "", fmt.Errorf("unknown isolation level %q", level)
 }
 
+// NewConnect opens a single connection, it is used by tools that need one session such as migrations.
 func NewConnect(ctx context.Context, dsn string) (*pgx.Conn, func(), error) {
 	closer := func() {}
 	conn, err := pgx.Connect(ctx, dsn)
@@ -29,32 +146,140 @@ func NewConnect(ctx context.Context, dsn string) (*pgx.Conn, func(), error) {
 	return conn, closer, nil
 }
 
+// NewPool opens a connection pool configured by conf, zero settings keep the pgxpool defaults.
+func NewPool(ctx context.Context, conf config.Repository) (*pgxpool.Pool, func(), error) {
+	closer := func() {}
+	poolConf, err := NewPoolConfig(conf)
+	if err != nil {
+		return nil, closer, err
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, poolConf)
+	if err != nil {
+		return nil, closer, err
+	}
+	closer = pool.Close
+	if err := pool.Ping(ctx); err != nil {
+		return nil, closer, err
+	}
+	return pool, closer, nil
+}
+
+// NewPoolConfig parses the DSN and applies the pool settings of conf, the statements of traced contexts are traced.
+func NewPoolConfig(conf config.Repository) (*pgxpool.Config, error) {
+	poolConf, err := pgxpool.ParseConfig(conf.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if conf.MaxConns > 0 {
+		poolConf.MaxConns = conf.MaxConns
+	}
+	if conf.MinConns > 0 {
+		poolConf.MinConns = conf.MinConns
+	}
+	if conf.MaxConnLifetime > 0 {
+		poolConf.MaxConnLifetime = time.Duration(conf.MaxConnLifetime)
+	}
+	if conf.MaxConnIdleTime > 0 {
+		poolConf.MaxConnIdleTime = time.Duration(conf.MaxConnIdleTime)
+	}
+	if conf.HealthCheckPeriod > 0 {
+		poolConf.HealthCheckPeriod = time.Duration(conf.HealthCheckPeriod)
+	}
+	poolConf.ConnConfig.Tracer = queryTracer{}
+	if conf.RowLevelSecurity {
+		poolConf.BeforeAcquire = setTenant
+		poolConf.AfterRelease = resetTenant
+	}
+	return poolConf, nil
+}
+
+// setTenant sets app.tenant_id, read by the row level security policies, to the tenant of ctx
+// on the acquired connection. A context without tenant clears it, the policies then allow every tenant.
+// The connection is destroyed if the setting fails, so it never runs queries for another tenant.
+func setTenant(ctx context.Context, conn *pgx.Conn) bool {
+	id, _ := tenant.FromContext(ctx)
+	_, err := conn.Exec(ctx, "select set_config('app.tenant_id', $1, false)", id)
+	return err == nil
+}
+
+// resetTenant clears app.tenant_id before the connection returns to the pool.
+func resetTenant(conn *pgx.Conn) bool {
+	_, err := conn.Exec(context.Background(), "reset app.tenant_id")
+	return err == nil
+}
+
 func NewDBTx(repo *Repository) wallet.DBTx {
 	return repo
 }
 
 type contextTxKey struct{}
 
-func (repo *Repository) ExecTx(ctx context.Context, fn func(ctx context.Context) error) error {
-	return wrapError(repo.execTx(ctx, fn))
-}
 func (repo *Repository) execTx(ctx context.Context, fn func(ctx context.Context) error) error {
-	tx, err := repo.db.Begin(ctx)
+	var (
+		tx  pgx.Tx
+		err error
+	)
+	if outer, ok := ctx.Value(contextTxKey{}).(pgx.Tx); ok {
+		// nested in the transaction in progress, run in a savepoint so
+		// a failure only rolls back the work of fn
+		tx, err = outer.Begin(ctx)
+	} else {
+		// the transaction holds a connection of the pool until it ends
+		tx, err = repo.db.BeginTx(ctx, repo.txOptions)
+	}
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
+	parent, nested := ctx.Value(afterCommitKey{}).(*[]func())
+	var afterCommit []func()
 	ctx = context.WithValue(ctx, contextTxKey{}, tx)
+	ctx = context.WithValue(ctx, afterCommitKey{}, &afterCommit)
 	if err := fn(ctx); err != nil {
 		return err
 	}
-	return tx.Commit(ctx)
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	if nested {
+		// released savepoint, its work commits with the enclosing transaction
+		*parent = append(*parent, afterCommit...)
+		return nil
+	}
+	for _, f := range afterCommit {
+		f()
+	}
+	return nil
+}
+
+type afterCommitKey struct{}
+
+// AfterCommit runs f once the transaction in progress commits, that is with the outermost transaction.
+// f never runs if the transaction or a savepoint enclosing the call rolls back, f runs at once outside a transaction.
+func (repo *Repository) AfterCommit(ctx context.Context, f func()) {
+	if afterCommit, ok := ctx.Value(afterCommitKey{}).(*[]func()); ok {
+		*afterCommit = append(*afterCommit, f)
+		return
+	}
+	f()
 }
 
-func (repo *Repository) DB(ctx context.Context) *pgx.Conn {
-	tx, ok := ctx.Value(contextTxKey{}).(*pgx.Conn)
+// DB returns the transaction in progress or the pool.
+func (repo *Repository) DB(ctx context.Context) Querier {
+	tx, ok := ctx.Value(contextTxKey{}).(pgx.Tx)
 	if ok {
 		return tx
 	}
 	return repo.db
 }
+
+// scoped restricts query to the tenant of ctx, it must end with its where clause.
+// A context without tenant comes from the service itself and sees every tenant.
+func scoped(ctx context.Context, query string, args ...any) (string, []any) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return query, args
+	}
+	args = append(args, id)
+	return query + " and tenant_id = $" + strconv.Itoa(len(args)), args
+}
@@ -0,0 +1,39 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace"
+	"github.com/jackc/pgx/v5"
+	"strings"
+)
+
+// queryTracer traces every statement run with a traced context in a client span, child of the span of
+// the context and named by the statement keyword, such as SELECT. The arguments are not recorded.
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = trace.Start(ctx, statementName(data.SQL), trace.WithKind(trace.KindClient), trace.WithAttributes(
+		trace.Attr("db.system", "postgresql"),
+		trace.Attr("db.statement", data.SQL),
+	))
+	return ctx
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	// the span started by TraceQueryStart, nil if the context wasn't traced
+	span := trace.SpanFromContext(ctx)
+	if data.Err == nil {
+		span.SetAttributes(trace.Attr("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	span.SetError(data.Err)
+	span.End()
+}
+
+// statementName returns the keyword starting the statement in upper case.
+func statementName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(strings.TrimLeft(fields[0], "("))
+}
@@ -0,0 +1,114 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace/tracetest"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func attributes(s trace.SpanData) map[string]any {
+	attrs := make(map[string]any)
+	for _, a := range s.Attributes {
+		attrs[a.Key] = a.Value
+	}
+	return attrs
+}
+
+func TestStatementName(t *testing.T) {
+	assert.Equal(t, "SELECT", statementName("select id from wallets where id = $1"))
+	assert.Equal(t, "UPDATE", statementName("\n\tupdate wallets set balance = balance + $1"))
+	assert.Equal(t, "WITH", statementName("(with due as (select 1) select * from due)"))
+	assert.Equal(t, "QUERY", statementName("  "))
+}
+
+func TestQueryTracer(t *testing.T) {
+	exporter := &tracetest.Recorder{}
+	tracer := trace.NewTracer(exporter)
+	tr := queryTracer{}
+
+	// a context without span isn't traced
+	ctx := tr.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "select 1"})
+	assert.Nil(t, trace.SpanFromContext(ctx))
+	tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	ctx, parent := tracer.Start(context.Background(), "wallet.deposit")
+	queryCtx := tr.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "update wallets set balance = $1 where id = $2", Args: []any{"secret", 1}})
+	tr.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("UPDATE 1")})
+	queryCtx = tr.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "select * from missing"})
+	tr.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{Err: &pgconn.PgError{Code: "42P01", Message: "relation does not exist"}})
+	parent.End()
+
+	require.NoError(t, tracer.Shutdown(context.Background()))
+	require.Len(t, exporter.Spans(), 3)
+	update, failed := exporter.Spans()[0], exporter.Spans()[1]
+	assert.Equal(t, "UPDATE", update.Name)
+	assert.Equal(t, trace.KindClient, update.Kind)
+	assert.Equal(t, parent.SpanContext().SpanID, update.ParentSpanID)
+	assert.Equal(t, map[string]any{
+		"db.system":        "postgresql",
+		"db.statement":     "update wallets set balance = $1 where id = $2",
+		"db.rows_affected": int64(1),
+	}, attributes(update))
+	assert.Equal(t, trace.StatusUnset, update.Status)
+	assert.Equal(t, "SELECT", failed.Name)
+	assert.Equal(t, trace.StatusError, failed.Status)
+	assert.Contains(t, failed.StatusMessage, "relation does not exist")
+}
+
+func TestWithTracer(t *testing.T) {
+	ctx := context.Background()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		// a pool tracing its statements as NewPoolConfig configures it
+		conf := pool.Config()
+		conf.ConnConfig.Tracer = queryTracer{}
+		traced, err := pgxpool.NewWithConfig(ctx, conf)
+		require.NoError(t, err)
+		defer traced.Close()
+
+		exporter := &tracetest.Recorder{}
+		tracer := trace.NewTracer(exporter)
+		repo := NewRepository(traced, WithRetry(1, time.Millisecond), WithTracer(tracer))
+
+		ctx, parent := tracer.Start(ctx, "wallet.deposit")
+		calls := 0
+		err = repo.ExecTx(ctx, func(ctx context.Context) error {
+			mustExec(ctx, t, repo.DB(ctx), "insert into wallets (balance) values (1)")
+			if calls++; calls == 1 {
+				return errors.ConcurrentUpdate
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		parent.End()
+
+		require.NoError(t, tracer.Shutdown(context.Background()))
+		var tx trace.SpanData
+		names := make(map[string]int)
+		for _, s := range exporter.Spans() {
+			names[s.Name]++
+			if s.Name == "db.transaction" {
+				tx = s
+			}
+		}
+		assert.Equal(t, parent.SpanContext().SpanID, tx.ParentSpanID)
+		assert.Equal(t, 1, attributes(tx)["db.transaction.retries"])
+		// both attempts begin, insert and end
+		assert.Equal(t, 2, names["BEGIN"])
+		assert.Equal(t, 2, names["INSERT"])
+		assert.Equal(t, 1, names["ROLLBACK"])
+		assert.Equal(t, 1, names["COMMIT"])
+		for _, s := range exporter.Spans() {
+			if s.Kind == trace.KindClient {
+				assert.Equal(t, tx.SpanID, s.ParentSpanID, s.Name)
+			}
+		}
+	})
+}
@@ -2,10 +2,18 @@ package pg
 
 import (
 	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
 	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
 	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"strconv"
+	"strings"
 )
 
+const transactionColumns = "id, method, tx_at, amount, currency, to_amount, to_currency, rate, fee, from_wallet_id, to_wallet_id, reversal_of, reversed_amount, reason, tenant_id"
+
 type transactionRepository struct {
 	*Repository
 }
@@ -14,23 +22,106 @@ func NewTransactionRepository(repo *Repository) transaction.Repository {
 	return &transactionRepository{repo}
 }
 
-func (t *transactionRepository) ListByWalletID(ctx context.Context, walletID uint) ([]transaction.Transaction, error) {
-	list, err := t.listByWalletID(ctx, walletID)
+func (t *transactionRepository) ListByWalletID(ctx context.Context, walletID uint, filter transaction.Filter) ([]transaction.Transaction, error) {
+	list, err := t.listByWalletID(ctx, walletID, filter)
 	return list, wrapError(err)
 }
-func (t *transactionRepository) listByWalletID(ctx context.Context, walletID uint) ([]transaction.Transaction, error) {
-	rows, err := t.DB(ctx).Query(ctx, "select * from transactions where from_wallet_id = $1 or to_wallet_id = $2", walletID, walletID)
+func (t *transactionRepository) listByWalletID(ctx context.Context, walletID uint, filter transaction.Filter) ([]transaction.Transaction, error) {
+	query, args := transactionQuery(ctx, walletID, filter)
+	rows, err := t.DB(ctx).Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	return pgx.CollectRows(rows, pgx.RowToStructByName[transaction.Transaction])
 }
 
+// transactionQuery builds the keyset query listing the transactions of the wallet in the tenant of ctx.
+func transactionQuery(ctx context.Context, walletID uint, filter transaction.Filter) (string, []any) {
+	args := []any{walletID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	where := []string{"(from_wallet_id = $1 or to_wallet_id = $1)"}
+	if id, ok := tenant.FromContext(ctx); ok {
+		where = append(where, "tenant_id = "+arg(id))
+	}
+	if len(filter.Methods) > 0 {
+		methods := make([]string, 0, len(filter.Methods))
+		for _, m := range filter.Methods {
+			methods = append(methods, string(m))
+		}
+		where = append(where, "method = any("+arg(methods)+")")
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "tx_at >= "+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "tx_at < "+arg(filter.To))
+	}
+	if filter.MinAmount.Valid {
+		where = append(where, "amount >= "+arg(filter.MinAmount.Decimal))
+	}
+	if filter.MaxAmount.Valid {
+		where = append(where, "amount <= "+arg(filter.MaxAmount.Decimal))
+	}
+	if filter.CounterpartyID != 0 {
+		cp := arg(filter.CounterpartyID)
+		where = append(where, "((from_wallet_id = $1 and to_wallet_id = "+cp+") or (to_wallet_id = $1 and from_wallet_id = "+cp+"))")
+	}
+	order, cmp := "desc", "<"
+	if filter.Order == transaction.OrderAsc {
+		order, cmp = "asc", ">"
+	}
+	if filter.After != nil {
+		where = append(where, "(tx_at, id) "+cmp+" ("+arg(filter.After.TxAt)+", "+arg(filter.After.ID)+")")
+	}
+	query := "select " + transactionColumns + " from transactions where " + strings.Join(where, " and ") +
+		" order by tx_at " + order + ", id " + order
+	if filter.Limit > 0 {
+		query += " limit " + arg(filter.Limit)
+	}
+	return query, args
+}
+
+// Create inserts the transaction in the tenant of its wallets, the use cases never move money across tenants.
 func (t *transactionRepository) Create(ctx context.Context, transaction *transaction.Transaction) error {
-	_, err := t.DB(ctx).Exec(
+	err := t.DB(ctx).QueryRow(
 		ctx,
-		"insert into transactions (method, tx_at, amount, from_wallet_id, to_wallet_id) values ($1, $2, $3, $4, $5 )",
-		transaction.Method, transaction.TxAt, transaction.Amount, transaction.FromWalletID, transaction.ToWalletID,
-	)
+		`insert into transactions (method, tx_at, amount, currency, to_amount, to_currency, rate, fee, from_wallet_id, to_wallet_id, reversal_of, reason, tenant_id)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
+			coalesce((select tenant_id from wallets where id in ($9, $10) limit 1), $13)) returning id, tenant_id`,
+		transaction.Method, transaction.TxAt, transaction.Amount, transaction.Currency,
+		transaction.ToAmount, transaction.ToCurrency, transaction.Rate, transaction.Fee, transaction.FromWalletID, transaction.ToWalletID,
+		transaction.ReversalOf, transaction.Reason, tenant.OrDefault(ctx),
+	).Scan(&transaction.ID, &transaction.TenantID)
 	return err
 }
+
+func (t *transactionRepository) Get(ctx context.Context, id uint) (*transaction.Transaction, error) {
+	query, args := scoped(ctx, "select "+transactionColumns+" from transactions where id = $1", id)
+	rows, err := t.DB(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	tx, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[transaction.Transaction])
+	return tx, wrapError(err)
+}
+
+func (t *transactionRepository) UpdateReversed(ctx context.Context, transaction *transaction.Transaction, amount decimal.Decimal) error {
+	query, args := scoped(
+		ctx,
+		"update transactions set reversed_amount = reversed_amount + $1 where id = $2 and reversed_amount = $3 and reversed_amount + $1 <= amount",
+		amount, transaction.ID, transaction.ReversedAmount,
+	)
+	ct, err := t.DB(ctx).Exec(ctx, query, args...)
+	if err != nil {
+		return wrapError(err)
+	}
+	if ct.RowsAffected() != 1 {
+		log.FromContext(ctx).Warnf("transaction %d reversed amount update failed, oldReversed=%v, amount=%s", transaction.ID, transaction.ReversedAmount, amount)
+		return errors.ConcurrentUpdate
+	}
+	transaction.ReversedAmount = transaction.ReversedAmount.Add(amount)
+	return nil
+}
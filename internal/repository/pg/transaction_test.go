@@ -2,8 +2,10 @@ package pg
 
 import (
 	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
 	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -13,21 +15,124 @@ import (
 func TestTransactionRepository(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
-	defaultConnTestRunner.RunTest(ctx, t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
-		tp := NewTransactionRepository(NewRepository(conn))
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		tp := NewTransactionRepository(NewRepository(pool))
 		tx := &transaction.Transaction{
-			Method:       transaction.MethodTransfer,
-			TxAt:         time.Date(2024, 11, 5, 0, 0, 0, 0, time.Local),
-			Amount:       decimal.NewFromFloat(100.1111),
-			FromWalletID: 1,
-			ToWalletID:   10,
+			Method:         transaction.MethodTransfer,
+			TxAt:           time.Date(2024, 11, 5, 0, 0, 0, 0, time.Local),
+			Amount:         decimal.NewFromFloat(100.1111),
+			Currency:       "USD",
+			ToAmount:       decimal.RequireFromString("92.1000"),
+			ToCurrency:     "EUR",
+			Rate:           decimal.RequireFromString("0.9200000000"),
+			Fee:            decimal.RequireFromString("1.5000"),
+			FromWalletID:   1,
+			ToWalletID:     10,
+			ReversedAmount: decimal.RequireFromString("0.0000"),
 		}
 		err := tp.Create(ctx, tx)
 		assert.NoError(t, err)
-		list, err := tp.ListByWalletID(ctx, 1)
+		assert.Equal(t, uint(1), tx.ID)
+		// the wallets don't exist, the transaction belongs to the default tenant
+		assert.Equal(t, tenant.Default, tx.TenantID)
+		list, err := tp.ListByWalletID(ctx, 1, transaction.Filter{})
 		assert.NoError(t, err)
 		assert.Len(t, list, 1)
-		tx.ID = list[0].ID
 		assert.Equal(t, *tx, list[0])
+
+		got, err := tp.Get(ctx, tx.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, tx, got)
+		_, err = tp.Get(ctx, 999)
+		assert.True(t, errors.Is(err, errors.RecordNotFound))
+
+		// partial reversal
+		err = tp.UpdateReversed(ctx, got, decimal.NewFromFloat(40))
+		assert.NoError(t, err)
+		assert.Equal(t, "40", got.ReversedAmount.String())
+		// stale reversed amount
+		err = tp.UpdateReversed(ctx, tx, decimal.NewFromFloat(10))
+		assert.True(t, errors.Is(err, errors.ConcurrentUpdate))
+		// more than the amount
+		err = tp.UpdateReversed(ctx, got, decimal.NewFromFloat(60.1112))
+		assert.True(t, errors.Is(err, errors.ConcurrentUpdate))
+
+		reversal := got.Reversal(decimal.NewFromFloat(40), "refund")
+		assert.NoError(t, tp.Create(ctx, reversal))
+		got, err = tp.Get(ctx, reversal.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, tx.ID, got.ReversalOf)
+		assert.Equal(t, "refund", got.Reason)
+	})
+}
+
+func TestTransactionRepository_Tenant(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		mustExec(ctx, t, pool, "insert into wallets (balance, tenant_id) values (100, 'acme'), (100, 'acme');")
+		tp := NewTransactionRepository(NewRepository(pool))
+		acme, globex := tenant.NewContext(ctx, "acme"), tenant.NewContext(ctx, "globex")
+
+		// the transaction takes the tenant of its wallets, whatever the context
+		tx := transaction.New(transaction.MethodTransfer, decimal.NewFromInt(10), "USD", 1, 2)
+		assert.NoError(t, tp.Create(ctx, tx))
+		assert.Equal(t, "acme", tx.TenantID)
+
+		list, err := tp.ListByWalletID(acme, 1, transaction.Filter{})
+		assert.NoError(t, err)
+		assert.Len(t, list, 1)
+		list, err = tp.ListByWalletID(globex, 1, transaction.Filter{})
+		assert.NoError(t, err)
+		assert.Empty(t, list)
+
+		_, err = tp.Get(acme, tx.ID)
+		assert.NoError(t, err)
+		_, err = tp.Get(globex, tx.ID)
+		assert.True(t, errors.Is(err, errors.RecordNotFound), "Get() error = %v", err)
+		err = tp.UpdateReversed(globex, tx, decimal.NewFromInt(1))
+		assert.True(t, errors.Is(err, errors.ConcurrentUpdate), "UpdateReversed() error = %v", err)
+	})
+}
+
+func TestTransactionRepository_ListByWalletID(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		tp := NewTransactionRepository(NewRepository(pool))
+		start := time.Date(2024, 11, 5, 0, 0, 0, 0, time.UTC)
+		for i, tx := range []*transaction.Transaction{
+			transaction.New(transaction.MethodDeposit, decimal.NewFromInt(100), "USD", 0, 1),
+			transaction.New(transaction.MethodWithdraw, decimal.NewFromInt(50), "USD", 1, 0),
+			transaction.New(transaction.MethodTransfer, decimal.NewFromInt(30), "USD", 1, 2),
+			transaction.New(transaction.MethodTransfer, decimal.NewFromInt(20), "USD", 3, 1),
+			transaction.New(transaction.MethodDeposit, decimal.NewFromInt(10), "USD", 0, 2),
+		} {
+			tx.TxAt = start.Add(time.Duration(i) * time.Hour)
+			assert.NoError(t, tp.Create(ctx, tx))
+		}
+
+		ids := func(filter transaction.Filter) []uint {
+			list, err := tp.ListByWalletID(ctx, 1, filter)
+			assert.NoError(t, err)
+			result := make([]uint, 0, len(list))
+			for _, tx := range list {
+				result = append(result, tx.ID)
+			}
+			return result
+		}
+
+		assert.Equal(t, []uint{4, 3, 2, 1}, ids(transaction.Filter{}))
+		assert.Equal(t, []uint{1, 2, 3, 4}, ids(transaction.Filter{Order: transaction.OrderAsc}))
+		assert.Equal(t, []uint{4, 3}, ids(transaction.Filter{Limit: 2}))
+		assert.Equal(t, []uint{2, 1}, ids(transaction.Filter{After: &transaction.Cursor{TxAt: start.Add(2 * time.Hour), ID: 3}}))
+		assert.Equal(t, []uint{4}, ids(transaction.Filter{Order: transaction.OrderAsc, After: &transaction.Cursor{TxAt: start.Add(2 * time.Hour), ID: 3}}))
+		assert.Equal(t, []uint{2, 1}, ids(transaction.Filter{Methods: []transaction.Method{transaction.MethodDeposit, transaction.MethodWithdraw}}))
+		assert.Equal(t, []uint{3, 2}, ids(transaction.Filter{From: start.Add(time.Hour), To: start.Add(3 * time.Hour)}))
+		assert.Equal(t, []uint{3, 2}, ids(transaction.Filter{
+			MinAmount: decimal.NewNullDecimal(decimal.NewFromInt(30)),
+			MaxAmount: decimal.NewNullDecimal(decimal.NewFromInt(50)),
+		}))
+		assert.Equal(t, []uint{4}, ids(transaction.Filter{CounterpartyID: 3}))
 	})
 }
@@ -0,0 +1,113 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace"
+	"github.com/jackc/pgx/v5"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// TxStats counts the transactions ExecTx ran again after a conflict.
+type TxStats struct {
+	// Retries is the number of times a transaction ran again
+	Retries uint64
+	// Recovered is the number of transactions committed after a retry
+	Recovered uint64
+	// Exhausted is the number of transactions still failing after the last retry
+	Exhausted uint64
+}
+
+type txStats struct {
+	retries   atomic.Uint64
+	recovered atomic.Uint64
+	exhausted atomic.Uint64
+}
+
+// retry is the policy of ExecTx for transactions failed by a concurrent one.
+type retry struct {
+	attempts int
+	backoff  time.Duration
+}
+
+// delay returns a random delay before the retry following attempt, below backoff doubled attempt times.
+func (r retry) delay(attempt int) time.Duration {
+	ceiling := r.backoff << attempt
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling)
+}
+
+// TxStats returns the retry counters of ExecTx.
+func (repo *Repository) TxStats() TxStats {
+	return TxStats{
+		Retries:   repo.stats.retries.Load(),
+		Recovered: repo.stats.recovered.Load(),
+		Exhausted: repo.stats.exhausted.Load(),
+	}
+}
+
+// ExecTx runs fn in a transaction, or in a savepoint when a transaction is already in progress.
+// A transaction failed by a serialization failure, a deadlock or an optimistic conflict runs fn again
+// as the retry policy allows, so fn must read the state it depends on itself.
+func (repo *Repository) ExecTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(contextTxKey{}).(pgx.Tx); ok {
+		// a savepoint can't run again on its own, the outermost transaction does
+		return wrapError(repo.execTx(ctx, fn))
+	}
+	ctx, span := repo.tracer.Start(ctx, "db.transaction", trace.WithAttributes(
+		trace.Attr("db.system", "postgresql"),
+		trace.Attr("db.transaction.isolation_level", string(repo.txOptions.IsoLevel)),
+	))
+	defer span.End()
+	start := time.Now()
+	err := repo.execRetried(ctx, span, fn)
+	span.SetError(err)
+	if repo.txDuration == nil {
+		return err
+	}
+	outcome := "committed"
+	if err != nil {
+		outcome = "failed"
+	}
+	repo.txDuration.With(outcome).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// execRetried runs fn in a transaction, again as the retry policy allows while it conflicts.
+// The retries are recorded on the span of the transaction.
+func (repo *Repository) execRetried(ctx context.Context, span *trace.Span, fn func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := wrapError(repo.execTx(ctx, fn))
+		if err == nil {
+			if attempt > 0 {
+				repo.stats.recovered.Add(1)
+				log.FromContext(ctx).Infof("transaction committed after %d retries", attempt)
+			}
+			return nil
+		}
+		if !errors.Is(err, errors.ConcurrentUpdate) {
+			return err
+		}
+		if attempt >= repo.retry.attempts {
+			if attempt > 0 {
+				repo.stats.exhausted.Add(1)
+				log.FromContext(ctx).Warnf("transaction failed after %d retries: %v", attempt, err)
+			}
+			return err
+		}
+		delay := repo.retry.delay(attempt)
+		repo.stats.retries.Add(1)
+		span.SetAttributes(trace.Attr("db.transaction.retries", attempt+1))
+		log.FromContext(ctx).Infof("transaction conflict, retry %d/%d in %v: %v", attempt+1, repo.retry.attempts, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
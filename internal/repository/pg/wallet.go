@@ -3,11 +3,14 @@ package pg
 import (
 	"context"
 	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
 	"github.com/guoxiaopeng875/wallet/internal/wallet"
 	"github.com/shopspring/decimal"
-	"github.com/sirupsen/logrus"
 )
 
+const walletColumns = "id, currency, balance, held, status, owner_id, tenant_id"
+
 type walletRepository struct {
 	*Repository
 }
@@ -16,23 +19,74 @@ func NewWalletRepository(repo *Repository) wallet.Repository {
 	return &walletRepository{repo}
 }
 
+func (wp *walletRepository) Create(ctx context.Context, w *wallet.Wallet) error {
+	if w.TenantID == "" {
+		w.TenantID = tenant.OrDefault(ctx)
+	}
+	err := wp.DB(ctx).QueryRow(ctx, "insert into wallets (currency, balance, status, owner_id, tenant_id) values ($1, $2, $3, $4, $5) returning id",
+		w.Currency, w.Balance, w.Status, w.OwnerID, w.TenantID).Scan(&w.ID)
+	return wrapError(err)
+}
+
 func (wp *walletRepository) Get(ctx context.Context, id uint) (*wallet.Wallet, error) {
+	query, args := scoped(ctx, "select "+walletColumns+" from wallets where id = $1", id)
+	return wp.get(ctx, query, args)
+}
+
+func (wp *walletRepository) GetForUpdate(ctx context.Context, id uint) (*wallet.Wallet, error) {
+	query, args := scoped(ctx, "select "+walletColumns+" from wallets where id = $1", id)
+	return wp.get(ctx, query+" for update", args)
+}
+
+func (wp *walletRepository) get(ctx context.Context, query string, args []any) (*wallet.Wallet, error) {
 	var w wallet.Wallet
-	if err := wp.DB(ctx).QueryRow(ctx, "select id, balance from wallets where id = $1", id).Scan(&w.ID, &w.Balance); err != nil {
-		return nil, wrapError(err)
+	if err := wp.DB(ctx).QueryRow(ctx, query, args...).Scan(&w.ID, &w.Currency, &w.Balance, &w.Held, &w.Status, &w.OwnerID, &w.TenantID); err != nil {
+		err = wrapError(err)
+		if errors.Is(err, errors.RecordNotFound) {
+			return nil, errors.WalletNotFound.WithCause(err)
+		}
+		return nil, err
 	}
 	return &w, nil
 }
 
 func (wp *walletRepository) UpdateBalance(ctx context.Context, wallet *wallet.Wallet, amount decimal.Decimal) error {
-	ct, err := wp.DB(ctx).Exec(ctx, "update wallets set balance = balance + $1 where id = $2 and balance = $3", amount, wallet.ID, wallet.Balance)
+	query, args := scoped(ctx, "update wallets set balance = balance + $1 where id = $2 and balance = $3", amount, wallet.ID, wallet.Balance)
+	ct, err := wp.DB(ctx).Exec(ctx, query, args...)
 	if err != nil {
-		return err
+		return wrapError(err)
 	}
 	if ct.RowsAffected() != 1 {
-		logrus.Warnf("wallet %d balance update failed, oldBalance=%v, amount=%s", wallet.ID, wallet.Balance, amount)
-		return errors.RecordNotFound
+		log.FromContext(ctx).Warnf("wallet %d balance update failed, oldBalance=%v, amount=%s", wallet.ID, wallet.Balance, amount)
+		return errors.ConcurrentUpdate
 	}
+	wallet.Balance = wallet.Balance.Add(amount)
+	return nil
+}
 
+func (wp *walletRepository) UpdateHeld(ctx context.Context, wallet *wallet.Wallet, amount decimal.Decimal) error {
+	query, args := scoped(ctx, "update wallets set held = held + $1 where id = $2 and held = $3", amount, wallet.ID, wallet.Held)
+	ct, err := wp.DB(ctx).Exec(ctx, query, args...)
+	if err != nil {
+		return wrapError(err)
+	}
+	if ct.RowsAffected() != 1 {
+		log.FromContext(ctx).Warnf("wallet %d held update failed, oldHeld=%v, amount=%s", wallet.ID, wallet.Held, amount)
+		return errors.ConcurrentUpdate
+	}
+	wallet.Held = wallet.Held.Add(amount)
+	return nil
+}
+
+func (wp *walletRepository) UpdateStatus(ctx context.Context, wallet *wallet.Wallet, status wallet.Status) error {
+	query, args := scoped(ctx, "update wallets set status = $1 where id = $2 and status = $3 and balance = $4", status, wallet.ID, wallet.Status, wallet.Balance)
+	ct, err := wp.DB(ctx).Exec(ctx, query, args...)
+	if err != nil {
+		return wrapError(err)
+	}
+	if ct.RowsAffected() != 1 {
+		log.FromContext(ctx).Warnf("wallet %d status update failed, oldStatus=%s, oldBalance=%v, status=%s", wallet.ID, wallet.Status, wallet.Balance, status)
+		return errors.ConcurrentUpdate
+	}
 	return nil
 }
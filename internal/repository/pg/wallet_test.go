@@ -2,8 +2,11 @@ package pg
 
 import (
 	"context"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
 	"github.com/guoxiaopeng875/wallet/internal/wallet"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"sync"
@@ -15,29 +18,105 @@ import (
 func TestWalletRepository_Get(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
-	defaultConnTestRunner.RunTest(ctx, t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
 		id := uint(1)
-		wp := NewWalletRepository(NewRepository(conn))
+		wp := NewWalletRepository(NewRepository(pool))
 		w, err := wp.Get(ctx, id)
-		assert.Error(t, err)
+		assert.True(t, errors.Is(err, errors.WalletNotFound), "Get() error = %v", err)
+		assert.True(t, errors.Is(err, errors.RecordNotFound), "Get() error = %v", err)
 		assert.Nil(t, w)
 
-		mustExec(ctx, t, conn, "insert into wallets (balance) values (100.1122);")
+		mustExec(ctx, t, pool, "insert into wallets (balance, held) values (100.1122, 20.5);")
 		w = mustGetWallet(ctx, t, wp, id)
 		assert.Equal(t, w, &wallet.Wallet{
-			ID:      id,
-			Balance: decimal.NewFromFloat(100.1122),
+			ID:       id,
+			Currency: "USD",
+			Balance:  decimal.NewFromFloat(100.1122),
+			Held:     decimal.RequireFromString("20.5000"),
+			Status:   wallet.StatusActive,
+			TenantID: tenant.Default,
 		})
 	})
 }
 
+func TestWalletRepository_Tenant(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		wp := NewWalletRepository(NewRepository(pool))
+		acme, globex := tenant.NewContext(ctx, "acme"), tenant.NewContext(ctx, "globex")
+		w := &wallet.Wallet{Currency: "USD", Balance: decimal.Zero, Status: wallet.StatusActive}
+		assert.NoError(t, wp.Create(acme, w))
+		assert.Equal(t, "acme", w.TenantID)
+
+		got, err := wp.Get(acme, w.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, w, got)
+		// the service sees every tenant
+		_, err = wp.Get(ctx, w.ID)
+		assert.NoError(t, err)
+
+		_, err = wp.Get(globex, w.ID)
+		assert.True(t, errors.Is(err, errors.WalletNotFound), "Get() error = %v", err)
+		_, err = wp.GetForUpdate(globex, w.ID)
+		assert.True(t, errors.Is(err, errors.WalletNotFound), "GetForUpdate() error = %v", err)
+		err = wp.UpdateBalance(globex, got, decimal.NewFromInt(10))
+		assert.True(t, errors.Is(err, errors.ConcurrentUpdate), "UpdateBalance() error = %v", err)
+		assert.NoError(t, wp.UpdateBalance(acme, got, decimal.NewFromInt(10)))
+	})
+}
+
+func TestWalletRepository_Create(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		wp := NewWalletRepository(NewRepository(pool))
+		w := &wallet.Wallet{Currency: "EUR", Balance: decimal.Zero, Status: wallet.StatusActive, OwnerID: "ak_1"}
+		err := wp.Create(ctx, w)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(1), w.ID)
+
+		got := mustGetWallet(ctx, t, wp, w.ID)
+		assert.Equal(t, "EUR", got.Currency)
+		assert.Equal(t, "0", got.Balance.String())
+		assert.Equal(t, wallet.StatusActive, got.Status)
+		assert.Equal(t, "ak_1", got.OwnerID)
+	})
+}
+
+func TestWalletRepository_UpdateStatus(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		id := uint(1)
+		wp := NewWalletRepository(NewRepository(pool))
+		mustExec(ctx, t, pool, "insert into wallets (balance) values (0.0000);")
+		w := mustGetWallet(ctx, t, wp, id)
+
+		err := wp.UpdateStatus(ctx, w, wallet.StatusFrozen)
+		assert.NoError(t, err)
+		assert.Equal(t, wallet.StatusFrozen, mustGetWallet(ctx, t, wp, id).Status)
+
+		// stale status
+		err = wp.UpdateStatus(ctx, w, wallet.StatusClosed)
+		assert.ErrorIs(t, err, errors.ConcurrentUpdate)
+
+		// balance changed after read
+		w = mustGetWallet(ctx, t, wp, id)
+		mustExec(ctx, t, pool, "update wallets set balance = 1 where id = $1;", id)
+		err = wp.UpdateStatus(ctx, w, wallet.StatusClosed)
+		assert.Error(t, err)
+		assert.Equal(t, wallet.StatusFrozen, mustGetWallet(ctx, t, wp, id).Status)
+	})
+}
+
 func TestWalletRepository_UpdateBalance(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
-	defaultConnTestRunner.RunTest(ctx, t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
 		id := uint(1)
-		wp := NewWalletRepository(NewRepository(conn))
-		mustExec(ctx, t, conn, "insert into wallets (balance) values (0.0000);")
+		wp := NewWalletRepository(NewRepository(pool))
+		mustExec(ctx, t, pool, "insert into wallets (balance) values (0.0000);")
 		w := mustGetWallet(ctx, t, wp, id)
 		// add balance
 		err := wp.UpdateBalance(ctx, w, decimal.NewFromFloat(1))
@@ -60,6 +139,10 @@ func TestWalletRepository_UpdateBalance(t *testing.T) {
 		w = mustGetWallet(ctx, t, wp, id)
 		assert.Equal(t, "0.0222", w.Balance.String())
 
+		// the database refuses a negative balance
+		err = wp.UpdateBalance(ctx, w, decimal.NewFromFloat(-1))
+		assert.True(t, errors.Is(err, errors.InsufficientBalance), "UpdateBalance() error = %v", err)
+
 		// update failed
 		w.ID = 0
 		err = wp.UpdateBalance(ctx, w, decimal.NewFromFloat(-3.2))
@@ -68,47 +151,102 @@ func TestWalletRepository_UpdateBalance(t *testing.T) {
 	})
 }
 
+func TestWalletRepository_UpdateHeld(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		id := uint(1)
+		wp := NewWalletRepository(NewRepository(pool))
+		mustExec(ctx, t, pool, "insert into wallets (balance) values (100.0000);")
+		w := mustGetWallet(ctx, t, wp, id)
+
+		// hold
+		err := wp.UpdateHeld(ctx, w, decimal.NewFromFloat(60))
+		assert.NoError(t, err)
+		assert.Equal(t, "60", w.Held.String())
+		assert.Equal(t, "60", mustGetWallet(ctx, t, wp, id).Held.String())
+
+		// hold more than the balance
+		err = wp.UpdateHeld(ctx, w, decimal.NewFromFloat(50))
+		assert.ErrorIs(t, err, errors.InsufficientBalance)
+
+		// release
+		err = wp.UpdateHeld(ctx, w, decimal.NewFromFloat(-60))
+		assert.NoError(t, err)
+		assert.Equal(t, "0", mustGetWallet(ctx, t, wp, id).Held.String())
+
+		// stale held
+		w.Held = decimal.NewFromFloat(10)
+		err = wp.UpdateHeld(ctx, w, decimal.NewFromFloat(-10))
+		assert.ErrorIs(t, err, errors.ConcurrentUpdate)
+	})
+}
+
+func TestWalletRepository_GetForUpdate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		id := uint(1)
+		repo := NewRepository(pool)
+		wp := NewWalletRepository(repo)
+		mustExec(ctx, t, pool, "insert into wallets (balance) values (100.0000);")
+
+		err := repo.ExecTx(ctx, func(ctx context.Context) error {
+			w, err := wp.GetForUpdate(ctx, id)
+			assert.NoError(t, err)
+			assert.Equal(t, "100", w.Balance.String())
+			// the row stays locked until the transaction ends
+			_, err = pool.Exec(ctx, "select id from wallets where id = $1 for update nowait", id)
+			assert.Error(t, err)
+			return nil
+		})
+		assert.NoError(t, err)
+		_, err = pool.Exec(ctx, "select id from wallets where id = $1 for update nowait", id)
+		assert.NoError(t, err)
+
+		_, err = wp.GetForUpdate(ctx, 999)
+		assert.ErrorIs(t, err, errors.RecordNotFound)
+	})
+}
+
 func TestWalletRepository_UpdateConcurrently(t *testing.T) {
-	t.Skip()
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
-	defaultConnTestRunner.RunTest(ctx, t, func(ctx context.Context, t testing.TB, conn *pgx.Conn) {
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
 		id := uint(1)
-		wp := NewWalletRepository(NewRepository(conn))
-		mustExec(ctx, t, conn, "insert into wallets (balance) values (0.0000);")
+		wp := NewWalletRepository(NewRepository(pool))
+		mustExec(ctx, t, pool, "insert into wallets (balance) values (0.0000);")
 		w := mustGetWallet(ctx, t, wp, id)
 		var wg sync.WaitGroup
 		errCount := &atomic.Uint32{}
 		concurrentCount := 50
 		for i := 0; i < concurrentCount; i++ {
-			go func() {
-				wg.Add(1)
-				err := wp.UpdateBalance(ctx, w, decimal.NewFromFloat(1))
-				if err == nil {
-					w = mustGetWallet(ctx, t, wp, id)
-					assert.Equal(t, "1", w.Balance.String())
-				} else {
+			wg.Add(1)
+			go func(w wallet.Wallet) {
+				defer wg.Done()
+				if err := wp.UpdateBalance(ctx, &w, decimal.NewFromFloat(1)); err != nil {
+					assert.ErrorIs(t, err, errors.ConcurrentUpdate)
 					errCount.Add(1)
 				}
-				wg.Done()
-			}()
+			}(*w)
 		}
 		wg.Wait()
 		// there can only be one success
 		assert.Equal(t, uint32(concurrentCount-1), errCount.Load())
+		assert.Equal(t, "1", mustGetWallet(ctx, t, wp, id).Balance.String())
 	})
 }
 
 func BenchmarkWalletRepository_Update(b *testing.B) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
-	defaultConnTestRunner.RunTest(ctx, b, func(ctx context.Context, _ testing.TB, conn *pgx.Conn) {
+	runTest(ctx, b, func(ctx context.Context, _ testing.TB, pool *pgxpool.Pool) {
 		b.ResetTimer()
 
-		wp := NewWalletRepository(NewRepository(conn))
+		wp := NewWalletRepository(NewRepository(pool))
 		for i := 0; i < b.N; i++ {
 			id := uint(i + 1)
-			mustExec(ctx, b, conn, "insert into wallets (id, balance) values ($1, 0.0000);", id)
+			mustExec(ctx, b, pool, "insert into wallets (id, balance) values ($1, 0.0000);", id)
 			w := mustGetWallet(ctx, b, wp, id)
 			// add balance
 			err := wp.UpdateBalance(ctx, w, decimal.NewFromFloat(2.2222))
@@ -125,3 +263,134 @@ func mustGetWallet(ctx context.Context, t testing.TB, wp wallet.Repository, id u
 	assert.NotNil(t, w)
 	return w
 }
+
+func TestWalletUseCase_ConcurrentDeposits(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        wallet.LockMode
+		retries     int
+		mayConflict bool
+	}{
+		{name: "pessimistic", mode: wallet.LockPessimistic},
+		{name: "optimistic", mode: wallet.LockOptimistic, mayConflict: true},
+		// every conflict means another deposit committed, so one retry per deposit is enough
+		{name: "optimistic with retries", mode: wallet.LockOptimistic, retries: 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+			defer cancel()
+			runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+				repo := NewRepository(pool, WithRetry(tt.retries, time.Millisecond))
+				wp := NewWalletRepository(repo)
+				uc := wallet.NewUseCase(
+					wp,
+					NewTransactionRepository(repo),
+					NewHoldRepository(repo),
+					NewLedgerRepository(repo),
+					NewOutboxRepository(repo),
+					NewDBTx(repo),
+					fx.NewUseCase(NewRateRepository(repo), NewQuoteRepository(repo), time.Minute),
+					wallet.WithLockMode(tt.mode),
+				)
+				mustExec(ctx, t, pool, "insert into wallets (balance) values (0.0000);")
+
+				var wg sync.WaitGroup
+				var succeeded, conflicted atomic.Int64
+				for i := 0; i < 50; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						err := uc.Deposit(ctx, 1, decimal.NewFromInt(1))
+						switch {
+						case err == nil:
+							succeeded.Add(1)
+						case errors.Is(err, errors.ConcurrentUpdate):
+							conflicted.Add(1)
+						default:
+							t.Errorf("Deposit() error = %v", err)
+						}
+					}()
+				}
+				wg.Wait()
+
+				if !tt.mayConflict {
+					assert.Equal(t, int64(50), succeeded.Load())
+				}
+				assert.Equal(t, int64(50), succeeded.Load()+conflicted.Load())
+				assert.Equal(t, decimal.NewFromInt(succeeded.Load()).String(), mustGetWallet(ctx, t, wp, 1).Balance.String())
+			})
+		})
+	}
+}
+
+func TestWalletUseCase_ConcurrentWithdrawals(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        wallet.LockMode
+		mayConflict bool
+	}{
+		{name: "pessimistic", mode: wallet.LockPessimistic},
+		{name: "optimistic", mode: wallet.LockOptimistic, mayConflict: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+			defer cancel()
+			runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+				repo := NewRepository(pool)
+				wp := NewWalletRepository(repo)
+				uc := wallet.NewUseCase(
+					wp,
+					NewTransactionRepository(repo),
+					NewHoldRepository(repo),
+					NewLedgerRepository(repo),
+					NewOutboxRepository(repo),
+					NewDBTx(repo),
+					fx.NewUseCase(NewRateRepository(repo), NewQuoteRepository(repo), time.Minute),
+					wallet.WithLockMode(tt.mode),
+				)
+				mustExec(ctx, t, pool, "insert into wallets (balance) values (100.0000);")
+
+				// twice as many withdrawals as the balance covers
+				var wg sync.WaitGroup
+				var succeeded, refused, conflicted atomic.Int64
+				for i := 0; i < 200; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						err := uc.Withdraw(ctx, 1, decimal.NewFromInt(1))
+						switch {
+						case err == nil:
+							succeeded.Add(1)
+						case errors.Is(err, errors.InsufficientBalance):
+							refused.Add(1)
+						case errors.Is(err, errors.ConcurrentUpdate):
+							conflicted.Add(1)
+						default:
+							t.Errorf("Withdraw() error = %v", err)
+						}
+					}()
+				}
+				wg.Wait()
+
+				if !tt.mayConflict {
+					assert.Equal(t, int64(100), succeeded.Load())
+					assert.Equal(t, int64(100), refused.Load())
+				}
+				assert.LessOrEqual(t, succeeded.Load(), int64(100))
+				assert.Equal(t, int64(200), succeeded.Load()+refused.Load()+conflicted.Load())
+				w := mustGetWallet(ctx, t, wp, 1)
+				assert.False(t, w.Balance.IsNegative())
+				assert.Equal(t, decimal.NewFromInt(100-succeeded.Load()).String(), w.Balance.String())
+
+				var withdrawals int64
+				err := pool.QueryRow(ctx, "select count(*) from transactions where method = 'withdraw'").Scan(&withdrawals)
+				assert.NoError(t, err)
+				assert.Equal(t, succeeded.Load(), withdrawals)
+			})
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package pg
+
+import (
+	"cmp"
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/webhook"
+	"github.com/jackc/pgx/v5"
+	"slices"
+	"time"
+)
+
+const (
+	subscriptionColumns = "id, url, event_types, wallet_ids, secret, owner_id, tenant_id, created_at"
+	deliveryColumns     = "id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, " +
+		"last_attempt_at, response_status, last_error, created_at, delivered_at"
+)
+
+type webhookRepository struct {
+	*Repository
+}
+
+func NewWebhookRepository(repo *Repository) webhook.Repository {
+	return &webhookRepository{repo}
+}
+
+func (wr *webhookRepository) Create(ctx context.Context, s *webhook.Subscription) error {
+	err := wr.DB(ctx).QueryRow(
+		ctx,
+		`insert into webhook_subscriptions (url, event_types, wallet_ids, secret, owner_id, tenant_id, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id`,
+		s.URL, s.EventTypes, s.WalletIDs, s.Secret, s.OwnerID, s.TenantID, s.CreatedAt,
+	).Scan(&s.ID)
+	return wrapError(err)
+}
+
+func (wr *webhookRepository) Get(ctx context.Context, id uint) (*webhook.Subscription, error) {
+	query, args := scoped(ctx, "select "+subscriptionColumns+" from webhook_subscriptions where id = $1", id)
+	rows, err := wr.DB(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	s, err := pgx.CollectExactlyOneRow(rows, pgx.RowToAddrOfStructByName[webhook.Subscription])
+	if err != nil {
+		err = wrapError(err)
+		if errors.Is(err, errors.RecordNotFound) {
+			return nil, errors.WebhookNotFound.WithCause(err)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func (wr *webhookRepository) ListByTenant(ctx context.Context, tenantID string) ([]webhook.Subscription, error) {
+	rows, err := wr.DB(ctx).Query(
+		ctx,
+		"select "+subscriptionColumns+" from webhook_subscriptions where tenant_id = $1 order by id",
+		tenantID,
+	)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	list, err := pgx.CollectRows(rows, pgx.RowToStructByName[webhook.Subscription])
+	return list, wrapError(err)
+}
+
+// CreateDelivery leaves the id zero when the event already has a delivery for the subscription
+func (wr *webhookRepository) CreateDelivery(ctx context.Context, d *webhook.Delivery) error {
+	err := wr.DB(ctx).QueryRow(
+		ctx,
+		`insert into webhook_deliveries (subscription_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7) on conflict (subscription_id, event_id) do nothing returning id`,
+		d.SubscriptionID, d.EventID, d.EventType, d.Payload, d.Status, d.NextAttemptAt, d.CreatedAt,
+	).Scan(&d.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	return wrapError(err)
+}
+
+func (wr *webhookRepository) ListDeliveries(ctx context.Context, subscriptionID uint, limit int) ([]webhook.Delivery, error) {
+	rows, err := wr.DB(ctx).Query(
+		ctx,
+		"select "+deliveryColumns+" from webhook_deliveries where subscription_id = $1 order by id desc limit $2",
+		subscriptionID, limit,
+	)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	list, err := pgx.CollectRows(rows, pgx.RowToStructByName[webhook.Delivery])
+	return list, wrapError(err)
+}
+
+// ClaimDeliveries takes the due deliveries with FOR UPDATE SKIP LOCKED in a single statement,
+// so the locks are only held while they are claimed and no connection is held while they are posted
+func (wr *webhookRepository) ClaimDeliveries(ctx context.Context, at, until time.Time, limit int) ([]webhook.Delivery, error) {
+	rows, err := wr.DB(ctx).Query(
+		ctx,
+		`with due as (
+			select id from webhook_deliveries
+			where status = $1 and next_attempt_at <= $2
+			order by next_attempt_at, id limit $3
+			for update skip locked
+		)
+		update webhook_deliveries set attempts = attempts + 1, next_attempt_at = $4
+		where id in (select id from due) returning `+deliveryColumns,
+		webhook.DeliveryPending, at, limit, until,
+	)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	list, err := pgx.CollectRows(rows, pgx.RowToStructByName[webhook.Delivery])
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	// the updated rows are returned in no particular order
+	slices.SortFunc(list, func(a, b webhook.Delivery) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return list, nil
+}
+
+// UpdateDelivery only updates a pending delivery at the attempt it was claimed for
+func (wr *webhookRepository) UpdateDelivery(ctx context.Context, d *webhook.Delivery) error {
+	ct, err := wr.DB(ctx).Exec(
+		ctx,
+		`update webhook_deliveries set status = $1, next_attempt_at = $2, last_attempt_at = $3,
+		response_status = $4, last_error = $5, delivered_at = $6 where id = $7 and status = $8 and attempts = $9`,
+		d.Status, d.NextAttemptAt, d.LastAttemptAt, d.ResponseStatus, d.LastError, d.DeliveredAt, d.ID,
+		webhook.DeliveryPending, d.Attempts,
+	)
+	if err != nil {
+		return wrapError(err)
+	}
+	if ct.RowsAffected() != 1 {
+		return errors.RecordNotFound
+	}
+	return nil
+}
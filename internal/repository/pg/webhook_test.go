@@ -0,0 +1,129 @@
+package pg
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
+	"github.com/guoxiaopeng875/wallet/internal/webhook"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestWebhookRepository_Subscriptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		wr := NewWebhookRepository(NewRepository(pool))
+		_, err := wr.Get(ctx, 1)
+		assert.True(t, errors.Is(err, errors.WebhookNotFound), "Get() error = %v", err)
+
+		s := &webhook.Subscription{
+			URL:        "https://example.com/hook",
+			EventTypes: []outbox.Type{"wallet.credited", "wallet.debited"},
+			WalletIDs:  []uint{1, 3},
+			Secret:     "whsec_0123456789",
+			OwnerID:    "key1",
+			TenantID:   "acme",
+			CreatedAt:  time.Date(2024, 11, 5, 0, 0, 0, 0, time.Local),
+		}
+		require.NoError(t, wr.Create(ctx, s))
+		assert.Equal(t, uint(1), s.ID)
+		other := &webhook.Subscription{URL: "https://example.com/other", EventTypes: []outbox.Type{}, WalletIDs: []uint{},
+			Secret: "whsec_0123456789", TenantID: "globex", CreatedAt: s.CreatedAt}
+		require.NoError(t, wr.Create(ctx, other))
+
+		got, err := wr.Get(ctx, s.ID)
+		require.NoError(t, err)
+		assert.Equal(t, s, got)
+		got, err = wr.Get(tenant.NewContext(ctx, "acme"), s.ID)
+		require.NoError(t, err)
+		assert.Equal(t, s, got)
+		// scoped to the tenant of the context
+		_, err = wr.Get(tenant.NewContext(ctx, "globex"), s.ID)
+		assert.True(t, errors.Is(err, errors.WebhookNotFound), "Get() error = %v", err)
+
+		list, err := wr.ListByTenant(ctx, "globex")
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, *other, list[0])
+	})
+}
+
+func TestWebhookRepository_Deliveries(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	runTest(ctx, t, func(ctx context.Context, t testing.TB, pool *pgxpool.Pool) {
+		repo := NewRepository(pool)
+		wr := NewWebhookRepository(repo)
+		now := time.Date(2024, 11, 5, 0, 0, 0, 0, time.Local)
+		s := &webhook.Subscription{URL: "https://example.com/hook", EventTypes: []outbox.Type{}, WalletIDs: []uint{},
+			Secret: "whsec_0123456789", TenantID: tenant.Default, CreatedAt: now}
+		require.NoError(t, wr.Create(ctx, s))
+
+		var deliveries []*webhook.Delivery
+		for eventID := uint(1); eventID <= 3; eventID++ {
+			d := &webhook.Delivery{
+				SubscriptionID: s.ID,
+				EventID:        eventID,
+				EventType:      "wallet.credited",
+				Payload:        []byte(`{"id": 1}`),
+				Status:         webhook.DeliveryPending,
+				NextAttemptAt:  now.Add(time.Duration(eventID) * time.Minute),
+				CreatedAt:      now,
+			}
+			require.NoError(t, wr.CreateDelivery(ctx, d))
+			assert.Equal(t, eventID, d.ID)
+			deliveries = append(deliveries, d)
+		}
+		// an event is delivered once to a subscription
+		dup := *deliveries[0]
+		dup.ID = 0
+		require.NoError(t, wr.CreateDelivery(ctx, &dup))
+		assert.Zero(t, dup.ID)
+
+		claimed, err := wr.ClaimDeliveries(ctx, now.Add(2*time.Minute), now.Add(time.Hour), 10)
+		require.NoError(t, err)
+		require.Len(t, claimed, 2)
+		assert.Equal(t, []uint{1, 2}, []uint{claimed[0].ID, claimed[1].ID})
+		assert.Equal(t, 1, claimed[0].Attempts)
+		assert.True(t, claimed[0].NextAttemptAt.Equal(now.Add(time.Hour)))
+		// claimed deliveries aren't due until the claim times out
+		again, err := wr.ClaimDeliveries(ctx, now.Add(2*time.Minute), now.Add(time.Hour), 10)
+		require.NoError(t, err)
+		assert.Empty(t, again)
+
+		d := &claimed[0]
+		at := now.Add(time.Minute)
+		d.Status, d.ResponseStatus, d.LastAttemptAt, d.DeliveredAt = webhook.DeliveryDelivered, 200, &at, &at
+		require.NoError(t, wr.UpdateDelivery(ctx, d))
+		// the outcome is recorded once
+		assert.True(t, errors.Is(wr.UpdateDelivery(ctx, d), errors.RecordNotFound))
+		d = &claimed[1]
+		d.Status, d.NextAttemptAt, d.LastAttemptAt = webhook.DeliveryDead, at, &at
+		d.ResponseStatus, d.LastError = 500, "webhook responded 500 Internal Server Error"
+		// an attempt claimed again since is refused
+		stale := *d
+		stale.Attempts = 0
+		assert.True(t, errors.Is(wr.UpdateDelivery(ctx, &stale), errors.RecordNotFound))
+		require.NoError(t, wr.UpdateDelivery(ctx, d))
+		assert.True(t, errors.Is(wr.UpdateDelivery(ctx, &webhook.Delivery{ID: 9}), errors.RecordNotFound))
+
+		claimed, err = wr.ClaimDeliveries(ctx, now.Add(time.Hour), now.Add(2*time.Hour), 10)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+		assert.Equal(t, uint(3), claimed[0].ID)
+
+		list, err := wr.ListDeliveries(ctx, s.ID, 2)
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.Equal(t, uint(3), list[0].ID)
+		assert.Equal(t, webhook.DeliveryDead, list[1].Status)
+		assert.Equal(t, 500, list[1].ResponseStatus)
+		assert.JSONEq(t, `{"id": 1}`, string(list[1].Payload))
+
+	})
+}
@@ -0,0 +1,172 @@
+// Package seed loads demo and staging data from a fixture file.
+// Wallets and transactions go through the wallet use cases, so balances,
+// history and the journal stay consistent as if the API had been called.
+package seed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/wallet"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Fixture is the content of a fixture file.
+type Fixture struct {
+	Wallets []Wallet `json:"wallets" yaml:"wallets"`
+	// Transactions are posted in order, after all wallets are created
+	Transactions []Transaction `json:"transactions" yaml:"transactions"`
+}
+
+// Wallet is a wallet to create, referred to by Ref in the transactions.
+type Wallet struct {
+	Ref      string `json:"ref" yaml:"ref"`
+	Currency string `json:"currency" yaml:"currency"`
+	// Status is applied once the transactions are posted, active by default
+	Status wallet.Status `json:"status,omitempty" yaml:"status,omitempty"`
+}
+
+// Transaction is a deposit, withdrawal or transfer between fixture wallets.
+// A transfer between wallets of different currencies is converted at the current rate.
+type Transaction struct {
+	Method transaction.Method `json:"method" yaml:"method"`
+	From   string             `json:"from,omitempty" yaml:"from,omitempty"`
+	To     string             `json:"to,omitempty" yaml:"to,omitempty"`
+	Amount decimal.Decimal    `json:"amount" yaml:"amount"`
+	// At is when the transaction happened, now if unset
+	At *time.Time `json:"at,omitempty" yaml:"at,omitempty"`
+}
+
+// LoadFile reads a fixture from a JSON file, or a YAML file if its extension is .yaml or .yml.
+// Unknown fields are refused so typos don't go unnoticed.
+func LoadFile(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f Fixture
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&f)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode fixture file %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Validate checks the references and methods of the fixture before anything is loaded.
+func (f *Fixture) Validate() error {
+	refs := make(map[string]bool, len(f.Wallets))
+	for i, w := range f.Wallets {
+		if w.Ref == "" {
+			return fmt.Errorf("wallet %d has no ref", i)
+		}
+		if refs[w.Ref] {
+			return fmt.Errorf("wallet ref %q is used twice", w.Ref)
+		}
+		switch w.Status {
+		case "", wallet.StatusActive, wallet.StatusFrozen, wallet.StatusClosed:
+		default:
+			return fmt.Errorf("wallet %q has unknown status %q", w.Ref, w.Status)
+		}
+		refs[w.Ref] = true
+	}
+	for i, tx := range f.Transactions {
+		var needFrom, needTo bool
+		switch tx.Method {
+		case transaction.MethodDeposit:
+			needTo = true
+		case transaction.MethodWithdraw:
+			needFrom = true
+		case transaction.MethodTransfer:
+			needFrom, needTo = true, true
+		default:
+			return fmt.Errorf("transaction %d: unsupported method %q", i, tx.Method)
+		}
+		if needFrom != (tx.From != "") {
+			return fmt.Errorf("transaction %d: from is required for a withdraw or transfer and not allowed otherwise", i)
+		}
+		if needTo != (tx.To != "") {
+			return fmt.Errorf("transaction %d: to is required for a deposit or transfer and not allowed otherwise", i)
+		}
+		for _, ref := range []string{tx.From, tx.To} {
+			if ref != "" && !refs[ref] {
+				return fmt.Errorf("transaction %d: unknown wallet ref %q", i, ref)
+			}
+		}
+	}
+	return nil
+}
+
+// Load creates the wallets of the fixture, posts its transactions and applies the wallet statuses.
+// It returns the IDs of the created wallets by ref. Loading stops at the first failure,
+// what was loaded until then stays.
+func Load(ctx context.Context, uc wallet.UseCase, f *Fixture) (map[string]uint, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	wallets := make(map[string]*wallet.Wallet, len(f.Wallets))
+	ids := make(map[string]uint, len(f.Wallets))
+	for _, w := range f.Wallets {
+		created, err := uc.CreateWallet(ctx, w.Currency)
+		if err != nil {
+			return ids, fmt.Errorf("failed to create wallet %q: %w", w.Ref, err)
+		}
+		wallets[w.Ref], ids[w.Ref] = created, created.ID
+	}
+
+	for i, tx := range f.Transactions {
+		if err := post(ctx, uc, wallets, tx); err != nil {
+			return ids, fmt.Errorf("failed to post transaction %d (%s): %w", i, tx.Method, err)
+		}
+	}
+
+	for _, w := range f.Wallets {
+		var err error
+		switch w.Status {
+		case wallet.StatusFrozen:
+			_, err = uc.FreezeWallet(ctx, ids[w.Ref])
+		case wallet.StatusClosed:
+			_, err = uc.CloseWallet(ctx, ids[w.Ref])
+		}
+		if err != nil {
+			return ids, fmt.Errorf("failed to set status of wallet %q: %w", w.Ref, err)
+		}
+	}
+	return ids, nil
+}
+
+func post(ctx context.Context, uc wallet.UseCase, wallets map[string]*wallet.Wallet, tx Transaction) error {
+	if tx.At != nil {
+		ctx = wallet.ContextWithTxAt(ctx, *tx.At)
+	}
+	switch tx.Method {
+	case transaction.MethodDeposit:
+		return uc.Deposit(ctx, wallets[tx.To].ID, tx.Amount)
+	case transaction.MethodWithdraw:
+		return uc.Withdraw(ctx, wallets[tx.From].ID, tx.Amount)
+	}
+	from, to := wallets[tx.From], wallets[tx.To]
+	if from.Currency == to.Currency {
+		return uc.Transfer(ctx, from.ID, to.ID, tx.Amount)
+	}
+	quote, err := uc.QuoteTransfer(ctx, from.ID, to.ID, tx.Amount)
+	if err != nil {
+		return err
+	}
+	return uc.ConvertTransfer(ctx, from.ID, to.ID, tx.Amount, quote.ID)
+}
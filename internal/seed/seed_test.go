@@ -0,0 +1,203 @@
+package seed
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+	"github.com/guoxiaopeng875/wallet/internal/ledger"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/wallet"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
+	"github.com/shopspring/decimal"
+	"testing"
+	"time"
+)
+
+type mockDBTx struct{}
+
+func (m *mockDBTx) ExecTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func setupTest(t *testing.T) (wallet.UseCase, *ledger.MockRepository) {
+	ctx := context.Background()
+	ledgerRepo := ledger.NewMockRepository()
+	fxUC := fx.NewUseCase(fx.NewMockRateRepository(), fx.NewMockQuoteRepository(), time.Minute)
+	err := fxUC.LoadRates(ctx, []*fx.Rate{
+		{Base: "USD", Quote: "EUR", Rate: decimal.NewFromFloat(0.9), ValidFrom: time.Now().Add(-time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("LoadRates() error = %v", err)
+	}
+	uc := wallet.NewUseCase(
+		wallet.NewMockRepository(),
+		wallet.NewMockTransactionRepository(),
+		wallet.NewMockHoldRepository(),
+		ledgerRepo,
+		outbox.NewMockRepository(),
+		&mockDBTx{},
+		fxUC,
+	)
+	return uc, ledgerRepo
+}
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "json", path: "testdata/fixture.json"},
+		{name: "yaml", path: "testdata/fixture.yaml"},
+		{name: "unknown field", path: "testdata/unknown_field.yaml", wantErr: true},
+		{name: "missing file", path: "testdata/missing.json", wantErr: true},
+		{name: "invalid json", path: "seed.go", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := LoadFile(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(f.Wallets) != 3 || len(f.Transactions) != 4 {
+				t.Fatalf("LoadFile() = %d wallets and %d transactions, want 3 and 4", len(f.Wallets), len(f.Transactions))
+			}
+			if got := f.Transactions[1].Amount.String(); got != "250.5" {
+				t.Errorf("LoadFile() amount = %v, want 250.5", got)
+			}
+			if at := f.Transactions[0].At; at == nil || !at.Equal(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)) || f.Transactions[1].At != nil {
+				t.Errorf("LoadFile() at = %v and %v, want the time of the deposit only", at, f.Transactions[1].At)
+			}
+			if f.Wallets[2].Status != wallet.StatusFrozen {
+				t.Errorf("LoadFile() status = %v, want %v", f.Wallets[2].Status, wallet.StatusFrozen)
+			}
+		})
+	}
+}
+
+func TestFixture_Validate(t *testing.T) {
+	wallets := []Wallet{{Ref: "a", Currency: "USD"}, {Ref: "b", Currency: "USD"}}
+	amount := decimal.NewFromInt(1)
+	tests := []struct {
+		name    string
+		fixture Fixture
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			fixture: Fixture{Wallets: wallets, Transactions: []Transaction{
+				{Method: transaction.MethodDeposit, To: "a", Amount: amount},
+				{Method: transaction.MethodTransfer, From: "a", To: "b", Amount: amount},
+				{Method: transaction.MethodWithdraw, From: "b", Amount: amount},
+			}},
+		},
+		{name: "missing ref", fixture: Fixture{Wallets: []Wallet{{Currency: "USD"}}}, wantErr: true},
+		{name: "duplicate ref", fixture: Fixture{Wallets: []Wallet{{Ref: "a"}, {Ref: "a"}}}, wantErr: true},
+		{name: "unknown status", fixture: Fixture{Wallets: []Wallet{{Ref: "a", Status: "asleep"}}}, wantErr: true},
+		{
+			name:    "unknown wallet",
+			fixture: Fixture{Wallets: wallets, Transactions: []Transaction{{Method: transaction.MethodDeposit, To: "z", Amount: amount}}},
+			wantErr: true,
+		},
+		{
+			name:    "deposit from a wallet",
+			fixture: Fixture{Wallets: wallets, Transactions: []Transaction{{Method: transaction.MethodDeposit, From: "a", To: "b", Amount: amount}}},
+			wantErr: true,
+		},
+		{
+			name:    "transfer without source",
+			fixture: Fixture{Wallets: wallets, Transactions: []Transaction{{Method: transaction.MethodTransfer, To: "b", Amount: amount}}},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported method",
+			fixture: Fixture{Wallets: wallets, Transactions: []Transaction{{Method: transaction.MethodCapture, From: "a", Amount: amount}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fixture.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	uc, ledgerRepo := setupTest(t)
+	f, err := LoadFile("testdata/fixture.yaml")
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	ids, err := Load(ctx, uc, f)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := map[string]struct {
+		balance string
+		status  wallet.Status
+	}{
+		"alice": {balance: "649.5", status: wallet.StatusActive},
+		"bob":   {balance: "200.5", status: wallet.StatusActive},
+		"carol": {balance: "90", status: wallet.StatusFrozen},
+	}
+	for ref, w := range want {
+		got, err := uc.Wallet(ctx, ids[ref])
+		if err != nil {
+			t.Fatalf("Wallet(%s) error = %v", ref, err)
+		}
+		if got.Balance.String() != w.balance || got.Status != w.status {
+			t.Errorf("wallet %s = %v %v, want %v %v", ref, got.Balance, got.Status, w.balance, w.status)
+		}
+	}
+
+	// every transaction posted a balanced journal entry, at the time of the fixture or now
+	for id := range uint(len(f.Transactions)) {
+		entries, err := ledgerRepo.ListByTransactionID(ctx, id+1)
+		if err != nil || len(entries) != 1 {
+			t.Errorf("journal entries of transaction %d = %v, %v, want one", id+1, entries, err)
+			continue
+		}
+		if at := f.Transactions[id].At; at != nil && !entries[0].CreatedAt.Equal(*at) || at == nil && time.Since(entries[0].CreatedAt) > time.Minute {
+			t.Errorf("journal entry of transaction %d created at %v, want %v", id+1, entries[0].CreatedAt, at)
+		}
+	}
+	page, err := uc.WalletTransactions(ctx, ids["alice"], transaction.Filter{})
+	if err != nil {
+		t.Fatalf("WalletTransactions() error = %v", err)
+	}
+	for _, tx := range page.Transactions {
+		if tx.ID == 1 && !tx.TxAt.Equal(*f.Transactions[0].At) {
+			t.Errorf("deposit at %v, want %v", tx.TxAt, *f.Transactions[0].At)
+		}
+	}
+}
+
+func TestLoadFailure(t *testing.T) {
+	ctx := context.Background()
+	uc, _ := setupTest(t)
+	f := &Fixture{
+		Wallets: []Wallet{{Ref: "a", Currency: "USD"}},
+		Transactions: []Transaction{
+			{Method: transaction.MethodDeposit, To: "a", Amount: decimal.NewFromInt(10)},
+			{Method: transaction.MethodWithdraw, From: "a", Amount: decimal.NewFromInt(20)},
+		},
+	}
+
+	ids, err := Load(ctx, uc, f)
+	if !errors.Is(err, errors.InsufficientBalance) {
+		t.Fatalf("Load() error = %v, want %v", err, errors.InsufficientBalance)
+	}
+	if _, ok := ids["a"]; !ok {
+		t.Errorf("Load() ids = %v, want the wallets created before the failure", ids)
+	}
+}
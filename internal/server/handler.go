@@ -1,87 +1,365 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/metrics"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace"
 	"github.com/guoxiaopeng875/wallet/internal/wallet"
+	"github.com/guoxiaopeng875/wallet/internal/webhook"
 	"net/http"
+	"time"
 )
 
 // Handler handles HTTP requests for wallet operations
 type Handler struct {
-	uc wallet.UseCase
+	uc       wallet.UseCase
+	rates    fx.UseCase
+	webhooks webhook.UseCase
+	metrics  *metrics.Registry
+	tracer   *trace.Tracer
 }
 
-func NewHandler(uc wallet.UseCase) *Handler {
-	return &Handler{uc: uc}
+// Option configures optional Handler dependencies
+type Option func(h *Handler)
+
+// WithRates enables the FX rate admin endpoints
+func WithRates(rates fx.UseCase) Option {
+	return func(h *Handler) {
+		h.rates = rates
+	}
+}
+
+// WithWebhooks enables the webhook subscription endpoints
+func WithWebhooks(webhooks webhook.UseCase) Option {
+	return func(h *Handler) {
+		h.webhooks = webhooks
+	}
+}
+
+// WithMetrics serves the metrics of the registry on /metrics and counts the requests in it
+func WithMetrics(reg *metrics.Registry) Option {
+	return func(h *Handler) {
+		h.metrics = reg
+	}
+}
+
+// WithTracer traces every request in a span of its route, continuing the trace of its traceparent header
+func WithTracer(tracer *trace.Tracer) Option {
+	return func(h *Handler) {
+		h.tracer = tracer
+	}
+}
+
+func NewHandler(uc wallet.UseCase, opts ...Option) *Handler {
+	h := &Handler{uc: uc}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // Deposit handles wallet deposit requests
 func (h *Handler) Deposit(w http.ResponseWriter, r *http.Request) {
-	id, req := parseWalletID(w, r), &DepositRequest{}
+	id, req := parseID(w, r, "id"), &DepositRequest{}
 	if id == 0 || !parseReqBody(w, r, req) {
 		return
 	}
 
 	if err := h.uc.Deposit(r.Context(), id, req.Amount); err != nil {
-		handleError(w, err)
+		handleError(w, r, err)
 		return
 	}
-	renderJSON(w, http.StatusOK, nil)
+	renderJSON(w, r, http.StatusOK, nil)
 }
 
 // Withdraw handles wallet withdrawal requests
 func (h *Handler) Withdraw(w http.ResponseWriter, r *http.Request) {
-	id, req := parseWalletID(w, r), &WithdrawRequest{}
+	id, req := parseID(w, r, "id"), &WithdrawRequest{}
 	if id == 0 || !parseReqBody(w, r, req) {
 		return
 	}
 
 	if err := h.uc.Withdraw(r.Context(), id, req.Amount); err != nil {
-		handleError(w, err)
+		handleError(w, r, err)
 		return
 	}
-	renderJSON(w, http.StatusOK, nil)
+	renderJSON(w, r, http.StatusOK, nil)
 }
 
-// Transfer handles wallet transfer requests
+// Transfer handles wallet transfer requests, converting at the quoted rate if a quote is given
 func (h *Handler) Transfer(w http.ResponseWriter, r *http.Request) {
-	id, req := parseWalletID(w, r), &TransferRequest{}
+	id, req := parseID(w, r, "id"), &TransferRequest{}
+	if id == 0 || !parseReqBody(w, r, req) || !checkTargetWallet(w, r, id, req.TargetWalletID) {
+		return
+	}
+
+	var err error
+	if req.QuoteID != "" {
+		err = h.uc.ConvertTransfer(r.Context(), id, req.TargetWalletID, req.Amount, req.QuoteID)
+	} else {
+		err = h.uc.Transfer(r.Context(), id, req.TargetWalletID, req.Amount)
+	}
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusOK, nil)
+}
+
+// QuoteTransfer handles cross-currency transfer quote requests
+func (h *Handler) QuoteTransfer(w http.ResponseWriter, r *http.Request) {
+	id, req := parseID(w, r, "id"), &QuoteTransferRequest{}
+	if id == 0 || !parseReqBody(w, r, req) || !checkTargetWallet(w, r, id, req.TargetWalletID) {
+		return
+	}
+
+	quote, err := h.uc.QuoteTransfer(r.Context(), id, req.TargetWalletID, req.Amount)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusCreated, quote)
+}
+
+// Authorize handles requests to place a hold on a wallet
+func (h *Handler) Authorize(w http.ResponseWriter, r *http.Request) {
+	id, req := parseID(w, r, "id"), &AuthorizeRequest{}
 	if id == 0 || !parseReqBody(w, r, req) {
 		return
 	}
 
-	if err := h.uc.Transfer(r.Context(), id, req.TargetWalletID, req.Amount); err != nil {
-		handleError(w, err)
+	hold, err := h.uc.Authorize(r.Context(), id, req.Amount, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusCreated, hold)
+}
+
+// Capture handles requests to capture a hold
+func (h *Handler) Capture(w http.ResponseWriter, r *http.Request) {
+	id, holdID, req := parseID(w, r, "id"), uint(0), &CaptureRequest{}
+	if id == 0 {
+		return
+	}
+	if holdID = parseID(w, r, "holdID"); holdID == 0 || !parseReqBody(w, r, req) {
+		return
+	}
+
+	hold, err := h.uc.Capture(r.Context(), id, holdID, req.Amount)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusOK, hold)
+}
+
+// Reverse handles requests to reverse or partially refund a transaction
+func (h *Handler) Reverse(w http.ResponseWriter, r *http.Request) {
+	id, req := parseID(w, r, "id"), &ReverseRequest{}
+	if id == 0 || !parseReqBody(w, r, req) {
+		return
+	}
+
+	tx, err := h.uc.Reverse(r.Context(), id, req.Amount, req.Reason)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusCreated, tx)
+}
+
+// Void handles requests to release a hold
+func (h *Handler) Void(w http.ResponseWriter, r *http.Request) {
+	id := parseID(w, r, "id")
+	if id == 0 {
+		return
+	}
+	holdID := parseID(w, r, "holdID")
+	if holdID == 0 {
+		return
+	}
+
+	hold, err := h.uc.Void(r.Context(), id, holdID)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusOK, hold)
+}
+
+// Holds retrieves the holds placed on a wallet
+func (h *Handler) Holds(w http.ResponseWriter, r *http.Request) {
+	id := parseID(w, r, "id")
+	if id == 0 {
+		return
+	}
+
+	holds, err := h.uc.WalletHolds(r.Context(), id)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusOK, holds)
+}
+
+// LoadRates handles FX rate uploads
+func (h *Handler) LoadRates(w http.ResponseWriter, r *http.Request) {
+	var rates []*fx.Rate
+	if !parseReqBody(w, r, &rates) {
+		return
+	}
+
+	if err := h.rates.LoadRates(r.Context(), rates); err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusCreated, rates)
+}
+
+// Rate retrieves the current FX rate between the base and quote query currencies
+func (h *Handler) Rate(w http.ResponseWriter, r *http.Request) {
+	base, quote := r.URL.Query().Get("base"), r.URL.Query().Get("quote")
+	if base == "" || quote == "" {
+		handleError(w, r, errors.InvalidArgs.WithCause(fmt.Errorf("base and quote are required")))
+		return
+	}
+
+	rate, err := h.rates.Rate(r.Context(), base, quote)
+	if err != nil {
+		handleError(w, r, err)
 		return
 	}
-	renderJSON(w, http.StatusOK, nil)
+	renderJSON(w, r, http.StatusOK, rate)
+}
+
+// CreateWebhook handles webhook subscriptions, the response carries the secret signing the deliveries
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	req := &CreateWebhookRequest{}
+	if !parseReqBody(w, r, req) {
+		return
+	}
+
+	sub := &webhook.Subscription{URL: req.URL, EventTypes: req.EventTypes, WalletIDs: req.WalletIDs, Secret: req.Secret}
+	if err := h.webhooks.CreateSubscription(r.Context(), sub); err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusCreated, &WebhookResponse{Subscription: sub, Secret: sub.Secret})
+}
+
+// Webhook retrieves a webhook subscription
+func (h *Handler) Webhook(w http.ResponseWriter, r *http.Request) {
+	id := parseID(w, r, "id")
+	if id == 0 {
+		return
+	}
+
+	sub, err := h.webhooks.Subscription(r.Context(), id)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusOK, &WebhookResponse{Subscription: sub})
+}
+
+// WebhookDeliveries retrieves the latest deliveries of a webhook subscription and their attempts
+func (h *Handler) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := parseID(w, r, "id")
+	if id == 0 {
+		return
+	}
+
+	deliveries, err := h.webhooks.Deliveries(r.Context(), id)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusOK, deliveries)
 }
 
 // Balance retrieves wallet balance
 func (h *Handler) Balance(w http.ResponseWriter, r *http.Request) {
-	id := parseWalletID(w, r)
+	id := parseID(w, r, "id")
 	if id == 0 {
 		return
 	}
 
 	wallet, err := h.uc.Wallet(r.Context(), id)
 	if err != nil {
-		handleError(w, err)
+		handleError(w, r, err)
 		return
 	}
-	renderJSON(w, http.StatusOK, &BalanceResponse{Balance: wallet.Balance.String()})
+	renderJSON(w, r, http.StatusOK, &BalanceResponse{
+		Balance:   wallet.Balance.String(),
+		Available: wallet.Available().String(),
+		Currency:  wallet.Currency,
+	})
 }
 
 // Transactions retrieves wallet transaction history
 func (h *Handler) Transactions(w http.ResponseWriter, r *http.Request) {
-	id := parseWalletID(w, r)
+	id := parseID(w, r, "id")
+	if id == 0 {
+		return
+	}
+
+	filter, ok := parseTransactionFilter(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := h.uc.WalletTransactions(r.Context(), id, filter)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusOK, page)
+}
+
+// CreateWallet handles wallet creation requests
+func (h *Handler) CreateWallet(w http.ResponseWriter, r *http.Request) {
+	req := &CreateWalletRequest{}
+	if !parseReqBody(w, r, req) {
+		return
+	}
+
+	wallet, err := h.uc.CreateWallet(r.Context(), req.Currency)
+	if err != nil {
+		handleError(w, r, err)
+		return
+	}
+	renderJSON(w, r, http.StatusCreated, newWalletResponse(wallet))
+}
+
+// FreezeWallet handles wallet freeze requests
+func (h *Handler) FreezeWallet(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, h.uc.FreezeWallet)
+}
+
+// UnfreezeWallet handles wallet unfreeze requests
+func (h *Handler) UnfreezeWallet(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, h.uc.UnfreezeWallet)
+}
+
+// CloseWallet handles wallet close requests
+func (h *Handler) CloseWallet(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, h.uc.CloseWallet)
+}
+
+func (h *Handler) changeStatus(w http.ResponseWriter, r *http.Request, fn func(ctx context.Context, walletID uint) (*wallet.Wallet, error)) {
+	id := parseID(w, r, "id")
 	if id == 0 {
 		return
 	}
 
-	txs, err := h.uc.WalletTransactions(r.Context(), id)
+	wallet, err := fn(r.Context(), id)
 	if err != nil {
-		handleError(w, err)
+		handleError(w, r, err)
 		return
 	}
-	renderJSON(w, http.StatusOK, txs)
+	renderJSON(w, r, http.StatusOK, newWalletResponse(wallet))
 }
@@ -4,14 +4,23 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
 	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
 	"github.com/guoxiaopeng875/wallet/internal/server/mocks"
 	"github.com/guoxiaopeng875/wallet/internal/wallet"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/hold"
 	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
+	"github.com/guoxiaopeng875/wallet/internal/webhook"
 	"github.com/shopspring/decimal"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -64,6 +73,19 @@ func TestHandler_Deposit(t *testing.T) {
 			},
 			wantStatus: http.StatusInternalServerError,
 		},
+		{
+			name:     "concurrent update",
+			walletID: "1",
+			reqBody: DepositRequest{
+				Amount: decimal.NewFromFloat(100),
+			},
+			mockSetup: func(m *mocks.MockUseCase) {
+				m.OnDeposit = func(ctx context.Context, id uint, amount decimal.Decimal) error {
+					return errors.ConcurrentUpdate
+				}
+			},
+			wantStatus: http.StatusConflict,
+		},
 	}
 
 	for _, tt := range tests {
@@ -123,6 +145,19 @@ func TestHandler_Withdraw(t *testing.T) {
 			reqBody:    "invalid json",
 			wantStatus: http.StatusBadRequest,
 		},
+		{
+			name:     "wallet of another owner",
+			walletID: "1",
+			reqBody: WithdrawRequest{
+				Amount: decimal.NewFromFloat(10.0),
+			},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnWithdraw = func(ctx context.Context, id uint, amount decimal.Decimal) error {
+					return errors.Forbidden
+				}
+			},
+			wantStatus: http.StatusForbidden,
+		},
 		{
 			name:     "insufficient balance",
 			walletID: "1",
@@ -134,7 +169,7 @@ func TestHandler_Withdraw(t *testing.T) {
 					return errors.InsufficientBalance
 				}
 			},
-			wantStatus: http.StatusBadRequest,
+			wantStatus: http.StatusUnprocessableEntity,
 		},
 		{
 			name:     "wallet not found",
@@ -162,6 +197,19 @@ func TestHandler_Withdraw(t *testing.T) {
 			},
 			wantStatus: http.StatusInternalServerError,
 		},
+		{
+			name:     "frozen wallet",
+			walletID: "1",
+			reqBody: WithdrawRequest{
+				Amount: decimal.NewFromFloat(50.0),
+			},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnWithdraw = func(ctx context.Context, id uint, amount decimal.Decimal) error {
+					return errors.WalletFrozen
+				}
+			},
+			wantStatus: http.StatusLocked,
+		},
 		{
 			name:     "negative amount",
 			walletID: "1",
@@ -248,7 +296,7 @@ func TestHandler_Transfer(t *testing.T) {
 					return errors.InsufficientBalance
 				}
 			},
-			wantStatus: http.StatusBadRequest,
+			wantStatus: http.StatusUnprocessableEntity,
 		},
 		{
 			name:     "source wallet not found",
@@ -307,17 +355,59 @@ func TestHandler_Transfer(t *testing.T) {
 			wantStatus: http.StatusBadRequest,
 		},
 		{
-			name:     "same wallet transfer",
+			name:     "cross currency transfer",
 			walletID: "1",
 			reqBody: TransferRequest{
-				TargetWalletID: 1,
+				TargetWalletID: 5,
 				Amount:         decimal.NewFromFloat(50.0),
 			},
 			setupMock: func(m *mocks.MockUseCase) {
 				m.OnTransfer = func(ctx context.Context, fromID, toID uint, amount decimal.Decimal) error {
-					return errors.InvalidArgs
+					return errors.CurrencyMismatch
+				}
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:     "quoted cross currency transfer",
+			walletID: "1",
+			reqBody: TransferRequest{
+				TargetWalletID: 5,
+				Amount:         decimal.NewFromFloat(50.0),
+				QuoteID:        "q1",
+			},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnConvertTransfer = func(ctx context.Context, fromID, toID uint, amount decimal.Decimal, quoteID string) error {
+					if quoteID != "q1" {
+						return errors.QuoteMismatch
+					}
+					return nil
+				}
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:     "expired quote",
+			walletID: "1",
+			reqBody: TransferRequest{
+				TargetWalletID: 5,
+				Amount:         decimal.NewFromFloat(50.0),
+				QuoteID:        "q1",
+			},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnConvertTransfer = func(ctx context.Context, fromID, toID uint, amount decimal.Decimal, quoteID string) error {
+					return errors.QuoteExpired
 				}
 			},
+			wantStatus: http.StatusGone,
+		},
+		{
+			name:     "same wallet transfer",
+			walletID: "1",
+			reqBody: TransferRequest{
+				TargetWalletID: 1,
+				Amount:         decimal.NewFromFloat(50.0),
+			},
 			wantStatus: http.StatusBadRequest,
 		},
 	}
@@ -358,13 +448,30 @@ func TestHandler_Balance(t *testing.T) {
 			setupMock: func(m *mocks.MockUseCase) {
 				m.OnWallet = func(ctx context.Context, id uint) (*wallet.Wallet, error) {
 					return &wallet.Wallet{
-						ID:      1,
-						Balance: decimal.NewFromFloat(100.50),
+						ID:       1,
+						Currency: "USD",
+						Balance:  decimal.NewFromFloat(100.50),
+					}, nil
+				}
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"balance":"100.5","available":"100.5","currency":"USD"}`,
+		},
+		{
+			name:     "balance with holds",
+			walletID: "1",
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnWallet = func(ctx context.Context, id uint) (*wallet.Wallet, error) {
+					return &wallet.Wallet{
+						ID:       1,
+						Currency: "USD",
+						Balance:  decimal.NewFromFloat(100.50),
+						Held:     decimal.NewFromFloat(40),
 					}, nil
 				}
 			},
 			wantStatus: http.StatusOK,
-			wantBody:   `{"balance":"100.5"}`,
+			wantBody:   `{"balance":"100.5","available":"60.5","currency":"USD"}`,
 		},
 		{
 			name:       "invalid wallet ID",
@@ -437,35 +544,95 @@ func TestHandler_Transactions(t *testing.T) {
 			FromWalletID: 1,
 		},
 	}
+	cursor := transaction.Cursor{TxAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), ID: 2}
 
 	tests := []struct {
 		name       string
 		walletID   string
+		query      string
 		setupMock  func(*mocks.MockUseCase)
 		wantStatus int
-		wantTxs    []transaction.Transaction
+		wantPage   *transaction.Page
 	}{
 		{
 			name:     "successful transactions retrieval",
 			walletID: "1",
 			setupMock: func(m *mocks.MockUseCase) {
-				m.OnWalletTransactions = func(ctx context.Context, id uint) ([]transaction.Transaction, error) {
-					return mockTxs, nil
+				m.OnWalletTransactions = func(ctx context.Context, id uint, filter transaction.Filter) (*transaction.Page, error) {
+					return &transaction.Page{Transactions: mockTxs, NextCursor: cursor.String()}, nil
+				}
+			},
+			wantStatus: http.StatusOK,
+			wantPage:   &transaction.Page{Transactions: mockTxs, NextCursor: cursor.String()},
+		},
+		{
+			name:     "filters and cursor",
+			walletID: "1",
+			query: "?method=deposit,withdraw&method=transfer&from=2024-01-01T00:00:00Z&to=2024-02-01T00:00:00Z" +
+				"&min_amount=10&max_amount=99.5&counterparty=2&order=asc&limit=20&cursor=" + cursor.String(),
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnWalletTransactions = func(ctx context.Context, id uint, filter transaction.Filter) (*transaction.Page, error) {
+					want := transaction.Filter{
+						Methods:        []transaction.Method{transaction.MethodDeposit, transaction.MethodWithdraw, transaction.MethodTransfer},
+						From:           time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+						To:             time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+						MinAmount:      decimal.NewNullDecimal(decimal.NewFromInt(10)),
+						MaxAmount:      decimal.NewNullDecimal(decimal.RequireFromString("99.5")),
+						CounterpartyID: 2,
+						Order:          transaction.OrderAsc,
+						Limit:          20,
+					}
+					if len(filter.Methods) != len(want.Methods) || !filter.From.Equal(want.From) || !filter.To.Equal(want.To) ||
+						!filter.MinAmount.Decimal.Equal(want.MinAmount.Decimal) || !filter.MaxAmount.Decimal.Equal(want.MaxAmount.Decimal) ||
+						filter.CounterpartyID != want.CounterpartyID || filter.Order != want.Order || filter.Limit != want.Limit ||
+						filter.After == nil || filter.After.ID != cursor.ID || !filter.After.TxAt.Equal(cursor.TxAt) {
+						t.Errorf("WalletTransactions() filter = %+v, want %+v", filter, want)
+					}
+					return &transaction.Page{Transactions: []transaction.Transaction{}}, nil
 				}
 			},
 			wantStatus: http.StatusOK,
-			wantTxs:    mockTxs,
+			wantPage:   &transaction.Page{Transactions: []transaction.Transaction{}},
 		},
 		{
 			name:       "invalid wallet ID",
 			walletID:   "invalid",
 			wantStatus: http.StatusBadRequest,
 		},
+		{
+			name:       "invalid date",
+			walletID:   "1",
+			query:      "?from=yesterday",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid amount",
+			walletID:   "1",
+			query:      "?min_amount=ten",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid cursor",
+			walletID:   "1",
+			query:      "?cursor=abc",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid filter",
+			walletID: "1",
+			query:    "?limit=1000",
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnWalletTransactions = func(ctx context.Context, id uint, filter transaction.Filter) (*transaction.Page, error) {
+					return nil, errors.InvalidArgs
+				}
+			},
+			wantStatus: http.StatusBadRequest,
+		},
 		{
 			name:     "wallet not found",
 			walletID: "999",
 			setupMock: func(m *mocks.MockUseCase) {
-				m.OnWalletTransactions = func(ctx context.Context, id uint) ([]transaction.Transaction, error) {
+				m.OnWalletTransactions = func(ctx context.Context, id uint, filter transaction.Filter) (*transaction.Page, error) {
 					return nil, errors.RecordNotFound
 				}
 			},
@@ -475,7 +642,7 @@ func TestHandler_Transactions(t *testing.T) {
 			name:     "internal server error",
 			walletID: "1",
 			setupMock: func(m *mocks.MockUseCase) {
-				m.OnWalletTransactions = func(ctx context.Context, id uint) ([]transaction.Transaction, error) {
+				m.OnWalletTransactions = func(ctx context.Context, id uint, filter transaction.Filter) (*transaction.Page, error) {
 					return nil, errors.InternalServer
 				}
 			},
@@ -485,12 +652,12 @@ func TestHandler_Transactions(t *testing.T) {
 			name:     "empty transaction list",
 			walletID: "1",
 			setupMock: func(m *mocks.MockUseCase) {
-				m.OnWalletTransactions = func(ctx context.Context, id uint) ([]transaction.Transaction, error) {
-					return []transaction.Transaction{}, nil
+				m.OnWalletTransactions = func(ctx context.Context, id uint, filter transaction.Filter) (*transaction.Page, error) {
+					return &transaction.Page{Transactions: []transaction.Transaction{}}, nil
 				}
 			},
 			wantStatus: http.StatusOK,
-			wantTxs:    []transaction.Transaction{},
+			wantPage:   &transaction.Page{Transactions: []transaction.Transaction{}},
 		},
 	}
 
@@ -502,7 +669,7 @@ func TestHandler_Transactions(t *testing.T) {
 			}
 
 			h := NewHandler(mockUC)
-			req := httptest.NewRequest(http.MethodGet, "/wallets/"+tt.walletID+"/transactions", nil)
+			req := httptest.NewRequest(http.MethodGet, "/wallets/"+tt.walletID+"/transactions"+tt.query, nil)
 			req = mux.SetURLVars(req, map[string]string{"id": tt.walletID})
 			w := httptest.NewRecorder()
 
@@ -512,14 +679,891 @@ func TestHandler_Transactions(t *testing.T) {
 				t.Errorf("Transactions() status = %v, want %v", w.Code, tt.wantStatus)
 			}
 
-			if tt.wantTxs != nil {
-				var gotTxs []transaction.Transaction
-				if err := json.NewDecoder(w.Body).Decode(&gotTxs); err != nil {
+			if tt.wantPage != nil {
+				var gotPage transaction.Page
+				if err := json.NewDecoder(w.Body).Decode(&gotPage); err != nil {
 					t.Errorf("Failed to decode response body: %v", err)
 				}
-				if len(gotTxs) != len(tt.wantTxs) {
-					t.Errorf("Transactions() returned %d transactions, want %d", len(gotTxs), len(tt.wantTxs))
+				if len(gotPage.Transactions) != len(tt.wantPage.Transactions) {
+					t.Errorf("Transactions() returned %d transactions, want %d", len(gotPage.Transactions), len(tt.wantPage.Transactions))
+				}
+				if gotPage.NextCursor != tt.wantPage.NextCursor {
+					t.Errorf("Transactions() next cursor = %q, want %q", gotPage.NextCursor, tt.wantPage.NextCursor)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_CreateWallet(t *testing.T) {
+	tests := []struct {
+		name       string
+		reqBody    interface{}
+		setupMock  func(*mocks.MockUseCase)
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:    "successful creation",
+			reqBody: CreateWalletRequest{Currency: "EUR"},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnCreateWallet = func(ctx context.Context, currency string) (*wallet.Wallet, error) {
+					return &wallet.Wallet{ID: 6, Currency: currency, Balance: decimal.Zero, Status: wallet.StatusActive}, nil
+				}
+			},
+			wantStatus: http.StatusCreated,
+			wantBody:   `{"id":6,"currency":"EUR","balance":"0","available":"0","status":"active"}`,
+		},
+		{
+			name:       "invalid request body",
+			reqBody:    "invalid json",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "unsupported currency",
+			reqBody: CreateWalletRequest{Currency: "XXX"},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnCreateWallet = func(ctx context.Context, currency string) (*wallet.Wallet, error) {
+					return nil, errors.UnsupportedCurrency
+				}
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "internal server error",
+			reqBody: CreateWalletRequest{Currency: "USD"},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnCreateWallet = func(ctx context.Context, currency string) (*wallet.Wallet, error) {
+					return nil, errors.InternalServer
+				}
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUC := &mocks.MockUseCase{}
+			if tt.setupMock != nil {
+				tt.setupMock(mockUC)
+			}
+
+			h := NewHandler(mockUC)
+			body, _ := json.Marshal(tt.reqBody)
+			req := httptest.NewRequest(http.MethodPost, "/wallets", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+
+			h.CreateWallet(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("CreateWallet() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" {
+				if body := w.Body.String(); body != tt.wantBody+"\n" {
+					t.Errorf("CreateWallet() body = %v, want %v", body, tt.wantBody)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_ChangeStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		walletID   string
+		handler    func(*Handler) http.HandlerFunc
+		setupMock  func(*mocks.MockUseCase)
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:     "freeze wallet",
+			walletID: "1",
+			handler:  func(h *Handler) http.HandlerFunc { return h.FreezeWallet },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnFreezeWallet = func(ctx context.Context, id uint) (*wallet.Wallet, error) {
+					return &wallet.Wallet{ID: id, Currency: "USD", Balance: decimal.NewFromFloat(10), Status: wallet.StatusFrozen}, nil
+				}
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":1,"currency":"USD","balance":"10","available":"10","status":"frozen"}`,
+		},
+		{
+			name:     "unfreeze wallet",
+			walletID: "1",
+			handler:  func(h *Handler) http.HandlerFunc { return h.UnfreezeWallet },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnUnfreezeWallet = func(ctx context.Context, id uint) (*wallet.Wallet, error) {
+					return &wallet.Wallet{ID: id, Currency: "USD", Balance: decimal.NewFromFloat(10), Status: wallet.StatusActive}, nil
+				}
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":1,"currency":"USD","balance":"10","available":"10","status":"active"}`,
+		},
+		{
+			name:     "close wallet",
+			walletID: "1",
+			handler:  func(h *Handler) http.HandlerFunc { return h.CloseWallet },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnCloseWallet = func(ctx context.Context, id uint) (*wallet.Wallet, error) {
+					return &wallet.Wallet{ID: id, Currency: "USD", Balance: decimal.Zero, Status: wallet.StatusClosed}, nil
+				}
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"id":1,"currency":"USD","balance":"0","available":"0","status":"closed"}`,
+		},
+		{
+			name:       "invalid wallet ID",
+			walletID:   "invalid",
+			handler:    func(h *Handler) http.HandlerFunc { return h.FreezeWallet },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:     "close wallet with balance",
+			walletID: "1",
+			handler:  func(h *Handler) http.HandlerFunc { return h.CloseWallet },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnCloseWallet = func(ctx context.Context, id uint) (*wallet.Wallet, error) {
+					return nil, errors.WalletNotEmpty
+				}
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:     "reopen closed wallet",
+			walletID: "1",
+			handler:  func(h *Handler) http.HandlerFunc { return h.UnfreezeWallet },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnUnfreezeWallet = func(ctx context.Context, id uint) (*wallet.Wallet, error) {
+					return nil, errors.WalletClosed
+				}
+			},
+			wantStatus: http.StatusGone,
+		},
+		{
+			name:     "wallet not found",
+			walletID: "999",
+			handler:  func(h *Handler) http.HandlerFunc { return h.FreezeWallet },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnFreezeWallet = func(ctx context.Context, id uint) (*wallet.Wallet, error) {
+					return nil, errors.RecordNotFound
+				}
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUC := &mocks.MockUseCase{}
+			if tt.setupMock != nil {
+				tt.setupMock(mockUC)
+			}
+
+			h := NewHandler(mockUC)
+			req := httptest.NewRequest(http.MethodPost, "/wallets/"+tt.walletID, nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.walletID})
+			w := httptest.NewRecorder()
+
+			tt.handler(h)(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" {
+				if body := w.Body.String(); body != tt.wantBody+"\n" {
+					t.Errorf("body = %v, want %v", body, tt.wantBody)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_QuoteTransfer(t *testing.T) {
+	tests := []struct {
+		name       string
+		walletID   string
+		reqBody    interface{}
+		setupMock  func(*mocks.MockUseCase)
+		wantStatus int
+	}{
+		{
+			name:     "successful quote",
+			walletID: "1",
+			reqBody:  QuoteTransferRequest{TargetWalletID: 5, Amount: decimal.NewFromFloat(100)},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnQuoteTransfer = func(ctx context.Context, fromID, toID uint, amount decimal.Decimal) (*fx.Quote, error) {
+					return &fx.Quote{ID: "q1", FromWalletID: fromID, ToWalletID: toID, Amount: amount}, nil
 				}
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "invalid wallet ID",
+			walletID:   "invalid",
+			reqBody:    QuoteTransferRequest{TargetWalletID: 5, Amount: decimal.NewFromFloat(100)},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:     "rate not found",
+			walletID: "1",
+			reqBody:  QuoteTransferRequest{TargetWalletID: 5, Amount: decimal.NewFromFloat(100)},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnQuoteTransfer = func(ctx context.Context, fromID, toID uint, amount decimal.Decimal) (*fx.Quote, error) {
+					return nil, errors.RateNotFound
+				}
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUC := &mocks.MockUseCase{}
+			if tt.setupMock != nil {
+				tt.setupMock(mockUC)
+			}
+
+			h := NewHandler(mockUC)
+			body, _ := json.Marshal(tt.reqBody)
+			req := httptest.NewRequest(http.MethodPost, "/wallets/"+tt.walletID+"/quotes", bytes.NewReader(body))
+			req = mux.SetURLVars(req, map[string]string{"id": tt.walletID})
+			w := httptest.NewRecorder()
+
+			h.QuoteTransfer(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("QuoteTransfer() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandler_Rates(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		reqBody    interface{}
+		setupMock  func(*mocks.MockFXUseCase)
+		wantStatus int
+	}{
+		{
+			name:    "load rates",
+			method:  http.MethodPost,
+			target:  "/fx/rates",
+			reqBody: []*fx.Rate{{Base: "USD", Quote: "EUR", Rate: decimal.NewFromFloat(0.9), ValidFrom: time.Now()}},
+			setupMock: func(m *mocks.MockFXUseCase) {
+				m.OnLoadRates = func(ctx context.Context, rates []*fx.Rate) error {
+					return nil
+				}
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "load invalid body",
+			method:     http.MethodPost,
+			target:     "/fx/rates",
+			reqBody:    "invalid json",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "load invalid rate",
+			method:  http.MethodPost,
+			target:  "/fx/rates",
+			reqBody: []*fx.Rate{{Base: "USD", Quote: "USD", Rate: decimal.NewFromFloat(1)}},
+			setupMock: func(m *mocks.MockFXUseCase) {
+				m.OnLoadRates = func(ctx context.Context, rates []*fx.Rate) error {
+					return errors.InvalidRate
+				}
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "get rate",
+			method: http.MethodGet,
+			target: "/fx/rates?base=USD&quote=EUR",
+			setupMock: func(m *mocks.MockFXUseCase) {
+				m.OnRate = func(ctx context.Context, base, quote string) (*fx.Rate, error) {
+					return &fx.Rate{Base: base, Quote: quote, Rate: decimal.NewFromFloat(0.9)}, nil
+				}
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get rate without quote",
+			method:     http.MethodGet,
+			target:     "/fx/rates?base=USD",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "rate not found",
+			method: http.MethodGet,
+			target: "/fx/rates?base=USD&quote=JPY",
+			setupMock: func(m *mocks.MockFXUseCase) {
+				m.OnRate = func(ctx context.Context, base, quote string) (*fx.Rate, error) {
+					return nil, errors.RateNotFound
+				}
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockFX := &mocks.MockFXUseCase{}
+			if tt.setupMock != nil {
+				tt.setupMock(mockFX)
+			}
+
+			h := NewHandler(&mocks.MockUseCase{}, WithRates(mockFX))
+			body, _ := json.Marshal(tt.reqBody)
+			req := httptest.NewRequest(tt.method, tt.target, bytes.NewReader(body))
+			w := httptest.NewRecorder()
+
+			if tt.method == http.MethodPost {
+				h.LoadRates(w, req)
+			} else {
+				h.Rate(w, req)
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("%s %s status = %v, want %v", tt.method, tt.target, w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandler_Holds(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		vars       map[string]string
+		reqBody    interface{}
+		handler    func(*Handler) http.HandlerFunc
+		setupMock  func(*mocks.MockUseCase)
+		wantStatus int
+	}{
+		{
+			name:    "authorize",
+			method:  http.MethodPost,
+			vars:    map[string]string{"id": "1"},
+			reqBody: AuthorizeRequest{Amount: decimal.NewFromFloat(100), ExpiresIn: 60},
+			handler: func(h *Handler) http.HandlerFunc { return h.Authorize },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnAuthorize = func(ctx context.Context, walletID uint, amount decimal.Decimal, ttl time.Duration) (*hold.Hold, error) {
+					if ttl != time.Minute {
+						return nil, errors.InvalidArgs
+					}
+					return hold.New(walletID, amount, "USD", ttl), nil
+				}
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:    "authorize insufficient balance",
+			method:  http.MethodPost,
+			vars:    map[string]string{"id": "1"},
+			reqBody: AuthorizeRequest{Amount: decimal.NewFromFloat(100)},
+			handler: func(h *Handler) http.HandlerFunc { return h.Authorize },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnAuthorize = func(ctx context.Context, walletID uint, amount decimal.Decimal, ttl time.Duration) (*hold.Hold, error) {
+					return nil, errors.InsufficientBalance
+				}
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:    "capture",
+			method:  http.MethodPost,
+			vars:    map[string]string{"id": "1", "holdID": "2"},
+			reqBody: CaptureRequest{Amount: decimal.NewFromFloat(50)},
+			handler: func(h *Handler) http.HandlerFunc { return h.Capture },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnCapture = func(ctx context.Context, walletID, holdID uint, amount decimal.Decimal) (*hold.Hold, error) {
+					return &hold.Hold{ID: holdID, WalletID: walletID, CapturedAmount: amount, Status: hold.StatusCaptured}, nil
+				}
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "capture invalid hold ID",
+			method:     http.MethodPost,
+			vars:       map[string]string{"id": "1", "holdID": "invalid"},
+			reqBody:    CaptureRequest{},
+			handler:    func(h *Handler) http.HandlerFunc { return h.Capture },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "capture expired hold",
+			method:  http.MethodPost,
+			vars:    map[string]string{"id": "1", "holdID": "2"},
+			reqBody: CaptureRequest{},
+			handler: func(h *Handler) http.HandlerFunc { return h.Capture },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnCapture = func(ctx context.Context, walletID, holdID uint, amount decimal.Decimal) (*hold.Hold, error) {
+					return nil, errors.HoldExpired
+				}
+			},
+			wantStatus: http.StatusGone,
+		},
+		{
+			name:    "void",
+			method:  http.MethodPost,
+			vars:    map[string]string{"id": "1", "holdID": "2"},
+			handler: func(h *Handler) http.HandlerFunc { return h.Void },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnVoid = func(ctx context.Context, walletID, holdID uint) (*hold.Hold, error) {
+					return &hold.Hold{ID: holdID, WalletID: walletID, Status: hold.StatusVoided}, nil
+				}
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:    "void captured hold",
+			method:  http.MethodPost,
+			vars:    map[string]string{"id": "1", "holdID": "2"},
+			handler: func(h *Handler) http.HandlerFunc { return h.Void },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnVoid = func(ctx context.Context, walletID, holdID uint) (*hold.Hold, error) {
+					return nil, errors.InvalidHoldStatus
+				}
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:    "list holds",
+			method:  http.MethodGet,
+			vars:    map[string]string{"id": "1"},
+			handler: func(h *Handler) http.HandlerFunc { return h.Holds },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnWalletHolds = func(ctx context.Context, walletID uint) ([]hold.Hold, error) {
+					return []hold.Hold{{ID: 1, WalletID: walletID}}, nil
+				}
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:    "list holds wallet not found",
+			method:  http.MethodGet,
+			vars:    map[string]string{"id": "999"},
+			handler: func(h *Handler) http.HandlerFunc { return h.Holds },
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnWalletHolds = func(ctx context.Context, walletID uint) ([]hold.Hold, error) {
+					return nil, errors.RecordNotFound
+				}
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUC := &mocks.MockUseCase{}
+			if tt.setupMock != nil {
+				tt.setupMock(mockUC)
+			}
+
+			h := NewHandler(mockUC)
+			body, _ := json.Marshal(tt.reqBody)
+			req := httptest.NewRequest(tt.method, "/wallets/"+tt.vars["id"]+"/holds", bytes.NewReader(body))
+			req = mux.SetURLVars(req, tt.vars)
+			w := httptest.NewRecorder()
+
+			tt.handler(h)(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandler_Reverse(t *testing.T) {
+	tests := []struct {
+		name       string
+		txID       string
+		reqBody    interface{}
+		setupMock  func(*mocks.MockUseCase)
+		wantStatus int
+	}{
+		{
+			name:    "full reversal",
+			txID:    "7",
+			reqBody: ReverseRequest{Reason: "duplicate charge"},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnReverse = func(ctx context.Context, transactionID uint, amount decimal.Decimal, reason string) (*transaction.Transaction, error) {
+					if transactionID != 7 || !amount.IsZero() || reason != "duplicate charge" {
+						t.Errorf("Reverse() got id %d, amount %v, reason %q", transactionID, amount, reason)
+					}
+					return &transaction.Transaction{ID: 8, ReversalOf: transactionID, Reason: reason}, nil
+				}
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:    "partial refund",
+			txID:    "7",
+			reqBody: ReverseRequest{Amount: decimal.NewFromFloat(10), Reason: "refund"},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnReverse = func(ctx context.Context, transactionID uint, amount decimal.Decimal, reason string) (*transaction.Transaction, error) {
+					return &transaction.Transaction{ID: 8, ReversalOf: transactionID, Amount: amount, Reason: reason}, nil
+				}
+			},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "invalid transaction ID",
+			txID:       "invalid",
+			reqBody:    ReverseRequest{Reason: "refund"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "already reversed",
+			txID:    "7",
+			reqBody: ReverseRequest{Reason: "refund"},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnReverse = func(ctx context.Context, transactionID uint, amount decimal.Decimal, reason string) (*transaction.Transaction, error) {
+					return nil, errors.TransactionReversed
+				}
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:    "exceeds remaining amount",
+			txID:    "7",
+			reqBody: ReverseRequest{Amount: decimal.NewFromFloat(1000), Reason: "refund"},
+			setupMock: func(m *mocks.MockUseCase) {
+				m.OnReverse = func(ctx context.Context, transactionID uint, amount decimal.Decimal, reason string) (*transaction.Transaction, error) {
+					return nil, errors.ReversalExceedsAmount
+				}
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUC := &mocks.MockUseCase{}
+			if tt.setupMock != nil {
+				tt.setupMock(mockUC)
+			}
+
+			h := NewHandler(mockUC)
+			body, _ := json.Marshal(tt.reqBody)
+			req := httptest.NewRequest(http.MethodPost, "/transactions/"+tt.txID+"/reverse", bytes.NewReader(body))
+			req = mux.SetURLVars(req, map[string]string{"id": tt.txID})
+			w := httptest.NewRecorder()
+
+			h.Reverse(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Reverse() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandler_Webhooks(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		vars       map[string]string
+		reqBody    interface{}
+		handler    func(*Handler) http.HandlerFunc
+		setupMock  func(*mocks.MockWebhookUseCase)
+		wantStatus int
+		wantSecret bool
+	}{
+		{
+			name:    "create",
+			method:  http.MethodPost,
+			reqBody: CreateWebhookRequest{URL: "https://example.com/hook", EventTypes: []outbox.Type{wallet.EventWalletCredited}, WalletIDs: []uint{1}},
+			handler: func(h *Handler) http.HandlerFunc { return h.CreateWebhook },
+			setupMock: func(m *mocks.MockWebhookUseCase) {
+				m.OnCreateSubscription = func(ctx context.Context, s *webhook.Subscription) error {
+					s.ID, s.Secret = 1, "whsec_generated"
+					return nil
+				}
+			},
+			wantStatus: http.StatusCreated,
+			wantSecret: true,
+		},
+		{
+			name:       "create without url",
+			method:     http.MethodPost,
+			reqBody:    CreateWebhookRequest{WalletIDs: []uint{1}},
+			handler:    func(h *Handler) http.HandlerFunc { return h.CreateWebhook },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "create for a wallet of another owner",
+			method:  http.MethodPost,
+			reqBody: CreateWebhookRequest{URL: "https://example.com/hook", WalletIDs: []uint{2}},
+			handler: func(h *Handler) http.HandlerFunc { return h.CreateWebhook },
+			setupMock: func(m *mocks.MockWebhookUseCase) {
+				m.OnCreateSubscription = func(ctx context.Context, s *webhook.Subscription) error {
+					return errors.Forbidden
+				}
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:    "get",
+			method:  http.MethodGet,
+			vars:    map[string]string{"id": "1"},
+			handler: func(h *Handler) http.HandlerFunc { return h.Webhook },
+			setupMock: func(m *mocks.MockWebhookUseCase) {
+				m.OnSubscription = func(ctx context.Context, id uint) (*webhook.Subscription, error) {
+					return &webhook.Subscription{ID: id, URL: "https://example.com/hook", Secret: "whsec_generated"}, nil
+				}
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "get invalid ID",
+			method:     http.MethodGet,
+			vars:       map[string]string{"id": "invalid"},
+			handler:    func(h *Handler) http.HandlerFunc { return h.Webhook },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "get not found",
+			method:  http.MethodGet,
+			vars:    map[string]string{"id": "9"},
+			handler: func(h *Handler) http.HandlerFunc { return h.Webhook },
+			setupMock: func(m *mocks.MockWebhookUseCase) {
+				m.OnSubscription = func(ctx context.Context, id uint) (*webhook.Subscription, error) {
+					return nil, errors.WebhookNotFound
+				}
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:    "list deliveries",
+			method:  http.MethodGet,
+			vars:    map[string]string{"id": "1"},
+			handler: func(h *Handler) http.HandlerFunc { return h.WebhookDeliveries },
+			setupMock: func(m *mocks.MockWebhookUseCase) {
+				m.OnDeliveries = func(ctx context.Context, subscriptionID uint) ([]webhook.Delivery, error) {
+					return []webhook.Delivery{{ID: 1, SubscriptionID: subscriptionID, Status: webhook.DeliveryDead, Attempts: 10}}, nil
+				}
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:    "list deliveries of another owner",
+			method:  http.MethodGet,
+			vars:    map[string]string{"id": "1"},
+			handler: func(h *Handler) http.HandlerFunc { return h.WebhookDeliveries },
+			setupMock: func(m *mocks.MockWebhookUseCase) {
+				m.OnDeliveries = func(ctx context.Context, subscriptionID uint) ([]webhook.Delivery, error) {
+					return nil, errors.Forbidden
+				}
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockWebhooks := &mocks.MockWebhookUseCase{}
+			if tt.setupMock != nil {
+				tt.setupMock(mockWebhooks)
+			}
+
+			h := NewHandler(&mocks.MockUseCase{}, WithWebhooks(mockWebhooks))
+			body, _ := json.Marshal(tt.reqBody)
+			req := httptest.NewRequest(tt.method, "/webhooks", bytes.NewReader(body))
+			req = mux.SetURLVars(req, tt.vars)
+			w := httptest.NewRecorder()
+
+			tt.handler(h)(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			// the secret is only shown on creation
+			if got := strings.Contains(w.Body.String(), `"secret"`); got != tt.wantSecret {
+				t.Errorf("body %s has a secret = %v, want %v", w.Body.String(), got, tt.wantSecret)
+			}
+		})
+	}
+}
+
+func TestHandleError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantDetail  string
+		wantDetails map[string]string
+	}{
+		{
+			name:       "insufficient balance",
+			err:        errors.InsufficientBalance.WithCause(fmt.Errorf("balance 1 < 2")),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   "INSUFFICIENT_BALANCE",
+			wantDetail: "insufficient balance",
+		},
+		{
+			name:       "wallet not found",
+			err:        errors.WalletNotFound.WithCause(errors.RecordNotFound),
+			wantStatus: http.StatusNotFound,
+			wantCode:   "WALLET_NOT_FOUND",
+			wantDetail: "wallet not found",
+		},
+		{
+			name:       "forbidden",
+			err:        errors.Forbidden.WithCause(fmt.Errorf("ak_2 may not debit wallet 1")),
+			wantStatus: http.StatusForbidden,
+			wantCode:   "FORBIDDEN",
+			wantDetail: "not allowed to perform this action",
+		},
+		{
+			name:       "wrapped error",
+			err:        fmt.Errorf("deposit: %w", errors.WalletFrozen),
+			wantStatus: http.StatusLocked,
+			wantCode:   "WALLET_FROZEN",
+			wantDetail: "wallet is frozen",
+		},
+		{
+			name:        "details",
+			err:         errors.InvalidArgs.WithMetadata(map[string]string{"amount": "required"}),
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    "INVALID_ARGUMENT",
+			wantDetail:  "invalid arguments",
+			wantDetails: map[string]string{"amount": "required"},
+		},
+		{
+			name:       "unknown error is hidden",
+			err:        fmt.Errorf("connection refused"),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   "INTERNAL",
+			wantDetail: "internal server error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, hook := logtest.NewNullLogger()
+			ctx := context.WithValue(context.Background(), requestIDKey{}, "req-1")
+			ctx = log.NewContext(ctx, logger.WithField("request_id", "req-1"))
+			r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			handleError(w, r, tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("handleError() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("handleError() content type = %v, want application/problem+json", ct)
+			}
+			var got ProblemResponse
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("handleError() body is not JSON: %v", err)
+			}
+			want := ProblemResponse{
+				Type:      "about:blank",
+				Title:     http.StatusText(tt.wantStatus),
+				Status:    tt.wantStatus,
+				Detail:    tt.wantDetail,
+				Code:      tt.wantCode,
+				Details:   tt.wantDetails,
+				RequestID: "req-1",
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("handleError() = %+v, want %+v", got, want)
+			}
+			// server errors are logged through the request logger
+			entries := hook.AllEntries()
+			if logged := len(entries) > 0; logged != (tt.wantStatus >= http.StatusInternalServerError) {
+				t.Errorf("handleError() logged = %v for status %d", logged, tt.wantStatus)
+			}
+			for _, e := range entries {
+				if e.Data["request_id"] != "req-1" {
+					t.Errorf("handleError() logged request_id = %v, want req-1", e.Data["request_id"])
+				}
+			}
+		})
+	}
+}
+
+func TestParseReqBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantOK      bool
+		wantStatus  int
+		wantDetails map[string]string
+	}{
+		{
+			name:   "valid body",
+			body:   `{"target_wallet_id": 2, "amount": "50"}`,
+			wantOK: true,
+		},
+		{
+			name:       "empty body",
+			body:       "",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "unknown field",
+			body:        `{"target_wallet_id": 2, "amount": "50", "currency": "USD"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantDetails: map[string]string{"currency": "is not allowed"},
+		},
+		{
+			name:        "wrong type",
+			body:        `{"target_wallet_id": "two", "amount": "50"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantDetails: map[string]string{"target_wallet_id": "must be a uint"},
+		},
+		{
+			name:       "trailing data",
+			body:       `{"target_wallet_id": 2, "amount": "50"} {}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "all field errors",
+			body:       `{"amount": "-1"}`,
+			wantStatus: http.StatusBadRequest,
+			wantDetails: map[string]string{
+				"target_wallet_id": "is required",
+				"amount":           "must be more than 0",
+			},
+		},
+		{
+			name:       "oversized body",
+			body:       `{"amount": "` + strings.Repeat("1", maxRequestBodyBytes) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/wallets/1/transfer", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			ok := parseReqBody(w, req, &TransferRequest{})
+
+			if ok != tt.wantOK {
+				t.Fatalf("parseReqBody() = %v, want %v", ok, tt.wantOK)
+			}
+			if ok {
+				return
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("parseReqBody() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			var got ProblemResponse
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("parseReqBody() body is not JSON: %v", err)
+			}
+			if tt.wantDetails != nil && !reflect.DeepEqual(got.Details, tt.wantDetails) {
+				t.Errorf("parseReqBody() details = %v, want %v", got.Details, tt.wantDetails)
 			}
 		})
 	}
@@ -2,10 +2,11 @@ package server
 
 import (
 	"context"
-	"errors"
+	stderrors "errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/guoxiaopeng875/wallet/internal/config"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"net"
 	"net/http"
@@ -23,23 +24,62 @@ type httpServer struct {
 	addr     string
 }
 
-// NewServer creates a new HTTP server instance
-func NewServer(h *Handler, conf *config.Config) Server {
+// NewServer creates a new HTTP server instance, mws are applied to every API route after the request ID, tracing,
+// logging and metrics, the health check and metrics endpoints skip them.
+func NewServer(h *Handler, conf *config.Config, mws ...mux.MiddlewareFunc) Server {
 	router := mux.NewRouter()
+	router.Use(RequestIDMiddleware())
+	if h.tracer != nil {
+		router.Use(TracingMiddleware(h.tracer))
+	}
 	router.Use(LoggingMiddleware())
+	if h.metrics != nil {
+		router.Use(MetricsMiddleware(h.metrics))
+		router.Handle("/metrics", h.metrics).Methods(http.MethodGet)
+	}
 
-	// Register routes
-	router.HandleFunc("/wallets/{id}/deposit", h.Deposit).Methods(http.MethodPost)
-	router.HandleFunc("/wallets/{id}/withdraw", h.Withdraw).Methods(http.MethodPost)
-	router.HandleFunc("/wallets/{id}/transfer", h.Transfer).Methods(http.MethodPost)
-	router.HandleFunc("/wallets/{id}/balance", h.Balance).Methods(http.MethodGet)
-	router.HandleFunc("/wallets/{id}/transactions", h.Transactions).Methods(http.MethodGet)
+	// unmatched requests get a problem too, the router middlewares only run on a match
+	router.NotFoundHandler = RequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleError(w, r, errors.RouteNotFound)
+	}))
+	router.MethodNotAllowedHandler = RequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleError(w, r, errors.MethodNotAllowed)
+	}))
 
 	// Add health check endpoint
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}).Methods(http.MethodGet)
 
+	// Register routes
+	api := router.NewRoute().Subrouter()
+	api.Use(mws...)
+	api.HandleFunc("/wallets", h.CreateWallet).Methods(http.MethodPost)
+	api.HandleFunc("/wallets/{id}/freeze", h.FreezeWallet).Methods(http.MethodPost)
+	api.HandleFunc("/wallets/{id}/unfreeze", h.UnfreezeWallet).Methods(http.MethodPost)
+	api.HandleFunc("/wallets/{id}/close", h.CloseWallet).Methods(http.MethodPost)
+	api.HandleFunc("/wallets/{id}/deposit", h.Deposit).Methods(http.MethodPost)
+	api.HandleFunc("/wallets/{id}/withdraw", h.Withdraw).Methods(http.MethodPost)
+	api.HandleFunc("/wallets/{id}/transfer", h.Transfer).Methods(http.MethodPost)
+	api.HandleFunc("/wallets/{id}/quotes", h.QuoteTransfer).Methods(http.MethodPost)
+	api.HandleFunc("/wallets/{id}/holds", h.Authorize).Methods(http.MethodPost)
+	api.HandleFunc("/wallets/{id}/holds", h.Holds).Methods(http.MethodGet)
+	api.HandleFunc("/wallets/{id}/holds/{holdID}/capture", h.Capture).Methods(http.MethodPost)
+	api.HandleFunc("/wallets/{id}/holds/{holdID}/void", h.Void).Methods(http.MethodPost)
+	api.HandleFunc("/wallets/{id}/balance", h.Balance).Methods(http.MethodGet)
+	api.HandleFunc("/wallets/{id}/transactions", h.Transactions).Methods(http.MethodGet)
+	api.HandleFunc("/transactions/{id}/reverse", h.Reverse).Methods(http.MethodPost)
+
+	if h.rates != nil {
+		api.HandleFunc("/fx/rates", h.LoadRates).Methods(http.MethodPost)
+		api.HandleFunc("/fx/rates", h.Rate).Methods(http.MethodGet)
+	}
+	if h.webhooks != nil {
+		api.HandleFunc("/webhooks", h.CreateWebhook).Methods(http.MethodPost)
+		api.HandleFunc("/webhooks/{id}", h.Webhook).Methods(http.MethodGet)
+		api.HandleFunc("/webhooks/{id}/deliveries", h.WebhookDeliveries).Methods(http.MethodGet)
+	}
+
 	srv := &httpServer{
 		Server: &http.Server{
 			Handler: router,
@@ -59,7 +99,7 @@ func (s *httpServer) Start(ctx context.Context) error {
 	s.listener = listener
 
 	logrus.Infof("HTTP server listening on %s", s.Addr)
-	if err := s.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	if err := s.Serve(listener); err != nil && !stderrors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("failed to serve: %w", err)
 	}
 	return nil
@@ -7,6 +7,8 @@ import (
 	"github.com/guoxiaopeng875/wallet/internal/server/mocks"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -82,3 +84,31 @@ func TestServer_StartStop(t *testing.T) {
 		t.Error("Context timeout while waiting for server to stop")
 	}
 }
+
+func TestServer_Unmatched(t *testing.T) {
+	srv := NewServer(NewHandler(&mocks.MockUseCase{}), &config.Config{}).(*httpServer)
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "unknown path", method: http.MethodGet, path: "/unknown", wantStatus: http.StatusNotFound, wantCode: "ROUTE_NOT_FOUND"},
+		{name: "unknown method", method: http.MethodDelete, path: "/wallets/1/balance", wantStatus: http.StatusMethodNotAllowed, wantCode: "METHOD_NOT_ALLOWED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if w.Code != tt.wantStatus || w.Header().Get("Content-Type") != "application/problem+json" {
+				t.Fatalf("ServeHTTP() = %d %s, want a %d problem", w.Code, w.Header().Get("Content-Type"), tt.wantStatus)
+			}
+			id := w.Header().Get(requestIDHeader)
+			if id == "" || !strings.Contains(w.Body.String(), `"code":"`+tt.wantCode+`"`) || !strings.Contains(w.Body.String(), `"request_id":"`+id+`"`) {
+				t.Errorf("ServeHTTP() body = %s, want %s with request ID %q", w.Body.String(), tt.wantCode, id)
+			}
+		})
+	}
+}
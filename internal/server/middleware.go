@@ -1,27 +1,355 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
+	"github.com/guoxiaopeng875/wallet/internal/idempotency"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/metrics"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace"
 	"github.com/sirupsen/logrus"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// LoggingMiddleware logs incoming HTTP requests
+const (
+	requestIDHeader          = "X-Request-ID"
+	maxRequestIDLength       = 128
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	apiKeyHeader             = "X-API-Key"
+	apiKeyIDHeader           = "X-API-Key-ID"
+	timestampHeader          = "X-Timestamp"
+	nonceHeader              = "X-Nonce"
+	signatureHeader          = "X-Signature"
+	traceparentHeader        = "traceparent"
+)
+
+// errRequestFailed rolls back the idempotent transaction when the handler responds with an error
+var errRequestFailed = errors.New(0, "REQUEST_FAILED", "request failed")
+
+type requestIDKey struct{}
+
+// RequestIDMiddleware gives every request an ID, taken from the X-Request-ID header or generated.
+// The ID is echoed in the X-Request-ID response header and in error responses, and the context
+// carries a logger with a request_id field, see log.FromContext.
+func RequestIDMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(requestIDHeader, id)
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			ctx = log.WithFields(ctx, logrus.Fields{"request_id": id})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestID returns the ID RequestIDMiddleware gave the request of ctx, or empty.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts client IDs of printable ASCII without spaces, so they are safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// LoggingMiddleware logs a line per completed request through the logger of its context,
+// with its status, the bytes of the response, its duration and the wallet of the path if any.
 func LoggingMiddleware() mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			logrus.WithFields(logrus.Fields{
-				"method": r.Method,
-				"path":   r.URL.Path,
-			}).Info("Request started")
-
-			next.ServeHTTP(w, r)
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
 
-			logrus.WithFields(logrus.Fields{
+			fields := logrus.Fields{
+				"method":   r.Method,
+				"path":     r.URL.Path,
+				"status":   rec.status,
+				"bytes":    rec.bytes,
 				"duration": time.Since(start),
-			}).Info("Request completed")
+			}
+			if id := walletID(r); id != "" {
+				fields["wallet_id"] = id
+			}
+			log.FromContext(r.Context()).WithFields(fields).Info("Request completed")
+		})
+	}
+}
+
+// walletID returns the wallet of the path of r, or empty if its route isn't a wallet one.
+func walletID(r *http.Request) string {
+	if !strings.HasPrefix(routeTemplate(r), "/wallets/{id}") {
+		return ""
+	}
+	return mux.Vars(r)["id"]
+}
+
+// TracingMiddleware traces every request in a server span named by its method and route template,
+// child of the span of its W3C traceparent header if any. A 5xx response fails the span.
+// The logger of the request records the trace and span IDs.
+func TracingMiddleware(tracer *trace.Tracer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if sc, err := trace.ParseTraceparent(r.Header.Get(traceparentHeader)); err == nil {
+				ctx = trace.ContextWithRemote(ctx, sc)
+			}
+			name, route := r.Method, routeTemplate(r)
+			if route != "" {
+				name += " " + route
+			}
+			ctx, span := tracer.Start(ctx, name, trace.WithKind(trace.KindServer), trace.WithAttributes(
+				trace.Attr("http.request.method", r.Method),
+				trace.Attr("http.route", route),
+				trace.Attr("url.path", r.URL.Path),
+				trace.Attr("http.request_id", RequestID(ctx)),
+			))
+			defer span.End()
+			sc := span.SpanContext()
+			ctx = log.WithFields(ctx, logrus.Fields{"trace_id": sc.TraceID.String(), "span_id": sc.SpanID.String()})
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			span.SetAttributes(trace.Attr("http.response.status_code", rec.status))
+			if rec.status >= http.StatusInternalServerError {
+				span.SetStatus(trace.StatusError, http.StatusText(rec.status))
+			}
+		})
+	}
+}
+
+// routeTemplate returns the path template of the route of r, or empty if it has none.
+func routeTemplate(r *http.Request) string {
+	current := mux.CurrentRoute(r)
+	if current == nil {
+		return ""
+	}
+	tpl, err := current.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return tpl
+}
+
+// MetricsMiddleware counts the requests and observes their latency per method, route template and status,
+// so the wallet IDs of the paths don't make a series each.
+func MetricsMiddleware(reg *metrics.Registry) mux.MiddlewareFunc {
+	requests := reg.Counter("http_requests_total", "HTTP requests served.", "method", "route", "status")
+	latency := reg.Histogram("http_request_duration_seconds", "Latency of the HTTP requests in seconds.",
+		metrics.DefaultBuckets, "method", "route", "status")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			route := routeTemplate(r)
+			if route == "" {
+				route = r.URL.Path
+			}
+			status := strconv.Itoa(rec.status)
+			requests.With(r.Method, route, status).Inc()
+			latency.With(r.Method, route, status).Observe(time.Since(start).Seconds())
 		})
 	}
 }
+
+// statusRecorder is an http.ResponseWriter that remembers the status and size of the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// AuthMiddleware authenticates every request and puts its principal in the context, see auth.FromContext,
+// the request is scoped to the tenant of the principal, which its logger records with the key.
+// A request sends its API key in the X-API-Key header, or is signed: X-API-Key-ID, X-Timestamp
+// in unix seconds, X-Nonce and X-Signature, the HMAC-SHA256 of auth.SignedRequest.StringToSign.
+func AuthMiddleware(uc auth.UseCase) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				principal *auth.Principal
+				err       error
+			)
+			switch {
+			case r.Header.Get(apiKeyHeader) != "":
+				principal, err = uc.Authenticate(r.Context(), r.Header.Get(apiKeyHeader))
+			case r.Header.Get(signatureHeader) != "":
+				var req *auth.SignedRequest
+				if req, err = signedRequest(w, r); err == nil {
+					principal, err = uc.AuthenticateSigned(r.Context(), req)
+				}
+			default:
+				err = errors.Unauthenticated
+			}
+			if err != nil {
+				handleError(w, r, err)
+				return
+			}
+			ctx := tenant.NewContext(auth.NewContext(r.Context(), principal), principal.TenantID)
+			ctx = log.WithFields(ctx, logrus.Fields{"key_id": principal.KeyID, "tenant": principal.TenantID})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// signedRequest reads the signature headers and the body of r, the body is restored for the handler
+func signedRequest(w http.ResponseWriter, r *http.Request) (*auth.SignedRequest, error) {
+	ts, err := strconv.ParseInt(r.Header.Get(timestampHeader), 10, 64)
+	if err != nil {
+		return nil, errors.Unauthenticated.WithCause(fmt.Errorf("invalid %s header: %w", timestampHeader, err))
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	if err != nil {
+		return nil, bodyError(err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return &auth.SignedRequest{
+		KeyID:     r.Header.Get(apiKeyIDHeader),
+		Method:    r.Method,
+		Path:      r.URL.RequestURI(),
+		Timestamp: time.Unix(ts, 0),
+		Nonce:     r.Header.Get(nonceHeader),
+		Body:      body,
+		Signature: r.Header.Get(signatureHeader),
+	}, nil
+}
+
+// IdempotencyMiddleware executes POST requests carrying an Idempotency-Key header at most once.
+// The handler runs inside the transaction that stores its response, retries replay the stored response.
+// Keys are scoped to the authenticated principal, so clients can't replay each other's responses.
+func IdempotencyMiddleware(uc idempotency.UseCase) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyKeyHeader)
+			if key == "" || r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if p, ok := auth.FromContext(r.Context()); ok {
+				key = p.KeyID + "/" + key
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+			if err != nil {
+				handleError(w, r, bodyError(err))
+				return
+			}
+			fingerprint := idempotency.Fingerprint(r.Method, r.URL.Path, body)
+
+			var failed *responseBuffer
+			record, replayed, err := uc.Execute(r.Context(), key, fingerprint, func(ctx context.Context) (*idempotency.Record, error) {
+				// the buffer starts with the headers already set, such as the request ID
+				buf := newResponseBuffer(w.Header().Clone())
+				req := r.WithContext(ctx)
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				next.ServeHTTP(buf, req)
+				failed = nil
+				if buf.status >= http.StatusBadRequest {
+					failed = buf
+					// the transaction of the handler is nested in this one, a concurrent update retries them both
+					if errors.Is(buf.err, errors.ConcurrentUpdate) {
+						return nil, buf.err
+					}
+					return nil, errRequestFailed
+				}
+				return &idempotency.Record{StatusCode: buf.status, Body: buf.body.Bytes()}, nil
+			})
+			if failed != nil {
+				failed.writeTo(w)
+				return
+			}
+			if err != nil {
+				handleError(w, r, err)
+				return
+			}
+
+			if replayed {
+				w.Header().Set(idempotentReplayedHeader, "true")
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(record.StatusCode)
+			_, _ = w.Write(record.Body)
+		})
+	}
+}
+
+// responseBuffer is an http.ResponseWriter that keeps the response in memory, and the error it renders
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	err    error
+}
+
+func newResponseBuffer(header http.Header) *responseBuffer {
+	return &responseBuffer{header: header, status: http.StatusOK}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *responseBuffer) recordError(err error) {
+	b.err = err
+}
+
+func (b *responseBuffer) writeTo(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(b.status)
+	_, _ = w.Write(b.body.Bytes())
+}
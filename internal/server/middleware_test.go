@@ -1,9 +1,26 @@
 package server
 
 import (
+	"context"
+	stderrors "errors"
+	"github.com/gorilla/mux"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
+	"github.com/guoxiaopeng875/wallet/internal/idempotency"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/metrics"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace/tracetest"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoggingMiddleware(t *testing.T) {
@@ -45,3 +62,481 @@ func TestLoggingMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestLoggingMiddleware_CompletionLine(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	router := mux.NewRouter()
+	router.Use(RequestIDMiddleware(), LoggingMiddleware())
+	router.HandleFunc("/wallets/{id}/deposit", func(w http.ResponseWriter, r *http.Request) {
+		log.FromContext(r.Context()).Warn("from the handler")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	})
+	req := httptest.NewRequest(http.MethodPost, "/wallets/7/deposit", nil)
+	req.Header.Set(requestIDHeader, "req-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := hook.AllEntries()
+	if len(entries) != 2 {
+		t.Fatalf("logged %d lines, want 2", len(entries))
+	}
+	if entries[0].Data["request_id"] != "req-1" {
+		t.Errorf("handler line fields = %v, want the request ID", entries[0].Data)
+	}
+	want := logrus.Fields{"request_id": "req-1", "method": http.MethodPost, "path": "/wallets/7/deposit",
+		"status": http.StatusCreated, "bytes": len("created"), "wallet_id": "7"}
+	for k, v := range want {
+		if entries[1].Data[k] != v {
+			t.Errorf("completion line %s = %v, want %v", k, entries[1].Data[k], v)
+		}
+	}
+	if entries[1].Message != "Request completed" {
+		t.Errorf("completion line message = %q", entries[1].Message)
+	}
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	exporter := &tracetest.Recorder{}
+	tracer := trace.NewTracer(exporter)
+
+	var (
+		handlerSpans []trace.SpanContext
+		logged       []logrus.Fields
+	)
+	router := mux.NewRouter()
+	router.Use(RequestIDMiddleware(), TracingMiddleware(tracer))
+	router.HandleFunc("/wallets/{id}/transfer", func(w http.ResponseWriter, r *http.Request) {
+		handlerSpans = append(handlerSpans, trace.SpanContextFromContext(r.Context()))
+		logged = append(logged, log.FromContext(r.Context()).Data)
+		handleError(w, r, stderrors.New("database is down"))
+	}).Methods(http.MethodPost)
+
+	req := httptest.NewRequest(http.MethodPost, "/wallets/7/transfer", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	// a request without traceparent starts a trace
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/wallets/8/transfer", nil))
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if len(exporter.Spans()) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(exporter.Spans()))
+	}
+	span := exporter.Spans()[0]
+	if span.Name != "POST /wallets/{id}/transfer" || span.Kind != trace.KindServer {
+		t.Errorf("span = %s (%v), want the server span of the route", span.Name, span.Kind)
+	}
+	if span.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("span trace = %s parent = %s, want those of the traceparent", span.TraceID, span.ParentSpanID)
+	}
+	if handlerSpans[0].SpanID != span.SpanID {
+		t.Errorf("handler context span = %s, want %s", handlerSpans[0].SpanID, span.SpanID)
+	}
+	if logged[0]["trace_id"] != span.TraceID.String() || logged[0]["span_id"] != span.SpanID.String() {
+		t.Errorf("logger fields = %v, want the trace and span IDs", logged[0])
+	}
+	if span.Status != trace.StatusError {
+		t.Errorf("span status = %v, want error on a 500", span.Status)
+	}
+	attrs := make(map[string]any)
+	for _, a := range span.Attributes {
+		attrs[a.Key] = a.Value
+	}
+	if attrs["http.route"] != "/wallets/{id}/transfer" || attrs["http.response.status_code"] != http.StatusInternalServerError {
+		t.Errorf("span attributes = %v", attrs)
+	}
+	if root := exporter.Spans()[1]; root.TraceID == span.TraceID || root.ParentSpanID.IsValid() {
+		t.Errorf("span without traceparent = %+v, want the root of a new trace", root)
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	reg := metrics.NewRegistry()
+	router := mux.NewRouter()
+	router.Use(MetricsMiddleware(reg))
+	router.HandleFunc("/wallets/{id}/balance", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "9" {
+			handleError(w, r, errors.WalletNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("{}"))
+	}).Methods(http.MethodGet)
+	router.Handle("/metrics", reg).Methods(http.MethodGet)
+
+	for _, path := range []string{"/wallets/1/balance", "/wallets/2/balance", "/wallets/9/balance"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/wallets/{id}/balance",status="200"} 2`,
+		`http_requests_total{method="GET",route="/wallets/{id}/balance",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/wallets/{id}/balance",status="200"} 2`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics miss %s:\n%s", want, body)
+		}
+	}
+}
+
+type mockDBTx struct{}
+
+func (m *mockDBTx) ExecTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	calls := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == `{"amount":"-1"}` {
+			http.Error(w, "invalid arguments", http.StatusBadRequest)
+			return
+		}
+		renderJSON(w, r, http.StatusOK, map[string]int{"calls": calls})
+	})
+	middleware := IdempotencyMiddleware(idempotency.NewUseCase(idempotency.NewMockRepository(), &mockDBTx{}))(handler)
+
+	tests := []struct {
+		name         string
+		method       string
+		key          string
+		body         string
+		wantStatus   int
+		wantBody     string
+		wantReplayed bool
+		wantCalls    int
+	}{
+		{
+			name:       "first request",
+			method:     http.MethodPost,
+			key:        "key-1",
+			body:       `{"amount":"1"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"calls":1}`,
+			wantCalls:  1,
+		},
+		{
+			name:         "retry replays response",
+			method:       http.MethodPost,
+			key:          "key-1",
+			body:         `{"amount":"1"}`,
+			wantStatus:   http.StatusOK,
+			wantBody:     `{"calls":1}`,
+			wantReplayed: true,
+			wantCalls:    1,
+		},
+		{
+			name:       "reused key with different body",
+			method:     http.MethodPost,
+			key:        "key-1",
+			body:       `{"amount":"2"}`,
+			wantStatus: http.StatusConflict,
+			wantCalls:  1,
+		},
+		{
+			name:       "failed request is not stored",
+			method:     http.MethodPost,
+			key:        "key-2",
+			body:       `{"amount":"-1"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCalls:  2,
+		},
+		{
+			name:       "failed request can be retried",
+			method:     http.MethodPost,
+			key:        "key-2",
+			body:       `{"amount":"-1"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCalls:  3,
+		},
+		{
+			name:       "request without key",
+			method:     http.MethodPost,
+			body:       `{"amount":"1"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"calls":4}`,
+			wantCalls:  4,
+		},
+		{
+			name:       "GET request ignores key",
+			method:     http.MethodGet,
+			key:        "key-1",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"calls":5}`,
+			wantCalls:  5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/wallets/1/deposit", strings.NewReader(tt.body))
+			if tt.key != "" {
+				req.Header.Set(idempotencyKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+
+			middleware.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("IdempotencyMiddleware() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(w.Body.String()) != tt.wantBody {
+				t.Errorf("IdempotencyMiddleware() body = %v, want %v", w.Body.String(), tt.wantBody)
+			}
+			if replayed := w.Header().Get(idempotentReplayedHeader) == "true"; replayed != tt.wantReplayed {
+				t.Errorf("IdempotencyMiddleware() replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("IdempotencyMiddleware() calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		wantEqual bool
+	}{
+		{name: "client ID", header: "abc-123", wantEqual: true},
+		{name: "generated ID", header: ""},
+		{name: "ID with spaces is replaced", header: "abc 123"},
+		{name: "ID too long is replaced", header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestID(r.Context())
+				handleError(w, r, errors.InvalidArgs)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/wallets/1/deposit", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			RequestIDMiddleware()(handler).ServeHTTP(w, req)
+
+			id := w.Header().Get(requestIDHeader)
+			if id == "" || id != seen {
+				t.Fatalf("RequestIDMiddleware() header = %q, context = %q", id, seen)
+			}
+			if (id == tt.header) != tt.wantEqual {
+				t.Errorf("RequestIDMiddleware() id = %q, client sent %q", id, tt.header)
+			}
+			if !strings.Contains(w.Body.String(), `"request_id":"`+id+`"`) {
+				t.Errorf("RequestIDMiddleware() error body = %s, want the request ID", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestIdempotencyMiddleware_FailureKeepsRequestID(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleError(w, r, errors.InsufficientBalance)
+	})
+	middleware := RequestIDMiddleware()(IdempotencyMiddleware(idempotency.NewUseCase(idempotency.NewMockRepository(), &mockDBTx{}))(handler))
+	req := httptest.NewRequest(http.MethodPost, "/wallets/1/withdraw", strings.NewReader(`{"amount":"1"}`))
+	req.Header.Set(idempotencyKeyHeader, "key-1")
+	req.Header.Set(requestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+
+	middleware.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity || w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("IdempotencyMiddleware() = %v %v, want a problem", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), `"request_id":"req-1"`) || !strings.Contains(w.Body.String(), `"code":"INSUFFICIENT_BALANCE"`) {
+		t.Errorf("IdempotencyMiddleware() body = %s", w.Body.String())
+	}
+}
+
+// retryingDBTx runs fn again when it fails with a concurrent update, as the repository does
+type retryingDBTx struct {
+	retries int
+}
+
+func (m *retryingDBTx) ExecTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	for i := 0; i < m.retries && errors.Is(err, errors.ConcurrentUpdate); i++ {
+		err = fn(ctx)
+	}
+	return err
+}
+
+func TestIdempotencyMiddleware_RetriesConcurrentUpdate(t *testing.T) {
+	tests := []struct {
+		name       string
+		conflicts  int
+		wantStatus int
+		wantCalls  int
+		wantStored bool
+	}{
+		{name: "retried until it succeeds", conflicts: 2, wantStatus: http.StatusOK, wantCalls: 3, wantStored: true},
+		{name: "conflict after the retries", conflicts: 5, wantStatus: http.StatusConflict, wantCalls: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls++; calls <= tt.conflicts {
+					handleError(w, r, errors.ConcurrentUpdate)
+					return
+				}
+				body, _ := io.ReadAll(r.Body)
+				renderJSON(w, r, http.StatusOK, map[string]string{"body": string(body)})
+			})
+			repo := idempotency.NewMockRepository()
+			middleware := IdempotencyMiddleware(idempotency.NewUseCase(repo, &retryingDBTx{retries: 3}))(handler)
+			req := httptest.NewRequest(http.MethodPost, "/wallets/1/withdraw", strings.NewReader(`{"amount":"1"}`))
+			req.Header.Set(idempotencyKeyHeader, "key-1")
+			w := httptest.NewRecorder()
+
+			middleware.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus || calls != tt.wantCalls {
+				t.Fatalf("IdempotencyMiddleware() = %d after %d calls, want %d after %d", w.Code, calls, tt.wantStatus, tt.wantCalls)
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != `{"body":"{\"amount\":\"1\"}"}`+"\n" {
+				t.Errorf("IdempotencyMiddleware() body = %s, want the request body read on the last call", w.Body.String())
+			}
+			if tt.wantStatus == http.StatusConflict && !strings.Contains(w.Body.String(), `"code":"CONFLICT"`) {
+				t.Errorf("IdempotencyMiddleware() body = %s, want the conflict", w.Body.String())
+			}
+			_, err := repo.Get(context.Background(), "key-1")
+			if stored := err == nil; stored != tt.wantStored {
+				t.Errorf("IdempotencyMiddleware() stored = %v, want %v", stored, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	ctx := context.Background()
+	aead, err := auth.NewCipher(strings.Repeat("ab", auth.EncryptionKeySize))
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	uc := auth.NewUseCase(auth.NewMockRepository(), auth.WithCipher(aead))
+	key, apiKey, err := uc.CreateKey(ctx, "checkout", auth.RoleClient, "acme")
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	_, secret, _ := auth.ParseAPIKey(apiKey)
+
+	var (
+		principal *auth.Principal
+		tenantID  string
+		body      string
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = auth.FromContext(r.Context())
+		tenantID, _ = tenant.FromContext(r.Context())
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	})
+	middleware := AuthMiddleware(uc)(handler)
+
+	const reqBody = `{"amount":"10"}`
+	sign := func(nonce string, at time.Time) http.Header {
+		signed := &auth.SignedRequest{
+			Method:    http.MethodPost,
+			Path:      "/wallets/1/deposit?source=test",
+			Timestamp: at,
+			Nonce:     nonce,
+			Body:      []byte(reqBody),
+		}
+		h := http.Header{}
+		h.Set(apiKeyIDHeader, key.ID)
+		h.Set(timestampHeader, strconv.FormatInt(at.Unix(), 10))
+		h.Set(nonceHeader, nonce)
+		h.Set(signatureHeader, auth.Sign(secret, signed))
+		return h
+	}
+	withHeader := func(name, value string) http.Header {
+		h := http.Header{}
+		h.Set(name, value)
+		return h
+	}
+	replayed := sign("nonce-2", time.Now())
+
+	tests := []struct {
+		name       string
+		header     http.Header
+		wantStatus int
+	}{
+		{name: "no credentials", header: http.Header{}, wantStatus: http.StatusUnauthorized},
+		{name: "api key", header: withHeader(apiKeyHeader, apiKey), wantStatus: http.StatusOK},
+		{name: "wrong api key", header: withHeader(apiKeyHeader, key.ID+".wrong"), wantStatus: http.StatusUnauthorized},
+		{name: "signed request", header: sign("nonce-1", time.Now()), wantStatus: http.StatusOK},
+		{name: "first use of a nonce", header: replayed, wantStatus: http.StatusOK},
+		{name: "replayed signature", header: replayed, wantStatus: http.StatusUnauthorized},
+		{name: "stale signature", header: sign("nonce-3", time.Now().Add(-time.Hour)), wantStatus: http.StatusUnauthorized},
+		{name: "invalid timestamp", header: withHeader(signatureHeader, "abc"), wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, tenantID, body = nil, "", ""
+			req := httptest.NewRequest(http.MethodPost, "/wallets/1/deposit?source=test", strings.NewReader(reqBody))
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			w := httptest.NewRecorder()
+
+			middleware.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("AuthMiddleware() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if principal == nil || principal.KeyID != key.ID {
+				t.Errorf("AuthMiddleware() principal = %+v, want key %s", principal, key.ID)
+			}
+			if tenantID != "acme" {
+				t.Errorf("AuthMiddleware() tenant = %q, want acme", tenantID)
+			}
+			if body != reqBody {
+				t.Errorf("AuthMiddleware() body = %q, want %q", body, reqBody)
+			}
+		})
+	}
+}
+
+func TestIdempotencyMiddleware_ScopedToPrincipal(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := auth.FromContext(r.Context())
+		renderJSON(w, r, http.StatusOK, map[string]string{"key_id": p.KeyID})
+	})
+	middleware := IdempotencyMiddleware(idempotency.NewUseCase(idempotency.NewMockRepository(), &mockDBTx{}))(handler)
+
+	for _, keyID := range []string{"ak_1", "ak_2"} {
+		req := httptest.NewRequest(http.MethodPost, "/wallets/1/deposit", strings.NewReader(`{"amount":"1"}`))
+		req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{KeyID: keyID}))
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		w := httptest.NewRecorder()
+
+		middleware.ServeHTTP(w, req)
+
+		// the same key used by another client runs the request again
+		if w.Code != http.StatusOK || w.Header().Get(idempotentReplayedHeader) != "" {
+			t.Errorf("IdempotencyMiddleware() principal %s status = %v, replayed = %q", keyID, w.Code, w.Header().Get(idempotentReplayedHeader))
+		}
+		if want := `{"key_id":"` + keyID + `"}`; strings.TrimSpace(w.Body.String()) != want {
+			t.Errorf("IdempotencyMiddleware() body = %v, want %v", w.Body.String(), want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package mocks
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+)
+
+type MockFXUseCase struct {
+	OnLoadRates func(ctx context.Context, rates []*fx.Rate) error
+	OnRate      func(ctx context.Context, base, quote string) (*fx.Rate, error)
+	OnQuote     func(ctx context.Context, quote *fx.Quote) error
+	OnRedeem    func(ctx context.Context, quoteID string) (*fx.Quote, error)
+}
+
+func (m *MockFXUseCase) LoadRates(ctx context.Context, rates []*fx.Rate) error {
+	return m.OnLoadRates(ctx, rates)
+}
+
+func (m *MockFXUseCase) Rate(ctx context.Context, base, quote string) (*fx.Rate, error) {
+	return m.OnRate(ctx, base, quote)
+}
+
+func (m *MockFXUseCase) Quote(ctx context.Context, quote *fx.Quote) error {
+	return m.OnQuote(ctx, quote)
+}
+
+func (m *MockFXUseCase) Redeem(ctx context.Context, quoteID string) (*fx.Quote, error) {
+	return m.OnRedeem(ctx, quoteID)
+}
@@ -2,17 +2,32 @@ package mocks
 
 import (
 	"context"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
 	"github.com/guoxiaopeng875/wallet/internal/wallet"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/hold"
 	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
 	"github.com/shopspring/decimal"
+	"time"
 )
 
 type MockUseCase struct {
 	OnDeposit            func(ctx context.Context, walletID uint, amount decimal.Decimal) error
 	OnWithdraw           func(ctx context.Context, walletID uint, amount decimal.Decimal) error
 	OnTransfer           func(ctx context.Context, fromID, toID uint, amount decimal.Decimal) error
+	OnQuoteTransfer      func(ctx context.Context, fromID, toID uint, amount decimal.Decimal) (*fx.Quote, error)
+	OnConvertTransfer    func(ctx context.Context, fromID, toID uint, amount decimal.Decimal, quoteID string) error
+	OnAuthorize          func(ctx context.Context, walletID uint, amount decimal.Decimal, ttl time.Duration) (*hold.Hold, error)
+	OnCapture            func(ctx context.Context, walletID, holdID uint, amount decimal.Decimal) (*hold.Hold, error)
+	OnVoid               func(ctx context.Context, walletID, holdID uint) (*hold.Hold, error)
+	OnWalletHolds        func(ctx context.Context, walletID uint) ([]hold.Hold, error)
+	OnExpireHolds        func(ctx context.Context, at time.Time) (int, error)
+	OnReverse            func(ctx context.Context, transactionID uint, amount decimal.Decimal, reason string) (*transaction.Transaction, error)
 	OnWallet             func(ctx context.Context, walletID uint) (*wallet.Wallet, error)
-	OnWalletTransactions func(ctx context.Context, walletID uint) ([]transaction.Transaction, error)
+	OnWalletTransactions func(ctx context.Context, walletID uint, filter transaction.Filter) (*transaction.Page, error)
+	OnCreateWallet       func(ctx context.Context, currency string) (*wallet.Wallet, error)
+	OnFreezeWallet       func(ctx context.Context, walletID uint) (*wallet.Wallet, error)
+	OnUnfreezeWallet     func(ctx context.Context, walletID uint) (*wallet.Wallet, error)
+	OnCloseWallet        func(ctx context.Context, walletID uint) (*wallet.Wallet, error)
 }
 
 func (m *MockUseCase) Deposit(ctx context.Context, walletID uint, amount decimal.Decimal) error {
@@ -27,10 +42,58 @@ func (m *MockUseCase) Transfer(ctx context.Context, fromID, toID uint, amount de
 	return m.OnTransfer(ctx, fromID, toID, amount)
 }
 
+func (m *MockUseCase) QuoteTransfer(ctx context.Context, fromID, toID uint, amount decimal.Decimal) (*fx.Quote, error) {
+	return m.OnQuoteTransfer(ctx, fromID, toID, amount)
+}
+
+func (m *MockUseCase) ConvertTransfer(ctx context.Context, fromID, toID uint, amount decimal.Decimal, quoteID string) error {
+	return m.OnConvertTransfer(ctx, fromID, toID, amount, quoteID)
+}
+
+func (m *MockUseCase) Authorize(ctx context.Context, walletID uint, amount decimal.Decimal, ttl time.Duration) (*hold.Hold, error) {
+	return m.OnAuthorize(ctx, walletID, amount, ttl)
+}
+
+func (m *MockUseCase) Capture(ctx context.Context, walletID, holdID uint, amount decimal.Decimal) (*hold.Hold, error) {
+	return m.OnCapture(ctx, walletID, holdID, amount)
+}
+
+func (m *MockUseCase) Void(ctx context.Context, walletID, holdID uint) (*hold.Hold, error) {
+	return m.OnVoid(ctx, walletID, holdID)
+}
+
+func (m *MockUseCase) WalletHolds(ctx context.Context, walletID uint) ([]hold.Hold, error) {
+	return m.OnWalletHolds(ctx, walletID)
+}
+
+func (m *MockUseCase) ExpireHolds(ctx context.Context, at time.Time) (int, error) {
+	return m.OnExpireHolds(ctx, at)
+}
+
+func (m *MockUseCase) Reverse(ctx context.Context, transactionID uint, amount decimal.Decimal, reason string) (*transaction.Transaction, error) {
+	return m.OnReverse(ctx, transactionID, amount, reason)
+}
+
 func (m *MockUseCase) Wallet(ctx context.Context, walletID uint) (*wallet.Wallet, error) {
 	return m.OnWallet(ctx, walletID)
 }
 
-func (m *MockUseCase) WalletTransactions(ctx context.Context, walletID uint) ([]transaction.Transaction, error) {
-	return m.OnWalletTransactions(ctx, walletID)
+func (m *MockUseCase) WalletTransactions(ctx context.Context, walletID uint, filter transaction.Filter) (*transaction.Page, error) {
+	return m.OnWalletTransactions(ctx, walletID, filter)
+}
+
+func (m *MockUseCase) CreateWallet(ctx context.Context, currency string) (*wallet.Wallet, error) {
+	return m.OnCreateWallet(ctx, currency)
+}
+
+func (m *MockUseCase) FreezeWallet(ctx context.Context, walletID uint) (*wallet.Wallet, error) {
+	return m.OnFreezeWallet(ctx, walletID)
+}
+
+func (m *MockUseCase) UnfreezeWallet(ctx context.Context, walletID uint) (*wallet.Wallet, error) {
+	return m.OnUnfreezeWallet(ctx, walletID)
+}
+
+func (m *MockUseCase) CloseWallet(ctx context.Context, walletID uint) (*wallet.Wallet, error) {
+	return m.OnCloseWallet(ctx, walletID)
 }
@@ -0,0 +1,36 @@
+package mocks
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/webhook"
+	"time"
+)
+
+type MockWebhookUseCase struct {
+	OnPublish            func(ctx context.Context, event *outbox.Event) error
+	OnCreateSubscription func(ctx context.Context, s *webhook.Subscription) error
+	OnSubscription       func(ctx context.Context, id uint) (*webhook.Subscription, error)
+	OnDeliveries         func(ctx context.Context, subscriptionID uint) ([]webhook.Delivery, error)
+	OnDeliver            func(ctx context.Context, at time.Time) (int, error)
+}
+
+func (m *MockWebhookUseCase) Publish(ctx context.Context, event *outbox.Event) error {
+	return m.OnPublish(ctx, event)
+}
+
+func (m *MockWebhookUseCase) CreateSubscription(ctx context.Context, s *webhook.Subscription) error {
+	return m.OnCreateSubscription(ctx, s)
+}
+
+func (m *MockWebhookUseCase) Subscription(ctx context.Context, id uint) (*webhook.Subscription, error) {
+	return m.OnSubscription(ctx, id)
+}
+
+func (m *MockWebhookUseCase) Deliveries(ctx context.Context, subscriptionID uint) ([]webhook.Delivery, error) {
+	return m.OnDeliveries(ctx, subscriptionID)
+}
+
+func (m *MockWebhookUseCase) Deliver(ctx context.Context, at time.Time) (int, error) {
+	return m.OnDeliver(ctx, at)
+}
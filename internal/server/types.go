@@ -1,6 +1,11 @@
 package server
 
-import "github.com/shopspring/decimal"
+import (
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/wallet"
+	"github.com/guoxiaopeng875/wallet/internal/webhook"
+	"github.com/shopspring/decimal"
+)
 
 // Request types for API endpoints
 type (
@@ -12,13 +17,92 @@ type (
 		Amount decimal.Decimal `json:"amount" validate:"required,gt=0"`
 	}
 
+	CreateWalletRequest struct {
+		Currency string `json:"currency" validate:"required,len=3"`
+	}
+
 	TransferRequest struct {
 		TargetWalletID uint            `json:"target_wallet_id" validate:"required,gt=0"`
 		Amount         decimal.Decimal `json:"amount" validate:"required,gt=0"`
+		QuoteID        string          `json:"quote_id,omitempty"`
+	}
+
+	AuthorizeRequest struct {
+		Amount decimal.Decimal `json:"amount" validate:"required,gt=0"`
+		// ExpiresIn is the hold lifetime in seconds, the default lifetime is used if it is zero
+		ExpiresIn int64 `json:"expires_in" validate:"gte=0"`
+	}
+
+	CaptureRequest struct {
+		// Amount to capture, the full hold is captured if it is zero
+		Amount decimal.Decimal `json:"amount" validate:"gte=0"`
+	}
+
+	ReverseRequest struct {
+		// Amount to refund, the remaining amount is reversed if it is zero
+		Amount decimal.Decimal `json:"amount" validate:"gte=0"`
+		Reason string          `json:"reason" validate:"required"`
+	}
+
+	QuoteTransferRequest struct {
+		TargetWalletID uint            `json:"target_wallet_id" validate:"required,gt=0"`
+		Amount         decimal.Decimal `json:"amount" validate:"required,gt=0"`
+	}
+
+	CreateWebhookRequest struct {
+		URL string `json:"url" validate:"required,max=2048"`
+		// EventTypes filters the events delivered, every event if empty
+		EventTypes []outbox.Type `json:"event_types"`
+		// WalletIDs filters the wallets whose events are delivered, required unless admin
+		WalletIDs []uint `json:"wallet_ids"`
+		// Secret signs the deliveries, one is generated if it is empty
+		Secret string `json:"secret,omitempty" validate:"max=255"`
 	}
 
 	// Response types
+	// BalanceResponse has the ledger balance and the available balance that is not held
 	BalanceResponse struct {
-		Balance string `json:"balance"`
+		Balance   string `json:"balance"`
+		Available string `json:"available"`
+		Currency  string `json:"currency"`
+	}
+
+	WalletResponse struct {
+		ID        uint   `json:"id"`
+		Currency  string `json:"currency"`
+		Balance   string `json:"balance"`
+		Available string `json:"available"`
+		Status    string `json:"status"`
+		OwnerID   string `json:"owner_id,omitempty"`
+	}
+
+	// WebhookResponse is a subscription, with its secret only when it is created
+	WebhookResponse struct {
+		*webhook.Subscription
+		Secret string `json:"secret,omitempty"`
+	}
+
+	// ProblemResponse is an RFC 9457 problem detail, every error is rendered as one
+	ProblemResponse struct {
+		Type   string `json:"type"`
+		Title  string `json:"title"`
+		Status int    `json:"status"`
+		Detail string `json:"detail,omitempty"`
+		// Code is the stable application error code, e.g. INSUFFICIENT_BALANCE
+		Code string `json:"code"`
+		// Details are optional details of the error, e.g. the invalid fields of a request
+		Details   map[string]string `json:"details,omitempty"`
+		RequestID string            `json:"request_id,omitempty"`
 	}
 )
+
+func newWalletResponse(w *wallet.Wallet) *WalletResponse {
+	return &WalletResponse{
+		ID:        w.ID,
+		Currency:  w.Currency,
+		Balance:   w.Balance.String(),
+		Available: w.Available().String(),
+		Status:    string(w.Status),
+		OwnerID:   w.OwnerID,
+	}
+}
@@ -2,46 +2,190 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
 	"github.com/guoxiaopeng875/wallet/internal/pkg/util"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/validate"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
+	"github.com/shopspring/decimal"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Helper functions for request handling
 
-func renderJSON(w http.ResponseWriter, status int, data interface{}) {
+func renderJSON(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if data != nil {
 		if err := json.NewEncoder(w).Encode(data); err != nil {
-			handleError(w, errors.InternalServer.WithCause(err))
+			handleError(w, r, errors.InternalServer.WithCause(err))
 		}
 	}
 }
 
+// maxRequestBodyBytes is the largest request body the API reads
+const maxRequestBodyBytes = 1 << 20
+
+// parseReqBody decodes the JSON body of the request into v and checks its validate tags.
+// Empty, oversized and trailing bodies are refused, as are unknown fields.
 func parseReqBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
-	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
-		handleError(w, errors.InvalidArgs.WithCause(err))
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = fmt.Errorf("request body must be a single JSON value")
+	}
+	if err != nil {
+		handleError(w, r, bodyError(err))
+		return false
+	}
+	if err := validate.Struct(v); err != nil {
+		handleError(w, r, err)
 		return false
 	}
 	return true
 }
 
-func parseWalletID(w http.ResponseWriter, r *http.Request) uint {
-	id, err := util.StringToUint(mux.Vars(r)["id"])
+// bodyError classifies an error decoding the request body, naming the field at fault when possible
+func bodyError(err error) error {
+	var (
+		maxBytesErr *http.MaxBytesError
+		typeErr     *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return errors.RequestTooLarge.WithCause(err)
+	case errors.Is(err, io.EOF):
+		return errors.InvalidArgs.WithCause(fmt.Errorf("request body is required"))
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return errors.InvalidArgs.WithCause(err).WithMetadata(map[string]string{typeErr.Field: "must be a " + typeErr.Type.String()})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return errors.InvalidArgs.WithCause(err).WithMetadata(map[string]string{field: "is not allowed"})
+	}
+	return errors.InvalidArgs.WithCause(err)
+}
+
+// checkTargetWallet refuses a request moving money from a wallet to itself
+func checkTargetWallet(w http.ResponseWriter, r *http.Request, walletID, targetWalletID uint) bool {
+	if walletID == targetWalletID {
+		handleError(w, r, errors.InvalidArgs.WithMetadata(map[string]string{"target_wallet_id": "must differ from the source wallet"}))
+		return false
+	}
+	return true
+}
+
+// parseID parses the route variable name as an ID, it returns 0 if the ID is invalid
+func parseID(w http.ResponseWriter, r *http.Request, name string) uint {
+	id, err := util.StringToUint(mux.Vars(r)[name])
 	if err != nil {
-		handleError(w, errors.InvalidArgs.WithCause(err))
+		handleError(w, r, errors.InvalidArgs.WithCause(fmt.Errorf("%s: %w", name, err)))
 		return 0
 	}
 	return id
 }
 
-func handleError(w http.ResponseWriter, err error) {
+// parseTransactionFilter parses the transaction history query:
+// method (repeated or comma separated), from and to (RFC 3339), min_amount, max_amount,
+// counterparty, order (asc or desc), limit and cursor.
+func parseTransactionFilter(w http.ResponseWriter, r *http.Request) (transaction.Filter, bool) {
+	q, filter := r.URL.Query(), transaction.Filter{}
+	fail := func(name string, err error) (transaction.Filter, bool) {
+		handleError(w, r, errors.InvalidArgs.WithCause(fmt.Errorf("%s: %w", name, err)))
+		return filter, false
+	}
+
+	for _, v := range q["method"] {
+		for _, m := range strings.Split(v, ",") {
+			filter.Methods = append(filter.Methods, transaction.Method(strings.TrimSpace(m)))
+		}
+	}
+	for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := q.Get(name); v != "" {
+			at, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return fail(name, err)
+			}
+			*t = at
+		}
+	}
+	for name, d := range map[string]*decimal.NullDecimal{"min_amount": &filter.MinAmount, "max_amount": &filter.MaxAmount} {
+		if v := q.Get(name); v != "" {
+			amount, err := decimal.NewFromString(v)
+			if err != nil {
+				return fail(name, err)
+			}
+			*d = decimal.NewNullDecimal(amount)
+		}
+	}
+	if v := q.Get("counterparty"); v != "" {
+		id, err := util.StringToUint(v)
+		if err != nil {
+			return fail("counterparty", err)
+		}
+		filter.CounterpartyID = id
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return fail("limit", err)
+		}
+		filter.Limit = limit
+	}
+	if v := q.Get("cursor"); v != "" {
+		after, err := transaction.ParseCursor(v)
+		if err != nil {
+			handleError(w, r, err)
+			return filter, false
+		}
+		filter.After = after
+	}
+	filter.Order = transaction.Order(q.Get("order"))
+	return filter, true
+}
+
+// errorRecorder is a response writer keeping the error its response renders
+type errorRecorder interface {
+	recordError(err error)
+}
+
+// handleError renders err as an application/problem+json response,
+// errors that aren't an *errors.Error are hidden behind an internal server error.
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if rec, ok := w.(errorRecorder); ok {
+		rec.recordError(err)
+	}
 	var wErr *errors.Error
-	if errors.As(err, &wErr) {
-		http.Error(w, wErr.Message, wErr.Code)
-		return
+	if !errors.As(err, &wErr) {
+		wErr = errors.InternalServer.WithCause(err)
+	}
+	status := wErr.Code
+	if status < http.StatusBadRequest {
+		status = http.StatusInternalServerError
 	}
-	http.Error(w, err.Error(), http.StatusInternalServerError)
+	if status >= http.StatusInternalServerError {
+		log.FromContext(r.Context()).Errorf("Request failed: %v", err)
+	}
+
+	problem := &ProblemResponse{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    wErr.Message,
+		Code:      wErr.Reason,
+		Details:   wErr.Metadata,
+		RequestID: RequestID(r.Context()),
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/problem+json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(problem)
 }
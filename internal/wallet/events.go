@@ -0,0 +1,66 @@
+package wallet
+
+import (
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
+)
+
+// Domain events written to the outbox with every money movement.
+const (
+	// EventWalletCredited is written for the wallet money reached
+	EventWalletCredited outbox.Type = "wallet.credited"
+	// EventWalletDebited is written for the wallet money left
+	EventWalletDebited outbox.Type = "wallet.debited"
+	// EventTransferCompleted is written for the source wallet of a transfer, after its debit and credit
+	EventTransferCompleted outbox.Type = "transfer.completed"
+	// EventTransactionReversed is written for the first wallet of a reversal, after its debit and credit
+	EventTransactionReversed outbox.Type = "transaction.reversed"
+)
+
+// EventTypes are the types of all the domain events of the wallets.
+var EventTypes = []outbox.Type{EventWalletCredited, EventWalletDebited, EventTransferCompleted, EventTransactionReversed}
+
+// MovementEvent is the payload of the domain events, the wallet and the transaction that moved its money.
+type MovementEvent struct {
+	WalletID    uint                     `json:"wallet_id"`
+	Transaction *transaction.Transaction `json:"transaction"`
+}
+
+// transactionEvents returns the events of a recorded transaction, the debit and credit of its wallets,
+// then the completion of a transfer or reversal. Money moving in or out of the service has no wallet on one side.
+func transactionEvents(tx *transaction.Transaction) ([]*outbox.Event, error) {
+	var events []*outbox.Event
+	add := func(eventType outbox.Type, walletID uint) error {
+		e, err := outbox.NewEvent(eventType, walletID, tx.TenantID, MovementEvent{WalletID: walletID, Transaction: tx})
+		if err != nil {
+			return err
+		}
+		events = append(events, e)
+		return nil
+	}
+	if tx.FromWalletID != 0 {
+		if err := add(EventWalletDebited, tx.FromWalletID); err != nil {
+			return nil, err
+		}
+	}
+	if tx.ToWalletID != 0 {
+		if err := add(EventWalletCredited, tx.ToWalletID); err != nil {
+			return nil, err
+		}
+	}
+	walletID := tx.FromWalletID
+	if walletID == 0 {
+		walletID = tx.ToWalletID
+	}
+	switch tx.Method {
+	case transaction.MethodTransfer:
+		if err := add(EventTransferCompleted, walletID); err != nil {
+			return nil, err
+		}
+	case transaction.MethodReversal:
+		if err := add(EventTransactionReversed, walletID); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
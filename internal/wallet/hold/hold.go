@@ -0,0 +1,77 @@
+package hold
+
+import (
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// Status of hold
+type Status string
+
+const (
+	StatusAuthorized Status = "authorized"
+	StatusCaptured   Status = "captured"
+	StatusVoided     Status = "voided"
+	StatusExpired    Status = "expired"
+)
+
+// Hold reserves Amount of a wallet balance until it is captured, voided or expires.
+// A hold is captured at most once, a partial capture releases the rest of the amount.
+type Hold struct {
+	ID             uint            `json:"id"`
+	WalletID       uint            `json:"wallet_id"`
+	Amount         decimal.Decimal `json:"amount"`
+	CapturedAmount decimal.Decimal `json:"captured_amount"`
+	Currency       string          `json:"currency"`
+	Status         Status          `json:"status"`
+	CreatedAt      time.Time       `json:"created_at"`
+	ExpiresAt      time.Time       `json:"expires_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// New creates an authorized hold on the wallet expiring after ttl
+func New(walletID uint, amount decimal.Decimal, currency string, ttl time.Duration) *Hold {
+	now := time.Now()
+	return &Hold{
+		WalletID:       walletID,
+		Amount:         amount,
+		CapturedAmount: decimal.Zero,
+		Currency:       currency,
+		Status:         StatusAuthorized,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(ttl),
+		UpdatedAt:      now,
+	}
+}
+
+// CheckCapture checks if amount of the hold can be captured at the given time
+func (h *Hold) CheckCapture(amount decimal.Decimal, at time.Time) error {
+	if err := h.checkAuthorized(); err != nil {
+		return err
+	}
+	if h.IsExpired(at) {
+		return errors.HoldExpired
+	}
+	if amount.GreaterThan(h.Amount) {
+		return errors.CaptureExceedsHold
+	}
+	return nil
+}
+
+// CheckVoid checks if the hold can be voided, an expired hold can still be voided
+func (h *Hold) CheckVoid() error {
+	return h.checkAuthorized()
+}
+
+// IsExpired reports whether the hold is past its expiry at the given time
+func (h *Hold) IsExpired(at time.Time) bool {
+	return !at.Before(h.ExpiresAt)
+}
+
+func (h *Hold) checkAuthorized() error {
+	if h.Status != StatusAuthorized {
+		return errors.InvalidHoldStatus
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package hold
+
+import (
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	h := New(1, decimal.NewFromFloat(100), "USD", time.Hour)
+	if h.Status != StatusAuthorized {
+		t.Errorf("New() status = %v, want %v", h.Status, StatusAuthorized)
+	}
+	if !h.CapturedAmount.IsZero() {
+		t.Errorf("New() captured amount = %v, want 0", h.CapturedAmount)
+	}
+	if got := h.ExpiresAt.Sub(h.CreatedAt); got != time.Hour {
+		t.Errorf("New() ttl = %v, want %v", got, time.Hour)
+	}
+}
+
+func TestHold_CheckCapture(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		hold    Hold
+		amount  decimal.Decimal
+		wantErr error
+	}{
+		{
+			name:   "full capture",
+			hold:   Hold{Amount: decimal.NewFromFloat(100), Status: StatusAuthorized, ExpiresAt: now.Add(time.Hour)},
+			amount: decimal.NewFromFloat(100),
+		},
+		{
+			name:   "partial capture",
+			hold:   Hold{Amount: decimal.NewFromFloat(100), Status: StatusAuthorized, ExpiresAt: now.Add(time.Hour)},
+			amount: decimal.NewFromFloat(40),
+		},
+		{
+			name:    "capture exceeds hold",
+			hold:    Hold{Amount: decimal.NewFromFloat(100), Status: StatusAuthorized, ExpiresAt: now.Add(time.Hour)},
+			amount:  decimal.NewFromFloat(100.01),
+			wantErr: errors.CaptureExceedsHold,
+		},
+		{
+			name:    "expired hold",
+			hold:    Hold{Amount: decimal.NewFromFloat(100), Status: StatusAuthorized, ExpiresAt: now},
+			amount:  decimal.NewFromFloat(100),
+			wantErr: errors.HoldExpired,
+		},
+		{
+			name:    "captured hold",
+			hold:    Hold{Amount: decimal.NewFromFloat(100), Status: StatusCaptured, ExpiresAt: now.Add(time.Hour)},
+			amount:  decimal.NewFromFloat(100),
+			wantErr: errors.InvalidHoldStatus,
+		},
+		{
+			name:    "voided hold",
+			hold:    Hold{Amount: decimal.NewFromFloat(100), Status: StatusVoided, ExpiresAt: now.Add(time.Hour)},
+			amount:  decimal.NewFromFloat(100),
+			wantErr: errors.InvalidHoldStatus,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.hold.CheckCapture(tt.amount, now); err != tt.wantErr {
+				t.Errorf("CheckCapture() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHold_CheckVoid(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  Status
+		wantErr error
+	}{
+		{"authorized", StatusAuthorized, nil},
+		{"captured", StatusCaptured, errors.InvalidHoldStatus},
+		{"voided", StatusVoided, errors.InvalidHoldStatus},
+		{"expired", StatusExpired, errors.InvalidHoldStatus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Hold{Status: tt.status}
+			if err := h.CheckVoid(); err != tt.wantErr {
+				t.Errorf("CheckVoid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package hold
+
+import (
+	"context"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// Repository defines the repository for hold.
+type Repository interface {
+	// Create creates a new hold and sets its id.
+	Create(ctx context.Context, hold *Hold) error
+	// Get gets the hold by id.
+	Get(ctx context.Context, id uint) (*Hold, error)
+	// ListByWalletID lists the holds of the wallet, newest first.
+	ListByWalletID(ctx context.Context, walletID uint) ([]Hold, error)
+	// ListExpired lists at most limit authorized holds that expired at the given time.
+	ListExpired(ctx context.Context, at time.Time, limit int) ([]Hold, error)
+	// UpdateStatus settles an authorized hold with the given status and captured amount.
+	// Fails with ConcurrentUpdate if the status changed since the hold was read.
+	UpdateStatus(ctx context.Context, hold *Hold, status Status, capturedAmount decimal.Decimal) error
+}
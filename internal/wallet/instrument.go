@@ -0,0 +1,156 @@
+package wallet
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/hold"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// WithTracer traces every use case in a span named wallet.<operation>, child of the span of its context.
+func WithTracer(tracer *trace.Tracer) Option {
+	return func(u *useCase) {
+		u.tracer = tracer
+	}
+}
+
+// instrumentedUseCase counts the outcome of the use cases and traces them, as configured.
+type instrumentedUseCase struct {
+	uc      UseCase
+	metrics *useCaseMetrics
+	tracer  *trace.Tracer
+}
+
+// begin starts the span of an operation, done ends it and counts the outcome.
+func (i *instrumentedUseCase) begin(ctx context.Context, operation string, attrs ...trace.Attribute) (context.Context, func(err error)) {
+	ctx, span := i.tracer.Start(ctx, "wallet."+operation, trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		span.SetError(err)
+		span.End()
+		if i.metrics != nil {
+			i.metrics.observe(operation, err)
+		}
+	}
+}
+
+func (i *instrumentedUseCase) Deposit(ctx context.Context, walletID uint, amount decimal.Decimal) error {
+	ctx, done := i.begin(ctx, "deposit", trace.Attr("wallet.id", walletID))
+	err := i.uc.Deposit(ctx, walletID, amount)
+	done(err)
+	return err
+}
+
+func (i *instrumentedUseCase) Withdraw(ctx context.Context, walletID uint, amount decimal.Decimal) error {
+	ctx, done := i.begin(ctx, "withdraw", trace.Attr("wallet.id", walletID))
+	err := i.uc.Withdraw(ctx, walletID, amount)
+	done(err)
+	return err
+}
+
+func (i *instrumentedUseCase) Transfer(ctx context.Context, fromWalletID, toWalletID uint, amount decimal.Decimal) error {
+	ctx, done := i.begin(ctx, "transfer", trace.Attr("wallet.from_id", fromWalletID), trace.Attr("wallet.to_id", toWalletID))
+	err := i.uc.Transfer(ctx, fromWalletID, toWalletID, amount)
+	done(err)
+	return err
+}
+
+func (i *instrumentedUseCase) QuoteTransfer(ctx context.Context, fromWalletID, toWalletID uint, amount decimal.Decimal) (*fx.Quote, error) {
+	ctx, done := i.begin(ctx, "quote_transfer", trace.Attr("wallet.from_id", fromWalletID), trace.Attr("wallet.to_id", toWalletID))
+	quote, err := i.uc.QuoteTransfer(ctx, fromWalletID, toWalletID, amount)
+	done(err)
+	return quote, err
+}
+
+func (i *instrumentedUseCase) ConvertTransfer(ctx context.Context, fromWalletID, toWalletID uint, amount decimal.Decimal, quoteID string) error {
+	ctx, done := i.begin(ctx, "convert_transfer", trace.Attr("wallet.from_id", fromWalletID), trace.Attr("wallet.to_id", toWalletID))
+	err := i.uc.ConvertTransfer(ctx, fromWalletID, toWalletID, amount, quoteID)
+	done(err)
+	return err
+}
+
+func (i *instrumentedUseCase) Authorize(ctx context.Context, walletID uint, amount decimal.Decimal, ttl time.Duration) (*hold.Hold, error) {
+	ctx, done := i.begin(ctx, "authorize", trace.Attr("wallet.id", walletID))
+	h, err := i.uc.Authorize(ctx, walletID, amount, ttl)
+	done(err)
+	return h, err
+}
+
+func (i *instrumentedUseCase) Capture(ctx context.Context, walletID, holdID uint, amount decimal.Decimal) (*hold.Hold, error) {
+	ctx, done := i.begin(ctx, "capture", trace.Attr("wallet.id", walletID), trace.Attr("hold.id", holdID))
+	h, err := i.uc.Capture(ctx, walletID, holdID, amount)
+	done(err)
+	return h, err
+}
+
+func (i *instrumentedUseCase) Void(ctx context.Context, walletID, holdID uint) (*hold.Hold, error) {
+	ctx, done := i.begin(ctx, "void", trace.Attr("wallet.id", walletID), trace.Attr("hold.id", holdID))
+	h, err := i.uc.Void(ctx, walletID, holdID)
+	done(err)
+	return h, err
+}
+
+func (i *instrumentedUseCase) WalletHolds(ctx context.Context, walletID uint) ([]hold.Hold, error) {
+	ctx, done := i.begin(ctx, "wallet_holds", trace.Attr("wallet.id", walletID))
+	holds, err := i.uc.WalletHolds(ctx, walletID)
+	done(err)
+	return holds, err
+}
+
+func (i *instrumentedUseCase) ExpireHolds(ctx context.Context, at time.Time) (int, error) {
+	ctx, done := i.begin(ctx, "expire_holds")
+	n, err := i.uc.ExpireHolds(ctx, at)
+	done(err)
+	return n, err
+}
+
+func (i *instrumentedUseCase) Reverse(ctx context.Context, transactionID uint, amount decimal.Decimal, reason string) (*transaction.Transaction, error) {
+	ctx, done := i.begin(ctx, "reverse", trace.Attr("transaction.id", transactionID))
+	tx, err := i.uc.Reverse(ctx, transactionID, amount, reason)
+	done(err)
+	return tx, err
+}
+
+func (i *instrumentedUseCase) Wallet(ctx context.Context, walletID uint) (*Wallet, error) {
+	ctx, done := i.begin(ctx, "wallet", trace.Attr("wallet.id", walletID))
+	w, err := i.uc.Wallet(ctx, walletID)
+	done(err)
+	return w, err
+}
+
+func (i *instrumentedUseCase) WalletTransactions(ctx context.Context, walletID uint, filter transaction.Filter) (*transaction.Page, error) {
+	ctx, done := i.begin(ctx, "wallet_transactions", trace.Attr("wallet.id", walletID))
+	page, err := i.uc.WalletTransactions(ctx, walletID, filter)
+	done(err)
+	return page, err
+}
+
+func (i *instrumentedUseCase) CreateWallet(ctx context.Context, currencyCode string) (*Wallet, error) {
+	ctx, done := i.begin(ctx, "create_wallet", trace.Attr("wallet.currency", currencyCode))
+	w, err := i.uc.CreateWallet(ctx, currencyCode)
+	done(err)
+	return w, err
+}
+
+func (i *instrumentedUseCase) FreezeWallet(ctx context.Context, walletID uint) (*Wallet, error) {
+	ctx, done := i.begin(ctx, "freeze_wallet", trace.Attr("wallet.id", walletID))
+	w, err := i.uc.FreezeWallet(ctx, walletID)
+	done(err)
+	return w, err
+}
+
+func (i *instrumentedUseCase) UnfreezeWallet(ctx context.Context, walletID uint) (*Wallet, error) {
+	ctx, done := i.begin(ctx, "unfreeze_wallet", trace.Attr("wallet.id", walletID))
+	w, err := i.uc.UnfreezeWallet(ctx, walletID)
+	done(err)
+	return w, err
+}
+
+func (i *instrumentedUseCase) CloseWallet(ctx context.Context, walletID uint) (*Wallet, error) {
+	ctx, done := i.begin(ctx, "close_wallet", trace.Attr("wallet.id", walletID))
+	w, err := i.uc.CloseWallet(ctx, walletID)
+	done(err)
+	return w, err
+}
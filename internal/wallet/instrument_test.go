@@ -0,0 +1,51 @@
+package wallet
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/ledger"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace/tracetest"
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+func TestUseCase_Tracer(t *testing.T) {
+	exporter := &tracetest.Recorder{}
+	tracer := trace.NewTracer(exporter)
+	uc, _, _ := setupTestWithOutbox(t, ledger.NewMockRepository(), outbox.NewMockRepository(), WithTracer(tracer))
+
+	ctx, request := tracer.Start(context.Background(), "POST /wallets/{id}/transfer", trace.WithKind(trace.KindServer))
+	if err := uc.Transfer(ctx, 1, 2, decimal.NewFromFloat(30)); err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	request.End()
+	if err := uc.Withdraw(context.Background(), 2, decimal.NewFromFloat(10000)); !errors.Is(err, errors.InsufficientBalance) {
+		t.Fatalf("Withdraw() error = %v, want %v", err, errors.InsufficientBalance)
+	}
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if len(exporter.Spans()) != 3 {
+		t.Fatalf("exported %d spans, want 3", len(exporter.Spans()))
+	}
+	transfer, withdraw := exporter.Spans()[0], exporter.Spans()[2]
+	if transfer.Name != "wallet.transfer" || transfer.ParentSpanID != request.SpanContext().SpanID {
+		t.Errorf("span = %s, parent %s, want wallet.transfer child of the request", transfer.Name, transfer.ParentSpanID)
+	}
+	want := []trace.Attribute{trace.Attr("wallet.from_id", uint(1)), trace.Attr("wallet.to_id", uint(2))}
+	if len(transfer.Attributes) != 2 || transfer.Attributes[0] != want[0] || transfer.Attributes[1] != want[1] {
+		t.Errorf("transfer attributes = %v, want %v", transfer.Attributes, want)
+	}
+	if transfer.Status != trace.StatusUnset {
+		t.Errorf("transfer status = %v, want unset", transfer.Status)
+	}
+	if withdraw.Name != "wallet.withdraw" || withdraw.ParentSpanID.IsValid() {
+		t.Errorf("span = %s, parent %s, want wallet.withdraw root", withdraw.Name, withdraw.ParentSpanID)
+	}
+	if withdraw.Status != trace.StatusError || withdraw.StatusMessage != errors.InsufficientBalance.Error() {
+		t.Errorf("withdraw status = %v %q, want the error", withdraw.Status, withdraw.StatusMessage)
+	}
+}
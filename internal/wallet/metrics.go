@@ -0,0 +1,86 @@
+package wallet
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/metrics"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
+)
+
+// WithMetrics counts the outcome of every use case per operation and error code, OK on success,
+// and the money moved per transaction method and currency once its transaction is committed.
+func WithMetrics(reg *metrics.Registry) Option {
+	return func(u *useCase) {
+		u.metrics = &useCaseMetrics{
+			operations: reg.Counter("wallet_operations_total", "Wallet use case calls by operation and error code.", "operation", "code"),
+			volume:     reg.Counter("wallet_volume_total", "Money moved by transaction method and currency.", "method", "currency"),
+		}
+	}
+}
+
+type useCaseMetrics struct {
+	operations *metrics.CounterVec
+	volume     *metrics.CounterVec
+}
+
+// observe counts the outcome of an operation, errors that aren't classified count as INTERNAL
+func (m *useCaseMetrics) observe(operation string, err error) {
+	code := "OK"
+	if err != nil {
+		var wErr *errors.Error
+		if !errors.As(err, &wErr) {
+			wErr = errors.InternalServer
+		}
+		code = wErr.Reason
+	}
+	m.operations.With(operation, code).Inc()
+}
+
+type recordedKey struct{}
+
+// afterCommitter is a DBTx deferring work until the outermost database transaction commits.
+type afterCommitter interface {
+	AfterCommit(ctx context.Context, f func())
+}
+
+// countingTx counts the volume of the transactions recorded by a database transaction after it commits,
+// those recorded by an attempt that is rolled back or retried are not counted.
+// Run in a transaction it doesn't own, such as the one of an idempotent request, it counts when that one
+// commits if the DBTx is an afterCommitter.
+type countingTx struct {
+	DBTx
+	metrics *useCaseMetrics
+}
+
+func (c *countingTx) ExecTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(recordedKey{}).(*[]*transaction.Transaction); ok {
+		// nested, the outermost transaction counts
+		return c.DBTx.ExecTx(ctx, fn)
+	}
+	var recorded []*transaction.Transaction
+	err := c.DBTx.ExecTx(ctx, func(ctx context.Context) error {
+		recorded = recorded[:0]
+		return fn(context.WithValue(ctx, recordedKey{}, &recorded))
+	})
+	if err != nil {
+		return err
+	}
+	count := func() {
+		for _, tx := range recorded {
+			c.metrics.volume.With(string(tx.Method), tx.Currency).Add(tx.Amount.InexactFloat64())
+		}
+	}
+	if ac, ok := c.DBTx.(afterCommitter); ok {
+		ac.AfterCommit(ctx, count)
+		return nil
+	}
+	count()
+	return nil
+}
+
+// collect adds a recorded transaction to those counted when the database transaction of ctx commits
+func collect(ctx context.Context, tx *transaction.Transaction) {
+	if recorded, ok := ctx.Value(recordedKey{}).(*[]*transaction.Transaction); ok {
+		*recorded = append(*recorded, tx)
+	}
+}
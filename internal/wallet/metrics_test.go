@@ -0,0 +1,139 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/ledger"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/metrics"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
+	"github.com/shopspring/decimal"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, reg *metrics.Registry) string {
+	var out bytes.Buffer
+	if _, err := reg.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	return out.String()
+}
+
+func TestUseCase_Metrics(t *testing.T) {
+	ctx := context.Background()
+	reg := metrics.NewRegistry()
+	uc, _, _ := setupTestWithOutbox(t, ledger.NewMockRepository(), outbox.NewMockRepository(), WithMetrics(reg))
+
+	if err := uc.Deposit(ctx, 1, decimal.NewFromFloat(100.5)); err != nil {
+		t.Fatalf("Deposit() error = %v", err)
+	}
+	if err := uc.Deposit(ctx, 5, decimal.NewFromFloat(20)); err != nil {
+		t.Fatalf("Deposit() error = %v", err)
+	}
+	if err := uc.Transfer(ctx, 1, 2, decimal.NewFromFloat(30)); err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	if err := uc.Withdraw(ctx, 2, decimal.NewFromFloat(10000)); !errors.Is(err, errors.InsufficientBalance) {
+		t.Fatalf("Withdraw() error = %v, want %v", err, errors.InsufficientBalance)
+	}
+	if _, err := uc.Wallet(ctx, 1); err != nil {
+		t.Fatalf("Wallet() error = %v", err)
+	}
+
+	out := scrape(t, reg)
+	for _, want := range []string{
+		`wallet_operations_total{operation="deposit",code="OK"} 2`,
+		`wallet_operations_total{operation="transfer",code="OK"} 1`,
+		`wallet_operations_total{operation="withdraw",code="INSUFFICIENT_BALANCE"} 1`,
+		`wallet_operations_total{operation="wallet",code="OK"} 1`,
+		`wallet_volume_total{method="deposit",currency="EUR"} 20`,
+		`wallet_volume_total{method="deposit",currency="USD"} 100.5`,
+		`wallet_volume_total{method="transfer",currency="USD"} 30`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("metrics miss %s:\n%s", want, out)
+		}
+	}
+	// a failed movement moves no money
+	if strings.Contains(out, `method="withdraw"`) {
+		t.Errorf("metrics count the volume of a failed withdrawal:\n%s", out)
+	}
+}
+
+// retryingDBTx runs fn once more after a conflict, as the repository does
+type retryingDBTx struct{}
+
+func (retryingDBTx) ExecTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := fn(ctx); !errors.Is(err, errors.ConcurrentUpdate) {
+		return err
+	}
+	return fn(ctx)
+}
+
+func TestCountingTx(t *testing.T) {
+	reg := metrics.NewRegistry()
+	m := &useCaseMetrics{volume: reg.Counter("wallet_volume_total", "", "method", "currency")}
+	dbTx := &countingTx{DBTx: retryingDBTx{}, metrics: m}
+
+	attempt := 0
+	err := dbTx.ExecTx(context.Background(), func(ctx context.Context) error {
+		attempt++
+		collect(ctx, transaction.New(transaction.MethodDeposit, decimal.NewFromInt(5), "USD", 0, 1))
+		if attempt == 1 {
+			return errors.ConcurrentUpdate
+		}
+		// nested transactions are counted by the outermost one
+		return dbTx.ExecTx(ctx, func(ctx context.Context) error {
+			collect(ctx, transaction.New(transaction.MethodWithdraw, decimal.NewFromInt(2), "USD", 1, 0))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("ExecTx() error = %v", err)
+	}
+	if got := m.volume.With("deposit", "USD").Value(); got != 5 {
+		t.Errorf("deposit volume = %v, want 5 from the committed attempt only", got)
+	}
+	if got := m.volume.With("withdraw", "USD").Value(); got != 2 {
+		t.Errorf("withdraw volume = %v, want 2", got)
+	}
+}
+
+// outerDBTx runs fn in the transaction of an enclosing request, keeping the work deferred until it commits
+type outerDBTx struct {
+	afterCommit []func()
+}
+
+func (d *outerDBTx) ExecTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (d *outerDBTx) AfterCommit(_ context.Context, f func()) {
+	d.afterCommit = append(d.afterCommit, f)
+}
+
+func TestCountingTx_OuterTransaction(t *testing.T) {
+	reg := metrics.NewRegistry()
+	m := &useCaseMetrics{volume: reg.Counter("wallet_volume_total", "", "method", "currency")}
+	outer := &outerDBTx{}
+	dbTx := &countingTx{DBTx: outer, metrics: m}
+
+	err := dbTx.ExecTx(context.Background(), func(ctx context.Context) error {
+		collect(ctx, transaction.New(transaction.MethodDeposit, decimal.NewFromInt(5), "USD", 0, 1))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ExecTx() error = %v", err)
+	}
+	if got := m.volume.With("deposit", "USD").Value(); got != 0 {
+		t.Errorf("deposit volume = %v before the outer transaction commits, want 0", got)
+	}
+	for _, f := range outer.afterCommit {
+		f()
+	}
+	if got := m.volume.With("deposit", "USD").Value(); got != 5 {
+		t.Errorf("deposit volume = %v after the outer transaction commits, want 5", got)
+	}
+}
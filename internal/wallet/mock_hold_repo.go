@@ -0,0 +1,74 @@
+package wallet
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/hold"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+type MockHoldRepository struct {
+	holds  map[uint]*hold.Hold
+	nextID uint
+}
+
+func NewMockHoldRepository() *MockHoldRepository {
+	return &MockHoldRepository{
+		holds: make(map[uint]*hold.Hold),
+	}
+}
+
+func (m *MockHoldRepository) Create(ctx context.Context, h *hold.Hold) error {
+	m.nextID++
+	h.ID = m.nextID
+	m.holds[h.ID] = h
+	return nil
+}
+
+func (m *MockHoldRepository) Get(ctx context.Context, id uint) (*hold.Hold, error) {
+	if h, exists := m.holds[id]; exists {
+		return h, nil
+	}
+	return nil, errors.RecordNotFound
+}
+
+func (m *MockHoldRepository) ListByWalletID(ctx context.Context, walletID uint) ([]hold.Hold, error) {
+	result := make([]hold.Hold, 0)
+	for id := m.nextID; id > 0; id-- {
+		if h, exists := m.holds[id]; exists && h.WalletID == walletID {
+			result = append(result, *h)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockHoldRepository) ListExpired(ctx context.Context, at time.Time, limit int) ([]hold.Hold, error) {
+	result := make([]hold.Hold, 0)
+	for id := uint(1); id <= m.nextID && len(result) < limit; id++ {
+		if h, exists := m.holds[id]; exists && h.Status == hold.StatusAuthorized && h.IsExpired(at) {
+			result = append(result, *h)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockHoldRepository) UpdateStatus(ctx context.Context, h *hold.Hold, status hold.Status, capturedAmount decimal.Decimal) error {
+	stored, exists := m.holds[h.ID]
+	if !exists {
+		return errors.RecordNotFound
+	}
+	if stored.Status != h.Status {
+		return errors.ConcurrentUpdate
+	}
+	h.Status, h.CapturedAmount, h.UpdatedAt = status, capturedAmount, time.Now()
+	m.holds[h.ID] = h
+	return nil
+}
+
+func (m *MockHoldRepository) AddHold(h *hold.Hold) {
+	if h.ID > m.nextID {
+		m.nextID = h.ID
+	}
+	m.holds[h.ID] = h
+}
@@ -2,7 +2,10 @@ package wallet
 
 import (
 	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
 	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
+	"github.com/shopspring/decimal"
 )
 
 type MockTransactionRepository struct {
@@ -16,16 +19,44 @@ func NewMockTransactionRepository() *MockTransactionRepository {
 }
 
 func (m *MockTransactionRepository) Create(ctx context.Context, tx *transaction.Transaction) error {
+	tx.ID = uint(len(m.transactions) + 1)
+	if tx.TenantID == "" {
+		tx.TenantID = tenant.OrDefault(ctx)
+	}
 	m.transactions = append(m.transactions, *tx)
 	return nil
 }
 
-func (m *MockTransactionRepository) ListByWalletID(ctx context.Context, walletID uint) ([]transaction.Transaction, error) {
+func (m *MockTransactionRepository) ListByWalletID(ctx context.Context, walletID uint, filter transaction.Filter) ([]transaction.Transaction, error) {
 	result := make([]transaction.Transaction, 0)
 	for _, tx := range m.transactions {
-		if tx.FromWalletID == walletID || tx.ToWalletID == walletID {
+		if inTenant(ctx, tx.TenantID) && filter.Match(walletID, &tx) {
 			result = append(result, tx)
 		}
 	}
+	filter.Sort(result)
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
 	return result, nil
 }
+
+func (m *MockTransactionRepository) Get(ctx context.Context, id uint) (*transaction.Transaction, error) {
+	if id == 0 || id > uint(len(m.transactions)) || !inTenant(ctx, m.transactions[id-1].TenantID) {
+		return nil, errors.RecordNotFound
+	}
+	tx := m.transactions[id-1]
+	return &tx, nil
+}
+
+func (m *MockTransactionRepository) UpdateReversed(ctx context.Context, tx *transaction.Transaction, amount decimal.Decimal) error {
+	if tx.ID == 0 || tx.ID > uint(len(m.transactions)) {
+		return errors.RecordNotFound
+	}
+	if !m.transactions[tx.ID-1].ReversedAmount.Equal(tx.ReversedAmount) {
+		return errors.ConcurrentUpdate
+	}
+	tx.ReversedAmount = tx.ReversedAmount.Add(amount)
+	m.transactions[tx.ID-1].ReversedAmount = tx.ReversedAmount
+	return nil
+}
@@ -3,11 +3,15 @@ package wallet
 import (
 	"context"
 	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
 	"github.com/shopspring/decimal"
 )
 
 type MockRepository struct {
 	wallets map[uint]*Wallet
+	nextID  uint
+	// Locked records the wallets locked by GetForUpdate in order
+	Locked []uint
 }
 
 func NewMockRepository() *MockRepository {
@@ -16,11 +20,35 @@ func NewMockRepository() *MockRepository {
 	}
 }
 
+func (m *MockRepository) Create(ctx context.Context, w *Wallet) error {
+	for {
+		m.nextID++
+		if _, exists := m.wallets[m.nextID]; !exists {
+			break
+		}
+	}
+	w.ID = m.nextID
+	if w.TenantID == "" {
+		w.TenantID = tenant.OrDefault(ctx)
+	}
+	m.wallets[w.ID] = w
+	return nil
+}
+
 func (m *MockRepository) Get(ctx context.Context, id uint) (*Wallet, error) {
-	if w, exists := m.wallets[id]; exists {
+	if w, exists := m.wallets[id]; exists && inTenant(ctx, w.TenantID) {
 		return w, nil
 	}
-	return nil, errors.RecordNotFound
+	return nil, errors.WalletNotFound.WithCause(errors.RecordNotFound)
+}
+
+func (m *MockRepository) GetForUpdate(ctx context.Context, id uint) (*Wallet, error) {
+	w, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	m.Locked = append(m.Locked, id)
+	return w, nil
 }
 
 func (m *MockRepository) UpdateBalance(ctx context.Context, w *Wallet, amount decimal.Decimal) error {
@@ -32,6 +60,36 @@ func (m *MockRepository) UpdateBalance(ctx context.Context, w *Wallet, amount de
 	return nil
 }
 
+func (m *MockRepository) UpdateHeld(ctx context.Context, w *Wallet, amount decimal.Decimal) error {
+	if _, exists := m.wallets[w.ID]; !exists {
+		return errors.RecordNotFound
+	}
+	w.Held = w.Held.Add(amount)
+	m.wallets[w.ID] = w
+	return nil
+}
+
+func (m *MockRepository) UpdateStatus(ctx context.Context, w *Wallet, status Status) error {
+	if _, exists := m.wallets[w.ID]; !exists {
+		return errors.RecordNotFound
+	}
+	w.Status = status
+	m.wallets[w.ID] = w
+	return nil
+}
+
 func (m *MockRepository) AddWallet(w *Wallet) {
 	m.wallets[w.ID] = w
 }
+
+// inTenant reports whether data of the tenant is visible in ctx, data without tenant belongs to the default one.
+func inTenant(ctx context.Context, id string) bool {
+	scope, ok := tenant.FromContext(ctx)
+	if !ok {
+		return true
+	}
+	if id == "" {
+		id = tenant.Default
+	}
+	return id == scope
+}
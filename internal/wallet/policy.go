@@ -0,0 +1,70 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+)
+
+// Action is what a principal does to a wallet.
+type Action string
+
+const (
+	// ActionRead reads the balance, transactions or holds of a wallet.
+	ActionRead Action = "read"
+	// ActionDebit takes money out of a wallet: withdrawals, outgoing transfers and holds.
+	ActionDebit Action = "debit"
+	// ActionCredit puts money into a wallet: deposits and incoming transfers.
+	ActionCredit Action = "credit"
+	// ActionManage freezes or closes a wallet.
+	ActionManage Action = "manage"
+	// ActionAdmin lifts a freeze or reverses a transaction.
+	ActionAdmin Action = "admin"
+)
+
+// Policy decides whether a principal may act on a wallet.
+type Policy interface {
+	// Authorize returns errors.Forbidden if the principal may not act on the wallet,
+	// the wallet is nil for actions on no particular wallet.
+	Authorize(p *auth.Principal, action Action, w *Wallet) error
+}
+
+// OwnerPolicy lets owners read, debit and manage their wallets, anyone credit a wallet
+// and admins do everything.
+type OwnerPolicy struct{}
+
+func (OwnerPolicy) Authorize(p *auth.Principal, action Action, w *Wallet) error {
+	switch {
+	case p.IsAdmin(), action == ActionCredit:
+		return nil
+	case action != ActionAdmin && w != nil && w.OwnerID != "" && w.OwnerID == p.KeyID:
+		return nil
+	}
+	if w == nil {
+		return errors.Forbidden.WithCause(fmt.Errorf("%s may not %s", p.KeyID, action))
+	}
+	return errors.Forbidden.WithCause(fmt.Errorf("%s may not %s wallet %d", p.KeyID, action, w.ID))
+}
+
+// authorize checks the principal of ctx may act on the wallets, nil wallets are skipped.
+// A context without principal comes from the service itself, such as the hold sweeper or the seed command,
+// and is allowed everything: requests always carry the principal set by the authentication middleware.
+func (u *useCase) authorize(ctx context.Context, action Action, wallets ...*Wallet) error {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if len(wallets) == 0 {
+		return u.policy.Authorize(p, action, nil)
+	}
+	for _, w := range wallets {
+		if w == nil {
+			continue
+		}
+		if err := u.policy.Authorize(p, action, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
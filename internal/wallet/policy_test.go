@@ -0,0 +1,255 @@
+package wallet
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+var (
+	alice = &auth.Principal{KeyID: "ak_alice", Role: auth.RoleClient}
+	bob   = &auth.Principal{KeyID: "ak_bob", Role: auth.RoleClient}
+	admin = &auth.Principal{KeyID: "ak_admin", Role: auth.RoleAdmin}
+)
+
+func TestOwnerPolicy(t *testing.T) {
+	owned := &Wallet{ID: 1, OwnerID: alice.KeyID}
+	unowned := &Wallet{ID: 2}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		action    Action
+		wallet    *Wallet
+		want      bool
+	}{
+		{name: "owner reads", principal: alice, action: ActionRead, wallet: owned, want: true},
+		{name: "owner debits", principal: alice, action: ActionDebit, wallet: owned, want: true},
+		{name: "owner credits", principal: alice, action: ActionCredit, wallet: owned, want: true},
+		{name: "owner manages", principal: alice, action: ActionManage, wallet: owned, want: true},
+		{name: "owner can't unfreeze", principal: alice, action: ActionAdmin, wallet: owned},
+		{name: "other can't read", principal: bob, action: ActionRead, wallet: owned},
+		{name: "other can't debit", principal: bob, action: ActionDebit, wallet: owned},
+		{name: "other credits", principal: bob, action: ActionCredit, wallet: owned, want: true},
+		{name: "other can't manage", principal: bob, action: ActionManage, wallet: owned},
+		{name: "nobody owns an unowned wallet", principal: alice, action: ActionRead, wallet: unowned},
+		{name: "client can't act on no wallet", principal: alice, action: ActionAdmin},
+		{name: "admin reads", principal: admin, action: ActionRead, wallet: owned, want: true},
+		{name: "admin debits", principal: admin, action: ActionDebit, wallet: unowned, want: true},
+		{name: "admin acts on no wallet", principal: admin, action: ActionAdmin, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := OwnerPolicy{}.Authorize(tt.principal, tt.action, tt.wallet)
+			if tt.want && err != nil {
+				t.Errorf("Authorize() error = %v", err)
+			}
+			if !tt.want && !errors.Is(err, errors.Forbidden) {
+				t.Errorf("Authorize() error = %v, want %v", err, errors.Forbidden)
+			}
+		})
+	}
+}
+
+func TestUseCase_Policy(t *testing.T) {
+	amount := decimal.NewFromInt(10)
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		call      func(ctx context.Context, uc UseCase) error
+		want      bool
+	}{
+		{
+			name:      "owner withdraws",
+			principal: alice,
+			call: func(ctx context.Context, uc UseCase) error {
+				return uc.Withdraw(ctx, 10, amount)
+			},
+			want: true,
+		},
+		{
+			name:      "other withdraws",
+			principal: bob,
+			call: func(ctx context.Context, uc UseCase) error {
+				return uc.Withdraw(ctx, 10, amount)
+			},
+		},
+		{
+			name:      "other deposits",
+			principal: bob,
+			call: func(ctx context.Context, uc UseCase) error {
+				return uc.Deposit(ctx, 10, amount)
+			},
+			want: true,
+		},
+		{
+			name:      "owner transfers to other",
+			principal: alice,
+			call: func(ctx context.Context, uc UseCase) error {
+				return uc.Transfer(ctx, 10, 11, amount)
+			},
+			want: true,
+		},
+		{
+			name:      "other transfers from owner",
+			principal: bob,
+			call: func(ctx context.Context, uc UseCase) error {
+				return uc.Transfer(ctx, 10, 11, amount)
+			},
+		},
+		{
+			name:      "other quotes from owner",
+			principal: bob,
+			call: func(ctx context.Context, uc UseCase) error {
+				_, err := uc.QuoteTransfer(ctx, 10, 5, amount)
+				return err
+			},
+		},
+		{
+			name:      "other places a hold",
+			principal: bob,
+			call: func(ctx context.Context, uc UseCase) error {
+				_, err := uc.Authorize(ctx, 10, amount, 0)
+				return err
+			},
+		},
+		{
+			name:      "other captures a hold",
+			principal: bob,
+			call: func(ctx context.Context, uc UseCase) error {
+				h, err := uc.Authorize(auth.NewContext(ctx, alice), 10, amount, 0)
+				if err != nil {
+					return err
+				}
+				_, err = uc.Capture(ctx, 10, h.ID, amount)
+				return err
+			},
+		},
+		{
+			name:      "owner reads balance",
+			principal: alice,
+			call: func(ctx context.Context, uc UseCase) error {
+				_, err := uc.Wallet(ctx, 10)
+				return err
+			},
+			want: true,
+		},
+		{
+			name:      "other reads balance",
+			principal: bob,
+			call: func(ctx context.Context, uc UseCase) error {
+				_, err := uc.Wallet(ctx, 10)
+				return err
+			},
+		},
+		{
+			name:      "other reads transactions",
+			principal: bob,
+			call: func(ctx context.Context, uc UseCase) error {
+				_, err := uc.WalletTransactions(ctx, 10, transaction.Filter{})
+				return err
+			},
+		},
+		{
+			name:      "other reads holds",
+			principal: bob,
+			call: func(ctx context.Context, uc UseCase) error {
+				_, err := uc.WalletHolds(ctx, 10)
+				return err
+			},
+		},
+		{
+			name:      "owner freezes",
+			principal: alice,
+			call: func(ctx context.Context, uc UseCase) error {
+				_, err := uc.FreezeWallet(ctx, 10)
+				return err
+			},
+			want: true,
+		},
+		{
+			name:      "owner unfreezes",
+			principal: alice,
+			call: func(ctx context.Context, uc UseCase) error {
+				if _, err := uc.FreezeWallet(ctx, 10); err != nil {
+					return err
+				}
+				_, err := uc.UnfreezeWallet(ctx, 10)
+				return err
+			},
+		},
+		{
+			name:      "admin unfreezes",
+			principal: admin,
+			call: func(ctx context.Context, uc UseCase) error {
+				if _, err := uc.FreezeWallet(ctx, 10); err != nil {
+					return err
+				}
+				_, err := uc.UnfreezeWallet(ctx, 10)
+				return err
+			},
+			want: true,
+		},
+		{
+			name:      "admin withdraws",
+			principal: admin,
+			call: func(ctx context.Context, uc UseCase) error {
+				return uc.Withdraw(ctx, 10, amount)
+			},
+			want: true,
+		},
+		{
+			name:      "owner reverses",
+			principal: alice,
+			call: func(ctx context.Context, uc UseCase) error {
+				_, err := uc.Reverse(ctx, 1, decimal.Zero, "refund")
+				return err
+			},
+		},
+		{
+			name: "service without principal withdraws",
+			call: func(ctx context.Context, uc UseCase) error {
+				return uc.Withdraw(ctx, 10, amount)
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, repo, _ := setupTest(t)
+			repo.AddWallet(&Wallet{ID: 10, Currency: "USD", Balance: decimal.NewFromInt(100), Status: StatusActive, OwnerID: alice.KeyID})
+			repo.AddWallet(&Wallet{ID: 11, Currency: "USD", Balance: decimal.NewFromInt(100), Status: StatusActive, OwnerID: bob.KeyID})
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = auth.NewContext(ctx, tt.principal)
+			}
+
+			err := tt.call(ctx, uc)
+			if tt.want && err != nil {
+				t.Errorf("error = %v", err)
+			}
+			if !tt.want && !errors.Is(err, errors.Forbidden) {
+				t.Errorf("error = %v, want %v", err, errors.Forbidden)
+			}
+		})
+	}
+}
+
+func TestUseCase_CreateWalletOwner(t *testing.T) {
+	uc, _, _ := setupTest(t)
+	w, err := uc.CreateWallet(auth.NewContext(context.Background(), alice), "USD")
+	if err != nil {
+		t.Fatalf("CreateWallet() error = %v", err)
+	}
+	if w.OwnerID != alice.KeyID {
+		t.Errorf("CreateWallet() owner = %q, want %q", w.OwnerID, alice.KeyID)
+	}
+	if _, err := uc.Wallet(auth.NewContext(context.Background(), bob), w.ID); !errors.Is(err, errors.Forbidden) {
+		t.Errorf("Wallet() by other error = %v, want %v", err, errors.Forbidden)
+	}
+}
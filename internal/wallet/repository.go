@@ -7,8 +7,16 @@ import (
 
 // Repository defines the repository for wallet.
 type Repository interface {
+	// Create creates a new wallet and sets its id.
+	Create(ctx context.Context, wallet *Wallet) error
 	// Get gets the wallet by id.
 	Get(ctx context.Context, id uint) (*Wallet, error)
+	// GetForUpdate gets the wallet by id and locks it until the transaction ends.
+	GetForUpdate(ctx context.Context, id uint) (*Wallet, error)
 	// UpdateBalance updates the balance of the wallet.
 	UpdateBalance(ctx context.Context, wallet *Wallet, amount decimal.Decimal) error
+	// UpdateHeld updates the amount of the wallet balance reserved by holds.
+	UpdateHeld(ctx context.Context, wallet *Wallet, amount decimal.Decimal) error
+	// UpdateStatus updates the status of the wallet.
+	UpdateStatus(ctx context.Context, wallet *Wallet, status Status) error
 }
@@ -0,0 +1,174 @@
+package transaction
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Order of the transaction history, by tx_at then id
+type Order string
+
+const (
+	OrderDesc Order = "desc"
+	OrderAsc  Order = "asc"
+)
+
+const (
+	// DefaultLimit is the page size used when the filter has no limit
+	DefaultLimit = 50
+	// MaxLimit is the largest page size a filter may ask for
+	MaxLimit = 200
+)
+
+// Cursor is the keyset position of the last transaction of a page.
+type Cursor struct {
+	TxAt time.Time
+	ID   uint
+}
+
+// String encodes the cursor to an opaque token.
+func (c Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", c.TxAt.UnixNano(), c.ID)))
+}
+
+// ParseCursor decodes a token returned by Cursor.String.
+func ParseCursor(token string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.InvalidArgs.WithCause(err)
+	}
+	at, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return nil, errors.InvalidArgs.WithCause(fmt.Errorf("malformed cursor %q", token))
+	}
+	nanos, err := strconv.ParseInt(at, 10, 64)
+	if err != nil {
+		return nil, errors.InvalidArgs.WithCause(err)
+	}
+	u64, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errors.InvalidArgs.WithCause(err)
+	}
+	return &Cursor{TxAt: time.Unix(0, nanos), ID: uint(u64)}, nil
+}
+
+// Filter selects and orders the transaction history of a wallet.
+// Zero fields don't filter, From is inclusive and To is exclusive.
+type Filter struct {
+	Methods []Method
+	From    time.Time
+	To      time.Time
+	// MinAmount and MaxAmount bound the amount leaving the source wallet
+	MinAmount decimal.NullDecimal
+	MaxAmount decimal.NullDecimal
+	// CounterpartyID is the other wallet of the transaction
+	CounterpartyID uint
+	Order          Order
+	Limit          int
+	// After continues the listing after the given position
+	After *Cursor
+}
+
+// Normalize validates the filter and fills in the default order and limit.
+func (f *Filter) Normalize() error {
+	switch f.Order {
+	case "":
+		f.Order = OrderDesc
+	case OrderAsc, OrderDesc:
+	default:
+		return errors.InvalidArgs.WithCause(fmt.Errorf("unknown order %q", f.Order))
+	}
+	switch {
+	case f.Limit == 0:
+		f.Limit = DefaultLimit
+	case f.Limit < 0 || f.Limit > MaxLimit:
+		return errors.InvalidArgs.WithCause(fmt.Errorf("limit must be between 1 and %d", MaxLimit))
+	}
+	for _, m := range f.Methods {
+		if !m.Valid() {
+			return errors.InvalidArgs.WithCause(fmt.Errorf("unknown method %q", m))
+		}
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return errors.InvalidArgs.WithCause(fmt.Errorf("from must be before to"))
+	}
+	if f.MinAmount.Valid && f.MaxAmount.Valid && f.MinAmount.Decimal.GreaterThan(f.MaxAmount.Decimal) {
+		return errors.InvalidArgs.WithCause(fmt.Errorf("min amount must not exceed max amount"))
+	}
+	return nil
+}
+
+// Match reports whether the transaction of the wallet passes the filter, the cursor included.
+func (f *Filter) Match(walletID uint, tx *Transaction) bool {
+	if tx.FromWalletID != walletID && tx.ToWalletID != walletID {
+		return false
+	}
+	if len(f.Methods) > 0 && !tx.Method.In(f.Methods) {
+		return false
+	}
+	if (!f.From.IsZero() && tx.TxAt.Before(f.From)) || (!f.To.IsZero() && !tx.TxAt.Before(f.To)) {
+		return false
+	}
+	if (f.MinAmount.Valid && tx.Amount.LessThan(f.MinAmount.Decimal)) ||
+		(f.MaxAmount.Valid && tx.Amount.GreaterThan(f.MaxAmount.Decimal)) {
+		return false
+	}
+	if f.CounterpartyID != 0 && tx.Counterparty(walletID) != f.CounterpartyID {
+		return false
+	}
+	if f.After != nil {
+		if f.Order == OrderAsc {
+			return f.After.less(tx)
+		}
+		return f.After.greater(tx)
+	}
+	return true
+}
+
+// Sort orders the transactions the way the filter asks for.
+func (f *Filter) Sort(list []Transaction) {
+	sort.Slice(list, func(i, j int) bool {
+		c := Cursor{TxAt: list[j].TxAt, ID: list[j].ID}
+		if f.Order == OrderAsc {
+			return c.greater(&list[i])
+		}
+		return c.less(&list[i])
+	})
+}
+
+// less reports whether the cursor is before the transaction.
+func (c *Cursor) less(tx *Transaction) bool {
+	return c.TxAt.Before(tx.TxAt) || (c.TxAt.Equal(tx.TxAt) && c.ID < tx.ID)
+}
+
+// greater reports whether the cursor is after the transaction.
+func (c *Cursor) greater(tx *Transaction) bool {
+	return c.TxAt.After(tx.TxAt) || (c.TxAt.Equal(tx.TxAt) && c.ID > tx.ID)
+}
+
+// Page is a page of the transaction history.
+type Page struct {
+	Transactions []Transaction `json:"transactions"`
+	// NextCursor continues the listing, it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewPage builds a page of limit transactions from a list fetched with one extra row,
+// the extra row tells whether there is a next page.
+func NewPage(list []Transaction, limit int) *Page {
+	if list == nil {
+		list = make([]Transaction, 0)
+	}
+	if len(list) <= limit {
+		return &Page{Transactions: list}
+	}
+	list = list[:limit]
+	last := list[limit-1]
+	return &Page{Transactions: list, NextCursor: Cursor{TxAt: last.TxAt, ID: last.ID}.String()}
+}
@@ -0,0 +1,81 @@
+package transaction
+
+import (
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	c := Cursor{TxAt: time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC), ID: 42}
+	got, err := ParseCursor(c.String())
+	if err != nil {
+		t.Fatalf("ParseCursor() error = %v", err)
+	}
+	if !got.TxAt.Equal(c.TxAt) || got.ID != c.ID {
+		t.Errorf("ParseCursor() = %v, want %v", got, c)
+	}
+
+	for _, token := range []string{"!!!", "MTIz", "YS4x", "MS5i"} {
+		if _, err := ParseCursor(token); !errors.Is(err, errors.InvalidArgs) {
+			t.Errorf("ParseCursor(%q) error = %v, want %v", token, err, errors.InvalidArgs)
+		}
+	}
+}
+
+func TestFilter_Normalize(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		filter  Filter
+		wantErr bool
+	}{
+		{name: "defaults", filter: Filter{}},
+		{name: "max limit", filter: Filter{Limit: MaxLimit}},
+		{name: "negative limit", filter: Filter{Limit: -1}, wantErr: true},
+		{name: "limit too large", filter: Filter{Limit: MaxLimit + 1}, wantErr: true},
+		{name: "unknown order", filter: Filter{Order: "random"}, wantErr: true},
+		{name: "unknown method", filter: Filter{Methods: []Method{"refund"}}, wantErr: true},
+		{name: "empty date range", filter: Filter{From: now, To: now}, wantErr: true},
+		{
+			name: "inverted amount range",
+			filter: Filter{
+				MinAmount: decimal.NewNullDecimal(decimal.NewFromInt(10)),
+				MaxAmount: decimal.NewNullDecimal(decimal.NewFromInt(5)),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.filter.Normalize()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Normalize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (tt.filter.Order == "" || tt.filter.Limit == 0) {
+				t.Errorf("Normalize() = %+v, want default order and limit", tt.filter)
+			}
+		})
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	at := time.Now()
+	list := []Transaction{{ID: 3, TxAt: at}, {ID: 2, TxAt: at}, {ID: 1, TxAt: at}}
+
+	page := NewPage(list, 3)
+	if len(page.Transactions) != 3 || page.NextCursor != "" {
+		t.Errorf("NewPage() = %+v, want last page", page)
+	}
+
+	page = NewPage(list, 2)
+	if len(page.Transactions) != 2 || page.NextCursor != (Cursor{TxAt: at, ID: 2}).String() {
+		t.Errorf("NewPage() = %+v, want next cursor after 2", page)
+	}
+
+	if page = NewPage(nil, 2); page.Transactions == nil {
+		t.Error("NewPage() transactions = nil, want empty")
+	}
+}
@@ -1,9 +1,20 @@
 package transaction
 
-import "context"
+import (
+	"context"
+	"github.com/shopspring/decimal"
+)
 
 // Repository defines the repository for transaction.
 type Repository interface {
-	ListByWalletID(ctx context.Context, walletID uint) ([]Transaction, error)
+	// ListByWalletID lists the transactions of the wallet matching the filter in its order,
+	// at most filter.Limit of them unless it is zero.
+	ListByWalletID(ctx context.Context, walletID uint, filter Filter) ([]Transaction, error)
+	// Get gets the transaction by id.
+	Get(ctx context.Context, id uint) (*Transaction, error)
+	// Create creates a new transaction and sets its id.
 	Create(ctx context.Context, transaction *Transaction) error
+	// UpdateReversed adds amount to the reversed amount of the transaction.
+	// Fails with ConcurrentUpdate if the reversed amount changed since the transaction was read.
+	UpdateReversed(ctx context.Context, transaction *Transaction, amount decimal.Decimal) error
 }
@@ -1,6 +1,9 @@
 package transaction
 
 import (
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
 	"github.com/shopspring/decimal"
 	"time"
 )
@@ -12,13 +15,113 @@ const (
 	MethodDeposit  Method = "deposit"
 	MethodWithdraw Method = "withdraw"
 	MethodTransfer Method = "transfer"
+	MethodCapture  Method = "capture"
+	MethodReversal Method = "reversal"
 )
 
+// Valid reports whether the method is known
+func (m Method) Valid() bool {
+	switch m {
+	case MethodDeposit, MethodWithdraw, MethodTransfer, MethodCapture, MethodReversal:
+		return true
+	}
+	return false
+}
+
+// In reports whether the method is one of methods
+func (m Method) In(methods []Method) bool {
+	for _, method := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Transaction records a money movement. Amount in Currency leaves the source,
+// ToAmount in ToCurrency reaches the destination at the applied Rate,
+// both legs are equal unless the currency is converted.
+// A reversal moves money back for the transaction it is a ReversalOf,
+// ReversedAmount is how much of Amount has been moved back so far.
+// Fee is charged to the source on top of Amount, a reversal doesn't refund it.
 type Transaction struct {
-	ID           uint            `json:"id"`
-	Method       Method          `json:"method"`
-	TxAt         time.Time       `json:"tx_at"`
-	Amount       decimal.Decimal `json:"amount"`
-	FromWalletID uint            `json:"from_wallet_id"`
-	ToWalletID   uint            `json:"to_wallet_id"`
+	ID             uint            `json:"id"`
+	Method         Method          `json:"method"`
+	TxAt           time.Time       `json:"tx_at"`
+	Amount         decimal.Decimal `json:"amount"`
+	Currency       string          `json:"currency"`
+	ToAmount       decimal.Decimal `json:"to_amount"`
+	ToCurrency     string          `json:"to_currency"`
+	Rate           decimal.Decimal `json:"rate"`
+	Fee            decimal.Decimal `json:"fee"`
+	FromWalletID   uint            `json:"from_wallet_id"`
+	ToWalletID     uint            `json:"to_wallet_id"`
+	ReversalOf     uint            `json:"reversal_of,omitempty"`
+	ReversedAmount decimal.Decimal `json:"reversed_amount"`
+	Reason         string          `json:"reason,omitempty"`
+	// TenantID is the tenant of the wallets, the repository sets it from them
+	TenantID string `json:"-"`
+}
+
+// New creates a transaction without currency conversion
+func New(method Method, amount decimal.Decimal, currency string, fromWalletID, toWalletID uint) *Transaction {
+	return &Transaction{
+		Method:         method,
+		TxAt:           time.Now(),
+		Amount:         amount,
+		Currency:       currency,
+		ToAmount:       amount,
+		ToCurrency:     currency,
+		Rate:           decimal.NewFromInt(1),
+		Fee:            decimal.Zero,
+		FromWalletID:   fromWalletID,
+		ToWalletID:     toWalletID,
+		ReversedAmount: decimal.Zero,
+	}
+}
+
+// IsConversion reports whether the currency is converted between the legs
+func (t *Transaction) IsConversion() bool {
+	return t.Currency != t.ToCurrency
+}
+
+// Counterparty returns the other wallet of the transaction for walletID, zero for deposits and withdrawals
+func (t *Transaction) Counterparty(walletID uint) uint {
+	if t.FromWalletID == walletID {
+		return t.ToWalletID
+	}
+	return t.FromWalletID
+}
+
+// CheckReversal checks if amount of the transaction can be reversed and returns the amount to reverse,
+// the whole unreversed amount if amount is zero. Converted transfers can only be reversed in full.
+func (t *Transaction) CheckReversal(amount decimal.Decimal) (decimal.Decimal, error) {
+	if t.Method == MethodReversal {
+		return decimal.Zero, errors.NotReversible.WithCause(fmt.Errorf("transaction %d is a reversal", t.ID))
+	}
+	remaining := t.Amount.Sub(t.ReversedAmount)
+	if !remaining.IsPositive() {
+		return decimal.Zero, errors.TransactionReversed
+	}
+	if amount.IsZero() {
+		amount = remaining
+	}
+	if amount.GreaterThan(remaining) {
+		return decimal.Zero, errors.ReversalExceedsAmount.WithCause(fmt.Errorf("%v left to reverse", remaining))
+	}
+	if t.IsConversion() && !amount.Equal(t.Amount) {
+		return decimal.Zero, errors.NotReversible.WithCause(fmt.Errorf("converted transfer %d can only be reversed in full", t.ID))
+	}
+	return amount, nil
+}
+
+// Reversal creates the transaction moving amount of the transaction back, the amount must be checked by CheckReversal
+func (t *Transaction) Reversal(amount decimal.Decimal, reason string) *Transaction {
+	r := New(MethodReversal, amount, t.ToCurrency, t.ToWalletID, t.FromWalletID)
+	if t.IsConversion() {
+		r.Amount, r.ToAmount, r.ToCurrency = t.ToAmount, t.Amount, t.Currency
+		r.Rate = t.Amount.DivRound(t.ToAmount, fx.RatePrecision)
+	}
+	r.ReversalOf, r.Reason = t.ID, reason
+	return r
 }
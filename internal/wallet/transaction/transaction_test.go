@@ -0,0 +1,103 @@
+package transaction
+
+import (
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+func TestTransaction_CheckReversal(t *testing.T) {
+	deposit := New(MethodDeposit, decimal.NewFromFloat(100), "USD", 0, 1)
+	conversion := New(MethodTransfer, decimal.NewFromFloat(100), "USD", 1, 2)
+	conversion.ToAmount, conversion.ToCurrency, conversion.Rate = decimal.NewFromFloat(90), "EUR", decimal.NewFromFloat(0.9)
+	tests := []struct {
+		name    string
+		tx      *Transaction
+		reverse decimal.Decimal
+		amount  decimal.Decimal
+		want    decimal.Decimal
+		wantErr error
+	}{
+		{
+			name: "full reversal",
+			tx:   deposit,
+			want: decimal.NewFromFloat(100),
+		},
+		{
+			name:   "partial reversal",
+			tx:     deposit,
+			amount: decimal.NewFromFloat(40),
+			want:   decimal.NewFromFloat(40),
+		},
+		{
+			name:    "rest of partially reversed",
+			tx:      deposit,
+			reverse: decimal.NewFromFloat(40),
+			want:    decimal.NewFromFloat(60),
+		},
+		{
+			name:    "exceeds unreversed amount",
+			tx:      deposit,
+			reverse: decimal.NewFromFloat(40),
+			amount:  decimal.NewFromFloat(61),
+			wantErr: errors.ReversalExceedsAmount,
+		},
+		{
+			name:    "already reversed",
+			tx:      deposit,
+			reverse: decimal.NewFromFloat(100),
+			wantErr: errors.TransactionReversed,
+		},
+		{
+			name: "full conversion reversal",
+			tx:   conversion,
+			want: decimal.NewFromFloat(100),
+		},
+		{
+			name:    "partial conversion reversal",
+			tx:      conversion,
+			amount:  decimal.NewFromFloat(50),
+			wantErr: errors.NotReversible,
+		},
+		{
+			name:    "reversal of reversal",
+			tx:      deposit.Reversal(decimal.NewFromFloat(10), "mistake"),
+			wantErr: errors.NotReversible,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := *tt.tx
+			tx.ReversedAmount = tt.reverse
+			got, err := tx.CheckReversal(tt.amount)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("CheckReversal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("CheckReversal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransaction_Reversal(t *testing.T) {
+	transfer := New(MethodTransfer, decimal.NewFromFloat(100), "USD", 1, 2)
+	transfer.ID = 7
+	r := transfer.Reversal(decimal.NewFromFloat(40), "refund")
+	if r.Method != MethodReversal || r.ReversalOf != 7 || r.Reason != "refund" {
+		t.Errorf("Reversal() = %+v, want a reversal of 7", r)
+	}
+	if r.FromWalletID != 2 || r.ToWalletID != 1 || !r.Amount.Equal(decimal.NewFromFloat(40)) || !r.ToAmount.Equal(r.Amount) {
+		t.Errorf("Reversal() moves %v from %d to %d, want 40 from 2 to 1", r.Amount, r.FromWalletID, r.ToWalletID)
+	}
+
+	conversion := New(MethodTransfer, decimal.NewFromFloat(100), "USD", 1, 2)
+	conversion.ToAmount, conversion.ToCurrency, conversion.Rate = decimal.NewFromFloat(80), "EUR", decimal.NewFromFloat(0.8)
+	r = conversion.Reversal(decimal.NewFromFloat(100), "refund")
+	if r.Currency != "EUR" || !r.Amount.Equal(decimal.NewFromFloat(80)) || r.ToCurrency != "USD" || !r.ToAmount.Equal(decimal.NewFromFloat(100)) {
+		t.Errorf("Reversal() = %v %s to %v %s, want 80 EUR to 100 USD", r.Amount, r.Currency, r.ToAmount, r.ToCurrency)
+	}
+	if !r.Rate.Equal(decimal.NewFromFloat(1.25)) {
+		t.Errorf("Reversal() rate = %v, want 1.25", r.Rate)
+	}
+}
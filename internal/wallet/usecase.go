@@ -3,14 +3,35 @@ package wallet
 import (
 	"context"
 	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+	"github.com/guoxiaopeng875/wallet/internal/ledger"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/currency"
 	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/trace"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/hold"
 	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
+	"slices"
 	"time"
 
 	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultHoldTTL is how long a hold lasts when no TTL is requested
+	DefaultHoldTTL = 7 * 24 * time.Hour
+	// MaxHoldTTL is the longest a hold can last
+	MaxHoldTTL = 30 * 24 * time.Hour
+
+	// expireHoldsBatch is the maximum number of holds released by one ExpireHolds call
+	expireHoldsBatch = 100
 )
 
 // UseCase defines use cases for the wallet.
+// The principal of ctx must be allowed by the Policy to act on the wallets, or errors.Forbidden is returned.
 type UseCase interface {
 	// Deposit adds the specified amount to the wallet balance.
 	// Returns an error if the amount is not positive or if the wallet doesn't exist.
@@ -25,17 +46,79 @@ type UseCase interface {
 	// Returns an error if:
 	// - The amount is not positive
 	// - Either wallet doesn't exist
+	// - The wallets hold different currencies
 	// - The source wallet has insufficient funds
 	// - There's a concurrent modification conflict
 	Transfer(ctx context.Context, fromWalletID, toWalletID uint, amount decimal.Decimal) error
 
+	// QuoteTransfer quotes the conversion of amount from the currency of one wallet to the currency of another.
+	// The returned quote locks the rate for a short time and can be executed once by ConvertTransfer.
+	// Returns an error if either wallet doesn't exist or isn't active, if the wallets hold the same currency,
+	// or if no exchange rate is available.
+	QuoteTransfer(ctx context.Context, fromWalletID, toWalletID uint, amount decimal.Decimal) (*fx.Quote, error)
+
+	// ConvertTransfer executes a cross-currency transfer at the rate locked by the quote.
+	// Returns an error if the quote doesn't match the wallets and amount, is expired or already used,
+	// or for the same reasons as Transfer.
+	ConvertTransfer(ctx context.Context, fromWalletID, toWalletID uint, amount decimal.Decimal, quoteID string) error
+
+	// Authorize places a hold of amount on the wallet, reserving it until the hold is captured, voided or expires
+	// after ttl. DefaultHoldTTL is used if ttl is zero. The held amount is no longer available to withdraw or transfer.
+	// Returns an error if the amount is not positive, if ttl is negative or longer than MaxHoldTTL,
+	// if the wallet doesn't exist or isn't active, or if the wallet has insufficient available funds.
+	Authorize(ctx context.Context, walletID uint, amount decimal.Decimal, ttl time.Duration) (*hold.Hold, error)
+
+	// Capture withdraws amount of the hold from the wallet and releases the rest of it.
+	// The full hold is captured if amount is zero.
+	// Returns an error if the hold doesn't exist on the wallet, isn't authorized or is expired,
+	// if the wallet isn't active, or if amount is negative or exceeds the hold.
+	Capture(ctx context.Context, walletID, holdID uint, amount decimal.Decimal) (*hold.Hold, error)
+
+	// Void releases the hold without moving money.
+	// Returns an error if the hold doesn't exist on the wallet or isn't authorized.
+	Void(ctx context.Context, walletID, holdID uint) (*hold.Hold, error)
+
+	// WalletHolds retrieves all holds placed on the specified wallet, newest first.
+	// Returns a list of holds or an error if the wallet doesn't exist.
+	WalletHolds(ctx context.Context, walletID uint) ([]hold.Hold, error)
+
+	// ExpireHolds releases a batch of authorized holds that expired at the given time.
+	// Returns the number of released holds.
+	ExpireHolds(ctx context.Context, at time.Time) (int, error)
+
+	// Reverse moves amount of a completed transaction back with a compensating transaction linked to it, only admins may.
+	// The whole unreversed amount is moved back if amount is zero, a transaction can be partially reversed
+	// several times until its amount is used up. Converted transfers can only be reversed in full.
+	// Returns the compensating transaction or an error if the transaction doesn't exist, is a reversal,
+	// is already reversed, if amount exceeds the unreversed amount, if reason is empty,
+	// or if the wallet to debit isn't active or has insufficient available funds.
+	Reverse(ctx context.Context, transactionID uint, amount decimal.Decimal, reason string) (*transaction.Transaction, error)
+
 	// Wallet retrieves wallet information by its ID.
 	// Returns the wallet details or an error if the wallet doesn't exist.
 	Wallet(ctx context.Context, walletID uint) (*Wallet, error)
 
-	// WalletTransactions retrieves all transactions associated with the specified wallet.
-	// Returns a list of transactions or an error if the wallet doesn't exist.
-	WalletTransactions(ctx context.Context, walletID uint) ([]transaction.Transaction, error)
+	// WalletTransactions retrieves a page of the transactions associated with the specified wallet,
+	// matching the filter and continuing after its cursor.
+	// Returns an error if the wallet doesn't exist or the filter is invalid.
+	WalletTransactions(ctx context.Context, walletID uint, filter transaction.Filter) (*transaction.Page, error)
+
+	// CreateWallet creates a new active wallet with zero balance in the given ISO-4217 currency,
+	// owned by the principal of ctx.
+	// Returns an error if the currency is not supported.
+	CreateWallet(ctx context.Context, currencyCode string) (*Wallet, error)
+
+	// FreezeWallet freezes an active wallet, money can't be moved in or out until it is unfrozen.
+	// Returns an error if the wallet doesn't exist or is not active.
+	FreezeWallet(ctx context.Context, walletID uint) (*Wallet, error)
+
+	// UnfreezeWallet reactivates a frozen wallet, only admins may.
+	// Returns an error if the wallet doesn't exist or is not frozen.
+	UnfreezeWallet(ctx context.Context, walletID uint) (*Wallet, error)
+
+	// CloseWallet closes a wallet permanently.
+	// Returns an error if the wallet doesn't exist, is already closed or its balance is not zero.
+	CloseWallet(ctx context.Context, walletID uint) (*Wallet, error)
 }
 
 // DBTx is database transaction.
@@ -43,35 +126,122 @@ type DBTx interface {
 	ExecTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
+type txAtKey struct{}
+
+// ContextWithTxAt returns a copy of ctx in which the transactions are recorded as happened at the given time
+// rather than now, to load historical transactions.
+func ContextWithTxAt(ctx context.Context, at time.Time) context.Context {
+	return context.WithValue(ctx, txAtKey{}, at)
+}
+
+// LockMode is how concurrent updates of a wallet are kept apart.
+type LockMode string
+
+const (
+	// LockOptimistic updates a wallet only if it hasn't changed since it was read,
+	// a conflict fails with errors.ConcurrentUpdate.
+	LockOptimistic LockMode = "optimistic"
+	// LockPessimistic locks the wallets with SELECT ... FOR UPDATE inside the transaction,
+	// in ID order so movements between the same wallets can't deadlock.
+	LockPessimistic LockMode = "pessimistic"
+)
+
+// ParseLockMode parses a configured lock mode, empty is LockOptimistic.
+func ParseLockMode(mode string) (LockMode, error) {
+	switch LockMode(mode) {
+	case "", LockOptimistic:
+		return LockOptimistic, nil
+	case LockPessimistic:
+		return LockPessimistic, nil
+	}
+	return "", fmt.Errorf("unknown lock mode %q", mode)
+}
+
+// Option configures the use case.
+type Option func(*useCase)
+
+// WithLockMode sets how concurrent updates of a wallet are kept apart, LockOptimistic by default.
+func WithLockMode(mode LockMode) Option {
+	return func(u *useCase) {
+		u.lockMode = mode
+	}
+}
+
+// WithPolicy sets who may act on which wallet, OwnerPolicy by default.
+func WithPolicy(policy Policy) Option {
+	return func(u *useCase) {
+		u.policy = policy
+	}
+}
+
+// WithWithdrawalFee charges the rate of every withdrawal to the wallet on top of the amount,
+// rounded to the minor units of its currency and posted to the fees system account. No fee by default.
+func WithWithdrawalFee(rate decimal.Decimal) Option {
+	return func(u *useCase) {
+		u.feeRate = rate
+	}
+}
+
 // useCase implements UseCase.
 type useCase struct {
-	repo   Repository
-	txRepo transaction.Repository
-	dbTx   DBTx
+	repo       Repository
+	txRepo     transaction.Repository
+	holdRepo   hold.Repository
+	ledgerRepo ledger.Repository
+	outboxRepo outbox.Repository
+	dbTx       DBTx
+	fx         fx.UseCase
+	lockMode   LockMode
+	policy     Policy
+	feeRate    decimal.Decimal
+	metrics    *useCaseMetrics
+	tracer     *trace.Tracer
 }
 
-func NewUseCase(repo Repository, txRepo transaction.Repository, dbTx DBTx) UseCase {
-	return &useCase{repo: repo, txRepo: txRepo, dbTx: dbTx}
+func NewUseCase(repo Repository, txRepo transaction.Repository, holdRepo hold.Repository, ledgerRepo ledger.Repository, outboxRepo outbox.Repository, dbTx DBTx, fxUC fx.UseCase, opts ...Option) UseCase {
+	u := &useCase{
+		repo: repo, txRepo: txRepo, holdRepo: holdRepo, ledgerRepo: ledgerRepo, outboxRepo: outboxRepo,
+		dbTx: dbTx, fx: fxUC, lockMode: LockOptimistic, policy: OwnerPolicy{},
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	if u.metrics != nil {
+		u.dbTx = &countingTx{DBTx: u.dbTx, metrics: u.metrics}
+	}
+	if u.metrics != nil || u.tracer != nil {
+		return &instrumentedUseCase{uc: u, metrics: u.metrics, tracer: u.tracer}
+	}
+	return u
 }
 
 func (u *useCase) Deposit(ctx context.Context, walletID uint, amount decimal.Decimal) error {
 	if !amount.IsPositive() {
 		return errors.InvalidArgs.WithCause(fmt.Errorf("deposit amount must be positive: %v", amount))
 	}
-	wallet, err := u.repo.Get(ctx, walletID)
-	if err != nil {
-		return err
-	}
 	return u.dbTx.ExecTx(ctx, func(ctx context.Context) error {
+		wallets, err := u.getWallets(ctx, walletID)
+		if err != nil {
+			return err
+		}
+		wallet := wallets[0]
+		if err := u.authorize(ctx, ActionCredit, wallet); err != nil {
+			return err
+		}
+		if err := wallet.CheckActive(); err != nil {
+			return err
+		}
+		if err := wallet.CheckAmount(amount); err != nil {
+			return err
+		}
 		if err := u.repo.UpdateBalance(ctx, wallet, amount); err != nil {
 			return err
 		}
-		return u.txRepo.Create(ctx, &transaction.Transaction{
-			Method:     transaction.MethodDeposit,
-			TxAt:       time.Now(),
-			Amount:     amount,
-			ToWalletID: wallet.ID,
-		})
+		return u.record(
+			ctx,
+			transaction.New(transaction.MethodDeposit, amount, wallet.Currency, 0, wallet.ID),
+			ledger.Move(ledger.SystemAccount(ledger.SystemDeposits, wallet.Currency), ledger.WalletAccount(wallet.ID), wallet.Currency, amount)...,
+		)
 	})
 }
 
@@ -79,23 +249,38 @@ func (u *useCase) Withdraw(ctx context.Context, walletID uint, amount decimal.De
 	if !amount.IsPositive() {
 		return errors.InvalidArgs.WithCause(fmt.Errorf("withdraw amount must be positive: %v", amount))
 	}
-	wallet, err := u.repo.Get(ctx, walletID)
-	if err != nil {
-		return err
-	}
-	if err := wallet.CheckBalance(amount); err != nil {
-		return err
-	}
 	return u.dbTx.ExecTx(ctx, func(ctx context.Context) error {
-		if err := u.repo.UpdateBalance(ctx, wallet, amount.Neg()); err != nil {
+		wallets, err := u.getWallets(ctx, walletID)
+		if err != nil {
 			return err
 		}
-		return u.txRepo.Create(ctx, &transaction.Transaction{
-			Method:       transaction.MethodWithdraw,
-			TxAt:         time.Now(),
-			Amount:       amount,
-			FromWalletID: wallet.ID,
-		})
+		wallet := wallets[0]
+		if err := u.authorize(ctx, ActionDebit, wallet); err != nil {
+			return err
+		}
+		if err := wallet.CheckActive(); err != nil {
+			return err
+		}
+		if err := wallet.CheckAmount(amount); err != nil {
+			return err
+		}
+		fee, err := u.fee(wallet, amount)
+		if err != nil {
+			return err
+		}
+		if err := wallet.CheckBalance(amount.Add(fee)); err != nil {
+			return err
+		}
+		if err := u.repo.UpdateBalance(ctx, wallet, amount.Add(fee).Neg()); err != nil {
+			return err
+		}
+		tx := transaction.New(transaction.MethodWithdraw, amount, wallet.Currency, wallet.ID, 0)
+		tx.Fee = fee
+		postings := ledger.Move(ledger.WalletAccount(wallet.ID), ledger.SystemAccount(ledger.SystemWithdrawals, wallet.Currency), wallet.Currency, amount)
+		if fee.IsPositive() {
+			postings = append(postings, ledger.Move(ledger.WalletAccount(wallet.ID), ledger.SystemAccount(ledger.SystemFees, wallet.Currency), wallet.Currency, fee)...)
+		}
+		return u.record(ctx, tx, postings...)
 	})
 }
 
@@ -103,46 +288,560 @@ func (u *useCase) Transfer(ctx context.Context, fromWalletID, toWalletID uint, a
 	if !amount.IsPositive() {
 		return errors.InvalidArgs.WithCause(fmt.Errorf("tranfer amount must be positive: %v", amount))
 	}
+	return u.dbTx.ExecTx(ctx, func(ctx context.Context) error {
+		wallets, err := u.getWallets(ctx, fromWalletID, toWalletID)
+		if err != nil {
+			return err
+		}
+		fromWallet, toWallet := wallets[0], wallets[1]
+		if err := u.authorizeTransfer(ctx, fromWallet, toWallet); err != nil {
+			return err
+		}
+		if err := fromWallet.CheckActive(); err != nil {
+			return err
+		}
+		if err := fromWallet.CheckAmount(amount); err != nil {
+			return err
+		}
+		if err := toWallet.CheckActive(); err != nil {
+			return err
+		}
+		if toWallet.Currency != fromWallet.Currency {
+			return errors.CurrencyMismatch.WithCause(fmt.Errorf("can't transfer %s to %s wallet without a quote", fromWallet.Currency, toWallet.Currency))
+		}
+		if err := fromWallet.CheckBalance(amount); err != nil {
+			return err
+		}
+		if err := u.repo.UpdateBalance(ctx, fromWallet, amount.Neg()); err != nil {
+			return err
+		}
+		if err := u.repo.UpdateBalance(ctx, toWallet, amount); err != nil {
+			return err
+		}
+		return u.record(
+			ctx,
+			transaction.New(transaction.MethodTransfer, amount, fromWallet.Currency, fromWallet.ID, toWallet.ID),
+			ledger.Move(ledger.WalletAccount(fromWallet.ID), ledger.WalletAccount(toWallet.ID), fromWallet.Currency, amount)...,
+		)
+	})
+}
+
+func (u *useCase) QuoteTransfer(ctx context.Context, fromWalletID, toWalletID uint, amount decimal.Decimal) (*fx.Quote, error) {
+	if !amount.IsPositive() {
+		return nil, errors.InvalidArgs.WithCause(fmt.Errorf("tranfer amount must be positive: %v", amount))
+	}
 	fromWallet, err := u.repo.Get(ctx, fromWalletID)
 	if err != nil {
+		return nil, err
+	}
+	toWallet, err := u.repo.Get(ctx, toWalletID)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.authorizeTransfer(ctx, fromWallet, toWallet); err != nil {
+		return nil, err
+	}
+	if err := checkConversion(fromWallet, toWallet, amount); err != nil {
+		return nil, err
+	}
+	quote := &fx.Quote{
+		FromWalletID: fromWallet.ID,
+		ToWalletID:   toWallet.ID,
+		FromCurrency: fromWallet.Currency,
+		ToCurrency:   toWallet.Currency,
+		Amount:       amount,
+	}
+	if err := u.fx.Quote(ctx, quote); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+func (u *useCase) ConvertTransfer(ctx context.Context, fromWalletID, toWalletID uint, amount decimal.Decimal, quoteID string) error {
+	if !amount.IsPositive() {
+		return errors.InvalidArgs.WithCause(fmt.Errorf("tranfer amount must be positive: %v", amount))
+	}
+	return u.dbTx.ExecTx(ctx, func(ctx context.Context) error {
+		wallets, err := u.getWallets(ctx, fromWalletID, toWalletID)
+		if err != nil {
+			return err
+		}
+		fromWallet, toWallet := wallets[0], wallets[1]
+		if err := u.authorizeTransfer(ctx, fromWallet, toWallet); err != nil {
+			return err
+		}
+		if err := checkConversion(fromWallet, toWallet, amount); err != nil {
+			return err
+		}
+		if err := fromWallet.CheckBalance(amount); err != nil {
+			return err
+		}
+		quote, err := u.fx.Redeem(ctx, quoteID)
+		if err != nil {
+			return err
+		}
+		if quote.FromWalletID != fromWallet.ID || quote.ToWalletID != toWallet.ID || !quote.Amount.Equal(amount) ||
+			quote.FromCurrency != fromWallet.Currency || quote.ToCurrency != toWallet.Currency {
+			return errors.QuoteMismatch
+		}
+		if err := u.repo.UpdateBalance(ctx, fromWallet, quote.Amount.Neg()); err != nil {
+			return err
+		}
+		if err := u.repo.UpdateBalance(ctx, toWallet, quote.ToAmount); err != nil {
+			return err
+		}
+		tx := transaction.New(transaction.MethodTransfer, quote.Amount, quote.FromCurrency, fromWallet.ID, toWallet.ID)
+		tx.ToAmount, tx.ToCurrency, tx.Rate = quote.ToAmount, quote.ToCurrency, quote.Rate
+		return u.record(
+			ctx,
+			tx,
+			ledger.Convert(ledger.WalletAccount(fromWallet.ID), ledger.WalletAccount(toWallet.ID), quote.FromCurrency, quote.Amount, quote.ToCurrency, quote.ToAmount)...,
+		)
+	})
+}
+
+// authorizeTransfer checks the wallets belong to the same tenant
+// and the principal of ctx may debit the source wallet and credit the destination
+func (u *useCase) authorizeTransfer(ctx context.Context, fromWallet, toWallet *Wallet) error {
+	if err := fromWallet.CheckTenant(toWallet); err != nil {
 		return err
 	}
-	if err := fromWallet.CheckBalance(amount); err != nil {
+	if err := u.authorize(ctx, ActionDebit, fromWallet); err != nil {
 		return err
 	}
-	toWallet, err := u.repo.Get(ctx, toWalletID)
-	if err != nil {
+	return u.authorize(ctx, ActionCredit, toWallet)
+}
+
+// checkConversion checks the source and destination wallets of a cross-currency transfer are active and hold different currencies
+func checkConversion(fromWallet, toWallet *Wallet, amount decimal.Decimal) error {
+	if err := fromWallet.CheckActive(); err != nil {
 		return err
 	}
-	if err := toWallet.CheckBalance(amount); err != nil {
+	if err := fromWallet.CheckAmount(amount); err != nil {
 		return err
 	}
+	if err := toWallet.CheckActive(); err != nil {
+		return err
+	}
+	if toWallet.Currency == fromWallet.Currency {
+		return errors.InvalidArgs.WithCause(fmt.Errorf("both wallets hold %s, no conversion needed", fromWallet.Currency))
+	}
+	return nil
+}
 
-	return u.dbTx.ExecTx(ctx, func(ctx context.Context) error {
-		if err := u.repo.UpdateBalance(ctx, fromWallet, amount.Neg()); err != nil {
+func (u *useCase) Authorize(ctx context.Context, walletID uint, amount decimal.Decimal, ttl time.Duration) (*hold.Hold, error) {
+	if !amount.IsPositive() {
+		return nil, errors.InvalidArgs.WithCause(fmt.Errorf("hold amount must be positive: %v", amount))
+	}
+	if ttl == 0 {
+		ttl = DefaultHoldTTL
+	}
+	if ttl < 0 || ttl > MaxHoldTTL {
+		return nil, errors.InvalidArgs.WithCause(fmt.Errorf("hold ttl must be between 0 and %v: %v", MaxHoldTTL, ttl))
+	}
+
+	var h *hold.Hold
+	err := u.dbTx.ExecTx(ctx, func(ctx context.Context) error {
+		wallets, err := u.getWallets(ctx, walletID)
+		if err != nil {
 			return err
 		}
-		if err := u.repo.UpdateBalance(ctx, toWallet, amount); err != nil {
+		wallet := wallets[0]
+		if err := u.authorize(ctx, ActionDebit, wallet); err != nil {
+			return err
+		}
+		if err := wallet.CheckActive(); err != nil {
+			return err
+		}
+		if err := wallet.CheckAmount(amount); err != nil {
+			return err
+		}
+		if err := wallet.CheckBalance(amount); err != nil {
+			return err
+		}
+		if err := u.repo.UpdateHeld(ctx, wallet, amount); err != nil {
+			return err
+		}
+		h = hold.New(wallet.ID, amount, wallet.Currency, ttl)
+		return u.holdRepo.Create(ctx, h)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (u *useCase) Capture(ctx context.Context, walletID, holdID uint, amount decimal.Decimal) (*hold.Hold, error) {
+	if amount.IsNegative() {
+		return nil, errors.InvalidArgs.WithCause(fmt.Errorf("capture amount must not be negative: %v", amount))
+	}
+
+	var h *hold.Hold
+	err := u.dbTx.ExecTx(ctx, func(ctx context.Context) error {
+		wallet, held, err := u.walletHold(ctx, walletID, holdID)
+		if err != nil {
+			return err
+		}
+		h = held
+		captured := amount
+		if captured.IsZero() {
+			captured = h.Amount
+		}
+		if err := wallet.CheckActive(); err != nil {
+			return err
+		}
+		if err := wallet.CheckAmount(captured); err != nil {
+			return err
+		}
+		if err := h.CheckCapture(captured, time.Now()); err != nil {
+			return err
+		}
+		if err := u.repo.UpdateHeld(ctx, wallet, h.Amount.Neg()); err != nil {
+			return err
+		}
+		if err := u.repo.UpdateBalance(ctx, wallet, captured.Neg()); err != nil {
+			return err
+		}
+		err = u.record(
+			ctx,
+			transaction.New(transaction.MethodCapture, captured, wallet.Currency, wallet.ID, 0),
+			ledger.Move(ledger.WalletAccount(wallet.ID), ledger.SystemAccount(ledger.SystemWithdrawals, wallet.Currency), wallet.Currency, captured)...,
+		)
+		if err != nil {
+			return err
+		}
+		return u.holdRepo.UpdateStatus(ctx, h, hold.StatusCaptured, captured)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (u *useCase) Void(ctx context.Context, walletID, holdID uint) (*hold.Hold, error) {
+	var h *hold.Hold
+	err := u.dbTx.ExecTx(ctx, func(ctx context.Context) error {
+		wallet, held, err := u.walletHold(ctx, walletID, holdID)
+		if err != nil {
+			return err
+		}
+		h = held
+		if err := h.CheckVoid(); err != nil {
 			return err
 		}
-		return u.txRepo.Create(ctx, &transaction.Transaction{
-			Method:       transaction.MethodTransfer,
-			TxAt:         time.Now(),
-			Amount:       amount,
-			FromWalletID: fromWallet.ID,
-			ToWalletID:   toWallet.ID,
+		return u.release(ctx, wallet, h, hold.StatusVoided)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (u *useCase) WalletHolds(ctx context.Context, walletID uint) ([]hold.Hold, error) {
+	wallet, err := u.repo.Get(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.authorize(ctx, ActionRead, wallet); err != nil {
+		return nil, err
+	}
+	return u.holdRepo.ListByWalletID(ctx, wallet.ID)
+}
+
+func (u *useCase) ExpireHolds(ctx context.Context, at time.Time) (int, error) {
+	holds, err := u.holdRepo.ListExpired(ctx, at, expireHoldsBatch)
+	if err != nil {
+		return 0, err
+	}
+	for i := range holds {
+		err := u.dbTx.ExecTx(ctx, func(ctx context.Context) error {
+			wallet, h, err := u.walletHold(ctx, holds[i].WalletID, holds[i].ID)
+			if err != nil {
+				return err
+			}
+			if h.Status != hold.StatusAuthorized {
+				// settled since it was listed
+				return nil
+			}
+			holds[i] = *h
+			return u.release(ctx, wallet, &holds[i], hold.StatusExpired)
 		})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(holds), nil
+}
+
+func (u *useCase) Reverse(ctx context.Context, transactionID uint, amount decimal.Decimal, reason string) (*transaction.Transaction, error) {
+	if amount.IsNegative() {
+		return nil, errors.InvalidArgs.WithCause(fmt.Errorf("reversal amount must not be negative: %v", amount))
+	}
+	if reason == "" {
+		return nil, errors.InvalidArgs.WithCause(fmt.Errorf("reversal reason is required"))
+	}
+
+	if err := u.authorize(ctx, ActionAdmin); err != nil {
+		return nil, err
+	}
+
+	var reversal *transaction.Transaction
+	err := u.dbTx.ExecTx(ctx, func(ctx context.Context) error {
+		original, err := u.txRepo.Get(ctx, transactionID)
+		if err != nil {
+			return err
+		}
+		reversed, err := original.CheckReversal(amount)
+		if err != nil {
+			return err
+		}
+		reversal = original.Reversal(reversed, reason)
+
+		// the wallets of the original transaction swap roles, zero is the outside world
+		wallets, err := u.getWallets(ctx, reversal.FromWalletID, reversal.ToWalletID)
+		if err != nil {
+			return err
+		}
+		fromWallet, toWallet := wallets[0], wallets[1]
+		if fromWallet != nil {
+			if err := fromWallet.CheckActive(); err != nil {
+				return err
+			}
+			if err := fromWallet.CheckBalance(reversal.Amount); err != nil {
+				return err
+			}
+		}
+		if toWallet != nil {
+			if err := toWallet.CheckActive(); err != nil {
+				return err
+			}
+		}
+
+		if err := u.txRepo.UpdateReversed(ctx, original, reversed); err != nil {
+			return err
+		}
+		if fromWallet != nil {
+			if err := u.repo.UpdateBalance(ctx, fromWallet, reversal.Amount.Neg()); err != nil {
+				return err
+			}
+		}
+		if toWallet != nil {
+			if err := u.repo.UpdateBalance(ctx, toWallet, reversal.ToAmount); err != nil {
+				return err
+			}
+		}
+		from, to := transactionAccounts(original)
+		postings := ledger.Move(to, from, reversal.Currency, reversal.Amount)
+		if original.IsConversion() {
+			postings = ledger.Convert(to, from, reversal.Currency, reversal.Amount, reversal.ToCurrency, reversal.ToAmount)
+		}
+		return u.record(ctx, reversal, postings...)
 	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// transactionAccounts returns the ledger accounts money moved from and to in a transaction that isn't a reversal
+func transactionAccounts(tx *transaction.Transaction) (from, to ledger.Account) {
+	from, to = ledger.SystemAccount(ledger.SystemDeposits, tx.Currency), ledger.SystemAccount(ledger.SystemWithdrawals, tx.ToCurrency)
+	if tx.FromWalletID != 0 {
+		from = ledger.WalletAccount(tx.FromWalletID)
+	}
+	if tx.ToWalletID != 0 {
+		to = ledger.WalletAccount(tx.ToWalletID)
+	}
+	return from, to
+}
+
+// getWallets reads the wallets inside the transaction, so the checks and updates work on their current state
+// and a transaction retried after a conflict reads them again. In pessimistic mode the rows are locked too,
+// in ID order so concurrent transactions on the same wallets can't deadlock.
+// The wallets are returned in the order of ids, a zero id gives a nil wallet.
+func (u *useCase) getWallets(ctx context.Context, ids ...uint) ([]*Wallet, error) {
+	get := u.repo.Get
+	if u.lockMode == LockPessimistic {
+		get = u.repo.GetForUpdate
+	}
+	read := make(map[uint]*Wallet, len(ids))
+	for _, id := range slices.Sorted(slices.Values(ids)) {
+		if _, ok := read[id]; ok || id == 0 {
+			continue
+		}
+		w, err := get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		read[id] = w
+	}
+	wallets := make([]*Wallet, len(ids))
+	for i, id := range ids {
+		wallets[i] = read[id]
+	}
+	return wallets, nil
+}
+
+// fee returns the fee charged on a withdrawal of amount from the wallet
+func (u *useCase) fee(wallet *Wallet, amount decimal.Decimal) (decimal.Decimal, error) {
+	if !u.feeRate.IsPositive() {
+		return decimal.Zero, nil
+	}
+	c, err := currency.Lookup(wallet.Currency)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return c.Round(amount.Mul(u.feeRate)), nil
+}
+
+// record creates the transaction together with the balanced journal entry of its postings
+// and writes its domain events to the outbox
+func (u *useCase) record(ctx context.Context, tx *transaction.Transaction, postings ...ledger.Posting) error {
+	if at, ok := ctx.Value(txAtKey{}).(time.Time); ok {
+		tx.TxAt = at
+	}
+	entry, err := ledger.NewEntry(string(tx.Method), postings...)
+	if err != nil {
+		return err
+	}
+	if err := u.txRepo.Create(ctx, tx); err != nil {
+		return err
+	}
+	entry.TransactionID, entry.CreatedAt = tx.ID, tx.TxAt
+	if err := u.ledgerRepo.Create(ctx, entry); err != nil {
+		return err
+	}
+	events, err := transactionEvents(tx)
+	if err != nil {
+		return err
+	}
+	if err := u.outboxRepo.Create(ctx, events...); err != nil {
+		return err
+	}
+	collect(ctx, tx)
+	log.FromContext(ctx).WithFields(logrus.Fields{
+		"transaction_id": tx.ID,
+		"method":         tx.Method,
+		"from_wallet_id": tx.FromWalletID,
+		"to_wallet_id":   tx.ToWalletID,
+		"amount":         tx.Amount,
+	}).Debug("transaction recorded")
+	return nil
+}
+
+// walletHold reads the wallet and one of its holds inside the transaction, settling a hold debits the wallet
+func (u *useCase) walletHold(ctx context.Context, walletID, holdID uint) (*Wallet, *hold.Hold, error) {
+	wallets, err := u.getWallets(ctx, walletID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := u.authorize(ctx, ActionDebit, wallets[0]); err != nil {
+		return nil, nil, err
+	}
+	h, err := u.holdRepo.Get(ctx, holdID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if h.WalletID != walletID {
+		return nil, nil, errors.RecordNotFound.WithCause(fmt.Errorf("hold %d is not on wallet %d", holdID, walletID))
+	}
+	return wallets[0], h, nil
+}
+
+// release returns the amount of an authorized hold to the available balance of the wallet, it must run inside the transaction
+func (u *useCase) release(ctx context.Context, wallet *Wallet, h *hold.Hold, status hold.Status) error {
+	if err := u.repo.UpdateHeld(ctx, wallet, h.Amount.Neg()); err != nil {
+		return err
+	}
+	return u.holdRepo.UpdateStatus(ctx, h, status, decimal.Zero)
 }
 
 func (u *useCase) Wallet(ctx context.Context, walletID uint) (*Wallet, error) {
-	return u.repo.Get(ctx, walletID)
+	wallet, err := u.repo.Get(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.authorize(ctx, ActionRead, wallet); err != nil {
+		return nil, err
+	}
+	return wallet, nil
 }
 
-func (u *useCase) WalletTransactions(ctx context.Context, walletID uint) ([]transaction.Transaction, error) {
+func (u *useCase) WalletTransactions(ctx context.Context, walletID uint, filter transaction.Filter) (*transaction.Page, error) {
+	if err := filter.Normalize(); err != nil {
+		return nil, err
+	}
 	wallet, err := u.repo.Get(ctx, walletID)
 	if err != nil {
 		return nil, err
 	}
-	return u.txRepo.ListByWalletID(ctx, wallet.ID)
+	if err := u.authorize(ctx, ActionRead, wallet); err != nil {
+		return nil, err
+	}
+	limit := filter.Limit
+	// one extra row tells whether there is a next page
+	filter.Limit++
+	list, err := u.txRepo.ListByWalletID(ctx, wallet.ID, filter)
+	if err != nil {
+		return nil, err
+	}
+	return transaction.NewPage(list, limit), nil
+}
+
+func (u *useCase) CreateWallet(ctx context.Context, currencyCode string) (*Wallet, error) {
+	c, err := currency.Lookup(currencyCode)
+	if err != nil {
+		return nil, err
+	}
+	wallet := &Wallet{
+		Currency: c.Code,
+		Balance:  decimal.Zero,
+		Status:   StatusActive,
+	}
+	if p, ok := auth.FromContext(ctx); ok {
+		wallet.OwnerID = p.KeyID
+	}
+	if err := u.repo.Create(ctx, wallet); err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+func (u *useCase) FreezeWallet(ctx context.Context, walletID uint) (*Wallet, error) {
+	return u.changeStatus(ctx, walletID, StatusFrozen)
+}
+
+func (u *useCase) UnfreezeWallet(ctx context.Context, walletID uint) (*Wallet, error) {
+	return u.changeStatus(ctx, walletID, StatusActive)
+}
+
+func (u *useCase) CloseWallet(ctx context.Context, walletID uint) (*Wallet, error) {
+	return u.changeStatus(ctx, walletID, StatusClosed)
+}
+
+func (u *useCase) changeStatus(ctx context.Context, walletID uint, status Status) (*Wallet, error) {
+	var wallet *Wallet
+	err := u.dbTx.ExecTx(ctx, func(ctx context.Context) error {
+		wallets, err := u.getWallets(ctx, walletID)
+		if err != nil {
+			return err
+		}
+		wallet = wallets[0]
+		action := ActionManage
+		if wallet.Status == StatusFrozen && status == StatusActive {
+			action = ActionAdmin
+		}
+		if err := u.authorize(ctx, action, wallet); err != nil {
+			return err
+		}
+		if err := wallet.CheckTransition(status); err != nil {
+			return err
+		}
+		return u.repo.UpdateStatus(ctx, wallet, status)
+	})
+	if err != nil {
+		return nil, err
+	}
+	wallet.Status = status
+	return wallet, nil
 }
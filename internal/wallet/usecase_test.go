@@ -2,8 +2,16 @@ package wallet
 
 import (
 	"context"
+	"encoding/json"
+	"github.com/guoxiaopeng875/wallet/internal/fx"
+	"github.com/guoxiaopeng875/wallet/internal/ledger"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
+	"github.com/guoxiaopeng875/wallet/internal/wallet/hold"
 	"github.com/guoxiaopeng875/wallet/internal/wallet/transaction"
 	"github.com/shopspring/decimal"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -15,14 +23,34 @@ func (m *mockDBTx) ExecTx(ctx context.Context, fn func(ctx context.Context) erro
 }
 
 func setupTest(t *testing.T) (UseCase, *MockRepository, *MockTransactionRepository) {
+	return setupTestWithLedger(t, ledger.NewMockRepository())
+}
+
+func setupTestWithLedger(t *testing.T, ledgerRepo ledger.Repository, opts ...Option) (UseCase, *MockRepository, *MockTransactionRepository) {
+	return setupTestWithOutbox(t, ledgerRepo, outbox.NewMockRepository(), opts...)
+}
+
+func setupTestWithOutbox(t *testing.T, ledgerRepo ledger.Repository, outboxRepo outbox.Repository, opts ...Option) (UseCase, *MockRepository, *MockTransactionRepository) {
 	repo := NewMockRepository()
 	txRepo := NewMockTransactionRepository()
 	dbTx := &mockDBTx{}
-	uc := NewUseCase(repo, txRepo, dbTx)
+	fxUC := fx.NewUseCase(fx.NewMockRateRepository(), fx.NewMockQuoteRepository(), time.Minute)
+	uc := NewUseCase(repo, txRepo, NewMockHoldRepository(), ledgerRepo, outboxRepo, dbTx, fxUC, opts...)
+
+	// Add test rates
+	err := fxUC.LoadRates(context.Background(), []*fx.Rate{
+		{Base: "USD", Quote: "EUR", Rate: decimal.NewFromFloat(0.9), ValidFrom: time.Now().Add(-time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("LoadRates() error = %v", err)
+	}
 
 	// Add test wallets
-	repo.AddWallet(&Wallet{ID: 1, Balance: decimal.NewFromFloat(1000)})
-	repo.AddWallet(&Wallet{ID: 2, Balance: decimal.NewFromFloat(500)})
+	repo.AddWallet(&Wallet{ID: 1, Currency: "USD", Balance: decimal.NewFromFloat(1000), Status: StatusActive})
+	repo.AddWallet(&Wallet{ID: 2, Currency: "USD", Balance: decimal.NewFromFloat(500), Status: StatusActive})
+	repo.AddWallet(&Wallet{ID: 3, Currency: "USD", Balance: decimal.NewFromFloat(100), Status: StatusFrozen})
+	repo.AddWallet(&Wallet{ID: 4, Currency: "USD", Balance: decimal.Zero, Status: StatusClosed})
+	repo.AddWallet(&Wallet{ID: 5, Currency: "EUR", Balance: decimal.NewFromFloat(300), Status: StatusActive})
 
 	return uc, repo, txRepo
 }
@@ -53,6 +81,24 @@ func TestUseCase_Deposit(t *testing.T) {
 			amount:   decimal.NewFromFloat(100),
 			wantErr:  true,
 		},
+		{
+			name:     "frozen wallet",
+			walletID: 3,
+			amount:   decimal.NewFromFloat(100),
+			wantErr:  true,
+		},
+		{
+			name:     "closed wallet",
+			walletID: 4,
+			amount:   decimal.NewFromFloat(100),
+			wantErr:  true,
+		},
+		{
+			name:     "amount exceeds currency precision",
+			walletID: 1,
+			amount:   decimal.NewFromFloat(100.001),
+			wantErr:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -95,6 +141,18 @@ func TestUseCase_Withdraw(t *testing.T) {
 			amount:   decimal.NewFromFloat(-100),
 			wantErr:  true,
 		},
+		{
+			name:     "frozen wallet",
+			walletID: 3,
+			amount:   decimal.NewFromFloat(10),
+			wantErr:  true,
+		},
+		{
+			name:     "amount exceeds currency precision",
+			walletID: 1,
+			amount:   decimal.NewFromFloat(0.005),
+			wantErr:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -123,6 +181,13 @@ func TestUseCase_Transfer(t *testing.T) {
 			amount:       decimal.NewFromFloat(100),
 			wantErr:      false,
 		},
+		{
+			name:         "target holds less than the amount",
+			fromWalletID: 1,
+			toWalletID:   2,
+			amount:       decimal.NewFromFloat(800),
+			wantErr:      false,
+		},
 		{
 			name:         "insufficient balance",
 			fromWalletID: 1,
@@ -144,6 +209,27 @@ func TestUseCase_Transfer(t *testing.T) {
 			amount:       decimal.NewFromFloat(100),
 			wantErr:      true,
 		},
+		{
+			name:         "frozen source wallet",
+			fromWalletID: 3,
+			toWalletID:   2,
+			amount:       decimal.NewFromFloat(10),
+			wantErr:      true,
+		},
+		{
+			name:         "closed target wallet",
+			fromWalletID: 1,
+			toWalletID:   4,
+			amount:       decimal.NewFromFloat(10),
+			wantErr:      true,
+		},
+		{
+			name:         "cross currency transfer",
+			fromWalletID: 1,
+			toWalletID:   5,
+			amount:       decimal.NewFromFloat(10),
+			wantErr:      true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -171,25 +257,1078 @@ func TestUseCase_WalletTransactions(t *testing.T) {
 		{"deposit", 0, 1, 100},
 		{"withdraw", 1, 0, 50},
 		{"transfer", 1, 2, 30},
+		{"transfer", 5, 1, 20},
+		{"deposit", 0, 2, 10},
 	}
 
-	for _, tx := range txs {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, tx := range txs {
 		_ = txRepo.Create(ctx, &transaction.Transaction{
 			Method:       transaction.Method(tx.method),
-			TxAt:         time.Now(),
+			TxAt:         start.Add(time.Duration(i) * time.Hour),
 			Amount:       decimal.NewFromFloat(tx.amount),
 			FromWalletID: tx.fromWalletID,
 			ToWalletID:   tx.toWalletID,
 		})
 	}
 
-	// Test retrieving transactions
-	transactions, err := uc.WalletTransactions(ctx, 1)
+	ids := func(page *transaction.Page) []uint {
+		result := make([]uint, 0, len(page.Transactions))
+		for _, tx := range page.Transactions {
+			result = append(result, tx.ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		walletID uint
+		filter   transaction.Filter
+		want     []uint
+		wantNext bool
+		wantErr  error
+	}{
+		{name: "newest first", walletID: 1, want: []uint{4, 3, 2, 1}},
+		{name: "oldest first", walletID: 1, filter: transaction.Filter{Order: transaction.OrderAsc}, want: []uint{1, 2, 3, 4}},
+		{name: "first page", walletID: 1, filter: transaction.Filter{Limit: 3}, want: []uint{4, 3, 2}, wantNext: true},
+		{
+			name:     "methods",
+			walletID: 1,
+			filter:   transaction.Filter{Methods: []transaction.Method{transaction.MethodDeposit, transaction.MethodWithdraw}},
+			want:     []uint{2, 1},
+		},
+		{
+			name:     "date range",
+			walletID: 1,
+			filter:   transaction.Filter{From: start.Add(time.Hour), To: start.Add(3 * time.Hour)},
+			want:     []uint{3, 2},
+		},
+		{
+			name:     "amount range",
+			walletID: 1,
+			filter: transaction.Filter{
+				MinAmount: decimal.NewNullDecimal(decimal.NewFromInt(30)),
+				MaxAmount: decimal.NewNullDecimal(decimal.NewFromInt(50)),
+			},
+			want: []uint{3, 2},
+		},
+		{name: "counterparty", walletID: 1, filter: transaction.Filter{CounterpartyID: 5}, want: []uint{4}},
+		{name: "other wallet", walletID: 2, want: []uint{5, 3}},
+		{name: "unknown method", walletID: 1, filter: transaction.Filter{Methods: []transaction.Method{"refund"}}, wantErr: errors.InvalidArgs},
+		{name: "limit too large", walletID: 1, filter: transaction.Filter{Limit: transaction.MaxLimit + 1}, wantErr: errors.InvalidArgs},
+		{name: "wallet not found", walletID: 999, wantErr: errors.RecordNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := uc.WalletTransactions(ctx, tt.walletID, tt.filter)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("WalletTransactions() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WalletTransactions() error = %v", err)
+			}
+			if !reflect.DeepEqual(ids(page), tt.want) {
+				t.Errorf("WalletTransactions() = %v, want %v", ids(page), tt.want)
+			}
+			if (page.NextCursor != "") != tt.wantNext {
+				t.Errorf("WalletTransactions() next cursor = %q, wantNext %v", page.NextCursor, tt.wantNext)
+			}
+		})
+	}
+
+	// walk every page
+	var got []uint
+	filter := transaction.Filter{Limit: 1}
+	for {
+		page, err := uc.WalletTransactions(ctx, 1, filter)
+		if err != nil {
+			t.Fatalf("WalletTransactions() error = %v", err)
+		}
+		got = append(got, ids(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		if filter.After, err = transaction.ParseCursor(page.NextCursor); err != nil {
+			t.Fatalf("ParseCursor() error = %v", err)
+		}
+	}
+	if !reflect.DeepEqual(got, []uint{4, 3, 2, 1}) {
+		t.Errorf("paged transactions = %v, want %v", got, []uint{4, 3, 2, 1})
+	}
+}
+
+func TestUseCase_CreateWallet(t *testing.T) {
+	ctx := context.Background()
+	uc, repo, _ := setupTest(t)
+
+	w, err := uc.CreateWallet(ctx, "eur")
+	if err != nil {
+		t.Fatalf("CreateWallet() error = %v", err)
+	}
+	if w.ID == 0 || w.Currency != "EUR" || w.Status != StatusActive || !w.Balance.IsZero() {
+		t.Errorf("CreateWallet() got = %+v", w)
+	}
+	if _, err := repo.Get(ctx, w.ID); err != nil {
+		t.Errorf("CreateWallet() wallet not stored: %v", err)
+	}
+
+	if _, err := uc.CreateWallet(ctx, "XXX"); !errors.Is(err, errors.UnsupportedCurrency) {
+		t.Errorf("CreateWallet() error = %v, want %v", err, errors.UnsupportedCurrency)
+	}
+}
+
+func TestUseCase_TransactionCurrency(t *testing.T) {
+	ctx := context.Background()
+	uc, _, txRepo := setupTest(t)
+
+	if err := uc.Deposit(ctx, 5, decimal.NewFromFloat(10.5)); err != nil {
+		t.Fatalf("Deposit() error = %v", err)
+	}
+	txs, _ := txRepo.ListByWalletID(ctx, 5, transaction.Filter{})
+	if len(txs) != 1 || txs[0].Currency != "EUR" {
+		t.Errorf("Deposit() transactions = %+v", txs)
+	}
+}
+
+func TestUseCase_ChangeStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		walletID   uint
+		fn         func(UseCase) func(context.Context, uint) (*Wallet, error)
+		wantStatus Status
+		wantErr    error
+	}{
+		{
+			name:       "freeze active wallet",
+			walletID:   1,
+			fn:         func(uc UseCase) func(context.Context, uint) (*Wallet, error) { return uc.FreezeWallet },
+			wantStatus: StatusFrozen,
+		},
+		{
+			name:     "freeze frozen wallet",
+			walletID: 3,
+			fn:       func(uc UseCase) func(context.Context, uint) (*Wallet, error) { return uc.FreezeWallet },
+			wantErr:  errors.InvalidWalletStatus,
+		},
+		{
+			name:       "unfreeze frozen wallet",
+			walletID:   3,
+			fn:         func(uc UseCase) func(context.Context, uint) (*Wallet, error) { return uc.UnfreezeWallet },
+			wantStatus: StatusActive,
+		},
+		{
+			name:     "close wallet with balance",
+			walletID: 1,
+			fn:       func(uc UseCase) func(context.Context, uint) (*Wallet, error) { return uc.CloseWallet },
+			wantErr:  errors.WalletNotEmpty,
+		},
+		{
+			name:     "close closed wallet",
+			walletID: 4,
+			fn:       func(uc UseCase) func(context.Context, uint) (*Wallet, error) { return uc.CloseWallet },
+			wantErr:  errors.WalletClosed,
+		},
+		{
+			name:     "wallet not found",
+			walletID: 999,
+			fn:       func(uc UseCase) func(context.Context, uint) (*Wallet, error) { return uc.FreezeWallet },
+			wantErr:  errors.WalletNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, _, _ := setupTest(t)
+			w, err := tt.fn(uc)(context.Background(), tt.walletID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && w.Status != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestUseCase_CloseWallet(t *testing.T) {
+	ctx := context.Background()
+	uc, _, _ := setupTest(t)
+
+	if err := uc.Withdraw(ctx, 2, decimal.NewFromFloat(500)); err != nil {
+		t.Fatalf("Withdraw() error = %v", err)
+	}
+	w, err := uc.CloseWallet(ctx, 2)
+	if err != nil {
+		t.Fatalf("CloseWallet() error = %v", err)
+	}
+	if w.Status != StatusClosed {
+		t.Errorf("CloseWallet() status = %v, want %v", w.Status, StatusClosed)
+	}
+	if err := uc.Deposit(ctx, 2, decimal.NewFromFloat(1)); err != errors.WalletClosed {
+		t.Errorf("Deposit() on closed wallet error = %v, want %v", err, errors.WalletClosed)
+	}
+}
+
+func TestUseCase_QuoteTransfer(t *testing.T) {
+	tests := []struct {
+		name         string
+		fromWalletID uint
+		toWalletID   uint
+		amount       decimal.Decimal
+		wantToAmount string
+		wantErr      error
+	}{
+		{
+			name:         "USD to EUR",
+			fromWalletID: 1,
+			toWalletID:   5,
+			amount:       decimal.NewFromFloat(10.01),
+			wantToAmount: "9.01",
+		},
+		{
+			name:         "EUR to USD by inverse rate",
+			fromWalletID: 5,
+			toWalletID:   1,
+			amount:       decimal.NewFromFloat(9),
+			wantToAmount: "10",
+		},
+		{
+			name:         "same currency",
+			fromWalletID: 1,
+			toWalletID:   2,
+			amount:       decimal.NewFromFloat(10),
+			wantErr:      errors.InvalidArgs,
+		},
+		{
+			name:         "frozen source wallet",
+			fromWalletID: 3,
+			toWalletID:   5,
+			amount:       decimal.NewFromFloat(10),
+			wantErr:      errors.WalletFrozen,
+		},
+		{
+			name:         "negative amount",
+			fromWalletID: 1,
+			toWalletID:   5,
+			amount:       decimal.NewFromFloat(-10),
+			wantErr:      errors.InvalidArgs,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, _, _ := setupTest(t)
+			quote, err := uc.QuoteTransfer(context.Background(), tt.fromWalletID, tt.toWalletID, tt.amount)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("QuoteTransfer() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("QuoteTransfer() error = %v", err)
+			}
+			if quote.ToAmount.String() != tt.wantToAmount {
+				t.Errorf("QuoteTransfer() to amount = %v, want %v", quote.ToAmount, tt.wantToAmount)
+			}
+		})
+	}
+}
+
+func TestUseCase_ConvertTransfer(t *testing.T) {
+	ctx := context.Background()
+	uc, repo, txRepo := setupTest(t)
+	amount := decimal.NewFromFloat(100)
+
+	quote, err := uc.QuoteTransfer(ctx, 1, 5, amount)
+	if err != nil {
+		t.Fatalf("QuoteTransfer() error = %v", err)
+	}
+
+	if err := uc.ConvertTransfer(ctx, 1, 5, amount, quote.ID); err != nil {
+		t.Fatalf("ConvertTransfer() error = %v", err)
+	}
+	from, _ := repo.Get(ctx, 1)
+	to, _ := repo.Get(ctx, 5)
+	if from.Balance.String() != "900" || to.Balance.String() != "390" {
+		t.Errorf("ConvertTransfer() balances = %v, %v", from.Balance, to.Balance)
+	}
+
+	txs, _ := txRepo.ListByWalletID(ctx, 5, transaction.Filter{})
+	if len(txs) != 1 {
+		t.Fatalf("ConvertTransfer() recorded %d transactions, want 1", len(txs))
+	}
+	tx := txs[0]
+	if tx.Currency != "USD" || tx.Amount.String() != "100" || tx.ToCurrency != "EUR" || tx.ToAmount.String() != "90" || tx.Rate.String() != "0.9" {
+		t.Errorf("ConvertTransfer() transaction = %+v", tx)
+	}
+
+	// quote can only be used once
+	if err := uc.ConvertTransfer(ctx, 1, 5, amount, quote.ID); !errors.Is(err, errors.QuoteUsed) {
+		t.Errorf("ConvertTransfer() reuse error = %v, want %v", err, errors.QuoteUsed)
+	}
+	if err := uc.ConvertTransfer(ctx, 1, 5, amount, "missing"); !errors.Is(err, errors.RecordNotFound) {
+		t.Errorf("ConvertTransfer() missing quote error = %v, want %v", err, errors.RecordNotFound)
+	}
+
+	// quote is bound to its wallets and amount
+	quote, err = uc.QuoteTransfer(ctx, 1, 5, amount)
+	if err != nil {
+		t.Fatalf("QuoteTransfer() error = %v", err)
+	}
+	if err := uc.ConvertTransfer(ctx, 1, 5, decimal.NewFromFloat(50), quote.ID); !errors.Is(err, errors.QuoteMismatch) {
+		t.Errorf("ConvertTransfer() mismatch error = %v, want %v", err, errors.QuoteMismatch)
+	}
+}
+
+func TestUseCase_Authorize(t *testing.T) {
+	tests := []struct {
+		name     string
+		walletID uint
+		amount   decimal.Decimal
+		ttl      time.Duration
+		wantErr  error
+	}{
+		{
+			name:     "successful authorize",
+			walletID: 1,
+			amount:   decimal.NewFromFloat(400),
+			ttl:      time.Hour,
+		},
+		{
+			name:     "default ttl",
+			walletID: 1,
+			amount:   decimal.NewFromFloat(400),
+		},
+		{
+			name:     "insufficient balance",
+			walletID: 1,
+			amount:   decimal.NewFromFloat(1000.01),
+			wantErr:  errors.InsufficientBalance,
+		},
+		{
+			name:     "negative amount",
+			walletID: 1,
+			amount:   decimal.NewFromFloat(-100),
+			wantErr:  errors.InvalidArgs,
+		},
+		{
+			name:     "ttl too long",
+			walletID: 1,
+			amount:   decimal.NewFromFloat(100),
+			ttl:      MaxHoldTTL + time.Second,
+			wantErr:  errors.InvalidArgs,
+		},
+		{
+			name:     "frozen wallet",
+			walletID: 3,
+			amount:   decimal.NewFromFloat(10),
+			wantErr:  errors.WalletFrozen,
+		},
+		{
+			name:     "wallet not found",
+			walletID: 999,
+			amount:   decimal.NewFromFloat(10),
+			wantErr:  errors.RecordNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, repo, _ := setupTest(t)
+			h, err := uc.Authorize(context.Background(), tt.walletID, tt.amount, tt.ttl)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			wantTTL := tt.ttl
+			if wantTTL == 0 {
+				wantTTL = DefaultHoldTTL
+			}
+			if got := h.ExpiresAt.Sub(h.CreatedAt); got != wantTTL {
+				t.Errorf("Authorize() ttl = %v, want %v", got, wantTTL)
+			}
+			w, _ := repo.Get(context.Background(), tt.walletID)
+			if !w.Held.Equal(tt.amount) || !w.Balance.Equal(decimal.NewFromFloat(1000)) {
+				t.Errorf("Authorize() wallet balance = %v held = %v, want 1000 and %v", w.Balance, w.Held, tt.amount)
+			}
+		})
+	}
+}
+
+func TestUseCase_HoldProtectsFunds(t *testing.T) {
+	ctx := context.Background()
+	uc, _, _ := setupTest(t)
+
+	if _, err := uc.Authorize(ctx, 1, decimal.NewFromFloat(800), time.Hour); err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if err := uc.Withdraw(ctx, 1, decimal.NewFromFloat(300)); err != errors.InsufficientBalance {
+		t.Errorf("Withdraw() error = %v, want %v", err, errors.InsufficientBalance)
+	}
+	if err := uc.Transfer(ctx, 1, 2, decimal.NewFromFloat(300)); err != errors.InsufficientBalance {
+		t.Errorf("Transfer() error = %v, want %v", err, errors.InsufficientBalance)
+	}
+	if _, err := uc.Authorize(ctx, 1, decimal.NewFromFloat(300), time.Hour); err != errors.InsufficientBalance {
+		t.Errorf("Authorize() error = %v, want %v", err, errors.InsufficientBalance)
+	}
+	if err := uc.Withdraw(ctx, 1, decimal.NewFromFloat(200)); err != nil {
+		t.Errorf("Withdraw() of available balance error = %v", err)
+	}
+}
+
+func TestUseCase_Capture(t *testing.T) {
+	tests := []struct {
+		name        string
+		amount      decimal.Decimal
+		wantErr     error
+		wantBalance decimal.Decimal
+		wantCapture decimal.Decimal
+	}{
+		{
+			name:        "full capture",
+			amount:      decimal.Zero,
+			wantBalance: decimal.NewFromFloat(600),
+			wantCapture: decimal.NewFromFloat(400),
+		},
+		{
+			name:        "partial capture",
+			amount:      decimal.NewFromFloat(150),
+			wantBalance: decimal.NewFromFloat(850),
+			wantCapture: decimal.NewFromFloat(150),
+		},
+		{
+			name:    "capture exceeds hold",
+			amount:  decimal.NewFromFloat(400.01),
+			wantErr: errors.CaptureExceedsHold,
+		},
+		{
+			name:    "negative amount",
+			amount:  decimal.NewFromFloat(-1),
+			wantErr: errors.InvalidArgs,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			uc, repo, txRepo := setupTest(t)
+			h, err := uc.Authorize(ctx, 1, decimal.NewFromFloat(400), time.Hour)
+			if err != nil {
+				t.Fatalf("Authorize() error = %v", err)
+			}
+
+			h, err = uc.Capture(ctx, 1, h.ID, tt.amount)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Capture() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if h.Status != hold.StatusCaptured || !h.CapturedAmount.Equal(tt.wantCapture) {
+				t.Errorf("Capture() hold = %v %v, want %v %v", h.Status, h.CapturedAmount, hold.StatusCaptured, tt.wantCapture)
+			}
+			w, _ := repo.Get(ctx, 1)
+			if !w.Balance.Equal(tt.wantBalance) || !w.Held.IsZero() {
+				t.Errorf("Capture() wallet balance = %v held = %v, want %v and 0", w.Balance, w.Held, tt.wantBalance)
+			}
+			txs, _ := txRepo.ListByWalletID(ctx, 1, transaction.Filter{})
+			if len(txs) != 1 || txs[0].Method != transaction.MethodCapture || !txs[0].Amount.Equal(tt.wantCapture) {
+				t.Errorf("Capture() transactions = %v, want one capture of %v", txs, tt.wantCapture)
+			}
+			if _, err := uc.Capture(ctx, 1, h.ID, decimal.Zero); err != errors.InvalidHoldStatus {
+				t.Errorf("second Capture() error = %v, want %v", err, errors.InvalidHoldStatus)
+			}
+		})
+	}
+}
+
+func TestUseCase_CaptureOtherWalletHold(t *testing.T) {
+	ctx := context.Background()
+	uc, _, _ := setupTest(t)
+	h, err := uc.Authorize(ctx, 1, decimal.NewFromFloat(100), time.Hour)
 	if err != nil {
-		t.Errorf("WalletTransactions() error = %v", err)
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if _, err := uc.Capture(ctx, 2, h.ID, decimal.Zero); !errors.Is(err, errors.RecordNotFound) {
+		t.Errorf("Capture() error = %v, want %v", err, errors.RecordNotFound)
 	}
+	if _, err := uc.Void(ctx, 2, h.ID); !errors.Is(err, errors.RecordNotFound) {
+		t.Errorf("Void() error = %v, want %v", err, errors.RecordNotFound)
+	}
+}
 
-	if len(transactions) != 3 {
-		t.Errorf("Expected 3 transactions, got %d", len(transactions))
+func TestUseCase_Void(t *testing.T) {
+	ctx := context.Background()
+	uc, repo, txRepo := setupTest(t)
+	h, err := uc.Authorize(ctx, 1, decimal.NewFromFloat(400), time.Hour)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+
+	h, err = uc.Void(ctx, 1, h.ID)
+	if err != nil {
+		t.Fatalf("Void() error = %v", err)
+	}
+	if h.Status != hold.StatusVoided {
+		t.Errorf("Void() status = %v, want %v", h.Status, hold.StatusVoided)
+	}
+	w, _ := repo.Get(ctx, 1)
+	if !w.Balance.Equal(decimal.NewFromFloat(1000)) || !w.Held.IsZero() {
+		t.Errorf("Void() wallet balance = %v held = %v, want 1000 and 0", w.Balance, w.Held)
+	}
+	if txs, _ := txRepo.ListByWalletID(ctx, 1, transaction.Filter{}); len(txs) != 0 {
+		t.Errorf("Void() transactions = %v, want none", txs)
+	}
+	if _, err := uc.Void(ctx, 1, h.ID); err != errors.InvalidHoldStatus {
+		t.Errorf("second Void() error = %v, want %v", err, errors.InvalidHoldStatus)
+	}
+	if _, err := uc.Capture(ctx, 1, h.ID, decimal.Zero); err != errors.InvalidHoldStatus {
+		t.Errorf("Capture() of voided hold error = %v, want %v", err, errors.InvalidHoldStatus)
+	}
+}
+
+func TestUseCase_ExpireHolds(t *testing.T) {
+	ctx := context.Background()
+	uc, repo, _ := setupTest(t)
+	expiring, err := uc.Authorize(ctx, 1, decimal.NewFromFloat(100), time.Minute)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if _, err := uc.Authorize(ctx, 1, decimal.NewFromFloat(200), time.Hour); err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+
+	at := time.Now().Add(2 * time.Minute)
+	n, err := uc.ExpireHolds(ctx, at)
+	if err != nil {
+		t.Fatalf("ExpireHolds() error = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("ExpireHolds() released = %d, want 1", n)
+	}
+	w, _ := repo.Get(ctx, 1)
+	if !w.Held.Equal(decimal.NewFromFloat(200)) {
+		t.Errorf("ExpireHolds() wallet held = %v, want 200", w.Held)
+	}
+	holds, _ := uc.WalletHolds(ctx, 1)
+	if len(holds) != 2 || holds[1].ID != expiring.ID || holds[1].Status != hold.StatusExpired {
+		t.Errorf("WalletHolds() = %v, want the first hold expired", holds)
+	}
+	if n, _ := uc.ExpireHolds(ctx, at); n != 0 {
+		t.Errorf("second ExpireHolds() released = %d, want 0", n)
+	}
+}
+
+func TestUseCase_WithdrawFee(t *testing.T) {
+	ctx := context.Background()
+	ledgerRepo := ledger.NewMockRepository()
+	uc, repo, txRepo := setupTestWithLedger(t, ledgerRepo, WithWithdrawalFee(decimal.RequireFromString("0.015")))
+
+	// 1.5% of 100.30 is 1.5045, rounded to the cent
+	if err := uc.Withdraw(ctx, 1, decimal.RequireFromString("100.30")); err != nil {
+		t.Fatalf("Withdraw() error = %v", err)
+	}
+	w, _ := repo.Get(ctx, 1)
+	if !w.Balance.Equal(decimal.RequireFromString("898.20")) {
+		t.Errorf("balance = %v, want 898.20 after the amount and its fee", w.Balance)
+	}
+	txs, _ := txRepo.ListByWalletID(ctx, 1, transaction.Filter{})
+	if len(txs) != 1 || !txs[0].Amount.Equal(decimal.RequireFromString("100.30")) || !txs[0].Fee.Equal(decimal.RequireFromString("1.50")) {
+		t.Fatalf("transactions = %+v, want the withdrawal with a fee of 1.50", txs)
+	}
+	balances, _ := ledgerRepo.Balances(ctx)
+	if err := ledger.CheckBalances(balances); err != nil {
+		t.Errorf("CheckBalances() error = %v", err)
+	}
+	want := map[ledger.Account]string{
+		ledger.WalletAccount(1):                               "-101.8",
+		ledger.SystemAccount(ledger.SystemWithdrawals, "USD"): "100.3",
+		ledger.SystemAccount(ledger.SystemFees, "USD"):        "1.5",
+	}
+	for _, b := range balances {
+		if b.Amount.String() != want[b.Account] {
+			t.Errorf("account %s balance = %v, want %v", b.Account, b.Amount, want[b.Account])
+		}
+	}
+
+	// the fee counts against the balance
+	if err := uc.Withdraw(ctx, 2, decimal.NewFromInt(500)); !errors.Is(err, errors.InsufficientBalance) {
+		t.Errorf("Withdraw() of the whole balance error = %v, want %v", err, errors.InsufficientBalance)
+	}
+}
+
+func TestUseCase_Journal(t *testing.T) {
+	ctx := context.Background()
+	ledgerRepo := ledger.NewMockRepository()
+	uc, _, txRepo := setupTestWithLedger(t, ledgerRepo)
+
+	if err := uc.Deposit(ctx, 1, decimal.NewFromFloat(100)); err != nil {
+		t.Fatalf("Deposit() error = %v", err)
+	}
+	if err := uc.Withdraw(ctx, 1, decimal.NewFromFloat(30)); err != nil {
+		t.Fatalf("Withdraw() error = %v", err)
+	}
+	if err := uc.Transfer(ctx, 1, 2, decimal.NewFromFloat(20)); err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	quote, err := uc.QuoteTransfer(ctx, 1, 5, decimal.NewFromFloat(10))
+	if err != nil {
+		t.Fatalf("QuoteTransfer() error = %v", err)
+	}
+	if err := uc.ConvertTransfer(ctx, 1, 5, decimal.NewFromFloat(10), quote.ID); err != nil {
+		t.Fatalf("ConvertTransfer() error = %v", err)
+	}
+	h, err := uc.Authorize(ctx, 2, decimal.NewFromFloat(50), time.Hour)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if _, err := uc.Capture(ctx, 2, h.ID, decimal.NewFromFloat(15)); err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+
+	// every transaction is recorded by one entry
+	for id := uint(1); id <= 5; id++ {
+		entries, _ := ledgerRepo.ListByTransactionID(ctx, id)
+		if len(entries) != 1 {
+			t.Errorf("transaction %d entries = %v, want one", id, entries)
+		}
+	}
+	txs, _ := txRepo.ListByWalletID(ctx, 5, transaction.Filter{})
+	if entries, _ := ledgerRepo.ListByTransactionID(ctx, txs[0].ID); len(entries[0].Postings) != 4 {
+		t.Errorf("conversion postings = %v, want 4", entries[0].Postings)
+	}
+
+	balances, err := ledgerRepo.Balances(ctx)
+	if err != nil {
+		t.Fatalf("Balances() error = %v", err)
+	}
+	if err := ledger.CheckBalances(balances); err != nil {
+		t.Errorf("CheckBalances() error = %v", err)
+	}
+	want := map[ledger.Account]string{
+		ledger.WalletAccount(1):                               "40",
+		ledger.WalletAccount(2):                               "5",
+		ledger.WalletAccount(5):                               "9",
+		ledger.SystemAccount(ledger.SystemDeposits, "USD"):    "-100",
+		ledger.SystemAccount(ledger.SystemWithdrawals, "USD"): "45",
+		ledger.SystemAccount(ledger.SystemFX, "USD"):          "10",
+		ledger.SystemAccount(ledger.SystemFX, "EUR"):          "-9",
+	}
+	if len(balances) != len(want) {
+		t.Errorf("Balances() = %v, want %d accounts", balances, len(want))
+	}
+	for _, b := range balances {
+		if b.Amount.String() != want[b.Account] {
+			t.Errorf("account %s balance = %v, want %v", b.Account, b.Amount, want[b.Account])
+		}
+	}
+}
+
+func TestUseCase_Reverse(t *testing.T) {
+	ctx := context.Background()
+	ledgerRepo := ledger.NewMockRepository()
+	uc, repo, txRepo := setupTestWithLedger(t, ledgerRepo)
+
+	// 1: deposit to 1, 2: withdraw from 1, 3: transfer from 1 to 2
+	if err := uc.Deposit(ctx, 1, decimal.NewFromFloat(100)); err != nil {
+		t.Fatalf("Deposit() error = %v", err)
+	}
+	if err := uc.Withdraw(ctx, 1, decimal.NewFromFloat(50)); err != nil {
+		t.Fatalf("Withdraw() error = %v", err)
+	}
+	if err := uc.Transfer(ctx, 1, 2, decimal.NewFromFloat(200)); err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		txID         uint
+		amount       decimal.Decimal
+		reason       string
+		wantErr      error
+		wantBalances map[uint]string
+	}{
+		{
+			name:         "partial refund of transfer",
+			txID:         3,
+			amount:       decimal.NewFromFloat(80),
+			reason:       "partial refund",
+			wantBalances: map[uint]string{1: "930", 2: "620"},
+		},
+		{
+			name:    "refund exceeds the rest",
+			txID:    3,
+			amount:  decimal.NewFromFloat(120.01),
+			reason:  "refund",
+			wantErr: errors.ReversalExceedsAmount,
+		},
+		{
+			name:         "rest of transfer",
+			txID:         3,
+			reason:       "refund",
+			wantBalances: map[uint]string{1: "1050", 2: "500"},
+		},
+		{
+			name:    "double reversal",
+			txID:    3,
+			reason:  "refund",
+			wantErr: errors.TransactionReversed,
+		},
+		{
+			name:         "reverse deposit",
+			txID:         1,
+			reason:       "mistaken deposit",
+			wantBalances: map[uint]string{1: "950"},
+		},
+		{
+			name:         "reverse withdrawal",
+			txID:         2,
+			reason:       "failed payout",
+			wantBalances: map[uint]string{1: "1000"},
+		},
+		{
+			name:    "reverse a reversal",
+			txID:    4,
+			reason:  "undo",
+			wantErr: errors.NotReversible,
+		},
+		{
+			name:    "missing reason",
+			txID:    1,
+			wantErr: errors.InvalidArgs,
+		},
+		{
+			name:    "transaction not found",
+			txID:    999,
+			reason:  "refund",
+			wantErr: errors.RecordNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reversal, err := uc.Reverse(ctx, tt.txID, tt.amount, tt.reason)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Reverse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if reversal.ReversalOf != tt.txID || reversal.Method != transaction.MethodReversal || reversal.Reason != tt.reason {
+				t.Errorf("Reverse() = %+v, want a reversal of %d", reversal, tt.txID)
+			}
+			for id, want := range tt.wantBalances {
+				if w, _ := repo.Get(ctx, id); w.Balance.String() != want {
+					t.Errorf("wallet %d balance = %v, want %v", id, w.Balance, want)
+				}
+			}
+		})
+	}
+
+	original, _ := txRepo.Get(ctx, 3)
+	if !original.ReversedAmount.Equal(original.Amount) {
+		t.Errorf("transfer reversed amount = %v, want %v", original.ReversedAmount, original.Amount)
+	}
+	page, _ := uc.WalletTransactions(ctx, 2, transaction.Filter{})
+	reversals := 0
+	for _, tx := range page.Transactions {
+		if tx.ReversalOf == 3 {
+			reversals++
+		}
+	}
+	if reversals != 2 {
+		t.Errorf("wallet 2 transactions = %v, want 2 reversals of 3", page.Transactions)
+	}
+	balances, _ := ledgerRepo.Balances(ctx)
+	if err := ledger.CheckBalances(balances); err != nil {
+		t.Errorf("CheckBalances() error = %v", err)
+	}
+	for _, b := range balances {
+		if b.Account == ledger.SystemAccount(ledger.SystemDeposits, "USD") || b.Account == ledger.SystemAccount(ledger.SystemWithdrawals, "USD") {
+			if !b.Amount.IsZero() {
+				t.Errorf("account %s balance = %v, want 0 after reversals", b.Account, b.Amount)
+			}
+		}
+	}
+}
+
+func TestUseCase_ReverseConversion(t *testing.T) {
+	ctx := context.Background()
+	uc, repo, _ := setupTest(t)
+	quote, err := uc.QuoteTransfer(ctx, 1, 5, decimal.NewFromFloat(100))
+	if err != nil {
+		t.Fatalf("QuoteTransfer() error = %v", err)
+	}
+	if err := uc.ConvertTransfer(ctx, 1, 5, decimal.NewFromFloat(100), quote.ID); err != nil {
+		t.Fatalf("ConvertTransfer() error = %v", err)
+	}
+
+	if _, err := uc.Reverse(ctx, 1, decimal.NewFromFloat(50), "refund"); !errors.Is(err, errors.NotReversible) {
+		t.Errorf("partial Reverse() error = %v, want %v", err, errors.NotReversible)
+	}
+	reversal, err := uc.Reverse(ctx, 1, decimal.Zero, "refund")
+	if err != nil {
+		t.Fatalf("Reverse() error = %v", err)
+	}
+	if reversal.Currency != "EUR" || !reversal.Amount.Equal(decimal.NewFromFloat(90)) || reversal.ToCurrency != "USD" {
+		t.Errorf("Reverse() = %v %s to %s, want 90 EUR to USD", reversal.Amount, reversal.Currency, reversal.ToCurrency)
+	}
+	if w, _ := repo.Get(ctx, 1); w.Balance.String() != "1000" {
+		t.Errorf("wallet 1 balance = %v, want 1000", w.Balance)
+	}
+	if w, _ := repo.Get(ctx, 5); w.Balance.String() != "300" {
+		t.Errorf("wallet 5 balance = %v, want 300", w.Balance)
+	}
+}
+
+func TestUseCase_ReverseInsufficientBalance(t *testing.T) {
+	ctx := context.Background()
+	uc, _, _ := setupTest(t)
+	if err := uc.Transfer(ctx, 1, 2, decimal.NewFromFloat(100)); err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	if err := uc.Withdraw(ctx, 2, decimal.NewFromFloat(550)); err != nil {
+		t.Fatalf("Withdraw() error = %v", err)
+	}
+	if _, err := uc.Reverse(ctx, 1, decimal.Zero, "refund"); err != errors.InsufficientBalance {
+		t.Errorf("Reverse() error = %v, want %v", err, errors.InsufficientBalance)
+	}
+}
+
+func TestParseLockMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    LockMode
+		wantErr bool
+	}{
+		{mode: "", want: LockOptimistic},
+		{mode: "optimistic", want: LockOptimistic},
+		{mode: "pessimistic", want: LockPessimistic},
+		{mode: "none", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := ParseLockMode(tt.mode)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseLockMode() = %v, %v, want %v, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUseCase_PessimisticLock(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		mode       LockMode
+		run        func(uc UseCase) error
+		wantLocked []uint
+	}{
+		{
+			name: "optimistic mode doesn't lock",
+			mode: LockOptimistic,
+			run: func(uc UseCase) error {
+				return uc.Transfer(ctx, 2, 1, decimal.NewFromFloat(10))
+			},
+		},
+		{
+			name: "deposit",
+			mode: LockPessimistic,
+			run: func(uc UseCase) error {
+				return uc.Deposit(ctx, 2, decimal.NewFromFloat(10))
+			},
+			wantLocked: []uint{2},
+		},
+		{
+			name: "transfer locks in id order",
+			mode: LockPessimistic,
+			run: func(uc UseCase) error {
+				return uc.Transfer(ctx, 2, 1, decimal.NewFromFloat(10))
+			},
+			wantLocked: []uint{1, 2},
+		},
+		{
+			name: "reversal locks in id order",
+			mode: LockPessimistic,
+			run: func(uc UseCase) error {
+				if err := uc.Transfer(ctx, 1, 2, decimal.NewFromFloat(10)); err != nil {
+					return err
+				}
+				_, err := uc.Reverse(ctx, 1, decimal.Zero, "refund")
+				return err
+			},
+			wantLocked: []uint{1, 2, 1, 2},
+		},
+		{
+			name: "freeze",
+			mode: LockPessimistic,
+			run: func(uc UseCase) error {
+				_, err := uc.FreezeWallet(ctx, 1)
+				return err
+			},
+			wantLocked: []uint{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, repo, _ := setupTestWithLedger(t, ledger.NewMockRepository(), WithLockMode(tt.mode))
+			if err := tt.run(uc); err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !reflect.DeepEqual(repo.Locked, tt.wantLocked) {
+				t.Errorf("locked = %v, want %v", repo.Locked, tt.wantLocked)
+			}
+		})
+	}
+}
+
+// staleRepository reads wallets as they were before another transaction changed them,
+// only a locked read sees the current state.
+type staleRepository struct {
+	*MockRepository
+	stale map[uint]Wallet
+}
+
+func (r *staleRepository) Get(ctx context.Context, id uint) (*Wallet, error) {
+	if w, ok := r.stale[id]; ok {
+		return &w, nil
+	}
+	return r.MockRepository.Get(ctx, id)
+}
+
+func TestUseCase_LockRereadsWallet(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockRepository()
+	repo.AddWallet(&Wallet{ID: 1, Currency: "USD", Balance: decimal.NewFromFloat(100), Status: StatusActive})
+	stale := &staleRepository{
+		MockRepository: repo,
+		stale:          map[uint]Wallet{1: {ID: 1, Currency: "USD", Balance: decimal.NewFromFloat(500), Status: StatusActive}},
+	}
+	fxUC := fx.NewUseCase(fx.NewMockRateRepository(), fx.NewMockQuoteRepository(), time.Minute)
+	uc := NewUseCase(stale, NewMockTransactionRepository(), NewMockHoldRepository(), ledger.NewMockRepository(), outbox.NewMockRepository(), &mockDBTx{}, fxUC, WithLockMode(LockPessimistic))
+
+	if err := uc.Withdraw(ctx, 1, decimal.NewFromFloat(400)); !errors.Is(err, errors.InsufficientBalance) {
+		t.Errorf("Withdraw() error = %v, want %v", err, errors.InsufficientBalance)
+	}
+	if err := uc.Withdraw(ctx, 1, decimal.NewFromFloat(60)); err != nil {
+		t.Fatalf("Withdraw() error = %v", err)
+	}
+	if got := repo.wallets[1].Balance; !got.Equal(decimal.NewFromFloat(40)) {
+		t.Errorf("balance = %v, want 40", got)
+	}
+}
+
+func TestUseCase_Tenant(t *testing.T) {
+	uc, repo, _ := setupTest(t)
+	repo.AddWallet(&Wallet{ID: 20, Currency: "USD", Balance: decimal.NewFromInt(100), Status: StatusActive, TenantID: "acme"})
+	acme := tenant.NewContext(context.Background(), "acme")
+	amount := decimal.NewFromInt(10)
+
+	w, err := uc.CreateWallet(acme, "USD")
+	if err != nil {
+		t.Fatalf("CreateWallet() error = %v", err)
+	}
+	if w.TenantID != "acme" {
+		t.Errorf("CreateWallet() tenant = %q, want acme", w.TenantID)
+	}
+	if err := uc.Transfer(acme, 20, w.ID, amount); err != nil {
+		t.Errorf("Transfer() in the tenant error = %v", err)
+	}
+	page, err := uc.WalletTransactions(acme, w.ID, transaction.Filter{})
+	if err != nil || len(page.Transactions) != 1 {
+		t.Errorf("WalletTransactions() = %v, %v, want the transfer", page, err)
+	}
+
+	// the wallets of other tenants don't exist for the request
+	if _, err := uc.Wallet(acme, 1); !errors.Is(err, errors.WalletNotFound) {
+		t.Errorf("Wallet() of the default tenant error = %v, want %v", err, errors.WalletNotFound)
+	}
+	if err := uc.Transfer(acme, 20, 1, amount); !errors.Is(err, errors.WalletNotFound) {
+		t.Errorf("Transfer() to the default tenant error = %v, want %v", err, errors.WalletNotFound)
+	}
+	if _, err := uc.Wallet(tenant.NewContext(context.Background(), tenant.Default), 20); !errors.Is(err, errors.WalletNotFound) {
+		t.Errorf("Wallet() of acme from the default tenant error = %v, want %v", err, errors.WalletNotFound)
+	}
+	page, err = uc.WalletTransactions(tenant.NewContext(context.Background(), tenant.Default), w.ID, transaction.Filter{})
+	if err == nil && len(page.Transactions) != 0 {
+		t.Errorf("WalletTransactions() of acme from the default tenant = %v", page.Transactions)
+	}
+
+	// the service sees every tenant but still can't move money across them
+	if err := uc.Transfer(context.Background(), 20, 1, amount); !errors.Is(err, errors.CrossTenantTransfer) {
+		t.Errorf("Transfer() across tenants error = %v, want %v", err, errors.CrossTenantTransfer)
+	}
+	if _, err := uc.QuoteTransfer(context.Background(), 20, 5, amount); !errors.Is(err, errors.CrossTenantTransfer) {
+		t.Errorf("QuoteTransfer() across tenants error = %v, want %v", err, errors.CrossTenantTransfer)
+	}
+	if !repo.wallets[1].Balance.Equal(decimal.NewFromInt(1000)) {
+		t.Errorf("balance of wallet 1 = %s, want 1000", repo.wallets[1].Balance)
+	}
+}
+
+func TestUseCase_Events(t *testing.T) {
+	ctx := context.Background()
+	outboxRepo := outbox.NewMockRepository()
+	uc, _, _ := setupTestWithOutbox(t, ledger.NewMockRepository(), outboxRepo)
+
+	if err := uc.Deposit(ctx, 1, decimal.NewFromFloat(100)); err != nil {
+		t.Fatalf("Deposit() error = %v", err)
+	}
+	if err := uc.Transfer(ctx, 1, 2, decimal.NewFromFloat(20)); err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	h, err := uc.Authorize(ctx, 2, decimal.NewFromFloat(50), time.Hour)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if _, err := uc.Capture(ctx, 2, h.ID, decimal.NewFromFloat(15)); err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+	if _, err := uc.Reverse(ctx, 2, decimal.Zero, "refund"); err != nil {
+		t.Fatalf("Reverse() error = %v", err)
+	}
+	// failed movements write no event
+	if err := uc.Withdraw(ctx, 3, decimal.NewFromFloat(10)); !errors.Is(err, errors.WalletFrozen) {
+		t.Fatalf("Withdraw() error = %v, want %v", err, errors.WalletFrozen)
+	}
+
+	type event struct {
+		Type          outbox.Type
+		WalletID      uint
+		TransactionID uint
+	}
+	want := []event{
+		{EventWalletCredited, 1, 1},
+		{EventWalletDebited, 1, 2},
+		{EventWalletCredited, 2, 2},
+		{EventTransferCompleted, 1, 2},
+		{EventWalletDebited, 2, 3},
+		// the reversal of the transfer moves the money back from wallet 2 to wallet 1
+		{EventWalletDebited, 2, 4},
+		{EventWalletCredited, 1, 4},
+		{EventTransactionReversed, 2, 4},
+	}
+	var got []event
+	for _, e := range outboxRepo.Events() {
+		var payload MovementEvent
+		if err := json.Unmarshal(e.Payload, &payload); err != nil {
+			t.Fatalf("event %d payload: %v", e.ID, err)
+		}
+		if payload.WalletID != e.WalletID || e.TenantID != tenant.Default {
+			t.Errorf("event %d of wallet %d in tenant %q has payload of wallet %d", e.ID, e.WalletID, e.TenantID, payload.WalletID)
+		}
+		got = append(got, event{e.Type, e.WalletID, payload.Transaction.ID})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
 	}
 }
@@ -1,20 +1,98 @@
 package wallet
 
 import (
+	"cmp"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/currency"
 	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
 	"github.com/shopspring/decimal"
 )
 
-// Wallet defines the wallet entity
+// Status of wallet
+type Status string
+
+const (
+	StatusActive Status = "active"
+	StatusFrozen Status = "frozen"
+	StatusClosed Status = "closed"
+)
+
+// Wallet defines the wallet entity.
+// Balance is the ledger balance, Held is the part of it reserved by authorized holds.
 type Wallet struct {
-	ID      uint            `json:"id"`
-	Balance decimal.Decimal `json:"balance"`
+	ID       uint            `json:"id"`
+	Currency string          `json:"currency"`
+	Balance  decimal.Decimal `json:"balance"`
+	Held     decimal.Decimal `json:"held"`
+	Status   Status          `json:"status"`
+	// OwnerID is the key ID of the principal that created the wallet
+	OwnerID string `json:"owner_id"`
+	// TenantID is the tenant the wallet belongs to, wallets only move money within their tenant
+	TenantID string `json:"tenant_id"`
+}
+
+// Available returns the balance that is not reserved by holds
+func (w *Wallet) Available() decimal.Decimal {
+	return w.Balance.Sub(w.Held)
 }
 
-// CheckBalance checks if the wallet has enough balance
+// CheckBalance checks if the wallet has enough available balance
 func (w *Wallet) CheckBalance(amount decimal.Decimal) error {
-	if w.Balance.LessThan(amount) {
+	if w.Available().LessThan(amount) {
 		return errors.InsufficientBalance
 	}
 	return nil
 }
+
+// CheckAmount checks if the amount fits the minor units of the wallet currency
+func (w *Wallet) CheckAmount(amount decimal.Decimal) error {
+	c, err := currency.Lookup(w.Currency)
+	if err != nil {
+		return err
+	}
+	return c.Validate(amount)
+}
+
+// CheckActive checks if the wallet accepts money movements
+func (w *Wallet) CheckActive() error {
+	switch w.Status {
+	case StatusFrozen:
+		return errors.WalletFrozen
+	case StatusClosed:
+		return errors.WalletClosed
+	}
+	return nil
+}
+
+// CheckTenant checks if the wallet belongs to the tenant of other, wallets without tenant belong to the default one
+func (w *Wallet) CheckTenant(other *Wallet) error {
+	if cmp.Or(w.TenantID, tenant.Default) != cmp.Or(other.TenantID, tenant.Default) {
+		return errors.CrossTenantTransfer
+	}
+	return nil
+}
+
+// CheckTransition checks if the wallet can move to the given status
+func (w *Wallet) CheckTransition(to Status) error {
+	switch to {
+	case StatusFrozen:
+		if w.Status == StatusActive {
+			return nil
+		}
+	case StatusActive:
+		if w.Status == StatusFrozen {
+			return nil
+		}
+	case StatusClosed:
+		if w.Status == StatusActive || w.Status == StatusFrozen {
+			if !w.Balance.IsZero() {
+				return errors.WalletNotEmpty
+			}
+			return nil
+		}
+	}
+	if w.Status == StatusClosed {
+		return errors.WalletClosed
+	}
+	return errors.InvalidWalletStatus
+}
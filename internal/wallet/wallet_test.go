@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
 	"github.com/shopspring/decimal"
 	"testing"
 )
@@ -39,6 +40,26 @@ func TestWallet_CheckBalance(t *testing.T) {
 			amount:  decimal.NewFromFloat(100),
 			wantErr: false,
 		},
+		{
+			name: "balance reserved by holds",
+			wallet: &Wallet{
+				ID:      1,
+				Balance: decimal.NewFromFloat(100),
+				Held:    decimal.NewFromFloat(60),
+			},
+			amount:  decimal.NewFromFloat(50),
+			wantErr: true,
+		},
+		{
+			name: "exact available balance",
+			wallet: &Wallet{
+				ID:      1,
+				Balance: decimal.NewFromFloat(100),
+				Held:    decimal.NewFromFloat(60),
+			},
+			amount:  decimal.NewFromFloat(40),
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -50,3 +71,141 @@ func TestWallet_CheckBalance(t *testing.T) {
 		})
 	}
 }
+
+func TestWallet_Available(t *testing.T) {
+	w := &Wallet{Balance: decimal.NewFromFloat(100), Held: decimal.NewFromFloat(30.5)}
+	if got := w.Available(); !got.Equal(decimal.NewFromFloat(69.5)) {
+		t.Errorf("Available() = %v, want %v", got, 69.5)
+	}
+}
+
+func TestWallet_CheckAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		amount   decimal.Decimal
+		wantErr  error
+	}{
+		{name: "valid USD", currency: "USD", amount: decimal.NewFromFloat(10.25)},
+		{name: "too precise USD", currency: "USD", amount: decimal.NewFromFloat(10.255), wantErr: errors.InvalidAmountPrecision},
+		{name: "valid JPY", currency: "JPY", amount: decimal.NewFromInt(100)},
+		{name: "too precise JPY", currency: "JPY", amount: decimal.NewFromFloat(100.5), wantErr: errors.InvalidAmountPrecision},
+		{name: "unknown currency", currency: "XXX", amount: decimal.NewFromInt(1), wantErr: errors.UnsupportedCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Wallet{ID: 1, Currency: tt.currency}
+			err := w.CheckAmount(tt.amount)
+			if (err != nil) != (tt.wantErr != nil) || (err != nil && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("CheckAmount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWallet_CheckActive(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  Status
+		wantErr error
+	}{
+		{name: "active", status: StatusActive},
+		{name: "frozen", status: StatusFrozen, wantErr: errors.WalletFrozen},
+		{name: "closed", status: StatusClosed, wantErr: errors.WalletClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Wallet{ID: 1, Status: tt.status}
+			if err := w.CheckActive(); err != tt.wantErr {
+				t.Errorf("CheckActive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWallet_CheckTenant(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		wantErr error
+	}{
+		{name: "same tenant", from: "acme", to: "acme"},
+		{name: "without tenant is default", from: "", to: "default"},
+		{name: "other tenant", from: "acme", to: "globex", wantErr: errors.CrossTenantTransfer},
+		{name: "other tenant than default", from: "", to: "acme", wantErr: errors.CrossTenantTransfer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := &Wallet{ID: 1, TenantID: tt.from}, &Wallet{ID: 2, TenantID: tt.to}
+			if err := from.CheckTenant(to); err != tt.wantErr {
+				t.Errorf("CheckTenant() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWallet_CheckTransition(t *testing.T) {
+	tests := []struct {
+		name    string
+		wallet  *Wallet
+		to      Status
+		wantErr error
+	}{
+		{
+			name:   "freeze active",
+			wallet: &Wallet{Status: StatusActive},
+			to:     StatusFrozen,
+		},
+		{
+			name:    "freeze frozen",
+			wallet:  &Wallet{Status: StatusFrozen},
+			to:      StatusFrozen,
+			wantErr: errors.InvalidWalletStatus,
+		},
+		{
+			name:   "unfreeze frozen",
+			wallet: &Wallet{Status: StatusFrozen},
+			to:     StatusActive,
+		},
+		{
+			name:    "unfreeze active",
+			wallet:  &Wallet{Status: StatusActive},
+			to:      StatusActive,
+			wantErr: errors.InvalidWalletStatus,
+		},
+		{
+			name:   "close active with zero balance",
+			wallet: &Wallet{Status: StatusActive, Balance: decimal.Zero},
+			to:     StatusClosed,
+		},
+		{
+			name:   "close frozen with zero balance",
+			wallet: &Wallet{Status: StatusFrozen, Balance: decimal.Zero},
+			to:     StatusClosed,
+		},
+		{
+			name:    "close with balance",
+			wallet:  &Wallet{Status: StatusActive, Balance: decimal.NewFromFloat(0.01)},
+			to:      StatusClosed,
+			wantErr: errors.WalletNotEmpty,
+		},
+		{
+			name:    "reopen closed",
+			wallet:  &Wallet{Status: StatusClosed},
+			to:      StatusActive,
+			wantErr: errors.WalletClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.wallet.CheckTransition(tt.to); err != tt.wantErr {
+				t.Errorf("CheckTransition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"context"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
+	"time"
+)
+
+type MockRepository struct {
+	subscriptions []Subscription
+	deliveries    []Delivery
+}
+
+func NewMockRepository() *MockRepository {
+	return &MockRepository{
+		subscriptions: make([]Subscription, 0),
+		deliveries:    make([]Delivery, 0),
+	}
+}
+
+func (m *MockRepository) Create(ctx context.Context, s *Subscription) error {
+	s.ID = uint(len(m.subscriptions) + 1)
+	m.subscriptions = append(m.subscriptions, *s)
+	return nil
+}
+
+func (m *MockRepository) Get(ctx context.Context, id uint) (*Subscription, error) {
+	if id == 0 || id > uint(len(m.subscriptions)) {
+		return nil, errors.WebhookNotFound.WithCause(errors.RecordNotFound)
+	}
+	s := m.subscriptions[id-1]
+	if scope, ok := tenant.FromContext(ctx); ok && s.TenantID != scope {
+		return nil, errors.WebhookNotFound.WithCause(errors.RecordNotFound)
+	}
+	return &s, nil
+}
+
+func (m *MockRepository) ListByTenant(ctx context.Context, tenantID string) ([]Subscription, error) {
+	result := make([]Subscription, 0)
+	for _, s := range m.subscriptions {
+		if s.TenantID == tenantID {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockRepository) CreateDelivery(ctx context.Context, d *Delivery) error {
+	for _, existing := range m.deliveries {
+		if existing.SubscriptionID == d.SubscriptionID && existing.EventID == d.EventID {
+			d.ID = existing.ID
+			return nil
+		}
+	}
+	d.ID = uint(len(m.deliveries) + 1)
+	m.deliveries = append(m.deliveries, *d)
+	return nil
+}
+
+func (m *MockRepository) ListDeliveries(ctx context.Context, subscriptionID uint, limit int) ([]Delivery, error) {
+	result := make([]Delivery, 0)
+	for i := len(m.deliveries) - 1; i >= 0 && len(result) < limit; i-- {
+		if m.deliveries[i].SubscriptionID == subscriptionID {
+			result = append(result, m.deliveries[i])
+		}
+	}
+	return result, nil
+}
+
+func (m *MockRepository) ClaimDeliveries(ctx context.Context, at, until time.Time, limit int) ([]Delivery, error) {
+	result := make([]Delivery, 0)
+	for i := range m.deliveries {
+		if len(result) == limit {
+			break
+		}
+		d := &m.deliveries[i]
+		if d.Status == DeliveryPending && !d.NextAttemptAt.After(at) {
+			d.Attempts++
+			d.NextAttemptAt = until
+			result = append(result, *d)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockRepository) UpdateDelivery(ctx context.Context, d *Delivery) error {
+	if d.ID == 0 || d.ID > uint(len(m.deliveries)) {
+		return errors.RecordNotFound
+	}
+	if stored := m.deliveries[d.ID-1]; stored.Status != DeliveryPending || stored.Attempts != d.Attempts {
+		return errors.RecordNotFound
+	}
+	m.deliveries[d.ID-1] = *d
+	return nil
+}
+
+// Deliveries returns all the deliveries in order.
+func (m *MockRepository) Deliveries() []Delivery {
+	return m.deliveries
+}
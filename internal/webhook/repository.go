@@ -0,0 +1,28 @@
+package webhook
+
+import (
+	"context"
+	"time"
+)
+
+// Repository defines the repository for subscriptions and their deliveries.
+type Repository interface {
+	// Create stores the subscription and sets its id.
+	Create(ctx context.Context, s *Subscription) error
+	// Get gets the subscription by id in the tenant of ctx, returns errors.WebhookNotFound if it doesn't exist.
+	Get(ctx context.Context, id uint) (*Subscription, error)
+	// ListByTenant lists the subscriptions of the tenant.
+	ListByTenant(ctx context.Context, tenantID string) ([]Subscription, error)
+
+	// CreateDelivery stores the delivery and sets its id, unless the event already has one for the subscription.
+	CreateDelivery(ctx context.Context, d *Delivery) error
+	// ListDeliveries lists up to limit deliveries of the subscription, newest first.
+	ListDeliveries(ctx context.Context, subscriptionID uint, limit int) ([]Delivery, error)
+	// ClaimDeliveries claims up to limit pending deliveries whose next attempt is due at the given time, oldest first.
+	// The claim counts an attempt and defers the next one until the given time, so no other instance claims
+	// the deliveries before their outcome is recorded or the claim times out.
+	ClaimDeliveries(ctx context.Context, at, until time.Time, limit int) ([]Delivery, error)
+	// UpdateDelivery stores the outcome of the claimed attempt of the delivery.
+	// Returns errors.RecordNotFound if the delivery isn't pending or was claimed again since.
+	UpdateDelivery(ctx context.Context, d *Delivery) error
+}
@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	signedAt := time.Unix(1700000000, 0)
+	signature := Sign("secret", signedAt, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		body      []byte
+		now       time.Time
+		wantErr   bool
+	}{
+		{name: "valid", secret: "secret", signature: signature, body: body, now: signedAt.Add(time.Minute)},
+		{name: "wrong secret", secret: "other", signature: signature, body: body, now: signedAt, wantErr: true},
+		{name: "tampered body", secret: "secret", signature: signature, body: []byte(`{"id":2}`), now: signedAt, wantErr: true},
+		{name: "too old", secret: "secret", signature: signature, body: body, now: signedAt.Add(10 * time.Minute), wantErr: true},
+		{name: "malformed", secret: "secret", signature: "v1=abc", body: body, now: signedAt, wantErr: true},
+		{name: "not hex", secret: "secret", signature: "t=1700000000,v1=xyz", body: body, now: signedAt, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.signature, tt.body, 5*time.Minute, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
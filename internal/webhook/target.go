@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// nonPublicPrefixes are the ranges not covered by netip.Addr methods that can't be reached from the internet
+var nonPublicPrefixes = []netip.Prefix{
+	// "this network"
+	netip.MustParsePrefix("0.0.0.0/8"),
+	// shared address space of carrier-grade NATs
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// publicAddr reports whether the address is a public unicast address,
+// loopback, link-local, private and multicast addresses aren't.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicHost reports whether the host of a subscription URL may be public,
+// its name is only resolved, and the address checked, when a delivery connects to it.
+func publicHost(host string) bool {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return publicAddr(addr)
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return host != "localhost" && !strings.HasSuffix(host, ".localhost")
+}
+
+// NewHTTPClient returns a client posting the deliveries with the timeout, which only connects to public addresses,
+// so a subscription can't make the server reach the hosts of its own network, by its name or by a redirect.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// the address is resolved when it is dialed
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(addr.Addr()) {
+				return fmt.Errorf("%s is not a public address", addr.Addr())
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// no proxy, the dialer checks the address of the endpoint itself
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
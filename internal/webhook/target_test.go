@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublicHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "example.com", want: true},
+		{host: "93.184.216.34", want: true},
+		{host: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{host: "localhost", want: false},
+		{host: "api.localhost.", want: false},
+		{host: "127.0.0.1", want: false},
+		{host: "::1", want: false},
+		{host: "::ffff:127.0.0.1", want: false},
+		{host: "169.254.169.254", want: false},
+		{host: "fe80::1", want: false},
+		{host: "10.1.2.3", want: false},
+		{host: "172.16.0.1", want: false},
+		{host: "192.168.1.1", want: false},
+		{host: "fd00::1", want: false},
+		{host: "100.64.0.1", want: false},
+		{host: "0.0.0.0", want: false},
+		{host: "224.0.0.1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := publicHost(tt.host); got != tt.want {
+				t.Errorf("publicHost(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// the endpoint listens on a loopback address
+	_, err := NewHTTPClient(time.Second).Post(server.URL, "application/json", nil)
+	if err == nil || !strings.Contains(err.Error(), "is not a public address") {
+		t.Errorf("Post() to a loopback address error = %v, want it refused", err)
+	}
+}
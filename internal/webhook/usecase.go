@@ -0,0 +1,331 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/log"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
+	"github.com/guoxiaopeng875/wallet/internal/wallet"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Defaults of the retry policy and the requests.
+const (
+	DefaultMaxAttempts    = 10
+	DefaultInitialBackoff = 10 * time.Second
+	DefaultMaxBackoff     = time.Hour
+	// DefaultTimeout bounds an attempt when no client is configured
+	DefaultTimeout = 10 * time.Second
+	// DefaultClaimTimeout is how long claimed deliveries are reserved to an instance when no timeout is configured
+	DefaultClaimTimeout = 5 * time.Minute
+)
+
+const (
+	// deliverBatch is how many due deliveries Deliver attempts at most
+	deliverBatch = 100
+	// claimBatch is how many deliveries are claimed at a time, their attempts must end before the claim times out
+	claimBatch = 10
+	// deliveriesLimit is how many deliveries of a subscription are listed
+	deliveriesLimit = 100
+	// minSecretLength is the shortest secret a subscription may be given
+	minSecretLength = 16
+)
+
+// UseCase defines use cases for the webhooks.
+type UseCase interface {
+	// Publish queues a delivery of the event to every matching subscription of its tenant,
+	// the use case is the publisher of the outbox relay.
+	outbox.Publisher
+	// CreateSubscription validates and stores the subscription, owned by the principal of ctx in its tenant.
+	// A secret is generated unless one is given, the subscription only carries it on creation.
+	// Principals but admins must filter the wallets, and may only subscribe to wallets they may read.
+	CreateSubscription(ctx context.Context, s *Subscription) error
+	// Subscription gets a subscription, only its owner and admins may see it.
+	Subscription(ctx context.Context, id uint) (*Subscription, error)
+	// Deliveries lists the latest deliveries of a subscription, newest first.
+	Deliveries(ctx context.Context, subscriptionID uint) ([]Delivery, error)
+	// Deliver claims the deliveries due at the given time and attempts them outside any transaction.
+	// A failed attempt is retried after a backoff, until the delivery is dead after the maximum attempts.
+	// Returns the number of deliveries accepted by their endpoint.
+	Deliver(ctx context.Context, at time.Time) (int, error)
+}
+
+// WalletReader reads the wallets a subscription filters, wallet.UseCase checks the principal may read them.
+type WalletReader interface {
+	Wallet(ctx context.Context, walletID uint) (*wallet.Wallet, error)
+}
+
+// RetryPolicy schedules the attempts of a delivery, as the outbox schedules those of its events.
+type RetryPolicy = outbox.RetryPolicy
+
+// Option configures the use case.
+type Option func(*useCase)
+
+// WithRetryPolicy sets the retry policy, zero fields keep their default.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(u *useCase) {
+		if p.MaxAttempts > 0 {
+			u.retry.MaxAttempts = p.MaxAttempts
+		}
+		if p.InitialBackoff > 0 {
+			u.retry.InitialBackoff = p.InitialBackoff
+		}
+		if p.MaxBackoff > 0 {
+			u.retry.MaxBackoff = p.MaxBackoff
+		}
+	}
+}
+
+// WithClaimTimeout sets how long claimed deliveries are reserved to the instance, DefaultClaimTimeout by default.
+// Deliveries still pending after it, because the instance stopped, are claimed again.
+func WithClaimTimeout(d time.Duration) Option {
+	return func(u *useCase) {
+		if d > 0 {
+			u.claimTimeout = d
+		}
+	}
+}
+
+// WithPrivateHosts lets the subscriptions target loopback and private hosts, for development only.
+// The client of WithHTTPClient must then be able to connect to them.
+func WithPrivateHosts() Option {
+	return func(u *useCase) {
+		u.privateHosts = true
+	}
+}
+
+// WithHTTPClient sets the client posting the deliveries, NewHTTPClient by default.
+func WithHTTPClient(client *http.Client) Option {
+	return func(u *useCase) {
+		u.client = client
+	}
+}
+
+// useCase implements UseCase.
+type useCase struct {
+	repo         Repository
+	wallets      WalletReader
+	client       *http.Client
+	retry        RetryPolicy
+	claimTimeout time.Duration
+	privateHosts bool
+}
+
+func NewUseCase(repo Repository, wallets WalletReader, opts ...Option) UseCase {
+	u := &useCase{
+		repo:    repo,
+		wallets: wallets,
+		client:  NewHTTPClient(DefaultTimeout),
+		retry: RetryPolicy{
+			MaxAttempts:    DefaultMaxAttempts,
+			InitialBackoff: DefaultInitialBackoff,
+			MaxBackoff:     DefaultMaxBackoff,
+		},
+		claimTimeout: DefaultClaimTimeout,
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+func (u *useCase) CreateSubscription(ctx context.Context, s *Subscription) error {
+	p, authenticated := auth.FromContext(ctx)
+	if err := validate(s, authenticated && !p.IsAdmin(), u.privateHosts); err != nil {
+		return err
+	}
+	for _, id := range s.WalletIDs {
+		if _, err := u.wallets.Wallet(ctx, id); err != nil {
+			return err
+		}
+	}
+	if s.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return err
+		}
+		s.Secret = secret
+	}
+	// no filter is an empty list, not null
+	if s.EventTypes == nil {
+		s.EventTypes = []outbox.Type{}
+	}
+	if s.WalletIDs == nil {
+		s.WalletIDs = []uint{}
+	}
+	if authenticated {
+		s.OwnerID = p.KeyID
+	}
+	s.TenantID = tenant.OrDefault(ctx)
+	s.CreatedAt = time.Now()
+	return u.repo.Create(ctx, s)
+}
+
+// validate checks the fields of a new subscription, wallets must be filtered if requireWallets,
+// and the URL must target a public host unless privateHosts.
+func validate(s *Subscription, requireWallets, privateHosts bool) error {
+	fields := make(map[string]string)
+	if target, err := url.Parse(s.URL); err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		fields["url"] = "must be an absolute http or https URL"
+	} else if !privateHosts && !publicHost(target.Hostname()) {
+		fields["url"] = "must target a public host"
+	}
+	for i, t := range s.EventTypes {
+		if !slices.Contains(wallet.EventTypes, t) {
+			fields[fmt.Sprintf("event_types[%d]", i)] = fmt.Sprintf("unknown event type %q", t)
+		}
+	}
+	if requireWallets && len(s.WalletIDs) == 0 {
+		fields["wallet_ids"] = "is required"
+	}
+	if s.Secret != "" && len(s.Secret) < minSecretLength {
+		fields["secret"] = fmt.Sprintf("must have a length of at least %d", minSecretLength)
+	}
+	if len(fields) > 0 {
+		return errors.InvalidArgs.WithMetadata(fields)
+	}
+	return nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+func (u *useCase) Subscription(ctx context.Context, id uint) (*Subscription, error) {
+	s, err := u.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// a context without principal comes from the service itself
+	if p, ok := auth.FromContext(ctx); ok && !p.IsAdmin() && s.OwnerID != p.KeyID {
+		return nil, errors.Forbidden.WithCause(fmt.Errorf("%s may not read webhook %d", p.KeyID, id))
+	}
+	return s, nil
+}
+
+func (u *useCase) Deliveries(ctx context.Context, subscriptionID uint) ([]Delivery, error) {
+	if _, err := u.Subscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+	return u.repo.ListDeliveries(ctx, subscriptionID, deliveriesLimit)
+}
+
+func (u *useCase) Publish(ctx context.Context, event *outbox.Event) error {
+	subscriptions, err := u.repo.ListByTenant(ctx, event.TenantID)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range subscriptions {
+		if !subscriptions[i].Matches(event) {
+			continue
+		}
+		err := u.repo.CreateDelivery(ctx, &Delivery{
+			SubscriptionID: subscriptions[i].ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         DeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *useCase) Deliver(ctx context.Context, at time.Time) (int, error) {
+	delivered := 0
+	// the claims are short and the posts hold no connection, so a slow endpoint doesn't starve the pool
+	for attempted := 0; attempted < deliverBatch && ctx.Err() == nil; {
+		claimed, err := u.repo.ClaimDeliveries(ctx, at, at.Add(u.claimTimeout), min(claimBatch, deliverBatch-attempted))
+		if err != nil || len(claimed) == 0 {
+			return delivered, err
+		}
+		attempted += len(claimed)
+		for i := range claimed {
+			d := &claimed[i]
+			s, err := u.repo.Get(ctx, d.SubscriptionID)
+			if err != nil {
+				return delivered, err
+			}
+			u.attempt(ctx, s, d, at)
+			err = u.repo.UpdateDelivery(ctx, d)
+			if errors.Is(err, errors.RecordNotFound) {
+				// the claim timed out and another instance attempted it
+				continue
+			}
+			if err != nil {
+				return delivered, err
+			}
+			if d.Status == DeliveryDelivered {
+				delivered++
+			}
+		}
+	}
+	return delivered, ctx.Err()
+}
+
+// attempt posts the claimed delivery and records the outcome in it, the claim counted the attempt.
+func (u *useCase) attempt(ctx context.Context, s *Subscription, d *Delivery, at time.Time) {
+	status, err := u.post(ctx, s, d)
+	d.LastAttemptAt = &at
+	d.ResponseStatus = status
+	if err == nil {
+		d.Status, d.DeliveredAt, d.LastError = DeliveryDelivered, &at, ""
+		return
+	}
+	d.LastError = err.Error()
+	if d.Attempts >= u.retry.MaxAttempts {
+		log.FromContext(ctx).Warnf("webhook delivery %d of event %d to subscription %d is dead after %d attempts: %v",
+			d.ID, d.EventID, s.ID, d.Attempts, err)
+		d.Status = DeliveryDead
+		return
+	}
+	d.NextAttemptAt = at.Add(u.retry.Backoff(d.Attempts))
+}
+
+// post sends the delivery to the subscription and returns the response status, any but a 2xx is an error.
+func (u *useCase) post(ctx context.Context, s *Subscription, d *Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set("X-Event-ID", strconv.FormatUint(uint64(d.EventID), 10))
+	req.Header.Set("X-Event-Type", string(d.EventType))
+	req.Header.Set(SignatureHeader, Sign(s.Secret, time.Now(), d.Payload))
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,416 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"github.com/guoxiaopeng875/wallet/internal/auth"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/errors"
+	"github.com/guoxiaopeng875/wallet/internal/pkg/tenant"
+	"github.com/guoxiaopeng875/wallet/internal/wallet"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockWallets lets the principals read the wallets they own
+type mockWallets map[uint]*wallet.Wallet
+
+func (m mockWallets) Wallet(ctx context.Context, walletID uint) (*wallet.Wallet, error) {
+	w, ok := m[walletID]
+	if !ok {
+		return nil, errors.WalletNotFound
+	}
+	if p, ok := auth.FromContext(ctx); ok && !p.IsAdmin() && w.OwnerID != p.KeyID {
+		return nil, errors.Forbidden
+	}
+	return w, nil
+}
+
+// receiver is an endpoint answering the deliveries with the statuses in order, then 200
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+var (
+	owner  = &auth.Principal{KeyID: "owner", Role: auth.RoleClient, TenantID: tenant.Default}
+	other  = &auth.Principal{KeyID: "other", Role: auth.RoleClient, TenantID: tenant.Default}
+	admin  = &auth.Principal{KeyID: "admin", Role: auth.RoleAdmin, TenantID: tenant.Default}
+	secret = "0123456789abcdef"
+)
+
+func setupTest(opts ...Option) (UseCase, *MockRepository) {
+	repo := NewMockRepository()
+	wallets := mockWallets{
+		1: {ID: 1, OwnerID: "owner", TenantID: tenant.Default},
+		2: {ID: 2, OwnerID: "other", TenantID: tenant.Default},
+	}
+	return NewUseCase(repo, wallets, opts...), repo
+}
+
+func principalContext(p *auth.Principal) context.Context {
+	return tenant.NewContext(auth.NewContext(context.Background(), p), p.TenantID)
+}
+
+func TestUseCase_CreateSubscription(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  *auth.Principal
+		sub        Subscription
+		wantErr    error
+		wantFields []string
+	}{
+		{
+			name:      "owned wallet",
+			principal: owner,
+			sub:       Subscription{URL: "https://example.com/hook", EventTypes: []outbox.Type{wallet.EventWalletCredited}, WalletIDs: []uint{1}},
+		},
+		{
+			name:      "admin without filter",
+			principal: admin,
+			sub:       Subscription{URL: "http://hooks.example.com:8080/hook", Secret: secret},
+		},
+		{
+			name:      "wallet of another owner",
+			principal: owner,
+			sub:       Subscription{URL: "https://example.com/hook", WalletIDs: []uint{2}},
+			wantErr:   errors.Forbidden,
+		},
+		{
+			name:      "unknown wallet",
+			principal: owner,
+			sub:       Subscription{URL: "https://example.com/hook", WalletIDs: []uint{9}},
+			wantErr:   errors.WalletNotFound,
+		},
+		{
+			name:       "client without filter",
+			principal:  owner,
+			sub:        Subscription{URL: "https://example.com/hook"},
+			wantErr:    errors.InvalidArgs,
+			wantFields: []string{"wallet_ids"},
+		},
+		{
+			name:       "loopback host",
+			principal:  admin,
+			sub:        Subscription{URL: "http://localhost:8080/hook"},
+			wantErr:    errors.InvalidArgs,
+			wantFields: []string{"url"},
+		},
+		{
+			name:       "metadata endpoint",
+			principal:  owner,
+			sub:        Subscription{URL: "http://169.254.169.254/latest/meta-data", WalletIDs: []uint{1}},
+			wantErr:    errors.InvalidArgs,
+			wantFields: []string{"url"},
+		},
+		{
+			name:       "private host",
+			principal:  owner,
+			sub:        Subscription{URL: "https://10.0.0.7/hook", WalletIDs: []uint{1}},
+			wantErr:    errors.InvalidArgs,
+			wantFields: []string{"url"},
+		},
+		{
+			name:       "invalid fields",
+			principal:  admin,
+			sub:        Subscription{URL: "ftp://example.com", EventTypes: []outbox.Type{"wallet.exploded"}, Secret: "short"},
+			wantErr:    errors.InvalidArgs,
+			wantFields: []string{"url", "event_types[0]", "secret"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc, repo := setupTest()
+			sub := tt.sub
+			err := uc.CreateSubscription(principalContext(tt.principal), &sub)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("CreateSubscription() error = %v, want %v", err, tt.wantErr)
+				}
+				var e *errors.Error
+				errors.As(err, &e)
+				for _, f := range tt.wantFields {
+					if _, ok := e.Metadata[f]; !ok {
+						t.Errorf("CreateSubscription() metadata = %v, want field %s", e.Metadata, f)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateSubscription() error = %v", err)
+			}
+			stored, err := repo.Get(context.Background(), sub.ID)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if stored.OwnerID != tt.principal.KeyID || stored.TenantID != tt.principal.TenantID {
+				t.Errorf("stored owner %q tenant %q, want %q %q", stored.OwnerID, stored.TenantID, tt.principal.KeyID, tt.principal.TenantID)
+			}
+			if tt.sub.Secret != "" && stored.Secret != tt.sub.Secret {
+				t.Errorf("stored secret %q, want %q", stored.Secret, tt.sub.Secret)
+			}
+			if tt.sub.Secret == "" && !strings.HasPrefix(stored.Secret, "whsec_") {
+				t.Errorf("generated secret %q, want a whsec_ prefix", stored.Secret)
+			}
+		})
+	}
+}
+
+func TestUseCase_Subscription(t *testing.T) {
+	uc, _ := setupTest()
+	sub := &Subscription{URL: "https://example.com/hook", WalletIDs: []uint{1}}
+	if err := uc.CreateSubscription(principalContext(owner), sub); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		id      uint
+		wantErr error
+	}{
+		{name: "owner", ctx: principalContext(owner), id: sub.ID},
+		{name: "admin", ctx: principalContext(admin), id: sub.ID},
+		{name: "service", ctx: context.Background(), id: sub.ID},
+		{name: "other client", ctx: principalContext(other), id: sub.ID, wantErr: errors.Forbidden},
+		{name: "other tenant", ctx: principalContext(&auth.Principal{KeyID: "owner", TenantID: "acme"}), id: sub.ID, wantErr: errors.WebhookNotFound},
+		{name: "unknown", ctx: principalContext(admin), id: 9, wantErr: errors.WebhookNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := uc.Subscription(tt.ctx, tt.id)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Subscription() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Subscription() error = %v, want %v", err, tt.wantErr)
+			}
+			_, err = uc.Deliveries(tt.ctx, tt.id)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Deliveries() error = %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Deliveries() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUseCase_Publish(t *testing.T) {
+	uc, repo := setupTest()
+	subs := []*Subscription{
+		{URL: "https://example.com/all"},
+		{URL: "https://example.com/debits", EventTypes: []outbox.Type{wallet.EventWalletDebited}},
+		{URL: "https://example.com/wallet-2", WalletIDs: []uint{2}},
+	}
+	for _, s := range subs {
+		if err := uc.CreateSubscription(principalContext(admin), s); err != nil {
+			t.Fatalf("CreateSubscription() error = %v", err)
+		}
+	}
+	// subscriptions of another tenant never see the events
+	if err := uc.CreateSubscription(principalContext(&auth.Principal{KeyID: "acme", Role: auth.RoleAdmin, TenantID: "acme"}),
+		&Subscription{URL: "https://example.com/acme"}); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+
+	events := []*outbox.Event{
+		{ID: 1, Type: wallet.EventWalletCredited, WalletID: 1, TenantID: tenant.Default},
+		{ID: 2, Type: wallet.EventWalletDebited, WalletID: 2, TenantID: tenant.Default},
+	}
+	for _, e := range events {
+		// publishing twice, as the relay does after a crash, delivers once
+		for i := 0; i < 2; i++ {
+			if err := uc.Publish(context.Background(), e); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+		}
+	}
+
+	var got []string
+	for _, d := range repo.Deliveries() {
+		got = append(got, fmt.Sprintf("%d:%d", d.SubscriptionID, d.EventID))
+		if d.Status != DeliveryPending {
+			t.Errorf("delivery %d status = %s, want pending", d.ID, d.Status)
+		}
+	}
+	want := "1:1 1:2 2:2 3:2"
+	if strings.Join(got, " ") != want {
+		t.Errorf("deliveries = %v, want %s", got, want)
+	}
+}
+
+func TestUseCase_Deliver(t *testing.T) {
+	rcv := &receiver{}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+
+	uc, repo := setupTest(WithPrivateHosts(), WithHTTPClient(server.Client()))
+	sub := &Subscription{URL: server.URL, Secret: secret}
+	if err := uc.CreateSubscription(principalContext(admin), sub); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+	event := &outbox.Event{ID: 5, Type: wallet.EventWalletCredited, WalletID: 1, TenantID: tenant.Default}
+	if err := uc.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	now := time.Now()
+	delivered, err := uc.Deliver(context.Background(), now)
+	if err != nil || delivered != 1 {
+		t.Fatalf("Deliver() = %d, %v, want 1", delivered, err)
+	}
+
+	if len(rcv.requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(rcv.requests))
+	}
+	req := rcv.requests[0]
+	if err := Verify(secret, req.Header.Get(SignatureHeader), rcv.bodies[0], time.Minute, time.Now()); err != nil {
+		t.Errorf("signature of the delivery: %v", err)
+	}
+	if req.Header.Get("X-Event-ID") != "5" || req.Header.Get("X-Event-Type") != string(wallet.EventWalletCredited) {
+		t.Errorf("event headers = %v", req.Header)
+	}
+	d := repo.Deliveries()[0]
+	if d.Status != DeliveryDelivered || d.Attempts != 1 || d.ResponseStatus != http.StatusOK || d.DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want delivered at the first attempt", d)
+	}
+
+	// nothing is due anymore
+	if delivered, err := uc.Deliver(context.Background(), now.Add(time.Hour)); err != nil || delivered != 0 || len(rcv.requests) != 1 {
+		t.Errorf("Deliver() = %d, %v after delivery, %d requests", delivered, err, len(rcv.requests))
+	}
+}
+
+func TestUseCase_DeliverRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		wantStatus DeliveryStatus
+		wantTries  int
+	}{
+		{
+			name:       "delivered after failures",
+			statuses:   []int{http.StatusInternalServerError, http.StatusBadGateway},
+			wantStatus: DeliveryDelivered,
+			wantTries:  3,
+		},
+		{
+			name:       "dead after max attempts",
+			statuses:   []int{500, 500, 500, 500, 500},
+			wantStatus: DeliveryDead,
+			wantTries:  3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcv := &receiver{statuses: tt.statuses}
+			server := httptest.NewServer(rcv)
+			defer server.Close()
+
+			policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+			uc, repo := setupTest(WithPrivateHosts(), WithHTTPClient(server.Client()), WithRetryPolicy(policy))
+			if err := uc.CreateSubscription(principalContext(admin), &Subscription{URL: server.URL}); err != nil {
+				t.Fatalf("CreateSubscription() error = %v", err)
+			}
+			event := &outbox.Event{ID: 1, Type: wallet.EventWalletCredited, WalletID: 1, TenantID: tenant.Default}
+			if err := uc.Publish(context.Background(), event); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+
+			at := time.Now()
+			for attempt := 1; attempt <= 5; attempt++ {
+				if _, err := uc.Deliver(context.Background(), at); err != nil {
+					t.Fatalf("Deliver() error = %v", err)
+				}
+				d := repo.Deliveries()[0]
+				if d.Status != DeliveryPending {
+					break
+				}
+				// the next attempt waits for the backoff
+				wantNext := at.Add(policy.Backoff(d.Attempts))
+				if !d.NextAttemptAt.Equal(wantNext) {
+					t.Errorf("attempt %d: next attempt at %v, want %v", attempt, d.NextAttemptAt, wantNext)
+				}
+				if _, err := uc.Deliver(context.Background(), wantNext.Add(-time.Second)); err != nil {
+					t.Fatalf("Deliver() error = %v", err)
+				}
+				if got := repo.Deliveries()[0].Attempts; got != d.Attempts {
+					t.Fatalf("attempt %d: delivery attempted before its backoff", attempt)
+				}
+				at = wantNext
+			}
+
+			d := repo.Deliveries()[0]
+			if d.Status != tt.wantStatus || d.Attempts != tt.wantTries || len(rcv.requests) != tt.wantTries {
+				t.Errorf("delivery status %s after %d attempts and %d requests, want %s after %d",
+					d.Status, d.Attempts, len(rcv.requests), tt.wantStatus, tt.wantTries)
+			}
+			if tt.wantStatus == DeliveryDead && (d.ResponseStatus != http.StatusInternalServerError || d.LastError == "") {
+				t.Errorf("dead delivery = %+v, want the last failure recorded", d)
+			}
+		})
+	}
+}
+
+func TestUseCase_DeliverClaimed(t *testing.T) {
+	rcv := &receiver{}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+
+	uc, repo := setupTest(WithPrivateHosts(), WithHTTPClient(server.Client()), WithClaimTimeout(time.Minute))
+	if err := uc.CreateSubscription(principalContext(admin), &Subscription{URL: server.URL}); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+	event := &outbox.Event{ID: 1, Type: wallet.EventWalletCredited, WalletID: 1, TenantID: tenant.Default}
+	if err := uc.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	// another instance claims the delivery and stops before recording its outcome
+	at := time.Now()
+	stale, err := repo.ClaimDeliveries(context.Background(), at, at.Add(time.Minute), 10)
+	if err != nil || len(stale) != 1 {
+		t.Fatalf("ClaimDeliveries() = %v, %v, want the delivery", stale, err)
+	}
+	if delivered, err := uc.Deliver(context.Background(), at); err != nil || delivered != 0 || len(rcv.requests) != 0 {
+		t.Fatalf("Deliver() = %d, %v with %d requests, want the claimed delivery skipped", delivered, err, len(rcv.requests))
+	}
+
+	// once the claim times out the delivery is attempted again
+	if delivered, err := uc.Deliver(context.Background(), at.Add(time.Minute)); err != nil || delivered != 1 {
+		t.Fatalf("Deliver() = %d, %v after the claim timed out, want 1", delivered, err)
+	}
+	d := repo.Deliveries()[0]
+	if d.Status != DeliveryDelivered || d.Attempts != 2 {
+		t.Errorf("delivery = %+v, want delivered at the second attempt", d)
+	}
+	// the outcome of the stale claim is refused
+	stale[0].Status, stale[0].LastError = DeliveryPending, "timeout"
+	if err := repo.UpdateDelivery(context.Background(), &stale[0]); !errors.Is(err, errors.RecordNotFound) {
+		t.Errorf("UpdateDelivery() of a stale claim error = %v, want %v", err, errors.RecordNotFound)
+	}
+}
@@ -0,0 +1,72 @@
+// Package webhook pushes the domain events of the wallets to the endpoints partners subscribe.
+//
+// The outbox relay publishes every event to the use case, which queues one delivery per matching subscription
+// in the relay transaction. Deliveries are then posted to the endpoints signed with the secret of their
+// subscription, see Sign, and retried with an exponential backoff until they succeed or are given up as dead.
+// Unlike the outbox, deliveries of a wallet may arrive out of order once one of them is retried.
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"slices"
+	"time"
+)
+
+// Subscription is an endpoint the matching events are delivered to.
+type Subscription struct {
+	ID  uint   `json:"id"`
+	URL string `json:"url"`
+	// EventTypes filters the events delivered, every event if empty
+	EventTypes []outbox.Type `json:"event_types"`
+	// WalletIDs filters the wallets whose events are delivered, every wallet of the tenant if empty
+	WalletIDs []uint `json:"wallet_ids"`
+	// Secret signs the deliveries, it is only shown when the subscription is created
+	Secret string `json:"-"`
+	// OwnerID is the key ID of the principal that created the subscription
+	OwnerID   string    `json:"owner_id"`
+	TenantID  string    `json:"tenant_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Matches reports whether the event is delivered to the subscription
+func (s *Subscription) Matches(event *outbox.Event) bool {
+	if event.TenantID != s.TenantID {
+		return false
+	}
+	if len(s.EventTypes) > 0 && !slices.Contains(s.EventTypes, event.Type) {
+		return false
+	}
+	return len(s.WalletIDs) == 0 || slices.Contains(s.WalletIDs, event.WalletID)
+}
+
+// DeliveryStatus is the state of a delivery
+type DeliveryStatus string
+
+const (
+	// DeliveryPending waits for its next attempt
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliveryDelivered was accepted by the endpoint
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDead failed too many times and is no longer attempted
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// Delivery is an event to post to a subscription and the outcome of its attempts.
+type Delivery struct {
+	ID             uint        `json:"id"`
+	SubscriptionID uint        `json:"subscription_id"`
+	EventID        uint        `json:"event_id"`
+	EventType      outbox.Type `json:"event_type"`
+	// Payload is the body posted, the outbox event as JSON
+	Payload       json.RawMessage `json:"payload"`
+	Status        DeliveryStatus  `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastAttemptAt *time.Time      `json:"last_attempt_at,omitempty"`
+	// ResponseStatus is the HTTP status of the last attempt, zero if the endpoint couldn't be reached
+	ResponseStatus int        `json:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
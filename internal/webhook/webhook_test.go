@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"github.com/guoxiaopeng875/wallet/internal/outbox"
+	"testing"
+)
+
+func TestSubscription_Matches(t *testing.T) {
+	event := &outbox.Event{ID: 1, Type: "wallet.credited", WalletID: 7, TenantID: "default"}
+
+	tests := []struct {
+		name string
+		sub  Subscription
+		want bool
+	}{
+		{name: "no filter", sub: Subscription{TenantID: "default"}, want: true},
+		{name: "other tenant", sub: Subscription{TenantID: "acme"}, want: false},
+		{name: "event type", sub: Subscription{TenantID: "default", EventTypes: []outbox.Type{"wallet.debited", "wallet.credited"}}, want: true},
+		{name: "other event type", sub: Subscription{TenantID: "default", EventTypes: []outbox.Type{"wallet.debited"}}, want: false},
+		{name: "wallet", sub: Subscription{TenantID: "default", WalletIDs: []uint{3, 7}}, want: true},
+		{name: "other wallet", sub: Subscription{TenantID: "default", WalletIDs: []uint{3}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sub.Matches(event); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, InitialBackoff: DefaultInitialBackoff, MaxBackoff: DefaultMaxBackoff}
+	tests := []struct {
+		failures int
+		want     string
+	}{
+		{failures: 1, want: "10s"},
+		{failures: 2, want: "20s"},
+		{failures: 3, want: "40s"},
+		{failures: 9, want: "42m40s"},
+		{failures: 10, want: "1h0m0s"},
+		{failures: 100, want: "1h0m0s"},
+	}
+	for _, tt := range tests {
+		if got := p.Backoff(tt.failures).String(); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+-- Drop wallets table
+DROP TABLE IF EXISTS wallets;
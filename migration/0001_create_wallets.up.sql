@@ -0,0 +1,21 @@
+-- Create wallets table
+CREATE TABLE IF NOT EXISTS wallets (
+    id SERIAL PRIMARY KEY,
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    balance DECIMAL(20,4) NOT NULL DEFAULT 0.0000 CONSTRAINT wallets_balance_check CHECK (balance >= 0),
+    held DECIMAL(20,4) NOT NULL DEFAULT 0.0000 CHECK (held >= 0 AND held <= balance),
+    status VARCHAR(10) NOT NULL DEFAULT 'active'
+);
+
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS status VARCHAR(10) NOT NULL DEFAULT 'active';
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS held DECIMAL(20,4) NOT NULL DEFAULT 0.0000 CHECK (held >= 0 AND held <= balance);
+
+-- Balances never go negative, whatever the application checks
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'wallets_balance_check') THEN
+        ALTER TABLE wallets ADD CONSTRAINT wallets_balance_check CHECK (balance >= 0);
+    END IF;
+END $$;
+
+ALTER TABLE IF EXISTS public.wallets OWNER to postgres;
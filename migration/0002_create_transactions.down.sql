@@ -0,0 +1,2 @@
+-- Drop transactions table
+DROP TABLE IF EXISTS transactions;
@@ -0,0 +1,33 @@
+-- Create transactions table
+CREATE TABLE IF NOT EXISTS transactions (
+    id SERIAL PRIMARY KEY,
+    method VARCHAR(10) NOT NULL,
+    tx_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    amount DECIMAL(20,4) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    to_amount DECIMAL(20,4),
+    to_currency CHAR(3),
+    rate DECIMAL(20,10) NOT NULL DEFAULT 1,
+    from_wallet_id INTEGER,
+    to_wallet_id INTEGER,
+    reversal_of INTEGER NOT NULL DEFAULT 0,
+    reversed_amount DECIMAL(20,4) NOT NULL DEFAULT 0.0000,
+    reason VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+ALTER TABLE transactions ALTER COLUMN amount TYPE DECIMAL(20,4);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS to_amount DECIMAL(20,4);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS to_currency CHAR(3);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS rate DECIMAL(20,10) NOT NULL DEFAULT 1;
+UPDATE transactions SET to_amount = amount, to_currency = currency WHERE to_amount IS NULL;
+ALTER TABLE transactions ALTER COLUMN to_amount SET NOT NULL;
+ALTER TABLE transactions ALTER COLUMN to_currency SET NOT NULL;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reversal_of INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reversed_amount DECIMAL(20,4) NOT NULL DEFAULT 0.0000;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reason VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS transactions_reversal_of_idx ON transactions (reversal_of) WHERE reversal_of <> 0;
+CREATE INDEX IF NOT EXISTS transactions_from_wallet_idx ON transactions (from_wallet_id, tx_at, id);
+CREATE INDEX IF NOT EXISTS transactions_to_wallet_idx ON transactions (to_wallet_id, tx_at, id);
+
+ALTER TABLE IF EXISTS public.transactions OWNER to postgres;
@@ -0,0 +1,3 @@
+-- Drop exchange rate and quote tables
+DROP TABLE IF EXISTS fx_quotes;
+DROP TABLE IF EXISTS fx_rates;
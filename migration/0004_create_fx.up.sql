@@ -0,0 +1,28 @@
+-- Create exchange rate and quote tables
+CREATE TABLE IF NOT EXISTS fx_rates (
+    id SERIAL PRIMARY KEY,
+    base CHAR(3) NOT NULL,
+    quote CHAR(3) NOT NULL,
+    rate DECIMAL(20,10) NOT NULL,
+    valid_from TIMESTAMP WITH TIME ZONE NOT NULL,
+    valid_to TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS fx_rates_pair_idx ON fx_rates (base, quote, valid_from);
+
+CREATE TABLE IF NOT EXISTS fx_quotes (
+    id VARCHAR(32) PRIMARY KEY,
+    from_wallet_id INTEGER NOT NULL,
+    to_wallet_id INTEGER NOT NULL,
+    from_currency CHAR(3) NOT NULL,
+    to_currency CHAR(3) NOT NULL,
+    amount DECIMAL(20,4) NOT NULL,
+    to_amount DECIMAL(20,4) NOT NULL,
+    rate DECIMAL(20,10) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE
+);
+
+ALTER TABLE IF EXISTS public.fx_rates OWNER to postgres;
+ALTER TABLE IF EXISTS public.fx_quotes OWNER to postgres;
@@ -0,0 +1,2 @@
+-- Drop holds table
+DROP TABLE IF EXISTS holds;
@@ -0,0 +1,17 @@
+-- Create holds table
+CREATE TABLE IF NOT EXISTS holds (
+    id SERIAL PRIMARY KEY,
+    wallet_id INTEGER NOT NULL REFERENCES wallets (id),
+    amount DECIMAL(20,4) NOT NULL,
+    captured_amount DECIMAL(20,4) NOT NULL DEFAULT 0.0000,
+    currency CHAR(3) NOT NULL,
+    status VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS holds_wallet_idx ON holds (wallet_id);
+CREATE INDEX IF NOT EXISTS holds_authorized_expiry_idx ON holds (expires_at) WHERE status = 'authorized';
+
+ALTER TABLE IF EXISTS public.holds OWNER to postgres;
@@ -0,0 +1,4 @@
+-- Drop the double-entry journal
+DROP TABLE IF EXISTS postings;
+DROP TABLE IF EXISTS journal_entries;
+DROP FUNCTION IF EXISTS check_entry_balanced();
@@ -0,0 +1,49 @@
+-- Create the double-entry journal, unbalanced entries are refused on commit
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id SERIAL PRIMARY KEY,
+    transaction_id INTEGER REFERENCES transactions (id),
+    description VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS journal_entries_transaction_idx ON journal_entries (transaction_id);
+CREATE TABLE IF NOT EXISTS postings (
+    id SERIAL PRIMARY KEY,
+    entry_id INTEGER NOT NULL REFERENCES journal_entries (id),
+    account VARCHAR(64) NOT NULL,
+    currency CHAR(3) NOT NULL,
+    amount DECIMAL(20,4) NOT NULL CHECK (amount <> 0)
+);
+CREATE INDEX IF NOT EXISTS postings_entry_idx ON postings (entry_id);
+CREATE INDEX IF NOT EXISTS postings_account_idx ON postings (account, currency);
+CREATE OR REPLACE FUNCTION check_entry_balanced() RETURNS trigger AS $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM postings WHERE entry_id = NEW.entry_id GROUP BY currency HAVING SUM(amount) <> 0) THEN
+        RAISE EXCEPTION 'journal entry % is unbalanced', NEW.entry_id USING ERRCODE = 'integrity_constraint_violation';
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS postings_balanced ON postings;
+CREATE CONSTRAINT TRIGGER postings_balanced AFTER INSERT OR UPDATE ON postings
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW EXECUTE FUNCTION check_entry_balanced();
+WITH entries AS (
+    INSERT INTO journal_entries (transaction_id, description, created_at)
+    SELECT t.id, t.method, t.tx_at FROM transactions t
+    WHERE NOT EXISTS (SELECT 1 FROM journal_entries e WHERE e.transaction_id = t.id)
+    RETURNING id, transaction_id
+)
+INSERT INTO postings (entry_id, account, currency, amount)
+SELECT e.id, CASE WHEN t.from_wallet_id > 0 THEN 'wallet:' || t.from_wallet_id ELSE 'system:deposits:' || t.currency END, t.currency, -t.amount
+FROM entries e JOIN transactions t ON t.id = e.transaction_id
+UNION ALL
+SELECT e.id, CASE WHEN t.to_wallet_id > 0 THEN 'wallet:' || t.to_wallet_id ELSE 'system:withdrawals:' || t.to_currency END, t.to_currency, t.to_amount
+FROM entries e JOIN transactions t ON t.id = e.transaction_id
+UNION ALL
+SELECT e.id, 'system:fx:' || t.currency, t.currency, t.amount
+FROM entries e JOIN transactions t ON t.id = e.transaction_id WHERE t.currency <> t.to_currency
+UNION ALL
+SELECT e.id, 'system:fx:' || t.to_currency, t.to_currency, -t.to_amount
+FROM entries e JOIN transactions t ON t.id = e.transaction_id WHERE t.currency <> t.to_currency;
+
+ALTER TABLE IF EXISTS public.journal_entries OWNER to postgres;
+ALTER TABLE IF EXISTS public.postings OWNER to postgres;
@@ -0,0 +1,22 @@
+-- Create api keys table, only the SHA-256 of the secrets is stored
+CREATE TABLE IF NOT EXISTS api_keys (
+    id VARCHAR(32) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    secret_hash CHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    rotated_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create api key nonces table, a signature nonce can only be used once per key
+CREATE TABLE IF NOT EXISTS api_key_nonces (
+    key_id VARCHAR(32) NOT NULL REFERENCES api_keys (id),
+    nonce VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (key_id, nonce)
+);
+
+CREATE INDEX IF NOT EXISTS api_key_nonces_used_idx ON api_key_nonces (key_id, used_at);
+
+ALTER TABLE IF EXISTS public.api_keys OWNER to postgres;
+ALTER TABLE IF EXISTS public.api_key_nonces OWNER to postgres;
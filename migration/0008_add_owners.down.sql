@@ -0,0 +1,4 @@
+-- Drop owners and roles
+ALTER TABLE api_keys DROP COLUMN IF EXISTS role;
+DROP INDEX IF EXISTS wallets_owner_idx;
+ALTER TABLE wallets DROP COLUMN IF EXISTS owner_id;
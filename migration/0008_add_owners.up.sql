@@ -0,0 +1,7 @@
+-- Wallets belong to the principal that created them, empty for wallets created before owners
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS owner_id VARCHAR(32) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS wallets_owner_idx ON wallets (owner_id);
+
+-- API keys are clients unless made admins
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS role VARCHAR(10) NOT NULL DEFAULT 'client';
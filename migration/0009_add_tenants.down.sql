@@ -0,0 +1,12 @@
+-- Drop tenants and their row level security
+DROP POLICY IF EXISTS transactions_tenant_isolation ON transactions;
+DROP POLICY IF EXISTS wallets_tenant_isolation ON wallets;
+ALTER TABLE transactions DISABLE ROW LEVEL SECURITY;
+ALTER TABLE wallets DISABLE ROW LEVEL SECURITY;
+
+DROP INDEX IF EXISTS transactions_tenant_idx;
+DROP INDEX IF EXISTS wallets_tenant_idx;
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE wallets DROP COLUMN IF EXISTS tenant_id;
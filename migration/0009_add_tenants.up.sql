@@ -0,0 +1,21 @@
+-- Wallets, their transactions and API keys belong to a tenant, rows created before tenants to the default one
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS wallets_tenant_idx ON wallets (tenant_id);
+CREATE INDEX IF NOT EXISTS transactions_tenant_idx ON transactions (tenant_id);
+
+-- Row level security scopes the rows to the app.tenant_id setting of the session, see the row_level_security
+-- setting of the repository. A session without the setting sees every tenant. The policies don't apply to
+-- the table owner, the application must connect with another role for them to be enforced.
+ALTER TABLE wallets ENABLE ROW LEVEL SECURITY;
+ALTER TABLE transactions ENABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS wallets_tenant_isolation ON wallets;
+CREATE POLICY wallets_tenant_isolation ON wallets
+    USING (coalesce(current_setting('app.tenant_id', true), '') IN ('', tenant_id));
+
+DROP POLICY IF EXISTS transactions_tenant_isolation ON transactions;
+CREATE POLICY transactions_tenant_isolation ON transactions
+    USING (coalesce(current_setting('app.tenant_id', true), '') IN ('', tenant_id));
@@ -0,0 +1,2 @@
+-- Drop outbox events table
+DROP TABLE IF EXISTS outbox_events;
@@ -0,0 +1,16 @@
+-- Create outbox events table, the domain events are written with the change they describe and relayed in id order
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id SERIAL PRIMARY KEY,
+    type VARCHAR(64) NOT NULL,
+    wallet_id INTEGER NOT NULL,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP WITH TIME ZONE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (id) WHERE published_at IS NULL;
+
+ALTER TABLE IF EXISTS public.outbox_events OWNER to postgres;
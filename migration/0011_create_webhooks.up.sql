@@ -0,0 +1,42 @@
+-- Create webhook subscriptions table, empty filters match every event type or wallet of the tenant
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id SERIAL PRIMARY KEY,
+    url VARCHAR(2048) NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    wallet_ids INTEGER[] NOT NULL DEFAULT '{}',
+    secret VARCHAR(255) NOT NULL,
+    owner_id VARCHAR(32) NOT NULL DEFAULT '',
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_subscriptions_tenant_idx ON webhook_subscriptions (tenant_id);
+
+ALTER TABLE webhook_subscriptions ENABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS webhook_subscriptions_tenant_isolation ON webhook_subscriptions;
+CREATE POLICY webhook_subscriptions_tenant_isolation ON webhook_subscriptions
+    USING (coalesce(current_setting('app.tenant_id', true), '') IN ('', tenant_id));
+
+-- Create webhook deliveries table, an event is delivered once to every matching subscription
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES webhook_subscriptions (id),
+    event_id INTEGER NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(10) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_attempt_at TIMESTAMP WITH TIME ZONE,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+ALTER TABLE IF EXISTS public.webhook_subscriptions OWNER to postgres;
+ALTER TABLE IF EXISTS public.webhook_deliveries OWNER to postgres;
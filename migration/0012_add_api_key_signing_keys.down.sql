@@ -0,0 +1,2 @@
+-- Drop the signing keys of the API keys
+ALTER TABLE api_keys DROP COLUMN IF EXISTS signing_key;
@@ -0,0 +1,3 @@
+-- The signing keys of the API keys, sealed with the encryption key of the server configuration.
+-- Keys created before can't sign requests until they are rotated.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS signing_key BYTEA;
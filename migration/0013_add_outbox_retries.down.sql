@@ -0,0 +1,7 @@
+-- Drop the retries of the outbox events, dead events are pending again
+DROP INDEX IF EXISTS outbox_events_wallet_pending_idx;
+DROP INDEX IF EXISTS outbox_events_due_idx;
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events (id) WHERE published_at IS NULL;
+
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS next_attempt_at;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS status;
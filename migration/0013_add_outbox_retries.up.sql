@@ -0,0 +1,9 @@
+-- Outbox events are retried after a backoff and given up as dead after the maximum attempts.
+-- A relay claims the due events by pushing their next attempt back, then publishes them outside of the lock.
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS status VARCHAR(10) NOT NULL DEFAULT 'pending';
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+UPDATE outbox_events SET status = 'published' WHERE published_at IS NOT NULL;
+
+DROP INDEX IF EXISTS outbox_events_pending_idx;
+CREATE INDEX IF NOT EXISTS outbox_events_due_idx ON outbox_events (id, next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS outbox_events_wallet_pending_idx ON outbox_events (wallet_id, id) WHERE status = 'pending';
@@ -0,0 +1,2 @@
+-- Drop the fees of the transactions
+ALTER TABLE transactions DROP COLUMN IF EXISTS fee;
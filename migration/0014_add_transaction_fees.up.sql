@@ -0,0 +1,2 @@
+-- A withdrawal may charge a fee to its wallet on top of the amount, posted to the fees system account.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fee DECIMAL(20,4) NOT NULL DEFAULT 0 CHECK (fee >= 0);
@@ -0,0 +1,3 @@
+-- Let a pair have several rates from the same time again
+CREATE INDEX IF NOT EXISTS fx_rates_pair_idx ON fx_rates (base, quote, valid_from);
+DROP INDEX IF EXISTS fx_rates_pair_key;
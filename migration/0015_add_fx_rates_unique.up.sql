@@ -0,0 +1,7 @@
+-- A pair has one rate from a given time, so loading the rates file again on every start updates them
+-- rather than adding them once more. The duplicates loaded so far are dropped, the latest one was in effect.
+DELETE FROM fx_rates a USING fx_rates b
+WHERE a.base = b.base AND a.quote = b.quote AND a.valid_from = b.valid_from AND a.id < b.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS fx_rates_pair_key ON fx_rates (base, quote, valid_from);
+DROP INDEX IF EXISTS fx_rates_pair_idx;
@@ -0,0 +1,12 @@
+// Package migration holds the versioned schema migrations of the wallet database.
+// Every change comes as a pair of NNNN_name.up.sql and NNNN_name.down.sql files,
+// applied in version order by cmd/migrate. Applied files must never be edited,
+// add a new version instead.
+package migration
+
+import "embed"
+
+// FS holds the migration files built into the binaries.
+//
+//go:embed *.up.sql *.down.sql
+var FS embed.FS